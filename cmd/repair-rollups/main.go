@@ -0,0 +1,18 @@
+// Command repair-rollups recomputes the interaction rollups of every customer and company.
+// Run it from the directory holding the .env file:
+//
+//	go run ./cmd/repair-rollups
+package main
+
+import (
+	"context"
+	"log"
+
+	controller "github.com/SiddharthaKR/golang-jwt-project/controllers"
+)
+
+func main() {
+	if err := controller.RepairRollups(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+}
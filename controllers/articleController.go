@@ -0,0 +1,820 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SiddharthaKR/golang-jwt-project/database"
+	helper "github.com/SiddharthaKR/golang-jwt-project/helpers"
+	"github.com/SiddharthaKR/golang-jwt-project/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var articleCategoryCollection *mongo.Collection = database.OpenCollection(database.Client, "article_category")
+var articleCollection *mongo.Collection = database.OpenCollection(database.Client, "article")
+var ticketArticleCollection *mongo.Collection = database.OpenCollection(database.Client, "ticket_article")
+
+var articleIndexesOnce sync.Once
+
+// maxSuggestionTerms bounds the words of a ticket used to search for similar articles.
+const maxSuggestionTerms = 100
+
+var articleSearchWord = regexp.MustCompile(`[\p{L}\p{N}]+`)
+var articleSlugSeparator = regexp.MustCompile(`[^a-z0-9]+`)
+
+// articleListProjection leaves out article bodies from lists.
+var articleListProjection = bson.M{"body": 0}
+
+// CreateArticleCategory adds a knowledge base category to a company. Staff only.
+func CreateArticleCategory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		companyID, err := primitive.ObjectIDFromHex(c.Param("company_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+			return
+		}
+		if isCustomerToken(c) || !checkUserAccessToCompany(c.GetString("uid"), companyID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var category models.ArticleCategory
+		if err := c.BindJSON(&category); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(category); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		category.ID = primitive.NewObjectID()
+		category.CompanyID = companyID
+		category.CreatedAt = time.Now()
+		category.UpdatedAt = time.Now()
+
+		if _, err := articleCategoryCollection.InsertOne(ctx, category); err != nil {
+			log.Println("Error creating article category:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while creating category"})
+			return
+		}
+
+		c.JSON(http.StatusOK, category)
+	}
+}
+
+// GetArticleCategories lists a company's knowledge base categories. Staff only; the customer
+// portal uses GetPublicArticleCategories.
+func GetArticleCategories() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		companyID, err := primitive.ObjectIDFromHex(c.Param("company_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+			return
+		}
+		if isCustomerToken(c) || !checkUserAccessToCompany(c.GetString("uid"), companyID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+			return
+		}
+		listArticleCategories(c, companyID)
+	}
+}
+
+// UpdateArticleCategory replaces a knowledge base category.
+func UpdateArticleCategory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		existing, ok := loadArticleCategory(ctx, c)
+		if !ok {
+			return
+		}
+
+		var category models.ArticleCategory
+		if err := c.BindJSON(&category); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(category); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		category.ID = existing.ID
+		category.CompanyID = existing.CompanyID
+		category.CreatedAt = existing.CreatedAt
+		category.UpdatedAt = time.Now()
+
+		if _, err := articleCategoryCollection.ReplaceOne(ctx, bson.M{"_id": existing.ID}, category); err != nil {
+			log.Println("Error updating article category:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while updating category"})
+			return
+		}
+
+		c.JSON(http.StatusOK, category)
+	}
+}
+
+// DeleteArticleCategory removes a knowledge base category that no longer has articles.
+func DeleteArticleCategory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		category, ok := loadArticleCategory(ctx, c)
+		if !ok {
+			return
+		}
+
+		count, err := articleCollection.CountDocuments(ctx, bson.M{"categoryID": category.ID})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while deleting category"})
+			return
+		}
+		if count > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Move or delete the articles of this category first"})
+			return
+		}
+
+		if _, err := articleCategoryCollection.DeleteOne(ctx, bson.M{"_id": category.ID}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while deleting category"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Category deleted successfully"})
+	}
+}
+
+// CreateArticle adds a knowledge base article to a company, as a draft unless status is PUBLISHED.
+// The slug is derived from the title unless one is given.
+func CreateArticle() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		companyID, err := primitive.ObjectIDFromHex(c.Param("company_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+			return
+		}
+		userID := c.GetString("uid")
+		if isCustomerToken(c) || !checkUserAccessToCompany(userID, companyID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var article models.Article
+		if err := c.BindJSON(&article); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if article.Status == "" {
+			article.Status = "DRAFT"
+		}
+		article.CompanyID = companyID
+		if msg := validateArticle(ctx, article); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+
+		now := time.Now()
+		article.ID = primitive.NewObjectID()
+		article.AuthorID, _ = primitive.ObjectIDFromHex(userID)
+		if article.Status == "PUBLISHED" {
+			article.PublishedAt = &now
+		}
+		article.CreatedAt = now
+		article.UpdatedAt = now
+
+		if err := saveArticle(ctx, &article, true); err != nil {
+			log.Println("Error creating article:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while creating article"})
+			return
+		}
+
+		article.BodyHTML = helper.RenderMarkdown(article.Body)
+		c.JSON(http.StatusOK, article)
+	}
+}
+
+// GetCompanyArticles lists a company's articles, drafts included, without their bodies.
+// Filters: status, category_id and q (full-text search, best matches first).
+// Paging: page and recordPerPage. Staff only.
+func GetCompanyArticles() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		companyID, err := primitive.ObjectIDFromHex(c.Param("company_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+			return
+		}
+		if isCustomerToken(c) || !checkUserAccessToCompany(c.GetString("uid"), companyID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+			return
+		}
+
+		filter := bson.M{"companyID": companyID}
+		if status := c.Query("status"); status != "" {
+			filter["status"] = status
+		}
+		listArticles(c, filter)
+	}
+}
+
+// GetArticle returns an article with its body rendered to HTML. Staff only.
+func GetArticle() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		article, ok := loadArticle(ctx, c)
+		if !ok {
+			return
+		}
+		article.BodyHTML = helper.RenderMarkdown(article.Body)
+		c.JSON(http.StatusOK, article)
+	}
+}
+
+// UpdateArticle replaces an article. The slug is kept unless a new one is given, so links
+// from the customer portal survive a change of title.
+func UpdateArticle() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		existing, ok := loadArticle(ctx, c)
+		if !ok {
+			return
+		}
+
+		var article models.Article
+		if err := c.BindJSON(&article); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if article.Status == "" {
+			article.Status = existing.Status
+		}
+		article.CompanyID = existing.CompanyID
+		if msg := validateArticle(ctx, article); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+
+		article.ID = existing.ID
+		article.AuthorID = existing.AuthorID
+		article.PublishedAt = existing.PublishedAt
+		if article.Status == "PUBLISHED" && article.PublishedAt == nil {
+			now := time.Now()
+			article.PublishedAt = &now
+		}
+		article.CreatedAt = existing.CreatedAt
+		article.UpdatedAt = time.Now()
+		newSlug := article.Slug != "" && slugify(article.Slug) != existing.Slug
+		if !newSlug {
+			article.Slug = existing.Slug
+		}
+
+		if err := saveArticle(ctx, &article, newSlug); err != nil {
+			log.Println("Error updating article:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while updating article"})
+			return
+		}
+
+		article.BodyHTML = helper.RenderMarkdown(article.Body)
+		c.JSON(http.StatusOK, article)
+	}
+}
+
+// DeleteArticle removes an article and its links to tickets.
+func DeleteArticle() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		article, ok := loadArticle(ctx, c)
+		if !ok {
+			return
+		}
+
+		if _, err := articleCollection.DeleteOne(ctx, bson.M{"_id": article.ID}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while deleting article"})
+			return
+		}
+		if _, err := ticketArticleCollection.DeleteMany(ctx, bson.M{"articleID": article.ID}); err != nil {
+			log.Println("Error removing ticket links of article", article.ID.Hex(), err)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Article deleted successfully"})
+	}
+}
+
+// GetArticleTickets lists the tickets an article resolved, most recent link first.
+func GetArticleTickets() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		article, ok := loadArticle(ctx, c)
+		if !ok {
+			return
+		}
+
+		links, err := findTicketArticles(ctx, bson.M{"articleID": article.ID})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving linked tickets"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"total_count": len(links), "links": links})
+	}
+}
+
+// GetPublicArticleCategories lists a company's knowledge base categories without authentication.
+func GetPublicArticleCategories() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		companyID, err := primitive.ObjectIDFromHex(c.Param("company_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+			return
+		}
+		listArticleCategories(c, companyID)
+	}
+}
+
+// GetPublicArticles lists a company's published articles without authentication.
+// It takes the same filters and paging as GetCompanyArticles, except status.
+func GetPublicArticles() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		companyID, err := primitive.ObjectIDFromHex(c.Param("company_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+			return
+		}
+		listArticles(c, bson.M{"companyID": companyID, "status": "PUBLISHED"})
+	}
+}
+
+// GetPublicArticle returns a published article by its slug or ID without authentication.
+func GetPublicArticle() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		companyID, err := primitive.ObjectIDFromHex(c.Param("company_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+			return
+		}
+		filter := bson.M{"companyID": companyID, "status": "PUBLISHED", "slug": c.Param("article")}
+		if articleID, err := primitive.ObjectIDFromHex(c.Param("article")); err == nil {
+			delete(filter, "slug")
+			filter["_id"] = articleID
+		}
+
+		var article models.Article
+		if err := articleCollection.FindOne(ctx, filter).Decode(&article); err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Article not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving article"})
+			return
+		}
+		article.BodyHTML = helper.RenderMarkdown(article.Body)
+		c.JSON(http.StatusOK, article)
+	}
+}
+
+// GetTicketArticleSuggestions suggests published articles whose text is most similar to the
+// ticket's subject and description, best first. limit defaults to 5, at most 20. Articles
+// already linked to the ticket are flagged.
+func GetTicketArticleSuggestions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		ticket, ok := loadArticleTicket(ctx, c)
+		if !ok {
+			return
+		}
+		limit, err := strconv.Atoi(c.Query("limit"))
+		if err != nil || limit < 1 {
+			limit = 5
+		}
+		if limit > 20 {
+			limit = 20
+		}
+
+		suggestions := []gin.H{}
+		terms := articleSearchWord.FindAllString(ticket.Subject+" "+ticket.Description, maxSuggestionTerms)
+		if len(terms) == 0 {
+			c.JSON(http.StatusOK, suggestions)
+			return
+		}
+
+		ensureArticleIndexes()
+		score := bson.M{"$meta": "textScore"}
+		projection := bson.M{"body": 0, "score": score}
+		cursor, err := articleCollection.Find(ctx, bson.M{
+			"companyID": ticket.CompanyID,
+			"status":    "PUBLISHED",
+			"$text":     bson.M{"$search": strings.Join(terms, " ")},
+		}, options.Find().SetProjection(projection).SetSort(bson.M{"score": score}).SetLimit(int64(limit)))
+		if err != nil {
+			log.Println("Error searching articles:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while searching articles"})
+			return
+		}
+		var results []struct {
+			models.Article `bson:",inline"`
+			Score          float64 `bson:"score"`
+		}
+		if err := cursor.All(ctx, &results); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while decoding articles"})
+			return
+		}
+
+		links, err := findTicketArticles(ctx, bson.M{"ticketID": ticket.ID})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving linked articles"})
+			return
+		}
+		for _, result := range results {
+			linked := false
+			for _, link := range links {
+				linked = linked || link.ArticleID == result.ID
+			}
+			suggestions = append(suggestions, gin.H{"article": result.Article, "score": result.Score, "linked": linked})
+		}
+		c.JSON(http.StatusOK, suggestions)
+	}
+}
+
+// GetTicketArticles lists the articles linked to a ticket as having resolved it.
+// Customers only see published articles.
+func GetTicketArticles() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		ticket, ok := loadArticleTicket(ctx, c)
+		if !ok {
+			return
+		}
+		links, err := findTicketArticles(ctx, bson.M{"ticketID": ticket.ID})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving linked articles"})
+			return
+		}
+		articleIDs := bson.A{}
+		for _, link := range links {
+			articleIDs = append(articleIDs, link.ArticleID)
+		}
+
+		filter := bson.M{"_id": bson.M{"$in": articleIDs}}
+		if isCustomerToken(c) {
+			filter["status"] = "PUBLISHED"
+		}
+		articles := []models.Article{}
+		cursor, err := articleCollection.Find(ctx, filter, options.Find().SetProjection(articleListProjection))
+		if err == nil {
+			err = cursor.All(ctx, &articles)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving linked articles"})
+			return
+		}
+		c.JSON(http.StatusOK, articles)
+	}
+}
+
+// LinkTicketArticle records that an article of the ticket's company resolved the ticket. Staff only.
+func LinkTicketArticle() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var requestBody struct {
+			ArticleID string `json:"article_id" validate:"required"`
+		}
+		if err := c.BindJSON(&requestBody); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if isCustomerToken(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized to access this resource"})
+			return
+		}
+		ticket, ok := loadArticleTicket(ctx, c)
+		if !ok {
+			return
+		}
+		articleID, err := primitive.ObjectIDFromHex(requestBody.ArticleID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid article ID"})
+			return
+		}
+		count, err := articleCollection.CountDocuments(ctx, bson.M{"_id": articleID, "companyID": ticket.CompanyID})
+		if err != nil || count == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Article not found"})
+			return
+		}
+
+		ensureArticleIndexes()
+		link := models.TicketArticle{
+			ID:        primitive.NewObjectID(),
+			CompanyID: ticket.CompanyID,
+			TicketID:  ticket.ID,
+			ArticleID: articleID,
+			CreatedAt: time.Now(),
+		}
+		link.LinkedBy, _ = primitive.ObjectIDFromHex(c.GetString("uid"))
+		if _, err := ticketArticleCollection.InsertOne(ctx, link); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Article is already linked to this ticket"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while linking article"})
+			return
+		}
+
+		c.JSON(http.StatusOK, link)
+	}
+}
+
+// UnlinkTicketArticle removes the link between a ticket and an article. Staff only.
+func UnlinkTicketArticle() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if isCustomerToken(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized to access this resource"})
+			return
+		}
+		ticket, ok := loadArticleTicket(ctx, c)
+		if !ok {
+			return
+		}
+		articleID, err := primitive.ObjectIDFromHex(c.Param("article_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid article ID"})
+			return
+		}
+
+		result, err := ticketArticleCollection.DeleteOne(ctx, bson.M{"ticketID": ticket.ID, "articleID": articleID})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while unlinking article"})
+			return
+		}
+		if result.DeletedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Article is not linked to this ticket"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Article unlinked successfully"})
+	}
+}
+
+func listArticleCategories(c *gin.Context, companyID primitive.ObjectID) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	cursor, err := articleCategoryCollection.Find(ctx, bson.M{"companyID": companyID},
+		options.Find().SetSort(bson.D{{Key: "position", Value: 1}, {Key: "name", Value: 1}}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving categories"})
+		return
+	}
+	categories := []models.ArticleCategory{}
+	if err := cursor.All(ctx, &categories); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while decoding categories"})
+		return
+	}
+	c.JSON(http.StatusOK, categories)
+}
+
+// listArticles writes a page of the articles matching filter, narrowed by the category_id and q parameters.
+func listArticles(c *gin.Context, filter bson.M) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	if categoryParam := c.Query("category_id"); categoryParam != "" {
+		categoryID, err := primitive.ObjectIDFromHex(categoryParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category ID"})
+			return
+		}
+		filter["categoryID"] = categoryID
+	}
+	recordPerPage, err := strconv.Atoi(c.Query("recordPerPage"))
+	if err != nil || recordPerPage < 1 {
+		recordPerPage = 10
+	}
+	page, err := strconv.Atoi(c.Query("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	findOptions := options.Find().SetSkip(int64((page - 1) * recordPerPage)).SetLimit(int64(recordPerPage))
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		ensureArticleIndexes()
+		filter["$text"] = bson.M{"$search": q}
+		score := bson.M{"$meta": "textScore"}
+		findOptions.SetProjection(bson.M{"body": 0, "score": score}).SetSort(bson.M{"score": score})
+	} else {
+		findOptions.SetProjection(articleListProjection).SetSort(bson.D{{Key: "title", Value: 1}, {Key: "_id", Value: 1}})
+	}
+
+	total, err := articleCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving articles"})
+		return
+	}
+	cursor, err := articleCollection.Find(ctx, filter, findOptions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving articles"})
+		return
+	}
+	articles := []models.Article{}
+	if err := cursor.All(ctx, &articles); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while decoding articles"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"total_count": total, "articles": articles})
+}
+
+// validateArticle returns an error message, or an empty string if the article is usable.
+func validateArticle(ctx context.Context, article models.Article) string {
+	if validationErr := validate.Struct(article); validationErr != nil {
+		return validationErr.Error()
+	}
+	if !article.CategoryID.IsZero() {
+		count, err := articleCategoryCollection.CountDocuments(ctx, bson.M{"_id": article.CategoryID, "companyID": article.CompanyID})
+		if err != nil || count == 0 {
+			return "Category not found"
+		}
+	}
+	return ""
+}
+
+// saveArticle inserts or replaces an article. With newSlug, the slug is derived from the given
+// slug or the title, and a number is appended until it is unique within the company.
+func saveArticle(ctx context.Context, article *models.Article, newSlug bool) error {
+	ensureArticleIndexes()
+	if !newSlug {
+		_, err := articleCollection.ReplaceOne(ctx, bson.M{"_id": article.ID}, article, options.Replace().SetUpsert(true))
+		return err
+	}
+
+	base := article.Slug
+	if base == "" {
+		base = article.Title
+	}
+	base = slugify(base)
+	var err error
+	for n := 1; n <= 20; n++ {
+		article.Slug = base
+		if n > 1 {
+			article.Slug = base + "-" + strconv.Itoa(n)
+		}
+		_, err = articleCollection.ReplaceOne(ctx, bson.M{"_id": article.ID}, article, options.Replace().SetUpsert(true))
+		if !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// slugify turns a title into a URL-friendly slug such as "reset-your-password".
+func slugify(title string) string {
+	slug := strings.Trim(articleSlugSeparator.ReplaceAllString(strings.ToLower(title), "-"), "-")
+	if len(slug) > 80 {
+		slug = strings.TrimRight(slug[:80], "-")
+	}
+	if slug == "" {
+		slug = "article"
+	}
+	return slug
+}
+
+// loadArticleCategory finds the category named by the category_id parameter and checks the
+// caller is staff of its company. It writes the error response itself and returns false if
+// the request should stop.
+func loadArticleCategory(ctx context.Context, c *gin.Context) (models.ArticleCategory, bool) {
+	var category models.ArticleCategory
+	categoryID, err := primitive.ObjectIDFromHex(c.Param("category_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category ID"})
+		return category, false
+	}
+	if err := articleCategoryCollection.FindOne(ctx, bson.M{"_id": categoryID}).Decode(&category); err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+			return category, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving category"})
+		return category, false
+	}
+	if isCustomerToken(c) || !checkUserAccessToCompany(c.GetString("uid"), category.CompanyID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+		return category, false
+	}
+	return category, true
+}
+
+// loadArticle finds the article named by the article_id parameter and checks the caller is
+// staff of its company. It writes the error response itself and returns false if the request
+// should stop.
+func loadArticle(ctx context.Context, c *gin.Context) (models.Article, bool) {
+	var article models.Article
+	articleID, err := primitive.ObjectIDFromHex(c.Param("article_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid article ID"})
+		return article, false
+	}
+	if err := articleCollection.FindOne(ctx, bson.M{"_id": articleID}).Decode(&article); err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Article not found"})
+			return article, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving article"})
+		return article, false
+	}
+	if isCustomerToken(c) || !checkUserAccessToCompany(c.GetString("uid"), article.CompanyID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+		return article, false
+	}
+	return article, true
+}
+
+// loadArticleTicket finds the ticket named by the ticket_id parameter and checks the caller may see it.
+func loadArticleTicket(ctx context.Context, c *gin.Context) (models.Interaction, bool) {
+	ticket, err := findTicket(ctx, c.Param("ticket_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ticket not found"})
+		return ticket, false
+	}
+	if !authorizeInteraction(c, ticket) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this ticket"})
+		return ticket, false
+	}
+	return ticket, true
+}
+
+func findTicketArticles(ctx context.Context, filter bson.M) ([]models.TicketArticle, error) {
+	cursor, err := ticketArticleCollection.Find(ctx, filter, options.Find().SetSort(bson.M{"created_at": -1}))
+	if err != nil {
+		return nil, err
+	}
+	links := []models.TicketArticle{}
+	if err := cursor.All(ctx, &links); err != nil {
+		return nil, err
+	}
+	return links, nil
+}
+
+// ensureArticleIndexes creates the full-text index that search and suggestions rely on,
+// and the indexes that keep slugs and ticket links unique.
+func ensureArticleIndexes() {
+	articleIndexesOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		_, err := articleCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+			{
+				Keys: bson.D{{Key: "title", Value: "text"}, {Key: "tags", Value: "text"}, {Key: "body", Value: "text"}},
+				Options: options.Index().SetName("article_text").
+					SetWeights(bson.M{"title": 5, "tags": 3, "body": 1}),
+			},
+			{
+				Keys:    bson.D{{Key: "companyID", Value: 1}, {Key: "slug", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+		})
+		if err != nil {
+			log.Println("Error creating article indexes:", err)
+		}
+		_, err = ticketArticleCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys:    bson.D{{Key: "ticketID", Value: 1}, {Key: "articleID", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		})
+		if err != nil {
+			log.Println("Error creating ticket article index:", err)
+		}
+	})
+}
@@ -0,0 +1,377 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/SiddharthaKR/golang-jwt-project/database"
+	helper "github.com/SiddharthaKR/golang-jwt-project/helpers"
+	"github.com/SiddharthaKR/golang-jwt-project/models"
+	"github.com/SiddharthaKR/golang-jwt-project/storage"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var attachmentCollection *mongo.Collection = database.OpenCollection(database.Client, "attachment")
+
+const defaultAttachmentMaxBytes = 10 << 20
+const attachmentURLTTL = 15 * time.Minute
+
+// maxAttachmentsPerUpload bounds the files of one upload request.
+const maxAttachmentsPerUpload = 10
+
+// attachmentMaxBytes is the per-file upload limit, configurable with ATTACHMENT_MAX_BYTES.
+func attachmentMaxBytes() int64 {
+	if limit, err := strconv.ParseInt(os.Getenv("ATTACHMENT_MAX_BYTES"), 10, 64); err == nil && limit > 0 {
+		return limit
+	}
+	return defaultAttachmentMaxBytes
+}
+
+// attachmentUploadMaxBytes bounds the body of an upload request: the largest files allowed plus
+// 1 MiB for the other form fields and multipart framing.
+func attachmentUploadMaxBytes() int64 {
+	return attachmentMaxBytes()*maxAttachmentsPerUpload + 1<<20
+}
+
+// UploadAttachments stores one or more files from the "file" fields of a multipart form
+// and links them to the target given by the target_type and target_id fields. Staff may send
+// visibility INTERNAL to hide the files from customers.
+func UploadAttachments() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		// Bound the body before it is parsed; the per-file check below runs only afterwards
+		uploadMaxBytes := attachmentUploadMaxBytes()
+		if c.Request.ContentLength > uploadMaxBytes {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Upload exceeds the size limit of " + strconv.FormatInt(uploadMaxBytes, 10) + " bytes"})
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, uploadMaxBytes)
+
+		form, err := c.MultipartForm()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A multipart form of at most " + strconv.FormatInt(uploadMaxBytes, 10) + " bytes is required"})
+			return
+		}
+		files := form.File["file"]
+		if len(files) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "At least one file is required in the 'file' field"})
+			return
+		}
+		if len(files) > maxAttachmentsPerUpload {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "At most " + strconv.Itoa(maxAttachmentsPerUpload) + " files can be uploaded at once"})
+			return
+		}
+
+		visibility := c.PostForm("visibility")
+		if visibility == "" {
+			visibility = "PUBLIC"
+		}
+		if visibility != "PUBLIC" && visibility != "INTERNAL" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "visibility must be PUBLIC or INTERNAL"})
+			return
+		}
+		if visibility == "INTERNAL" && isCustomerToken(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Customers cannot upload internal files"})
+			return
+		}
+
+		targetType := c.PostForm("target_type")
+		targetID, err := primitive.ObjectIDFromHex(c.PostForm("target_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid target ID"})
+			return
+		}
+		companyID, status, msg := resolveAttachmentTarget(ctx, c, targetType, targetID)
+		if msg != "" {
+			c.JSON(status, gin.H{"error": msg})
+			return
+		}
+
+		uploaderID, err := primitive.ObjectIDFromHex(c.GetString("uid"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid User ID"})
+			return
+		}
+
+		maxBytes := attachmentMaxBytes()
+		for _, fileHeader := range files {
+			if fileHeader.Size > maxBytes {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fileHeader.Filename + " exceeds the upload size limit of " + strconv.FormatInt(maxBytes, 10) + " bytes"})
+				return
+			}
+		}
+
+		attachments := []models.Attachment{}
+		for _, fileHeader := range files {
+			attachment := models.Attachment{
+				ID:         primitive.NewObjectID(),
+				CompanyID:  companyID,
+				TargetType: targetType,
+				TargetID:   targetID,
+				FileName:   filepath.Base(fileHeader.Filename),
+				Size:       fileHeader.Size,
+				Internal:   visibility == "INTERNAL",
+				UploadedBy: uploaderID,
+				CreatedAt:  time.Now(),
+			}
+			attachment.StorageKey = companyID.Hex() + "/" + attachment.ID.Hex()
+
+			if err := storeAttachment(ctx, fileHeader, &attachment); err != nil {
+				log.Println("Error storing attachment:", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while storing " + attachment.FileName})
+				return
+			}
+			if _, err := attachmentCollection.InsertOne(ctx, attachment); err != nil {
+				log.Println("Error saving attachment:", err)
+				storage.Default().Delete(ctx, attachment.StorageKey)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while saving attachment"})
+				return
+			}
+			attachments = append(attachments, attachment)
+		}
+
+		c.JSON(http.StatusOK, attachments)
+	}
+}
+
+// storeAttachment streams an uploaded file into the blob store, sniffing its content type
+// from the first bytes and computing its SHA-256 checksum on the way through.
+func storeAttachment(ctx context.Context, fileHeader *multipart.FileHeader, attachment *models.Attachment) error {
+	file, err := fileHeader.Open()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return storeAttachmentContent(ctx, file, attachment)
+}
+
+// storeAttachmentContent streams attachment.Size bytes from file into the blob store.
+func storeAttachmentContent(ctx context.Context, file io.Reader, attachment *models.Attachment) error {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return err
+	}
+	head = head[:n]
+	attachment.ContentType = http.DetectContentType(head)
+
+	hash := sha256.New()
+	body := io.TeeReader(io.MultiReader(bytes.NewReader(head), file), hash)
+	if err := storage.Default().Put(ctx, attachment.StorageKey, body, attachment.Size, attachment.ContentType); err != nil {
+		return err
+	}
+	attachment.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return nil
+}
+
+// GetAttachments lists the attachments linked to a target. Customers do not see internal files.
+func GetAttachments() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		targetType := c.Query("target_type")
+		targetID, err := primitive.ObjectIDFromHex(c.Query("target_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid target ID"})
+			return
+		}
+		if _, status, msg := resolveAttachmentTarget(ctx, c, targetType, targetID); msg != "" {
+			c.JSON(status, gin.H{"error": msg})
+			return
+		}
+
+		filter := bson.M{"target_type": targetType, "targetID": targetID}
+		if isCustomerToken(c) {
+			filter["internal"] = bson.M{"$ne": true}
+		}
+		cursor, err := attachmentCollection.Find(ctx, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving attachments"})
+			return
+		}
+		defer cursor.Close(ctx)
+
+		attachments := []models.Attachment{}
+		if err = cursor.All(ctx, &attachments); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while decoding attachments"})
+			return
+		}
+
+		c.JSON(http.StatusOK, attachments)
+	}
+}
+
+// GetAttachmentURL returns a time-limited signed download URL for an attachment the caller can access.
+func GetAttachmentURL() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		attachment, status, msg := findAccessibleAttachment(ctx, c, c.Param("attachment_id"))
+		if msg != "" {
+			c.JSON(status, gin.H{"error": msg})
+			return
+		}
+
+		expires, signature := helper.SignExpiring("attachment:"+attachment.ID.Hex(), attachmentURLTTL)
+		url := helper.PublicURL("/files/" + attachment.ID.Hex() + "?expires=" + expires + "&signature=" + signature)
+
+		c.JSON(http.StatusOK, gin.H{"url": url, "expires": expires})
+	}
+}
+
+// DownloadAttachment serves an attachment to anyone holding a valid signed URL.
+func DownloadAttachment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		attachmentID := c.Param("attachment_id")
+		if !helper.VerifyExpiring("attachment:"+attachmentID, c.Query("expires"), c.Query("signature")) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Download link is invalid or has expired"})
+			return
+		}
+
+		objectID, err := primitive.ObjectIDFromHex(attachmentID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attachment ID"})
+			return
+		}
+		var attachment models.Attachment
+		if err := attachmentCollection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&attachment); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+			return
+		}
+
+		reader, err := storage.Default().Get(ctx, attachment.StorageKey)
+		if err != nil {
+			if err == storage.ErrNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+				return
+			}
+			log.Println("Error reading attachment:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while reading attachment"})
+			return
+		}
+		defer reader.Close()
+
+		c.DataFromReader(http.StatusOK, attachment.Size, attachment.ContentType, reader, map[string]string{
+			"Content-Disposition":    mime.FormatMediaType("attachment", map[string]string{"filename": attachment.FileName}),
+			"X-Content-Type-Options": "nosniff",
+			"X-Checksum-Sha256":      attachment.SHA256,
+		})
+	}
+}
+
+// DeleteAttachment removes an attachment and its stored file.
+func DeleteAttachment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		attachment, status, msg := findAccessibleAttachment(ctx, c, c.Param("attachment_id"))
+		if msg != "" {
+			c.JSON(status, gin.H{"error": msg})
+			return
+		}
+		if isCustomerToken(c) && attachment.UploadedBy.Hex() != c.GetString("uid") {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Customers can only delete their own uploads"})
+			return
+		}
+
+		if err := storage.Default().Delete(ctx, attachment.StorageKey); err != nil {
+			log.Println("Error deleting stored attachment:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while deleting attachment"})
+			return
+		}
+		if _, err := attachmentCollection.DeleteOne(ctx, bson.M{"_id": attachment.ID}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while deleting attachment"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Attachment deleted successfully"})
+	}
+}
+
+// findAccessibleAttachment loads an attachment and checks the caller can access its target.
+// Internal files are reported as not found to customers.
+func findAccessibleAttachment(ctx context.Context, c *gin.Context, attachmentIDParam string) (models.Attachment, int, string) {
+	var attachment models.Attachment
+	attachmentID, err := primitive.ObjectIDFromHex(attachmentIDParam)
+	if err != nil {
+		return attachment, http.StatusBadRequest, "Invalid attachment ID"
+	}
+	filter := bson.M{"_id": attachmentID}
+	if isCustomerToken(c) {
+		filter["internal"] = bson.M{"$ne": true}
+	}
+	if err := attachmentCollection.FindOne(ctx, filter).Decode(&attachment); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return attachment, http.StatusNotFound, "Attachment not found"
+		}
+		return attachment, http.StatusInternalServerError, "Error occurred while retrieving attachment"
+	}
+	if _, status, msg := resolveAttachmentTarget(ctx, c, attachment.TargetType, attachment.TargetID); msg != "" {
+		return attachment, status, msg
+	}
+	return attachment, http.StatusOK, ""
+}
+
+// resolveAttachmentTarget finds the company that owns an attachment target and checks the caller may access it.
+// Customers may only reach their own record and their own tickets. It returns an HTTP status
+// and error message when access is refused.
+func resolveAttachmentTarget(ctx context.Context, c *gin.Context, targetType string, targetID primitive.ObjectID) (primitive.ObjectID, int, string) {
+	uid := c.GetString("uid")
+
+	switch targetType {
+	case "INTERACTION":
+		var interaction models.Interaction
+		if err := interactionCollection.FindOne(ctx, bson.M{"_id": targetID}).Decode(&interaction); err != nil {
+			return primitive.NilObjectID, http.StatusNotFound, "Interaction not found"
+		}
+		if !authorizeInteraction(c, interaction) || (isCustomerToken(c) && !customerVisible(interaction)) {
+			return primitive.NilObjectID, http.StatusForbidden, "You do not have access to this interaction"
+		}
+		return interaction.CompanyID, http.StatusOK, ""
+	case "CUSTOMER":
+		var customer models.Customer
+		if err := customerCollection.FindOne(ctx, bson.M{"_id": targetID}).Decode(&customer); err != nil {
+			return primitive.NilObjectID, http.StatusNotFound, "Customer not found"
+		}
+		if isCustomerToken(c) {
+			if customer.ID.Hex() != uid {
+				return primitive.NilObjectID, http.StatusForbidden, "You do not have access to this customer"
+			}
+		} else if !checkUserAccessToCompany(uid, customer.CompanyID) {
+			return primitive.NilObjectID, http.StatusForbidden, "You do not have access to this company"
+		}
+		return customer.CompanyID, http.StatusOK, ""
+	case "LEAD":
+		var lead models.Lead
+		if err := leadCollection.FindOne(ctx, bson.M{"_id": targetID}).Decode(&lead); err != nil {
+			return primitive.NilObjectID, http.StatusNotFound, "Lead not found"
+		}
+		if isCustomerToken(c) || !checkUserAccessToCompany(uid, lead.CompanyID) {
+			return primitive.NilObjectID, http.StatusForbidden, "You do not have access to this company"
+		}
+		return lead.CompanyID, http.StatusOK, ""
+	}
+	return primitive.NilObjectID, http.StatusBadRequest, "target_type must be INTERACTION, CUSTOMER or LEAD"
+}
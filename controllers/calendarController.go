@@ -0,0 +1,546 @@
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SiddharthaKR/golang-jwt-project/events"
+	helper "github.com/SiddharthaKR/golang-jwt-project/helpers"
+	"github.com/SiddharthaKR/golang-jwt-project/models"
+	"github.com/SiddharthaKR/golang-jwt-project/outbox"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// calendarUIDDomain makes meeting UIDs globally unique, as RFC 5545 asks.
+const calendarUIDDomain = "crm.golang-jwt-project"
+
+// calendarFeedHistory and calendarFeedFuture are how far back and ahead the calendar feed reaches.
+const calendarFeedHistory = 90 * 24 * time.Hour
+const calendarFeedFuture = 365 * 24 * time.Hour
+
+// canManageCalendarToken reports whether the caller may see or rotate a user's calendar token.
+// The token grants unauthenticated access to the user's meetings, so only the user and ADMIN
+// users may.
+func canManageCalendarToken(c *gin.Context, userID string) bool {
+	if isCustomerToken(c) {
+		return false
+	}
+	return c.GetString("uid") == userID || helper.CheckUserType(c, "ADMIN") == nil
+}
+
+// GetCalendarFeedURL returns the user's secret calendar feed URL, creating its token on first use.
+// Only the user and ADMIN users can get it.
+func GetCalendarFeedURL() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.Param("user_id")
+		if !canManageCalendarToken(c, userID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized to access this resource"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var user models.User
+		if err := userCollection.FindOne(ctx, bson.M{"user_id": userID}).Decode(&user); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
+		token := user.CalendarToken
+		if token == "" {
+			var err error
+			if token, err = setCalendarToken(ctx, userID, ""); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while creating calendar token"})
+				return
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{"url": calendarFeedURL(token)})
+	}
+}
+
+// RotateCalendarToken replaces the user's calendar token, invalidating the old feed URL.
+// Only the user and ADMIN users can rotate it.
+func RotateCalendarToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.Param("user_id")
+		if !canManageCalendarToken(c, userID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized to access this resource"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var user models.User
+		if err := userCollection.FindOne(ctx, bson.M{"user_id": userID}).Decode(&user); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		token, err := setCalendarToken(ctx, userID, user.CalendarToken)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while rotating calendar token"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"url": calendarFeedURL(token)})
+	}
+}
+
+// GetCalendarFeed serves a user's meetings as an iCalendar feed. It is public:
+// the token in the URL is the credential, so calendar apps can subscribe to it.
+func GetCalendarFeed() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		token := strings.TrimSuffix(c.Param("token"), ".ics")
+		if token == "" {
+			c.String(http.StatusNotFound, "Calendar not found")
+			return
+		}
+
+		var user models.User
+		if err := userCollection.FindOne(ctx, bson.M{"calendar_token": token}).Decode(&user); err != nil {
+			c.String(http.StatusNotFound, "Calendar not found")
+			return
+		}
+
+		// Cancelled meetings stay in the feed so subscribed calendars remove them
+		now := time.Now()
+		filter := bson.M{"type": "MEETING", "attendees.id": user.ID}
+		meetings, err := loadMeetingOccurrences(ctx, filter, now.Add(-calendarFeedHistory), now.Add(calendarFeedFuture))
+		if err != nil {
+			c.String(http.StatusInternalServerError, "Error occurred while retrieving meetings")
+			return
+		}
+
+		// Recurring meetings are expanded, so every occurrence is a standalone event with its own UID
+		events := make([]helper.ICSEvent, 0, len(meetings))
+		for _, meeting := range meetings {
+			event := meetingICSEvent(meeting)
+			if !event.RecurrenceID.IsZero() {
+				event.UID = event.RecurrenceID.UTC().Format("20060102T150405Z") + "-" + event.UID
+				event.RecurrenceID = time.Time{}
+			}
+			events = append(events, event)
+		}
+		name := strings.TrimSpace(stringValue(user.FirstName) + " " + stringValue(user.LastName))
+
+		c.Header("Cache-Control", "private, max-age=300")
+		c.Data(http.StatusOK, "text/calendar; charset=utf-8", []byte(helper.BuildICS("", "CRM meetings - "+name, events)))
+	}
+}
+
+// ImportMeetings creates or updates meetings from an uploaded .ics file (multipart field "file").
+// Events are matched to earlier imports by their UID. Attendees are matched to the company's
+// customers and users by email; customer_id sets the customer for events with no known customer.
+func ImportMeetings() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		companyID, err := primitive.ObjectIDFromHex(c.Param("company_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Company ID"})
+			return
+		}
+		userID := c.GetString("uid")
+		userObjID, err := primitive.ObjectIDFromHex(userID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid User ID"})
+			return
+		}
+		if isCustomerToken(c) || !checkUserAccessToCompany(userID, companyID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+			return
+		}
+
+		var defaultCustomerID primitive.ObjectID
+		if value := c.PostForm("customer_id"); value != "" {
+			if defaultCustomerID, err = primitive.ObjectIDFromHex(value); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Customer ID"})
+				return
+			}
+			count, err := customerCollection.CountDocuments(ctx, bson.M{"_id": defaultCustomerID, "companyID": companyID})
+			if err != nil || count == 0 {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+				return
+			}
+		}
+
+		fileHeader, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "An .ics file is required in the 'file' field"})
+			return
+		}
+		file, err := fileHeader.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unable to read uploaded file"})
+			return
+		}
+		defer file.Close()
+
+		events, err := helper.ParseICS(file)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid iCalendar file: " + err.Error()})
+			return
+		}
+
+		// Import recurring events before the edited occurrences that refer to them
+		sort.SliceStable(events, func(i, j int) bool {
+			return events[i].RecurrenceID.IsZero() && !events[j].RecurrenceID.IsZero()
+		})
+
+		created, updated := 0, 0
+		skipped := []gin.H{}
+		for _, event := range events {
+			if event.UID == "" {
+				skipped = append(skipped, gin.H{"summary": event.Summary, "reason": "Event has no UID"})
+				continue
+			}
+
+			attendees := []models.MeetingAttendee{{Type: "USER", ID: userObjID}}
+			customerID := defaultCustomerID
+			people := append([]helper.ICSPerson{event.Organizer}, event.Attendees...)
+			for _, person := range people {
+				attendee, ok := matchCalendarAttendee(ctx, companyID, person.Email)
+				if !ok {
+					continue
+				}
+				if attendee.Type == "CUSTOMER" && customerID.IsZero() {
+					customerID = attendee.ID
+				}
+				attendees = append(attendees, attendee)
+			}
+			if customerID.IsZero() {
+				skipped = append(skipped, gin.H{"uid": event.UID, "reason": "No attendee is a customer of this company"})
+				continue
+			}
+			attendees = append(attendees, models.MeetingAttendee{Type: "CUSTOMER", ID: customerID})
+			attendees, msg := resolveMeetingAttendees(ctx, companyID, attendees)
+			if msg != "" {
+				skipped = append(skipped, gin.H{"uid": event.UID, "reason": msg})
+				continue
+			}
+
+			meeting, msg := importedMeeting(event, attendees)
+			if msg != "" {
+				skipped = append(skipped, gin.H{"uid": event.UID, "reason": msg})
+				continue
+			}
+			meeting.CustomerID = customerID
+			if !event.RecurrenceID.IsZero() {
+				var series models.Interaction
+				filter := bson.M{"companyID": companyID, "type": "MEETING", "external_uid": event.UID, "rrule": bson.M{"$exists": true}}
+				if err := interactionCollection.FindOne(ctx, filter).Decode(&series); err != nil {
+					skipped = append(skipped, gin.H{"uid": event.UID, "reason": "Occurrence of a recurring event that is not in this company"})
+					continue
+				}
+				meeting.SeriesID = series.ID
+				meeting.RecurrenceID = event.RecurrenceID
+			}
+			isNew, err := upsertImportedMeeting(ctx, companyID, userObjID, meeting)
+			if err != nil {
+				log.Println("Error importing meeting", event.UID, err)
+				skipped = append(skipped, gin.H{"uid": event.UID, "reason": "Error occurred while saving meeting"})
+				continue
+			}
+			if isNew {
+				created++
+			} else {
+				updated++
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{"created": created, "updated": updated, "skipped": skipped})
+	}
+}
+
+// sendMeetingInvites emails an iCalendar REQUEST or CANCEL to every attendee except the organizer.
+func sendMeetingInvites(meeting models.Interaction, method string) {
+	var to []string
+	for _, attendee := range meeting.Attendees {
+		if attendee.Email != "" && attendee.ID != meeting.UserID {
+			to = append(to, attendee.Email)
+		}
+	}
+	if len(to) == 0 {
+		return
+	}
+
+	event := meetingICSEvent(meeting)
+	location, err := time.LoadLocation(meeting.TimeZone)
+	if err != nil {
+		location = time.UTC
+	}
+
+	subject := "Invitation: " + event.Summary
+	if method == "CANCEL" {
+		subject = "Cancelled: " + event.Summary
+	} else if meeting.Sequence > 0 {
+		subject = "Updated invitation: " + event.Summary
+	}
+	body := fmt.Sprintf("%s\n\nWhen: %s - %s (%s)\n",
+		event.Summary,
+		meeting.ScheduledAt.In(location).Format("Mon Jan 2, 2006 15:04"),
+		meeting.EndAt.In(location).Format("15:04"),
+		location.String())
+	if meeting.Location != "" {
+		body += "Where: " + meeting.Location + "\n"
+	}
+	if meeting.VideoLink != "" {
+		body += "Join: " + meeting.VideoLink + "\n"
+	}
+	if meeting.Description != "" {
+		body += "\n" + meeting.Description + "\n"
+	}
+
+	ics := helper.BuildICS(method, "", []helper.ICSEvent{event})
+	msg := models.OutboxMessage{
+		CompanyID: meeting.CompanyID,
+		Source:    "meeting_invite",
+		To:        to,
+		Subject:   subject,
+		Text:      body,
+		Attachments: []models.OutboxAttachment{{
+			FileName:    "invite.ics",
+			ContentType: "text/calendar; charset=utf-8; method=" + method,
+			Data:        []byte(ics),
+		}},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := outbox.Enqueue(ctx, &msg); err != nil {
+		log.Println("Error queueing meeting invitation:", err)
+	}
+}
+
+// meetingICSEvent converts a meeting to an iCalendar event. Imported meetings keep their original UID.
+// Occurrences of a series share the series' UID and are told apart by their RECURRENCE-ID.
+func meetingICSEvent(meeting models.Interaction) helper.ICSEvent {
+	uidID := meeting.ID
+	if !meeting.SeriesID.IsZero() {
+		uidID = meeting.SeriesID
+	}
+	event := helper.ICSEvent{
+		UID:          uidID.Hex() + "@" + calendarUIDDomain,
+		Sequence:     meeting.Sequence,
+		Start:        meeting.ScheduledAt,
+		End:          meeting.EndAt,
+		Summary:      meeting.Subject,
+		Description:  meeting.Description,
+		Location:     meeting.Location,
+		URL:          meeting.VideoLink,
+		Status:       "CONFIRMED",
+		Created:      meeting.CreatedAt,
+		LastModified: meeting.UpdatedAt,
+		TimeZone:     meeting.TimeZone,
+		RRule:        meeting.RRule,
+		ExDates:      meeting.ExDates,
+		RecurrenceID: meeting.RecurrenceID,
+	}
+	if meeting.ExternalUID != "" {
+		event.UID = meeting.ExternalUID
+	}
+	if event.End.IsZero() {
+		event.End = event.Start.Add(defaultMeetingDuration)
+	}
+	if event.Location == "" {
+		event.Location = meeting.VideoLink
+	}
+	if meeting.Status == "CANCELLED" {
+		event.Status = "CANCELLED"
+	}
+
+	var customerNames []string
+	for _, attendee := range meeting.Attendees {
+		person := helper.ICSPerson{Name: attendee.Name, Email: attendee.Email}
+		if attendee.ID == meeting.UserID {
+			event.Organizer = person
+		}
+		if attendee.Type == "CUSTOMER" && attendee.Name != "" {
+			customerNames = append(customerNames, attendee.Name)
+		}
+		event.Attendees = append(event.Attendees, person)
+	}
+	if event.Summary == "" {
+		event.Summary = "Meeting"
+		if len(customerNames) > 0 {
+			event.Summary = "Meeting with " + strings.Join(customerNames, ", ")
+		}
+	}
+	return event
+}
+
+// importedMeeting builds a meeting from an imported event. It returns an error message
+// if the event cannot be imported.
+func importedMeeting(event helper.ICSEvent, attendees []models.MeetingAttendee) (models.Interaction, string) {
+	meeting := models.Interaction{
+		Type:        "MEETING",
+		Status:      "SCHEDULED",
+		Subject:     event.Summary,
+		Description: event.Description,
+		Location:    event.Location,
+		ScheduledAt: event.Start,
+		EndAt:       event.End,
+		TimeZone:    "UTC",
+		Attendees:   attendees,
+		Sequence:    event.Sequence,
+		ExternalUID: event.UID,
+	}
+	if name := event.Start.Location().String(); name != "UTC" && name != "Local" {
+		meeting.TimeZone = name
+	}
+	if event.RRule != "" {
+		rule, err := helper.ParseRRule(event.RRule)
+		if err != nil {
+			return meeting, "Unsupported recurrence rule: " + err.Error()
+		}
+		meeting.RRule = rule.String()
+		meeting.ExDates = event.ExDates
+		meeting.RecurrenceEnd = meetingRecurrenceEnd(meeting)
+	}
+	if strings.HasPrefix(event.URL, "https://") || strings.HasPrefix(event.URL, "http://") {
+		meeting.VideoLink = event.URL
+	}
+	lastEnd := &meeting.EndAt
+	if meeting.RRule != "" {
+		lastEnd = meeting.RecurrenceEnd
+	}
+	if event.Status == "CANCELLED" {
+		meeting.Status = "CANCELLED"
+	} else if lastEnd != nil && lastEnd.Before(time.Now()) {
+		meeting.Status = "COMPLETED"
+	}
+	return meeting, ""
+}
+
+// upsertImportedMeeting stores an imported meeting, updating an earlier import of the same event.
+// It reports whether a new meeting was created.
+func upsertImportedMeeting(ctx context.Context, companyID primitive.ObjectID, importedBy primitive.ObjectID, meeting models.Interaction) (bool, error) {
+	now := time.Now()
+	filter := bson.M{"companyID": companyID, "type": "MEETING", "external_uid": meeting.ExternalUID}
+	set := bson.M{
+		"customerID":   meeting.CustomerID,
+		"status":       meeting.Status,
+		"subject":      meeting.Subject,
+		"description":  meeting.Description,
+		"location":     meeting.Location,
+		"video_link":   meeting.VideoLink,
+		"scheduled_at": meeting.ScheduledAt,
+		"end_at":       meeting.EndAt,
+		"time_zone":    meeting.TimeZone,
+		"attendees":    meeting.Attendees,
+		"sequence":     meeting.Sequence,
+		"updated_at":   now,
+	}
+	unset := bson.M{}
+	if meeting.SeriesID.IsZero() {
+		filter["recurrence_id"] = bson.M{"$exists": false}
+	} else {
+		filter["recurrence_id"] = meeting.RecurrenceID
+		set["seriesID"] = meeting.SeriesID
+	}
+	if meeting.RRule != "" {
+		set["rrule"] = meeting.RRule
+		set["exdates"] = meeting.ExDates
+		set["recurrence_end"] = meeting.RecurrenceEnd
+	} else {
+		unset["rrule"] = ""
+		unset["exdates"] = ""
+		unset["recurrence_end"] = ""
+	}
+
+	update := bson.M{
+		"$set": set,
+		"$setOnInsert": bson.M{
+			"_id":        primitive.NewObjectID(),
+			"userID":     importedBy,
+			"created_at": now,
+		},
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	result, err := interactionCollection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return false, err
+	}
+
+	var stored models.Interaction
+	if err := interactionCollection.FindOne(ctx, filter).Decode(&stored); err == nil {
+		scheduleInteractionReminder(ctx, stored, now)
+		publishInteractionEvent(ctx, events.InteractionUpdated, stored)
+	}
+	return result.UpsertedCount > 0, nil
+}
+
+// matchCalendarAttendee finds the company customer, or else the user, with the given email.
+func matchCalendarAttendee(ctx context.Context, companyID primitive.ObjectID, email string) (models.MeetingAttendee, bool) {
+	if email == "" {
+		return models.MeetingAttendee{}, false
+	}
+
+	var customer models.Customer
+	err := customerCollection.FindOne(ctx, bson.M{"email": email, "companyID": companyID}).Decode(&customer)
+	if err == nil {
+		return models.MeetingAttendee{Type: "CUSTOMER", ID: customer.ID}, true
+	}
+
+	var user models.User
+	err = userCollection.FindOne(ctx, bson.M{"email": email}).Decode(&user)
+	if err == nil && checkUserAccessToCompany(user.UserID, companyID) {
+		return models.MeetingAttendee{Type: "USER", ID: user.ID}, true
+	}
+	return models.MeetingAttendee{}, false
+}
+
+// setCalendarToken stores a new random calendar token for the user. If previous is not empty
+// the update only succeeds while it is still the current token.
+func setCalendarToken(ctx context.Context, userID string, previous string) (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+
+	filter := bson.M{"user_id": userID}
+	if previous != "" {
+		filter["calendar_token"] = previous
+	} else {
+		filter["calendar_token"] = bson.M{"$exists": false}
+	}
+	result, err := userCollection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"calendar_token": token}})
+	if err != nil {
+		return "", err
+	}
+	if result.MatchedCount == 0 {
+		// Someone else set the token first; use theirs
+		var user models.User
+		if err := userCollection.FindOne(ctx, bson.M{"user_id": userID}).Decode(&user); err != nil {
+			return "", err
+		}
+		if user.CalendarToken == "" {
+			return "", mongo.ErrNoDocuments
+		}
+		return user.CalendarToken, nil
+	}
+	return token, nil
+}
+
+func calendarFeedURL(token string) string {
+	return helper.PublicURL("/calendar/" + token + ".ics")
+}
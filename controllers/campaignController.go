@@ -0,0 +1,846 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SiddharthaKR/golang-jwt-project/database"
+	helper "github.com/SiddharthaKR/golang-jwt-project/helpers"
+	"github.com/SiddharthaKR/golang-jwt-project/mailer"
+	"github.com/SiddharthaKR/golang-jwt-project/models"
+	"github.com/SiddharthaKR/golang-jwt-project/outbox"
+	"github.com/SiddharthaKR/golang-jwt-project/scheduler"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var campaignCollection *mongo.Collection = database.OpenCollection(database.Client, "campaign")
+var campaignRecipientCollection *mongo.Collection = database.OpenCollection(database.Client, "campaign_recipient")
+
+var campaignIndexesOnce sync.Once
+
+const (
+	campaignJobType = "campaign_batch"
+
+	// defaultCampaignRate is how many emails of a campaign are queued per minute unless it says otherwise.
+	defaultCampaignRate = 60
+
+	// maxCampaignCustomers bounds the customer_ids list of a campaign.
+	maxCampaignCustomers = 10000
+)
+
+// CreateCampaign adds a DRAFT campaign to a company.
+func CreateCampaign() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		companyID, err := primitive.ObjectIDFromHex(c.Param("company_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+			return
+		}
+		userID := c.GetString("uid")
+		if isCustomerToken(c) || !checkUserAccessToCompany(userID, companyID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var campaign models.Campaign
+		if err := c.BindJSON(&campaign); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		campaign.CompanyID = companyID
+		if msg, err := validateCampaign(ctx, &campaign); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while validating campaign"})
+			return
+		} else if msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+
+		campaign.ID = primitive.NewObjectID()
+		campaign.Status = "DRAFT"
+		campaign.ScheduledAt = nil
+		campaign.StartedAt = nil
+		campaign.CompletedAt = nil
+		campaign.CreatedBy = userID
+		campaign.CreatedAt = time.Now()
+		campaign.UpdatedAt = time.Now()
+
+		if _, err := campaignCollection.InsertOne(ctx, campaign); err != nil {
+			log.Println("Error creating campaign:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while creating campaign"})
+			return
+		}
+
+		c.JSON(http.StatusOK, campaign)
+	}
+}
+
+// GetCampaigns lists a company's campaigns, newest first, optionally filtered by status.
+// Paging: page and recordPerPage.
+func GetCampaigns() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		companyID, err := primitive.ObjectIDFromHex(c.Param("company_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+			return
+		}
+		if isCustomerToken(c) || !checkUserAccessToCompany(c.GetString("uid"), companyID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		filter := bson.M{"companyID": companyID}
+		if status := c.Query("status"); status != "" {
+			filter["status"] = status
+		}
+		recordPerPage, err := strconv.Atoi(c.Query("recordPerPage"))
+		if err != nil || recordPerPage < 1 {
+			recordPerPage = 10
+		}
+		page, err := strconv.Atoi(c.Query("page"))
+		if err != nil || page < 1 {
+			page = 1
+		}
+
+		total, err := campaignCollection.CountDocuments(ctx, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while counting campaigns"})
+			return
+		}
+		cursor, err := campaignCollection.Find(ctx, filter, options.Find().
+			SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+			SetSkip(int64((page-1)*recordPerPage)).
+			SetLimit(int64(recordPerPage)))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving campaigns"})
+			return
+		}
+		campaigns := []models.Campaign{}
+		if err := cursor.All(ctx, &campaigns); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while decoding campaigns"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"total_count": total, "campaigns": campaigns})
+	}
+}
+
+// GetCampaign returns a campaign.
+func GetCampaign() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		campaign, ok := loadCampaign(ctx, c)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, campaign)
+	}
+}
+
+// UpdateCampaign replaces the name, template, audience and rate of a campaign that has not
+// started yet. A SCHEDULED campaign keeps its time.
+func UpdateCampaign() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		existing, ok := loadCampaign(ctx, c)
+		if !ok {
+			return
+		}
+
+		var campaign models.Campaign
+		if err := c.BindJSON(&campaign); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		campaign.CompanyID = existing.CompanyID
+		if msg, err := validateCampaign(ctx, &campaign); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while validating campaign"})
+			return
+		} else if msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+
+		campaign.ID = existing.ID
+		campaign.Status = existing.Status
+		campaign.ScheduledAt = existing.ScheduledAt
+		campaign.StartedAt = nil
+		campaign.CompletedAt = nil
+		campaign.CreatedBy = existing.CreatedBy
+		campaign.CreatedAt = existing.CreatedAt
+		campaign.UpdatedAt = time.Now()
+
+		// The job may have started the campaign since it was loaded
+		result, err := campaignCollection.ReplaceOne(ctx, bson.M{"_id": existing.ID, "status": bson.M{"$in": bson.A{"DRAFT", "SCHEDULED"}}}, campaign)
+		if err != nil {
+			log.Println("Error updating campaign:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while updating campaign"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Only draft or scheduled campaigns can be changed"})
+			return
+		}
+
+		c.JSON(http.StatusOK, campaign)
+	}
+}
+
+// DeleteCampaign removes a campaign with its recipients. A campaign that is sending has to be
+// cancelled first.
+func DeleteCampaign() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		campaign, ok := loadCampaign(ctx, c)
+		if !ok {
+			return
+		}
+
+		result, err := campaignCollection.DeleteOne(ctx, bson.M{"_id": campaign.ID, "status": bson.M{"$ne": "SENDING"}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while deleting campaign"})
+			return
+		}
+		if result.DeletedCount == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Cancel the campaign before deleting it"})
+			return
+		}
+		if err := scheduler.Cancel(ctx, campaignJobName(campaign.ID, 0)); err != nil {
+			log.Println("Error cancelling campaign job", campaign.ID.Hex(), err)
+		}
+		if _, err := campaignRecipientCollection.DeleteMany(ctx, bson.M{"campaignID": campaign.ID}); err != nil {
+			log.Println("Error deleting recipients of campaign", campaign.ID.Hex(), err)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Campaign deleted successfully"})
+	}
+}
+
+// ScheduleCampaign schedules a DRAFT campaign to start at scheduled_at, or straight away
+// without it. A SCHEDULED campaign is moved to the new time. Recipients are resolved when the
+// campaign starts, so customers added in the meantime are included.
+func ScheduleCampaign() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var requestBody struct {
+			ScheduledAt *time.Time `json:"scheduled_at"`
+		}
+		if err := c.ShouldBindJSON(&requestBody); err != nil && c.Request.ContentLength > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		campaign, ok := loadCampaign(ctx, c)
+		if !ok {
+			return
+		}
+		if campaign.Status != "DRAFT" && campaign.Status != "SCHEDULED" {
+			c.JSON(http.StatusConflict, gin.H{"error": "Only draft or scheduled campaigns can be scheduled"})
+			return
+		}
+		audience, err := customerCollection.CountDocuments(ctx, campaignAudienceFilter(campaign, true))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while counting campaign audience"})
+			return
+		}
+		if audience == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "The campaign has no customers with an email address"})
+			return
+		}
+
+		now := time.Now()
+		runAt := now
+		if requestBody.ScheduledAt != nil && requestBody.ScheduledAt.After(now) {
+			runAt = *requestBody.ScheduledAt
+		}
+		result, err := campaignCollection.UpdateOne(ctx, bson.M{"_id": campaign.ID, "status": campaign.Status}, bson.M{"$set": bson.M{
+			"status":       "SCHEDULED",
+			"scheduled_at": runAt,
+			"updated_at":   now,
+		}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while scheduling campaign"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Campaign was changed by someone else, please retry"})
+			return
+		}
+		if err := scheduleCampaignBatch(ctx, campaign.ID, 0, runAt); err != nil {
+			log.Println("Error scheduling campaign", campaign.ID.Hex(), err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while scheduling campaign"})
+			return
+		}
+
+		campaign.Status = "SCHEDULED"
+		campaign.ScheduledAt = &runAt
+		campaign.UpdatedAt = now
+		c.JSON(http.StatusOK, campaign)
+	}
+}
+
+// CancelCampaign stops a SCHEDULED or SENDING campaign. Emails already queued are still sent;
+// recipients not reached yet are skipped.
+func CancelCampaign() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		campaign, ok := loadCampaign(ctx, c)
+		if !ok {
+			return
+		}
+
+		now := time.Now()
+		result, err := campaignCollection.UpdateOne(ctx, bson.M{"_id": campaign.ID, "status": bson.M{"$in": bson.A{"SCHEDULED", "SENDING"}}}, bson.M{"$set": bson.M{
+			"status":       "CANCELLED",
+			"completed_at": now,
+			"updated_at":   now,
+		}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while cancelling campaign"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Only scheduled or sending campaigns can be cancelled"})
+			return
+		}
+		if err := scheduler.Cancel(ctx, campaignJobName(campaign.ID, 0)); err != nil {
+			log.Println("Error cancelling campaign job", campaign.ID.Hex(), err)
+		}
+		if _, err := campaignRecipientCollection.UpdateMany(ctx, bson.M{"campaignID": campaign.ID, "status": "PENDING"}, bson.M{"$set": bson.M{
+			"status": "SKIPPED",
+			"detail": "Campaign was cancelled",
+		}}); err != nil {
+			log.Println("Error skipping recipients of campaign", campaign.ID.Hex(), err)
+		}
+
+		campaign.Status = "CANCELLED"
+		campaign.CompletedAt = &now
+		campaign.UpdatedAt = now
+		c.JSON(http.StatusOK, campaign)
+	}
+}
+
+// GetCampaignRecipients lists the customers a campaign was resolved to, optionally filtered
+// by status. Paging: page and recordPerPage.
+func GetCampaignRecipients() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		campaign, ok := loadCampaign(ctx, c)
+		if !ok {
+			return
+		}
+
+		filter := bson.M{"campaignID": campaign.ID}
+		if status := c.Query("status"); status != "" {
+			filter["status"] = status
+		}
+		recordPerPage, err := strconv.Atoi(c.Query("recordPerPage"))
+		if err != nil || recordPerPage < 1 {
+			recordPerPage = 20
+		}
+		page, err := strconv.Atoi(c.Query("page"))
+		if err != nil || page < 1 {
+			page = 1
+		}
+
+		total, err := campaignRecipientCollection.CountDocuments(ctx, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while counting campaign recipients"})
+			return
+		}
+		cursor, err := campaignRecipientCollection.Find(ctx, filter, options.Find().
+			SetSort(bson.M{"_id": 1}).
+			SetSkip(int64((page-1)*recordPerPage)).
+			SetLimit(int64(recordPerPage)))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving campaign recipients"})
+			return
+		}
+		recipients := []models.CampaignRecipient{}
+		if err := cursor.All(ctx, &recipients); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while decoding campaign recipients"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"total_count": total, "recipients": recipients})
+	}
+}
+
+// GetCampaignStats reports how a campaign went: its recipients by status and how many of its
+// emails were sent, failed, opened and clicked. Before it starts, the audience it would reach.
+func GetCampaignStats() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		campaign, ok := loadCampaign(ctx, c)
+		if !ok {
+			return
+		}
+		stats, err := campaignStats(ctx, campaign)
+		if err != nil {
+			log.Println("Error computing campaign stats:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while computing campaign stats"})
+			return
+		}
+		c.JSON(http.StatusOK, stats)
+	}
+}
+
+func campaignStats(ctx context.Context, campaign models.Campaign) (models.CampaignStats, error) {
+	var stats models.CampaignStats
+	var err error
+	if campaign.Status == "DRAFT" || campaign.Status == "SCHEDULED" {
+		stats.Audience, err = customerCollection.CountDocuments(ctx, campaignAudienceFilter(campaign, true))
+		return stats, err
+	}
+
+	cursor, err := campaignRecipientCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"campaignID": campaign.ID}}},
+		{{Key: "$group", Value: bson.M{"_id": "$status", "count": bson.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		return stats, err
+	}
+	var groups []struct {
+		Status string `bson:"_id"`
+		Count  int64  `bson:"count"`
+	}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return stats, err
+	}
+	for _, group := range groups {
+		stats.Recipients += group.Count
+		switch group.Status {
+		case "PENDING":
+			stats.Pending = group.Count
+		case "SKIPPED":
+			stats.Skipped = group.Count
+		}
+	}
+
+	counts := []struct {
+		value  *int64
+		filter bson.M
+	}{
+		{&stats.Queued, bson.M{"status": bson.M{"$nin": bson.A{outbox.StatusSent, outbox.StatusDead, outbox.StatusSuppressed}}}},
+		{&stats.Sent, bson.M{"status": outbox.StatusSent}},
+		{&stats.Failed, bson.M{"status": outbox.StatusDead}},
+		{&stats.Suppressed, bson.M{"status": outbox.StatusSuppressed}},
+		{&stats.Opened, bson.M{"opened_at": bson.M{"$ne": nil}}},
+		{&stats.Clicked, bson.M{"clicked_at": bson.M{"$ne": nil}}},
+		{&stats.Bounced, bson.M{"bounced_at": bson.M{"$ne": nil}}},
+		{&stats.Complained, bson.M{"complained_at": bson.M{"$ne": nil}}},
+	}
+	for _, count := range counts {
+		count.filter["campaignID"] = campaign.ID
+		if *count.value, err = outbox.Count(ctx, count.filter); err != nil {
+			return stats, err
+		}
+	}
+	stats.Unsubscribed, err = campaignRecipientCollection.CountDocuments(ctx, bson.M{"campaignID": campaign.ID, "unsubscribed_at": bson.M{"$ne": nil}})
+	return stats, err
+}
+
+// sendCampaignBatch is the handler of campaign jobs. The first batch resolves the campaign's
+// recipients and marks it SENDING. Every batch queues up to the campaign's rate of pending
+// recipients, spread over the minute, and schedules the next batch a minute later until none
+// are left. A recipient's outbox message has the recipient's ID, so a retried batch does not
+// queue anyone twice.
+func sendCampaignBatch(ctx context.Context, job models.Job) error {
+	campaignID, err := primitive.ObjectIDFromHex(job.Payload["campaign_id"])
+	if err != nil {
+		return fmt.Errorf("invalid campaign job payload %v", job.Payload)
+	}
+	batch, _ := strconv.Atoi(job.Payload["batch"])
+
+	var campaign models.Campaign
+	if err := campaignCollection.FindOne(ctx, bson.M{"_id": campaignID}).Decode(&campaign); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		return err
+	}
+	switch campaign.Status {
+	case "SCHEDULED":
+		if err := resolveCampaignRecipients(ctx, campaign); err != nil {
+			return err
+		}
+		now := time.Now()
+		result, err := campaignCollection.UpdateOne(ctx, bson.M{"_id": campaign.ID, "status": "SCHEDULED"}, bson.M{"$set": bson.M{
+			"status":     "SENDING",
+			"started_at": now,
+			"updated_at": now,
+		}})
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			// Cancelled while the recipients were resolved
+			return nil
+		}
+	case "SENDING":
+	default:
+		return nil
+	}
+
+	var tmpl models.EmailTemplate
+	templateMissing := false
+	if err := emailTemplateCollection.FindOne(ctx, bson.M{"_id": campaign.TemplateID, "type": "TEMPLATE"}).Decode(&tmpl); err == mongo.ErrNoDocuments {
+		templateMissing = true
+	} else if err != nil {
+		return err
+	}
+
+	rate := campaign.RatePerMinute
+	if rate <= 0 {
+		rate = defaultCampaignRate
+	}
+	cursor, err := campaignRecipientCollection.Find(ctx, bson.M{"campaignID": campaign.ID, "status": "PENDING"}, options.Find().
+		SetSort(bson.M{"_id": 1}).
+		SetLimit(int64(rate)))
+	if err != nil {
+		return err
+	}
+	var recipients []models.CampaignRecipient
+	if err := cursor.All(ctx, &recipients); err != nil {
+		return err
+	}
+	addresses := make([]string, 0, len(recipients))
+	for _, recipient := range recipients {
+		addresses = append(addresses, recipient.Email)
+	}
+	suppressed, err := helper.SuppressedAddresses(ctx, helper.SuppressionScope{CompanyID: campaign.CompanyID, Marketing: true}, addresses)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now().UTC()
+	spacing := time.Minute / time.Duration(rate)
+	for i, recipient := range recipients {
+		detail := "Email template was deleted"
+		var msg models.OutboxMessage
+		if suppression, ok := suppressed[strings.ToLower(recipient.Email)]; ok {
+			detail = "Address is suppressed (" + suppression.Reason + ")"
+		} else if !templateMissing {
+			if msg, detail, err = campaignMessage(ctx, campaign, tmpl, recipient); err != nil {
+				return err
+			}
+		}
+		set := bson.M{"status": "QUEUED", "queued_at": time.Now()}
+		if detail != "" {
+			set = bson.M{"status": "SKIPPED", "detail": detail}
+		} else {
+			msg.NextAttemptAt = start.Add(time.Duration(i) * spacing)
+			if err := outbox.Enqueue(ctx, &msg); err != nil && !mongo.IsDuplicateKeyError(err) {
+				return err
+			}
+		}
+		if _, err := campaignRecipientCollection.UpdateOne(ctx, bson.M{"_id": recipient.ID, "status": "PENDING"}, bson.M{"$set": set}); err != nil {
+			return err
+		}
+	}
+
+	pending, err := campaignRecipientCollection.CountDocuments(ctx, bson.M{"campaignID": campaign.ID, "status": "PENDING"})
+	if err != nil {
+		return err
+	}
+	if pending > 0 {
+		return scheduleCampaignBatch(ctx, campaign.ID, batch+1, start.Add(time.Minute))
+	}
+	now := time.Now()
+	_, err = campaignCollection.UpdateOne(ctx, bson.M{"_id": campaign.ID, "status": "SENDING"}, bson.M{"$set": bson.M{
+		"status":       "SENT",
+		"completed_at": now,
+		"updated_at":   now,
+	}})
+	return err
+}
+
+// campaignMessage renders a campaign's template for one recipient. It returns why the
+// recipient has to be skipped instead when the customer is gone or the email cannot be built.
+// Every message carries an unsubscribe link: {{.UnsubscribeURL}} in the template, or else a
+// footer, and the List-Unsubscribe headers for one-click unsubscribe (RFC 8058).
+func campaignMessage(ctx context.Context, campaign models.Campaign, tmpl models.EmailTemplate, recipient models.CampaignRecipient) (models.OutboxMessage, string, error) {
+	var msg models.OutboxMessage
+	data, detail, err := buildEmailTemplateData(ctx, campaign.CompanyID, recipient.CustomerID.Hex(), "", campaign.CreatedBy, false)
+	if err != nil || detail != "" {
+		return msg, detail, err
+	}
+	data.UnsubscribeURL = unsubscribeURL(recipient.ID)
+	content, err := renderEmailTemplate(ctx, tmpl, data)
+	if err != nil {
+		return msg, err.Error(), nil
+	}
+	addUnsubscribeFooter(&content, data.UnsubscribeURL)
+
+	msg = models.OutboxMessage{
+		ID:         recipient.ID,
+		CompanyID:  campaign.CompanyID,
+		CustomerID: recipient.CustomerID,
+		CampaignID: campaign.ID,
+		CreatedBy:  campaign.CreatedBy,
+		Source:     "campaign",
+		Marketing:  true,
+		To:         []string{recipient.Email},
+		Subject:    content.Subject,
+		Text:       content.Text,
+		HTML:       content.HTML,
+		Headers: map[string]string{
+			"List-Unsubscribe":      "<" + data.UnsubscribeURL + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+	}
+	check := mailer.Message{To: msg.To, Subject: msg.Subject, Headers: msg.Headers}
+	if err := check.Check(); err != nil {
+		return msg, strings.TrimPrefix(err.Error(), mailer.ErrInvalidMessage.Error()+": "), nil
+	}
+	addEmailTracking(&msg)
+	return msg, "", nil
+}
+
+// addUnsubscribeFooter appends the unsubscribe link to the bodies of a rendered email that do
+// not contain it already.
+func addUnsubscribeFooter(content *helper.EmailContent, url string) {
+	if content.Text != "" && !strings.Contains(content.Text, url) {
+		content.Text += "\n\n--\nUnsubscribe: " + url + "\n"
+	}
+	if content.HTML != "" && !strings.Contains(content.HTML, html.EscapeString(url)) && !strings.Contains(content.HTML, url) {
+		footer := `<p style="font-size:12px;color:#888888"><a href="` + html.EscapeString(url) + `">Unsubscribe</a></p>`
+		if loc := closeBodyPattern.FindStringIndex(content.HTML); loc != nil {
+			content.HTML = content.HTML[:loc[0]] + footer + content.HTML[loc[0]:]
+		} else {
+			content.HTML += footer
+		}
+	}
+}
+
+// resolveCampaignRecipients records a PENDING recipient for every customer in the campaign's
+// audience. Customers without a valid address, or with the address of a customer before them,
+// are recorded as SKIPPED. Customers recorded already are left alone, so it can be retried.
+func resolveCampaignRecipients(ctx context.Context, campaign models.Campaign) error {
+	ensureCampaignIndexes()
+	cursor, err := customerCollection.Find(ctx, campaignAudienceFilter(campaign, false), options.Find().
+		SetSort(bson.M{"_id": 1}).
+		SetProjection(bson.M{"email": 1}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	var writes []mongo.WriteModel
+	flush := func() error {
+		if len(writes) == 0 {
+			return nil
+		}
+		_, err := campaignRecipientCollection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+		writes = writes[:0]
+		return err
+	}
+	seen := map[string]bool{}
+	for cursor.Next(ctx) {
+		var customer models.Customer
+		if err := cursor.Decode(&customer); err != nil {
+			return err
+		}
+		recipient := models.CampaignRecipient{
+			ID:         primitive.NewObjectID(),
+			CampaignID: campaign.ID,
+			CompanyID:  campaign.CompanyID,
+			CustomerID: customer.ID,
+			Email:      strings.TrimSpace(stringValue(customer.Email)),
+			Status:     "PENDING",
+		}
+		address, err := mail.ParseAddress(recipient.Email)
+		switch {
+		case recipient.Email == "":
+			recipient.Status, recipient.Detail = "SKIPPED", "Customer has no email address"
+		case err != nil:
+			recipient.Status, recipient.Detail = "SKIPPED", "Invalid email address"
+		case seen[strings.ToLower(address.Address)]:
+			recipient.Status, recipient.Detail = "SKIPPED", "Another customer has the same email address"
+		default:
+			recipient.Email = address.Address
+			seen[strings.ToLower(address.Address)] = true
+		}
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"campaignID": campaign.ID, "customerID": customer.ID}).
+			SetUpdate(bson.M{"$setOnInsert": recipient}).
+			SetUpsert(true))
+		if len(writes) == 500 {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	return flush()
+}
+
+// campaignAudienceFilter selects the customers a campaign is for: those of its company in its
+// segment or list. withEmail leaves out customers without an email address.
+func campaignAudienceFilter(campaign models.Campaign, withEmail bool) bson.M {
+	filter := bson.M{"companyID": campaign.CompanyID}
+	if len(campaign.CustomerIDs) > 0 {
+		filter["_id"] = bson.M{"$in": campaign.CustomerIDs}
+	} else if segment := campaign.Segment; segment != nil {
+		if len(segment.Statuses) > 0 {
+			filter["status"] = bson.M{"$in": segment.Statuses}
+		}
+		created := bson.M{}
+		if segment.CreatedAfter != nil {
+			created["$gte"] = *segment.CreatedAfter
+		}
+		if segment.CreatedBefore != nil {
+			created["$lt"] = *segment.CreatedBefore
+		}
+		if len(created) > 0 {
+			filter["created_at"] = created
+		}
+	}
+	if withEmail {
+		filter["email"] = bson.M{"$nin": bson.A{nil, ""}}
+	}
+	return filter
+}
+
+func campaignJobName(campaignID primitive.ObjectID, batch int) string {
+	return fmt.Sprintf("campaign:%s:%d", campaignID.Hex(), batch)
+}
+
+// scheduleCampaignBatch schedules a batch of a campaign. Each batch is a job of its own, so
+// that scheduling the next batch from a running one does not collide with it.
+func scheduleCampaignBatch(ctx context.Context, campaignID primitive.ObjectID, batch int, runAt time.Time) error {
+	payload := map[string]string{
+		"campaign_id": campaignID.Hex(),
+		"batch":       strconv.Itoa(batch),
+	}
+	return scheduler.ScheduleOnce(ctx, campaignJobName(campaignID, batch), campaignJobType, runAt, payload)
+}
+
+// validateCampaign checks a campaign's fields, its template and its audience, and defaults its
+// rate. It returns a message for the caller when something is wrong.
+func validateCampaign(ctx context.Context, campaign *models.Campaign) (string, error) {
+	if validationErr := validate.Struct(campaign); validationErr != nil {
+		return validationErr.Error(), nil
+	}
+	if campaign.RatePerMinute == 0 {
+		campaign.RatePerMinute = defaultCampaignRate
+	}
+
+	if campaign.TemplateID.IsZero() {
+		return "template_id is required", nil
+	}
+	count, err := emailTemplateCollection.CountDocuments(ctx, bson.M{"_id": campaign.TemplateID, "companyID": campaign.CompanyID, "type": "TEMPLATE"})
+	if err != nil {
+		return "", err
+	}
+	if count == 0 {
+		return "Email template not found", nil
+	}
+
+	if (campaign.Segment == nil) == (len(campaign.CustomerIDs) == 0) {
+		return "A campaign needs either a segment or customer_ids", nil
+	}
+	if segment := campaign.Segment; segment != nil && segment.CreatedAfter != nil && segment.CreatedBefore != nil && !segment.CreatedBefore.After(*segment.CreatedAfter) {
+		return "created_before must be after created_after", nil
+	}
+	if len(campaign.CustomerIDs) > 0 {
+		seen := map[primitive.ObjectID]bool{}
+		customerIDs := []primitive.ObjectID{}
+		for _, id := range campaign.CustomerIDs {
+			if !seen[id] {
+				seen[id] = true
+				customerIDs = append(customerIDs, id)
+			}
+		}
+		if len(customerIDs) > maxCampaignCustomers {
+			return fmt.Sprintf("A campaign may have at most %d customer_ids", maxCampaignCustomers), nil
+		}
+		count, err := customerCollection.CountDocuments(ctx, bson.M{"_id": bson.M{"$in": customerIDs}, "companyID": campaign.CompanyID})
+		if err != nil {
+			return "", err
+		}
+		if count != int64(len(customerIDs)) {
+			return "Some customers were not found in this company", nil
+		}
+		campaign.CustomerIDs = customerIDs
+	}
+	return "", nil
+}
+
+// loadCampaign reads the campaign named by the campaign_id parameter, checking that the caller
+// works for its company. On failure the response has been written.
+func loadCampaign(ctx context.Context, c *gin.Context) (models.Campaign, bool) {
+	var campaign models.Campaign
+	campaignID, err := primitive.ObjectIDFromHex(c.Param("campaign_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid campaign ID"})
+		return campaign, false
+	}
+	if err := campaignCollection.FindOne(ctx, bson.M{"_id": campaignID}).Decode(&campaign); err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Campaign not found"})
+			return campaign, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving campaign"})
+		return campaign, false
+	}
+	if isCustomerToken(c) || !checkUserAccessToCompany(c.GetString("uid"), campaign.CompanyID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+		return campaign, false
+	}
+	return campaign, true
+}
+
+// ensureCampaignIndexes creates the index that keeps a customer from being a campaign's
+// recipient twice, and the one batches find pending recipients with.
+func ensureCampaignIndexes() {
+	campaignIndexesOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		_, err := campaignRecipientCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+			{
+				Keys:    bson.D{{Key: "campaignID", Value: 1}, {Key: "customerID", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+			{Keys: bson.D{{Key: "campaignID", Value: 1}, {Key: "status", Value: 1}, {Key: "_id", Value: 1}}},
+		})
+		if err != nil {
+			log.Println("Error creating campaign recipient indexes:", err)
+		}
+	})
+}
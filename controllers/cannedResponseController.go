@@ -0,0 +1,305 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/SiddharthaKR/golang-jwt-project/database"
+	"github.com/SiddharthaKR/golang-jwt-project/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var cannedResponseCollection *mongo.Collection = database.OpenCollection(database.Client, "canned_response")
+
+// templateVariablePattern matches the {{customer.name}} style variables of canned responses.
+var templateVariablePattern = regexp.MustCompile(`\{\{\s*([a-z_]+\.[a-z_]+)\s*\}\}`)
+
+// ticketAgent is the staff member a canned response or macro is used by.
+type ticketAgent struct {
+	ID        string
+	FirstName string
+	LastName  string
+	Email     string
+}
+
+func agentFromContext(c *gin.Context) ticketAgent {
+	return ticketAgent{
+		ID:        c.GetString("uid"),
+		FirstName: c.GetString("first_name"),
+		LastName:  c.GetString("last_name"),
+		Email:     c.GetString("email"),
+	}
+}
+
+// CreateCannedResponse adds a canned response to a company.
+func CreateCannedResponse() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		companyID, err := primitive.ObjectIDFromHex(c.Param("company_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+			return
+		}
+		userID := c.GetString("uid")
+		if isCustomerToken(c) || !checkUserAccessToCompany(userID, companyID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var response models.CannedResponse
+		if err := c.BindJSON(&response); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(response); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+		if msg := validateTemplateVariables(response.Body); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+
+		response.ID = primitive.NewObjectID()
+		response.CompanyID = companyID
+		response.CreatedBy, _ = primitive.ObjectIDFromHex(userID)
+		response.CreatedAt = time.Now()
+		response.UpdatedAt = time.Now()
+
+		if _, err := cannedResponseCollection.InsertOne(ctx, response); err != nil {
+			log.Println("Error creating canned response:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while creating canned response"})
+			return
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// GetCannedResponses lists a company's canned responses by name. q searches the name, shortcut and body.
+func GetCannedResponses() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		companyID, err := primitive.ObjectIDFromHex(c.Param("company_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+			return
+		}
+		if isCustomerToken(c) || !checkUserAccessToCompany(c.GetString("uid"), companyID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		filter := bson.M{"companyID": companyID}
+		if q := strings.TrimSpace(c.Query("q")); q != "" {
+			pattern := primitive.Regex{Pattern: regexp.QuoteMeta(q), Options: "i"}
+			filter["$or"] = bson.A{
+				bson.M{"name": pattern},
+				bson.M{"shortcut": pattern},
+				bson.M{"body": pattern},
+			}
+		}
+
+		cursor, err := cannedResponseCollection.Find(ctx, filter, options.Find().SetSort(bson.M{"name": 1}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving canned responses"})
+			return
+		}
+		responses := []models.CannedResponse{}
+		if err := cursor.All(ctx, &responses); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while decoding canned responses"})
+			return
+		}
+
+		c.JSON(http.StatusOK, responses)
+	}
+}
+
+// UpdateCannedResponse replaces a canned response.
+func UpdateCannedResponse() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		existing, ok := loadCannedResponse(ctx, c)
+		if !ok {
+			return
+		}
+
+		var response models.CannedResponse
+		if err := c.BindJSON(&response); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(response); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+		if msg := validateTemplateVariables(response.Body); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+
+		response.ID = existing.ID
+		response.CompanyID = existing.CompanyID
+		response.CreatedBy = existing.CreatedBy
+		response.CreatedAt = existing.CreatedAt
+		response.UpdatedAt = time.Now()
+
+		if _, err := cannedResponseCollection.ReplaceOne(ctx, bson.M{"_id": existing.ID}, response); err != nil {
+			log.Println("Error updating canned response:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while updating canned response"})
+			return
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// DeleteCannedResponse removes a canned response that no macro uses.
+func DeleteCannedResponse() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		response, ok := loadCannedResponse(ctx, c)
+		if !ok {
+			return
+		}
+
+		count, err := macroCollection.CountDocuments(ctx, bson.M{"actions.cannedResponseID": response.ID})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while deleting canned response"})
+			return
+		}
+		if count > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Canned response is used by a macro"})
+			return
+		}
+
+		if _, err := cannedResponseCollection.DeleteOne(ctx, bson.M{"_id": response.ID}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while deleting canned response"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Canned response deleted successfully"})
+	}
+}
+
+// RenderCannedResponse fills in a canned response for a ticket, so the agent can review it
+// before posting it as a message.
+func RenderCannedResponse() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		response, ok := loadCannedResponse(ctx, c)
+		if !ok {
+			return
+		}
+		ticket, err := findTicket(ctx, c.Param("ticket_id"))
+		if err != nil || ticket.CompanyID != response.CompanyID {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Ticket not found"})
+			return
+		}
+
+		body, err := renderTicketTemplate(ctx, response.Body, ticket, agentFromContext(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while rendering canned response"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"canned_response_id": response.ID, "ticket_id": ticket.ID, "body": body})
+	}
+}
+
+// loadCannedResponse finds the canned response named by the response_id parameter and checks
+// the caller is staff of its company. It writes the error response itself and returns false if
+// the request should stop.
+func loadCannedResponse(ctx context.Context, c *gin.Context) (models.CannedResponse, bool) {
+	var response models.CannedResponse
+	responseID, err := primitive.ObjectIDFromHex(c.Param("response_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid canned response ID"})
+		return response, false
+	}
+	if err := cannedResponseCollection.FindOne(ctx, bson.M{"_id": responseID}).Decode(&response); err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Canned response not found"})
+			return response, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving canned response"})
+		return response, false
+	}
+	if isCustomerToken(c) || !checkUserAccessToCompany(c.GetString("uid"), response.CompanyID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+		return response, false
+	}
+	return response, true
+}
+
+// validateTemplateVariables returns an error message if body uses a variable that
+// renderTicketTemplate does not know.
+func validateTemplateVariables(body string) string {
+	for _, match := range templateVariablePattern.FindAllStringSubmatch(body, -1) {
+		if !containsString(models.CannedResponseVariables, match[1]) {
+			return "Unknown variable " + match[0]
+		}
+	}
+	return ""
+}
+
+// renderTicketTemplate replaces the variables in body with the details of the ticket, its
+// customer and company, and the agent. The customer and company are only loaded when used.
+func renderTicketTemplate(ctx context.Context, body string, ticket models.Interaction, agent ticketAgent) (string, error) {
+	values := map[string]string{
+		"ticket.id":        ticket.ID.Hex(),
+		"ticket.subject":   ticket.Subject,
+		"ticket.status":    ticket.Status,
+		"ticket.priority":  ticket.Priority,
+		"agent.name":       strings.TrimSpace(agent.FirstName + " " + agent.LastName),
+		"agent.first_name": agent.FirstName,
+		"agent.last_name":  agent.LastName,
+		"agent.email":      agent.Email,
+	}
+
+	if strings.Contains(body, "customer.") {
+		var customer models.Customer
+		err := customerCollection.FindOne(ctx, bson.M{"_id": ticket.CustomerID}).Decode(&customer)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return "", err
+		}
+		values["customer.first_name"] = stringValue(customer.FirstName)
+		values["customer.last_name"] = stringValue(customer.LastName)
+		values["customer.name"] = strings.TrimSpace(stringValue(customer.FirstName) + " " + stringValue(customer.LastName))
+		values["customer.email"] = stringValue(customer.Email)
+	}
+	if strings.Contains(body, "company.") {
+		var company models.Company
+		err := companyCollection.FindOne(ctx, bson.M{"_id": ticket.CompanyID}).Decode(&company)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return "", err
+		}
+		values["company.name"] = stringValue(company.Name)
+	}
+
+	return templateVariablePattern.ReplaceAllStringFunc(body, func(match string) string {
+		name := templateVariablePattern.FindStringSubmatch(match)[1]
+		if value, ok := values[name]; ok {
+			return value
+		}
+		return match
+	}), nil
+}
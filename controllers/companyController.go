@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/SiddharthaKR/golang-jwt-project/database"
+	helper "github.com/SiddharthaKR/golang-jwt-project/helpers"
 	"github.com/SiddharthaKR/golang-jwt-project/models"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
@@ -37,9 +38,23 @@ func CreateCompany() gin.HandlerFunc {
 			return
 		}
 
+		if company.ReportingCurrency != "" && !helper.IsValidCurrency(company.ReportingCurrency) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported reporting currency"})
+			return
+		}
+
+		company.ID = primitive.NewObjectID()
+		inboundEmails, msg := normalizeInboundEmails(ctx, company.ID, company.InboundEmails)
+		if msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+		company.InboundEmails = inboundEmails
+
 		company.CreatedAt = time.Now()
 		company.UpdatedAt = time.Now()
-		company.ID = primitive.NewObjectID()
+		company.CustomerCount = 0
+		company.OpenTickets = 0
 
 		// Insert the company
 		resultInsertionNumber, insertErr := companyCollection.InsertOne(ctx, company)
@@ -164,6 +179,23 @@ func UpdateCompany() gin.HandlerFunc {
 			return
 		}
 
+		if company.ReportingCurrency != "" && !helper.IsValidCurrency(company.ReportingCurrency) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported reporting currency"})
+			return
+		}
+
+		objectID, _ := primitive.ObjectIDFromHex(companyID)
+		inboundEmails, msg := normalizeInboundEmails(ctx, objectID, company.InboundEmails)
+		if msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+		company.InboundEmails = inboundEmails
+
+		// Rollups are maintained by the server
+		company.CustomerCount = 0
+		company.OpenTickets = 0
+
 		update := bson.M{
 			"$set": company,
 		}
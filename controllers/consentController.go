@@ -0,0 +1,350 @@
+package controllers
+
+import (
+	"context"
+	"html/template"
+	"log"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/SiddharthaKR/golang-jwt-project/database"
+	helper "github.com/SiddharthaKR/golang-jwt-project/helpers"
+	"github.com/SiddharthaKR/golang-jwt-project/models"
+	"github.com/SiddharthaKR/golang-jwt-project/outbox"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var consentCollection *mongo.Collection = database.OpenCollection(database.Client, "consent")
+
+// unsubscribePage asks to confirm an unsubscribe, or confirms it was done. Clicking the link
+// only shows the form, so that link scanners do not unsubscribe anyone; mail clients use the
+// one-click POST of RFC 8058.
+var unsubscribePage = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>Unsubscribe</title></head>
+<body style="font-family: sans-serif; max-width: 32em; margin: 3em auto; padding: 0 1em">
+{{if .Done}}<p>{{.Email}} has been unsubscribed and will no longer receive these emails.</p>
+{{else}}<p>Unsubscribe {{.Email}} from these emails?</p>
+<form method="post"><input type="hidden" name="List-Unsubscribe" value="One-Click"><button type="submit">Unsubscribe</button></form>
+{{end}}</body></html>
+`))
+
+// CreateConsent records that a customer granted or withdrew consent. Staff of the customer's
+// company may record it, and so may the customer. Withdrawing EMAIL MARKETING consent puts the
+// customer's address on the company's suppression list; granting it takes it off again.
+func CreateConsent() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		customer, ok := loadConsentCustomer(ctx, c)
+		if !ok {
+			return
+		}
+
+		var consent models.Consent
+		if err := c.BindJSON(&consent); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		consent.Channel = strings.ToUpper(strings.TrimSpace(consent.Channel))
+		consent.Purpose = strings.ToUpper(strings.TrimSpace(consent.Purpose))
+		consent.Status = strings.ToUpper(strings.TrimSpace(consent.Status))
+		if validationErr := validate.Struct(consent); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+		now := time.Now()
+		if consent.RecordedAt.IsZero() {
+			consent.RecordedAt = now
+		} else if consent.RecordedAt.After(now.Add(time.Minute)) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "recorded_at cannot be in the future"})
+			return
+		}
+		consent.ID = primitive.NewObjectID()
+		consent.CustomerID = customer.ID
+		consent.CompanyID = customer.CompanyID
+		consent.RecordedBy = c.GetString("uid")
+		consent.CreatedAt = now
+		if isCustomerToken(c) {
+			consent.IP = c.ClientIP()
+		}
+
+		if err := recordConsent(ctx, customer, consent, primitive.NilObjectID); err != nil {
+			log.Println("Error recording consent:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while recording consent"})
+			return
+		}
+		c.JSON(http.StatusOK, consent)
+	}
+}
+
+// GetConsents returns a customer's current consent for each channel and purpose, and the full
+// history of consent records, newest first.
+func GetConsents() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		customer, ok := loadConsentCustomer(ctx, c)
+		if !ok {
+			return
+		}
+
+		cursor, err := consentCollection.Find(ctx, bson.M{"customerID": customer.ID}, options.Find().
+			SetSort(bson.D{{Key: "recorded_at", Value: -1}, {Key: "_id", Value: -1}}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving consents"})
+			return
+		}
+		history := []models.Consent{}
+		if err := cursor.All(ctx, &history); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while decoding consents"})
+			return
+		}
+
+		current := []models.Consent{}
+		seen := map[string]bool{}
+		for _, consent := range history {
+			if key := consent.Channel + "/" + consent.Purpose; !seen[key] {
+				seen[key] = true
+				current = append(current, consent)
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"consents": current, "history": history})
+	}
+}
+
+// ShowUnsubscribe shows the page an unsubscribe link in an email leads to.
+func ShowUnsubscribe() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		msg, ok := loadUnsubscribeMessage(ctx, c)
+		if !ok {
+			return
+		}
+		renderUnsubscribePage(c, msg, false)
+	}
+}
+
+// Unsubscribe unsubscribes the recipient of a marketing email from the marketing email of the
+// company that sent it. It serves both the page's form and the one-click POST that mail
+// clients send to the List-Unsubscribe URL (RFC 8058). Unsubscribing twice is harmless.
+func Unsubscribe() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		msg, ok := loadUnsubscribeMessage(ctx, c)
+		if !ok {
+			return
+		}
+		if err := unsubscribeRecipient(ctx, msg, c.ClientIP()); err != nil {
+			log.Println("Error unsubscribing from outbox message", msg.ID.Hex(), err)
+			c.String(http.StatusInternalServerError, "Something went wrong, please try again later.")
+			return
+		}
+		renderUnsubscribePage(c, msg, true)
+	}
+}
+
+// unsubscribeRecipient suppresses the recipients of a marketing email for its company and
+// records the withdrawn consent and, for campaign email, the unsubscribe on the recipient.
+func unsubscribeRecipient(ctx context.Context, msg models.OutboxMessage, ip string) error {
+	now := time.Now()
+	for _, address := range bareAddresses(msg.To) {
+		_, err := helper.AddSuppression(ctx, models.Suppression{
+			Email:      address,
+			CompanyID:  msg.CompanyID,
+			Reason:     "UNSUBSCRIBE",
+			Source:     "unsubscribe_link",
+			OutboxID:   msg.ID,
+			CampaignID: msg.CampaignID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if !msg.CustomerID.IsZero() {
+		var customer models.Customer
+		err := customerCollection.FindOne(ctx, bson.M{"_id": msg.CustomerID}).Decode(&customer)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return err
+		}
+		if err == nil {
+			withdrawn, err := hasWithdrawnEmailMarketing(ctx, customer.ID)
+			if err != nil {
+				return err
+			}
+			if !withdrawn {
+				consent := models.Consent{
+					ID:         primitive.NewObjectID(),
+					CustomerID: customer.ID,
+					CompanyID:  customer.CompanyID,
+					Channel:    "EMAIL",
+					Purpose:    "MARKETING",
+					Status:     "WITHDRAWN",
+					Source:     "unsubscribe_link",
+					IP:         ip,
+					RecordedAt: now,
+					CreatedAt:  now,
+				}
+				if _, err := consentCollection.InsertOne(ctx, consent); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if !msg.CampaignID.IsZero() {
+		// A campaign recipient has the ID of its outbox message
+		_, err := campaignRecipientCollection.UpdateOne(ctx,
+			bson.M{"_id": msg.ID, "unsubscribed_at": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"unsubscribed_at": now}})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordConsent stores a consent record and brings the company's suppression list in line with
+// the customer's latest EMAIL MARKETING consent record, which a backdated record may not be.
+// outboxID is the email that led to the record, if any.
+func recordConsent(ctx context.Context, customer models.Customer, consent models.Consent, outboxID primitive.ObjectID) error {
+	if _, err := consentCollection.InsertOne(ctx, consent); err != nil {
+		return err
+	}
+	email := strings.TrimSpace(stringValue(customer.Email))
+	if consent.Channel != "EMAIL" || consent.Purpose != "MARKETING" || email == "" {
+		return nil
+	}
+	if addr, err := mail.ParseAddress(email); err == nil {
+		email = addr.Address
+	}
+	latest, err := latestEmailMarketingConsent(ctx, customer.ID)
+	if err != nil {
+		return err
+	}
+	if latest.Status == "GRANTED" {
+		return helper.RemoveSuppression(ctx, email, customer.CompanyID, "UNSUBSCRIBE")
+	}
+	if latest.ID != consent.ID {
+		outboxID = primitive.NilObjectID
+	}
+	_, err = helper.AddSuppression(ctx, models.Suppression{
+		Email:     email,
+		CompanyID: customer.CompanyID,
+		Reason:    "UNSUBSCRIBE",
+		Source:    "consent:" + latest.Source,
+		OutboxID:  outboxID,
+		CreatedBy: latest.RecordedBy,
+	})
+	return err
+}
+
+// latestEmailMarketingConsent returns a customer's latest EMAIL MARKETING consent record, by
+// when it was recorded. It returns mongo.ErrNoDocuments if there is none.
+func latestEmailMarketingConsent(ctx context.Context, customerID primitive.ObjectID) (models.Consent, error) {
+	var latest models.Consent
+	err := consentCollection.FindOne(ctx, bson.M{"customerID": customerID, "channel": "EMAIL", "purpose": "MARKETING"},
+		options.FindOne().SetSort(bson.D{{Key: "recorded_at", Value: -1}, {Key: "_id", Value: -1}})).Decode(&latest)
+	return latest, err
+}
+
+// hasWithdrawnEmailMarketing reports whether a customer's latest EMAIL MARKETING consent record
+// withdraws it.
+func hasWithdrawnEmailMarketing(ctx context.Context, customerID primitive.ObjectID) (bool, error) {
+	latest, err := latestEmailMarketingConsent(ctx, customerID)
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	}
+	return err == nil && latest.Status == "WITHDRAWN", err
+}
+
+// loadConsentCustomer reads the customer named by the customer_id parameter, checking that
+// the caller is that customer or staff of their company. On failure the response has been written.
+func loadConsentCustomer(ctx context.Context, c *gin.Context) (models.Customer, bool) {
+	var customer models.Customer
+	customerID, err := primitive.ObjectIDFromHex(c.Param("customer_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Customer ID"})
+		return customer, false
+	}
+	if err := customerCollection.FindOne(ctx, bson.M{"_id": customerID}).Decode(&customer); err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+			return customer, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving customer"})
+		return customer, false
+	}
+	uid := c.GetString("uid")
+	if isCustomerToken(c) {
+		if uid != customer.ID.Hex() {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized to access this resource"})
+			return customer, false
+		}
+	} else if !checkUserAccessToCompany(uid, customer.CompanyID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+		return customer, false
+	}
+	return customer, true
+}
+
+// loadUnsubscribeMessage finds the marketing email an unsubscribe token was issued for. On
+// failure the response has been written.
+func loadUnsubscribeMessage(ctx context.Context, c *gin.Context) (models.OutboxMessage, bool) {
+	outboxID, ok := parseUnsubscribeToken(c.Param("token"))
+	if !ok {
+		c.String(http.StatusNotFound, "This link is invalid.")
+		return models.OutboxMessage{}, false
+	}
+	msg, err := outbox.Get(ctx, outboxID)
+	if err == outbox.ErrNotFound || (err == nil && !msg.Marketing) {
+		c.String(http.StatusNotFound, "This link is invalid.")
+		return msg, false
+	}
+	if err != nil {
+		c.String(http.StatusInternalServerError, "Something went wrong, please try again later.")
+		return msg, false
+	}
+	return msg, true
+}
+
+func renderUnsubscribePage(c *gin.Context, msg models.OutboxMessage, done bool) {
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(http.StatusOK)
+	data := struct {
+		Email string
+		Done  bool
+	}{strings.Join(bareAddresses(msg.To), ", "), done}
+	if err := unsubscribePage.Execute(c.Writer, data); err != nil {
+		log.Println("Error rendering unsubscribe page:", err)
+	}
+}
+
+// unsubscribeURL returns the one-click unsubscribe link of a marketing email.
+func unsubscribeURL(outboxID primitive.ObjectID) string {
+	return helper.PublicURL("/u/" + outboxID.Hex() + "." + helper.Sign("unsubscribe:"+outboxID.Hex()))
+}
+
+func parseUnsubscribeToken(token string) (primitive.ObjectID, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 || !helper.VerifySignature("unsubscribe:"+parts[0], parts[1]) {
+		return primitive.NilObjectID, false
+	}
+	outboxID, err := primitive.ObjectIDFromHex(parts[0])
+	if err != nil {
+		return primitive.NilObjectID, false
+	}
+	return outboxID, true
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"github.com/SiddharthaKR/golang-jwt-project/database"
+	"github.com/SiddharthaKR/golang-jwt-project/events"
 	helper "github.com/SiddharthaKR/golang-jwt-project/helpers"
 	"github.com/SiddharthaKR/golang-jwt-project/models"
 	"github.com/gin-gonic/gin"
@@ -18,6 +19,7 @@ import (
 )
 
 var customerCollection *mongo.Collection = database.OpenCollection(database.Client, "customer")
+var customerChangeCollection *mongo.Collection = database.OpenCollection(database.Client, "customer_change")
 var validate = validator.New()
 
 type CustomerResponse struct {
@@ -31,6 +33,33 @@ type CustomerResponse struct {
 	CustomerID      string  `json:"customer_id"`
 	LastInteraction time.Time `json:"last_interaction,omitempty"`
 	CompanyID       string  `json:"company_id"`
+	OpenTickets       int        `json:"open_tickets"`
+	TotalInteractions int        `json:"total_interactions"`
+	NextMeetingAt     *time.Time `json:"next_meeting_at,omitempty"`
+	NextMeetingID     string     `json:"next_meeting_id,omitempty"`
+}
+
+// customerResponse converts a stored customer to its API form, without credentials.
+func customerResponse(customer models.Customer) CustomerResponse {
+	response := CustomerResponse{
+		FirstName:         customer.FirstName,
+		LastName:          customer.LastName,
+		Email:             customer.Email,
+		Phone:             customer.Phone,
+		Company:           customer.Company,
+		Status:            customer.Status,
+		Notes:             customer.Notes,
+		CustomerID:        customer.CustomerID,
+		LastInteraction:   customer.LastInteraction,
+		CompanyID:         customer.CompanyID.Hex(), // Convert ObjectID to string for response
+		OpenTickets:       customer.OpenTickets,
+		TotalInteractions: customer.TotalInteractions,
+		NextMeetingAt:     customer.NextMeetingAt,
+	}
+	if !customer.NextMeetingID.IsZero() {
+		response.NextMeetingID = customer.NextMeetingID.Hex()
+	}
+	return response
 }
 
 func CustomerSignup() gin.HandlerFunc {
@@ -93,6 +122,7 @@ func CustomerSignup() gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
 			return
 		}
+		events.Publish(ctx, events.Event{Type: events.CustomerCreated, CompanyID: customer.CompanyID, CustomerID: customer.ID})
 		defer cancel()
 		c.JSON(http.StatusOK, resultInsertionNumber)
 	}
@@ -178,18 +208,7 @@ func GetCustomersByCompany() gin.HandlerFunc {
 		// Transform the customer data
 		var response []CustomerResponse
 		for _, customer := range customers {
-			response = append(response, CustomerResponse{
-				FirstName:       customer.FirstName,
-				LastName:        customer.LastName,
-				Email:           customer.Email,
-				Phone:           customer.Phone,
-				Company:         customer.Company,
-				Status:          customer.Status,
-				Notes:           customer.Notes,
-				CustomerID:      customer.CustomerID,
-				LastInteraction: customer.LastInteraction,
-				CompanyID:       customer.CompanyID.Hex(), // Convert ObjectID to string for response
-			})
+			response = append(response, customerResponse(customer))
 		}
 
 		c.JSON(http.StatusOK, response)
@@ -237,18 +256,7 @@ func GetCompanyCustomerByID() gin.HandlerFunc {
 		}
 
 		// Transform the customer data
-		response := CustomerResponse{
-			FirstName:       customer.FirstName,
-			LastName:        customer.LastName,
-			Email:           customer.Email,
-			Phone:           customer.Phone,
-			Company:         customer.Company,
-			Status:          customer.Status,
-			Notes:           customer.Notes,
-			CustomerID:      customer.CustomerID,
-			LastInteraction: customer.LastInteraction,
-			CompanyID:       customer.CompanyID.Hex(), // Convert ObjectID to string for response
-		}
+		response := customerResponse(customer)
 
 		c.JSON(http.StatusOK, response)
 	}
@@ -288,6 +296,16 @@ func UpdateCompanyCustomerByID() gin.HandlerFunc {
 			return
 		}
 
+		var existing models.Customer
+		if err := customerCollection.FindOne(ctx, bson.M{"_id": customerID, "companyID": companyID}).Decode(&existing); err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving customer"})
+			return
+		}
+
 		update := bson.M{}
 		if updatedData.FirstName != nil {
 			update["first_name"] = updatedData.FirstName
@@ -327,11 +345,61 @@ func UpdateCompanyCustomerByID() gin.HandlerFunc {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
 			return
 		}
+		recordCustomerChanges(ctx, existing, updatedData, userID)
 
 		c.JSON(http.StatusOK, gin.H{"message": "Customer updated successfully"})
 	}
 }
 
+// auditedCustomerFields are the customer fields whose changes are kept in the customer's history.
+var auditedCustomerFields = []struct {
+	name  string
+	value func(models.Customer) *string
+}{
+	{"first_name", func(customer models.Customer) *string { return customer.FirstName }},
+	{"last_name", func(customer models.Customer) *string { return customer.LastName }},
+	{"email", func(customer models.Customer) *string { return customer.Email }},
+	{"phone", func(customer models.Customer) *string { return customer.Phone }},
+	{"status", func(customer models.Customer) *string { return customer.Status }},
+	{"notes", func(customer models.Customer) *string { return customer.Notes }},
+}
+
+// recordCustomerChanges stores a CustomerChange for every audited field the update changed.
+func recordCustomerChanges(ctx context.Context, before models.Customer, update models.Customer, actor string) {
+	actorID, _ := primitive.ObjectIDFromHex(actor)
+	now := time.Now()
+
+	var changes []interface{}
+	for _, field := range auditedCustomerFields {
+		to := field.value(update)
+		if to == nil {
+			continue
+		}
+		from := ""
+		if value := field.value(before); value != nil {
+			from = *value
+		}
+		if from == *to {
+			continue
+		}
+		changes = append(changes, models.CustomerChange{
+			CustomerID: before.ID,
+			CompanyID:  before.CompanyID,
+			Field:      field.name,
+			From:       from,
+			To:         *to,
+			ChangedBy:  actorID,
+			ChangedAt:  now,
+		})
+	}
+	if len(changes) == 0 {
+		return
+	}
+	if _, err := customerChangeCollection.InsertMany(ctx, changes); err != nil {
+		log.Println("Error recording changes of customer", before.ID.Hex(), err)
+	}
+}
+
 
 func DeleteComapnyCustomerByID() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -373,6 +441,7 @@ func DeleteComapnyCustomerByID() gin.HandlerFunc {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
 			return
 		}
+		events.Publish(ctx, events.Event{Type: events.CustomerDeleted, CompanyID: companyID, CustomerID: customerID})
 
 		c.JSON(http.StatusOK, gin.H{"message": "Customer deleted successfully"})
 	}
@@ -476,3 +545,28 @@ func checkUserAccessToCompany(userID string, companyID primitive.ObjectID) bool
 	log.Println("User does not have access to company ID:", companyID)
 	return false
 }
+
+// usersShareCompany reports whether two users have access to at least one common company.
+func usersShareCompany(userID string, otherUserID string) bool {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"user_id": userID}).Decode(&user); err != nil {
+		log.Println("Error finding user with ID:", userID, "Error:", err)
+		return false
+	}
+	var other models.User
+	if err := userCollection.FindOne(ctx, bson.M{"user_id": otherUserID}).Decode(&other); err != nil {
+		log.Println("Error finding user with ID:", otherUserID, "Error:", err)
+		return false
+	}
+	for _, id := range user.CompanyIDs {
+		for _, otherID := range other.CompanyIDs {
+			if id == otherID {
+				return true
+			}
+		}
+	}
+	return false
+}
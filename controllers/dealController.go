@@ -0,0 +1,490 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/SiddharthaKR/golang-jwt-project/database"
+	helper "github.com/SiddharthaKR/golang-jwt-project/helpers"
+	"github.com/SiddharthaKR/golang-jwt-project/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var dealCollection *mongo.Collection = database.OpenCollection(database.Client, "deal")
+var quoteCollection *mongo.Collection = database.OpenCollection(database.Client, "quote")
+
+// CreateDeal creates a deal for a customer of the company.
+func CreateDeal() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		companyID, err := primitive.ObjectIDFromHex(c.Param("company_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+			return
+		}
+		userID := c.GetString("uid")
+		if !checkUserAccessToCompany(userID, companyID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var deal models.Deal
+		if err := c.BindJSON(&deal); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(deal); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+		if !helper.IsValidCurrency(deal.Value.Currency) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported currency code"})
+			return
+		}
+		if deal.Value.Amount < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Deal value cannot be negative"})
+			return
+		}
+		if count, err := customerCollection.CountDocuments(ctx, bson.M{"_id": deal.CustomerID, "companyID": companyID}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while checking customer"})
+			return
+		} else if count == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Customer not found in this company"})
+			return
+		}
+
+		if ownerID, err := primitive.ObjectIDFromHex(userID); err == nil {
+			deal.OwnerID = ownerID
+		}
+		deal.ID = primitive.NewObjectID()
+		deal.CompanyID = companyID
+		deal.StageHistory = nil
+		deal.CreatedAt = time.Now()
+		deal.UpdatedAt = time.Now()
+
+		if _, err := dealCollection.InsertOne(ctx, deal); err != nil {
+			log.Println("Error creating deal:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while creating deal"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Deal created successfully", "deal_id": deal.ID})
+	}
+}
+
+// GetCompanyDeals lists the deals of a company, optionally filtered by stage.
+func GetCompanyDeals() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		companyID, err := primitive.ObjectIDFromHex(c.Param("company_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+			return
+		}
+		if !checkUserAccessToCompany(c.GetString("uid"), companyID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		filter := bson.M{"companyID": companyID}
+		if stage := c.Query("stage"); stage != "" {
+			filter["stage"] = stage
+		}
+
+		cursor, err := dealCollection.Find(ctx, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving deals"})
+			return
+		}
+		defer cursor.Close(ctx)
+
+		deals := []models.Deal{}
+		if err = cursor.All(ctx, &deals); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while decoding deals"})
+			return
+		}
+
+		c.JSON(http.StatusOK, deals)
+	}
+}
+
+// UpdateDealStage moves a deal to a new stage and records the change in its history.
+func UpdateDealStage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dealID, err := primitive.ObjectIDFromHex(c.Param("deal_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid deal ID"})
+			return
+		}
+
+		var requestBody struct {
+			Stage string `json:"stage" validate:"required,eq=PROSPECTING|eq=QUALIFIED|eq=PROPOSAL|eq=NEGOTIATION|eq=WON|eq=LOST"`
+		}
+		if err := c.BindJSON(&requestBody); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(requestBody); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var deal models.Deal
+		if err := dealCollection.FindOne(ctx, bson.M{"_id": dealID}).Decode(&deal); err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Deal not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving deal"})
+			return
+		}
+
+		userID := c.GetString("uid")
+		if !checkUserAccessToCompany(userID, deal.CompanyID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+			return
+		}
+		if deal.Stage == requestBody.Stage {
+			c.JSON(http.StatusOK, gin.H{"message": "Deal stage unchanged"})
+			return
+		}
+
+		change := models.DealStageChange{From: deal.Stage, To: requestBody.Stage, ChangedAt: time.Now()}
+		if changedBy, err := primitive.ObjectIDFromHex(userID); err == nil {
+			change.ChangedBy = changedBy
+		}
+		set := bson.M{"stage": requestBody.Stage, "updated_at": time.Now()}
+		if requestBody.Stage == "WON" || requestBody.Stage == "LOST" {
+			set["close_date"] = time.Now()
+		}
+
+		_, err = dealCollection.UpdateOne(ctx,
+			bson.M{"_id": dealID},
+			bson.M{"$set": set, "$push": bson.M{"stage_history": change}},
+		)
+		if err != nil {
+			log.Println("Error updating deal stage:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while updating deal"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Deal stage updated successfully"})
+	}
+}
+
+// CreateQuote creates a quote for a company customer, optionally for one of the customer's deals.
+// All items must be priced in the quote currency.
+func CreateQuote() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		companyID, err := primitive.ObjectIDFromHex(c.Param("company_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+			return
+		}
+		if !checkUserAccessToCompany(c.GetString("uid"), companyID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var quote models.Quote
+		if err := c.BindJSON(&quote); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(quote); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+		if !helper.IsValidCurrency(quote.Currency) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported currency code"})
+			return
+		}
+
+		if count, err := customerCollection.CountDocuments(ctx, bson.M{"_id": quote.CustomerID, "companyID": companyID}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while checking customer"})
+			return
+		} else if count == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Customer not found in this company"})
+			return
+		}
+		if !quote.DealID.IsZero() {
+			if count, err := dealCollection.CountDocuments(ctx, bson.M{"_id": quote.DealID, "companyID": companyID, "customerID": quote.CustomerID}); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while checking deal"})
+				return
+			} else if count == 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Deal not found for this customer"})
+				return
+			}
+		}
+
+		total := models.Money{Currency: quote.Currency}
+		for _, item := range quote.Items {
+			if item.UnitPrice.Currency != quote.Currency {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "All quote items must use the quote currency"})
+				return
+			}
+			if item.UnitPrice.Amount < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Unit prices cannot be negative"})
+				return
+			}
+			// Quantity is at least 1, so neither the line nor the running total may pass MaxInt64
+			if item.UnitPrice.Amount > math.MaxInt64/item.Quantity || total.Amount > math.MaxInt64-item.UnitPrice.Amount*item.Quantity {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Quote total is too large"})
+				return
+			}
+			total.Amount += item.UnitPrice.Amount * item.Quantity
+		}
+
+		quote.ID = primitive.NewObjectID()
+		quote.CompanyID = companyID
+		quote.Total = total
+		quote.CreatedAt = time.Now()
+		quote.UpdatedAt = time.Now()
+
+		if _, err := quoteCollection.InsertOne(ctx, quote); err != nil {
+			log.Println("Error creating quote:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while creating quote"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Quote created successfully", "quote_id": quote.ID, "total": quote.Total})
+	}
+}
+
+// GetCompanyQuotes lists the quotes of a company.
+func GetCompanyQuotes() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		companyID, err := primitive.ObjectIDFromHex(c.Param("company_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+			return
+		}
+		if !checkUserAccessToCompany(c.GetString("uid"), companyID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		cursor, err := quoteCollection.Find(ctx, bson.M{"companyID": companyID})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving quotes"})
+			return
+		}
+		defer cursor.Close(ctx)
+
+		quotes := []models.Quote{}
+		if err = cursor.All(ctx, &quotes); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while decoding quotes"})
+			return
+		}
+
+		c.JSON(http.StatusOK, quotes)
+	}
+}
+
+// GetDealReport totals a company's deals by stage in its reporting currency.
+// Each deal is converted at the rate effective on its close date, or its creation date if still open.
+func GetDealReport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		companyID, err := primitive.ObjectIDFromHex(c.Query("company_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+			return
+		}
+		if !checkUserAccessToCompany(c.GetString("uid"), companyID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		reportingCurrency, ok := loadReportingCurrency(ctx, c, companyID)
+		if !ok {
+			return
+		}
+
+		cursor, err := dealCollection.Find(ctx, reportFilter(c, companyID))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching deal report"})
+			return
+		}
+		defer cursor.Close(ctx)
+
+		var deals []models.Deal
+		if err = cursor.All(ctx, &deals); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error decoding deal report"})
+			return
+		}
+
+		type stageTotal struct {
+			Stage string       `json:"stage"`
+			Count int          `json:"count"`
+			Total models.Money `json:"total"`
+		}
+		totals := map[string]*stageTotal{}
+		var stages []string
+		var unconverted []primitive.ObjectID
+
+		for _, deal := range deals {
+			at := deal.CreatedAt
+			if !deal.CloseDate.IsZero() {
+				at = deal.CloseDate
+			}
+			converted, err := helper.ConvertMoney(ctx, deal.Value, reportingCurrency, at)
+			if err != nil {
+				log.Println("Unable to convert deal", deal.ID.Hex(), ":", err)
+				unconverted = append(unconverted, deal.ID)
+				continue
+			}
+			total, ok := totals[deal.Stage]
+			if !ok {
+				total = &stageTotal{Stage: deal.Stage, Total: models.Money{Currency: reportingCurrency}}
+				totals[deal.Stage] = total
+				stages = append(stages, deal.Stage)
+			}
+			total.Count++
+			total.Total.Amount += converted.Amount
+		}
+
+		byStage := []stageTotal{}
+		for _, stage := range stages {
+			byStage = append(byStage, *totals[stage])
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"reporting_currency": reportingCurrency,
+			"stages":             byStage,
+			"unconverted_deals":  unconverted,
+		})
+	}
+}
+
+// GetQuoteReport totals a company's quotes by status in its reporting currency.
+// Each quote is converted at the rate effective on the day it was created.
+func GetQuoteReport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		companyID, err := primitive.ObjectIDFromHex(c.Query("company_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+			return
+		}
+		if !checkUserAccessToCompany(c.GetString("uid"), companyID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		reportingCurrency, ok := loadReportingCurrency(ctx, c, companyID)
+		if !ok {
+			return
+		}
+
+		cursor, err := quoteCollection.Find(ctx, reportFilter(c, companyID))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching quote report"})
+			return
+		}
+		defer cursor.Close(ctx)
+
+		var quotes []models.Quote
+		if err = cursor.All(ctx, &quotes); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error decoding quote report"})
+			return
+		}
+
+		type statusTotal struct {
+			Status string       `json:"status"`
+			Count  int          `json:"count"`
+			Total  models.Money `json:"total"`
+		}
+		totals := map[string]*statusTotal{}
+		var statuses []string
+		var unconverted []primitive.ObjectID
+
+		for _, quote := range quotes {
+			converted, err := helper.ConvertMoney(ctx, quote.Total, reportingCurrency, quote.CreatedAt)
+			if err != nil {
+				log.Println("Unable to convert quote", quote.ID.Hex(), ":", err)
+				unconverted = append(unconverted, quote.ID)
+				continue
+			}
+			total, ok := totals[quote.Status]
+			if !ok {
+				total = &statusTotal{Status: quote.Status, Total: models.Money{Currency: reportingCurrency}}
+				totals[quote.Status] = total
+				statuses = append(statuses, quote.Status)
+			}
+			total.Count++
+			total.Total.Amount += converted.Amount
+		}
+
+		byStatus := []statusTotal{}
+		for _, status := range statuses {
+			byStatus = append(byStatus, *totals[status])
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"reporting_currency": reportingCurrency,
+			"statuses":           byStatus,
+			"unconverted_quotes": unconverted,
+		})
+	}
+}
+
+// loadReportingCurrency returns the reporting currency of a company.
+// It writes the error response itself and returns false if the request should stop.
+func loadReportingCurrency(ctx context.Context, c *gin.Context, companyID primitive.ObjectID) (string, bool) {
+	var company models.Company
+	if err := companyCollection.FindOne(ctx, bson.M{"_id": companyID}).Decode(&company); err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Company not found"})
+			return "", false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while checking company"})
+		return "", false
+	}
+	if company.ReportingCurrency == "" {
+		return helper.DefaultReportingCurrency, true
+	}
+	return company.ReportingCurrency, true
+}
+
+// reportFilter selects the records of a company created between the start_date and end_date
+// query parameters, when given.
+func reportFilter(c *gin.Context, companyID primitive.ObjectID) bson.M {
+	filter := bson.M{"companyID": companyID}
+	dateFilter := bson.M{}
+	if startDate := c.Query("start_date"); startDate != "" {
+		start, _ := time.Parse(time.RFC3339, startDate)
+		dateFilter["$gte"] = start
+	}
+	if endDate := c.Query("end_date"); endDate != "" {
+		end, _ := time.Parse(time.RFC3339, endDate)
+		dateFilter["$lte"] = end
+	}
+	if len(dateFilter) > 0 {
+		filter["created_at"] = dateFilter
+	}
+	return filter
+}
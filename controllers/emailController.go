@@ -1,21 +1,43 @@
 package controllers
 
 import (
+	"context"
+	"log"
 	"net/http"
 	"strings"
+	"time"
 
-	helpers "github.com/SiddharthaKR/golang-jwt-project/helpers"
+	"github.com/SiddharthaKR/golang-jwt-project/mailer"
+	"github.com/SiddharthaKR/golang-jwt-project/models"
+	"github.com/SiddharthaKR/golang-jwt-project/outbox"
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
-// EmailRequestBody defines the structure of the email request body
+// EmailRequestBody defines the structure of the email request body.
+// Either ToAddr, Subject and Body are given, or TemplateID and the CustomerID to send it to.
+// With ToAddr, CustomerID is optional and files opens and clicks under that customer; the
+// email is sent for the customer's company, or else for CompanyID.
 type EmailRequestBody struct {
-    ToAddr  string `json:"to_addr"`
-    Subject string `json:"subject"`
-    Body    string `json:"body"`
+    ToAddr        string            `json:"to_addr"`
+    CompanyID     string            `json:"company_id"` // Without CustomerID; defaults to the sender's only company
+    Subject       string            `json:"subject"`
+    Body          string            `json:"body"`
+    HTML          string            `json:"html"` // Optional HTML version of Body
+    TemplateID    string            `json:"template_id"`
+    CustomerID    string            `json:"customer_id"`
+    InteractionID string            `json:"interaction_id"` // Optional, fills {{.Interaction}} in the template
+    Cc            string            `json:"cc"`             // Comma-separated, like ToAddr
+    Bcc           string            `json:"bcc"`            // Comma-separated, hidden from the other recipients
+    ReplyTo       string            `json:"reply_to"`       // Comma-separated
+    Headers       map[string]string `json:"headers"`        // Custom headers, e.g. X-Campaign
+    Track         bool              `json:"track"`          // Track opens and link clicks
 }
 
-// SendEmail handles sending emails
+// SendEmail queues an email for delivery and answers 202 with its outbox ID; a worker sends it
+// in the background and retries failures.
 func SendEmail() gin.HandlerFunc {
     return func(c *gin.Context) {
         var reqBody EmailRequestBody
@@ -24,14 +46,201 @@ func SendEmail() gin.HandlerFunc {
             return
         }
 
-        // Convert comma-separated string to slice of strings
-        to := strings.Split(reqBody.ToAddr, ",")
+        if reqBody.TemplateID != "" {
+            sendTemplateEmail(c, reqBody)
+            return
+        }
+
+        to := splitAddressList(reqBody.ToAddr)
+        if len(to) == 0 {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "to_addr is required"})
+            return
+        }
+
+        var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+        defer cancel()
+
+        msg := models.OutboxMessage{
+            CreatedBy: c.GetString("uid"),
+            Source:    "email",
+            To:        to,
+            Subject:   reqBody.Subject,
+            Text:      reqBody.Body,
+            HTML:      reqBody.HTML,
+        }
+        if reqBody.CustomerID != "" {
+            customerID, err := primitive.ObjectIDFromHex(reqBody.CustomerID)
+            if err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Customer ID"})
+                return
+            }
+            var customer models.Customer
+            if err := customerCollection.FindOne(ctx, bson.M{"_id": customerID}).Decode(&customer); err != nil {
+                if err == mongo.ErrNoDocuments {
+                    c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+                    return
+                }
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving customer"})
+                return
+            }
+            if isCustomerToken(c) || !checkUserAccessToCompany(c.GetString("uid"), customer.CompanyID) {
+                c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+                return
+            }
+            msg.CustomerID = customer.ID
+            msg.CompanyID = customer.CompanyID
+        } else {
+            // Company suppressions only apply to email sent for the company
+            companyID, ok := senderCompany(ctx, c, reqBody.CompanyID)
+            if !ok {
+                return
+            }
+            msg.CompanyID = companyID
+        }
+        addEmailOptions(&msg, reqBody)
+        queueEmail(ctx, c, &msg)
+    }
+}
+
+// senderCompany returns the company a raw email is sent for: the given company_id, which the
+// caller must have access to, or else the only company the caller works for.
+func senderCompany(ctx context.Context, c *gin.Context, value string) (primitive.ObjectID, bool) {
+    if isCustomerToken(c) {
+        c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+        return primitive.NilObjectID, false
+    }
+    if value != "" {
+        companyID, err := primitive.ObjectIDFromHex(value)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company_id"})
+            return primitive.NilObjectID, false
+        }
+        if !checkUserAccessToCompany(c.GetString("uid"), companyID) {
+            c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+            return primitive.NilObjectID, false
+        }
+        return companyID, true
+    }
+
+    var user models.User
+    if err := userCollection.FindOne(ctx, bson.M{"user_id": c.GetString("uid")}).Decode(&user); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving user"})
+        return primitive.NilObjectID, false
+    }
+    if len(user.CompanyIDs) != 1 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "company_id is required"})
+        return primitive.NilObjectID, false
+    }
+    return user.CompanyIDs[0], true
+}
+
+// addEmailOptions copies the optional Cc, Bcc, Reply-To and custom headers of a request onto a
+// message, and adds open and click tracking if asked to.
+func addEmailOptions(msg *models.OutboxMessage, reqBody EmailRequestBody) {
+    msg.Cc = splitAddressList(reqBody.Cc)
+    msg.Bcc = splitAddressList(reqBody.Bcc)
+    msg.ReplyTo = splitAddressList(reqBody.ReplyTo)
+    msg.Headers = reqBody.Headers
+    if reqBody.Track {
+        addEmailTracking(msg)
+    }
+}
+
+// splitAddressList converts a comma-separated string of addresses to a slice of strings
+func splitAddressList(list string) []string {
+    var addrs []string
+    for _, addr := range strings.Split(list, ",") {
+        if addr = strings.TrimSpace(addr); addr != "" {
+            addrs = append(addrs, addr)
+        }
+    }
+    return addrs
+}
+
+// queueEmail puts an email into the outbox and answers with its ID, which GetOutboxMessage
+// reports the delivery status of.
+func queueEmail(ctx context.Context, c *gin.Context, msg *models.OutboxMessage) {
+    // Bad addresses and headers are reported now rather than when the message goes DEAD
+    check := mailer.Message{To: msg.To, Cc: msg.Cc, Bcc: msg.Bcc, ReplyTo: msg.ReplyTo, Subject: msg.Subject, Headers: msg.Headers}
+    if err := check.Check(); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": strings.TrimPrefix(err.Error(), mailer.ErrInvalidMessage.Error()+": ")})
+        return
+    }
+    if err := outbox.Enqueue(ctx, msg); err != nil {
+        log.Println("Error queueing email:", err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue email"})
+        return
+    }
+
+    c.JSON(http.StatusAccepted, gin.H{
+        "message":   "Email queued for delivery",
+        "outbox_id": msg.ID,
+        "status":    msg.Status,
+        "to":        msg.To,
+        "subject":   msg.Subject,
+    })
+}
+
+// sendTemplateEmail renders a company's email template for one of its customers and queues it
+// for the customer's address. Staff of the template's company only.
+func sendTemplateEmail(c *gin.Context, reqBody EmailRequestBody) {
+    var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+    defer cancel()
 
-        if err := helpers.SendEmail(to, reqBody.Subject, reqBody.Body); err != nil {
-            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send email"})
+    templateID, err := primitive.ObjectIDFromHex(reqBody.TemplateID)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template ID"})
+        return
+    }
+    if reqBody.CustomerID == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "customer_id is required with template_id"})
+        return
+    }
+
+    var tmpl models.EmailTemplate
+    if err := emailTemplateCollection.FindOne(ctx, bson.M{"_id": templateID, "type": "TEMPLATE"}).Decode(&tmpl); err != nil {
+        if err == mongo.ErrNoDocuments {
+            c.JSON(http.StatusNotFound, gin.H{"error": "Email template not found"})
             return
         }
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving email template"})
+        return
+    }
+    if isCustomerToken(c) || !checkUserAccessToCompany(c.GetString("uid"), tmpl.CompanyID) {
+        c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+        return
+    }
+
+    data, msg, err := buildEmailTemplateData(ctx, tmpl.CompanyID, reqBody.CustomerID, reqBody.InteractionID, c.GetString("uid"), false)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while loading template data"})
+        return
+    }
+    if msg != "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+        return
+    }
+    if data.Customer.Email == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Customer has no email address"})
+        return
+    }
+
+    content, err := renderEmailTemplate(ctx, tmpl, data)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
 
-        c.JSON(http.StatusOK, gin.H{"message": "Email sent successfully"})
+    email := models.OutboxMessage{
+        CompanyID: tmpl.CompanyID,
+        CreatedBy: c.GetString("uid"),
+        Source:    "email_template",
+        To:        []string{data.Customer.Email},
+        Subject:   content.Subject,
+        Text:      content.Text,
+        HTML:      content.HTML,
     }
+    email.CustomerID, _ = primitive.ObjectIDFromHex(data.Customer.ID)
+    addEmailOptions(&email, reqBody)
+    queueEmail(ctx, c, &email)
 }
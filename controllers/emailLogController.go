@@ -0,0 +1,291 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/mail"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SiddharthaKR/golang-jwt-project/database"
+	"github.com/SiddharthaKR/golang-jwt-project/events"
+	helper "github.com/SiddharthaKR/golang-jwt-project/helpers"
+	"github.com/SiddharthaKR/golang-jwt-project/inbound"
+	"github.com/SiddharthaKR/golang-jwt-project/models"
+	"github.com/SiddharthaKR/golang-jwt-project/outbox"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var emailBodyCollection *mongo.Collection = database.OpenCollection(database.Client, "email_body")
+
+var emailLogIndexesOnce sync.Once
+
+// emailSnippetLength is how much of the body an EMAIL interaction keeps as its snippet.
+const emailSnippetLength = 200
+
+// loggedEmail is an email to be logged as an EMAIL interaction on the customers it was
+// exchanged with. Message IDs are without angle brackets.
+type loggedEmail struct {
+	Direction  string // INBOUND or OUTBOUND
+	From       string
+	To         []string
+	Subject    string
+	Text       string
+	HTML       string
+	MessageID  string
+	InReplyTo  []string
+	References []string
+	UserID     primitive.ObjectID // The user who sent it; the customer for inbound email
+	OutboxID   primitive.ObjectID
+	At         time.Time
+}
+
+// GetLoggedEmail returns an EMAIL interaction together with the full text and HTML body of
+// the email. Emails logged by hand have their description as the text.
+func GetLoggedEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		interactionID, err := primitive.ObjectIDFromHex(c.Param("interaction_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid interaction ID"})
+			return
+		}
+		var interaction models.Interaction
+		if err := interactionCollection.FindOne(ctx, bson.M{"_id": interactionID, "type": "EMAIL"}).Decode(&interaction); err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Email not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving email"})
+			return
+		}
+		if !authorizeInteraction(c, interaction) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this email"})
+			return
+		}
+
+		body := models.EmailBody{ID: interaction.ID}
+		err = emailBodyCollection.FindOne(ctx, bson.M{"_id": interaction.ID}).Decode(&body)
+		if err == mongo.ErrNoDocuments {
+			body.Text = interaction.Description
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving email body"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"interaction": interaction, "text": body.Text, "html": body.HTML})
+	}
+}
+
+// logSentEmail logs a delivered outbox message on every customer of the message's company
+// among its recipients. Messages without a company are not logged.
+func logSentEmail(ctx context.Context, event events.Event) error {
+	msg, err := outbox.Get(ctx, event.OutboxID)
+	if err == outbox.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if msg.CompanyID.IsZero() {
+		return nil
+	}
+
+	var recipients []string
+	for _, list := range [][]string{msg.To, msg.Cc, msg.Bcc} {
+		recipients = append(recipients, bareAddresses(list)...)
+	}
+	customers, err := findCustomersByEmail(ctx, recipients, msg.CompanyID)
+	if err != nil {
+		return err
+	}
+	if !msg.CustomerID.IsZero() && !containsCustomer(customers, msg.CustomerID) {
+		// The customer's address may have changed since the email was queued
+		var customer models.Customer
+		if err := customerCollection.FindOne(ctx, bson.M{"_id": msg.CustomerID, "companyID": msg.CompanyID}).Decode(&customer); err == nil {
+			customers = append(customers, customer)
+		}
+	}
+
+	userID, _ := primitive.ObjectIDFromHex(msg.CreatedBy)
+	sentAt := time.Now()
+	if msg.SentAt != nil {
+		sentAt = *msg.SentAt
+	}
+	email := loggedEmail{
+		Direction: "OUTBOUND",
+		From:      helper.DefaultFromAddress(),
+		To:        append(append([]string{}, msg.To...), msg.Cc...),
+		Subject:   msg.Subject,
+		Text:      msg.Text,
+		HTML:      msg.HTML,
+		MessageID: msg.MessageID,
+		UserID:    userID,
+		OutboxID:  msg.ID,
+		At:        sentAt,
+	}
+	for _, customer := range customers {
+		if err := logEmailInteraction(ctx, customer, email); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// logEmailInteraction stores an email as an EMAIL interaction of the customer, with its body
+// in email_body. An email already logged on the customer is skipped: outbound email by its
+// outbox message, which a unique index enforces, and inbound email by its Message-ID.
+func logEmailInteraction(ctx context.Context, customer models.Customer, email loggedEmail) error {
+	ensureEmailLogIndexes()
+	if email.OutboxID.IsZero() && email.MessageID != "" {
+		count, err := interactionCollection.CountDocuments(ctx, bson.M{"type": "EMAIL", "customerID": customer.ID, "message_id": email.MessageID})
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return nil
+		}
+	}
+	threadID, err := emailThreadID(ctx, customer.CompanyID, email)
+	if err != nil {
+		return err
+	}
+
+	subject := email.Subject
+	if subject == "" {
+		subject = "(no subject)"
+	}
+	text := email.Text
+	if text == "" && email.HTML != "" {
+		text = inbound.HTMLToText(email.HTML)
+	}
+	interaction := models.Interaction{
+		ID:         primitive.NewObjectID(),
+		CustomerID: customer.ID,
+		UserID:     email.UserID,
+		CompanyID:  customer.CompanyID,
+		Type:       "EMAIL",
+		Status:     "LOGGED",
+		Direction:  email.Direction,
+		Subject:    subject,
+		MessageID:  email.MessageID,
+		ThreadID:   threadID,
+		Snippet:    emailSnippet(text),
+		From:       email.From,
+		To:         email.To,
+		OutboxID:   email.OutboxID,
+		CreatedAt:  email.At,
+		UpdatedAt:  time.Now(),
+	}
+	if _, err := interactionCollection.InsertOne(ctx, interaction); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			// Logged by another delivery of the same EmailSent event
+			return nil
+		}
+		return err
+	}
+	if _, err := emailBodyCollection.InsertOne(ctx, models.EmailBody{ID: interaction.ID, Text: text, HTML: email.HTML}); err != nil {
+		return err
+	}
+	publishInteractionEvent(ctx, events.InteractionCreated, interaction)
+	return nil
+}
+
+// ensureEmailLogIndexes creates the index that logs an outbox message on a customer once.
+func ensureEmailLogIndexes() {
+	emailLogIndexesOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		_, err := interactionCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys: bson.D{{Key: "outboxID", Value: 1}, {Key: "customerID", Value: 1}},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"outboxID": bson.M{"$exists": true}}),
+		})
+		if err != nil {
+			log.Println("Error creating email log indexes:", err)
+		}
+	})
+}
+
+// emailThreadID returns the thread of an email: the thread of an email it refers to that was
+// logged before, or else the first of its references, or else its own Message-ID.
+func emailThreadID(ctx context.Context, companyID primitive.ObjectID, email loggedEmail) (string, error) {
+	referenced := append(append([]string{}, email.References...), email.InReplyTo...)
+	if len(referenced) > 0 {
+		var earlier models.Interaction
+		err := interactionCollection.FindOne(ctx, bson.M{
+			"type":       "EMAIL",
+			"companyID":  companyID,
+			"message_id": bson.M{"$in": referenced},
+			"thread_id":  bson.M{"$exists": true},
+		}, options.FindOne().SetProjection(bson.M{"thread_id": 1})).Decode(&earlier)
+		if err == nil {
+			return earlier.ThreadID, nil
+		}
+		if err != mongo.ErrNoDocuments {
+			return "", err
+		}
+		return referenced[0], nil
+	}
+	return email.MessageID, nil
+}
+
+// findCustomersByEmail finds the customers of a company with one of the addresses, ignoring case.
+func findCustomersByEmail(ctx context.Context, addresses []string, companyID primitive.ObjectID) ([]models.Customer, error) {
+	if len(addresses) == 0 {
+		return nil, nil
+	}
+	patterns := bson.A{}
+	for _, address := range addresses {
+		patterns = append(patterns, primitive.Regex{Pattern: "^" + regexp.QuoteMeta(address) + "$", Options: "i"})
+	}
+	cursor, err := customerCollection.Find(ctx, bson.M{"email": bson.M{"$in": patterns}, "companyID": companyID})
+	if err != nil {
+		return nil, err
+	}
+	var customers []models.Customer
+	if err := cursor.All(ctx, &customers); err != nil {
+		return nil, err
+	}
+	return customers, nil
+}
+
+// bareAddresses returns the addresses of a list that may carry display names, skipping
+// entries that do not parse.
+func bareAddresses(list []string) []string {
+	var addresses []string
+	for _, value := range list {
+		if addr, err := mail.ParseAddress(value); err == nil {
+			addresses = append(addresses, addr.Address)
+		}
+	}
+	return addresses
+}
+
+func containsCustomer(customers []models.Customer, id primitive.ObjectID) bool {
+	for _, customer := range customers {
+		if customer.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// emailSnippet collapses the whitespace of a body and cuts it to emailSnippetLength characters.
+func emailSnippet(text string) string {
+	snippet := []rune(strings.Join(strings.Fields(text), " "))
+	if len(snippet) > emailSnippetLength {
+		return string(snippet[:emailSnippetLength-3]) + "..."
+	}
+	return string(snippet)
+}
@@ -0,0 +1,488 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/SiddharthaKR/golang-jwt-project/database"
+	helper "github.com/SiddharthaKR/golang-jwt-project/helpers"
+	"github.com/SiddharthaKR/golang-jwt-project/inbound"
+	"github.com/SiddharthaKR/golang-jwt-project/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var emailTemplateCollection *mongo.Collection = database.OpenCollection(database.Client, "email_template")
+
+// emailTemplateData is what email templates are executed against. Only fields that are safe to
+// put into an email are exposed, never password hashes or tokens.
+type emailTemplateData struct {
+	Customer    emailCustomer
+	User        emailUser
+	Company     emailCompany
+	Interaction emailInteraction
+
+	// UnsubscribeURL is the recipient's one-click unsubscribe link. It is only set for
+	// campaign email; elsewhere it is empty.
+	UnsubscribeURL string
+}
+
+type emailCustomer struct {
+	ID         string
+	CustomerID string
+	FirstName  string
+	LastName   string
+	Name       string
+	Email      string
+	Phone      string
+	Status     string
+	Company    string
+}
+
+type emailUser struct {
+	FirstName string
+	LastName  string
+	Name      string
+	Email     string
+	Phone     string
+}
+
+type emailCompany struct {
+	ID   string
+	Name string
+}
+
+type emailInteraction struct {
+	ID          string
+	Type        string
+	Status      string
+	Subject     string
+	Description string
+	Priority    string
+	Category    string
+	ScheduledAt time.Time
+	DueAt       time.Time
+	CreatedAt   time.Time
+}
+
+// CreateEmailTemplate adds an email template or layout to a company.
+func CreateEmailTemplate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		companyID, err := primitive.ObjectIDFromHex(c.Param("company_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+			return
+		}
+		userID := c.GetString("uid")
+		if isCustomerToken(c) || !checkUserAccessToCompany(userID, companyID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var tmpl models.EmailTemplate
+		if err := c.BindJSON(&tmpl); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		tmpl.CompanyID = companyID
+		if msg := validateEmailTemplate(ctx, &tmpl); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+
+		tmpl.ID = primitive.NewObjectID()
+		tmpl.CreatedBy, _ = primitive.ObjectIDFromHex(userID)
+		tmpl.CreatedAt = time.Now()
+		tmpl.UpdatedAt = time.Now()
+
+		if _, err := emailTemplateCollection.InsertOne(ctx, tmpl); err != nil {
+			log.Println("Error creating email template:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while creating email template"})
+			return
+		}
+
+		c.JSON(http.StatusOK, tmpl)
+	}
+}
+
+// GetEmailTemplates lists a company's email templates by name, filterable by type.
+func GetEmailTemplates() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		companyID, err := primitive.ObjectIDFromHex(c.Param("company_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+			return
+		}
+		if isCustomerToken(c) || !checkUserAccessToCompany(c.GetString("uid"), companyID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		filter := bson.M{"companyID": companyID}
+		if templateType := c.Query("type"); templateType != "" {
+			filter["type"] = templateType
+		}
+		cursor, err := emailTemplateCollection.Find(ctx, filter, options.Find().SetSort(bson.M{"name": 1}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving email templates"})
+			return
+		}
+		templates := []models.EmailTemplate{}
+		if err := cursor.All(ctx, &templates); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while decoding email templates"})
+			return
+		}
+
+		c.JSON(http.StatusOK, templates)
+	}
+}
+
+// GetEmailTemplate returns one email template or layout.
+func GetEmailTemplate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		tmpl, ok := loadEmailTemplate(ctx, c)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, tmpl)
+	}
+}
+
+// UpdateEmailTemplate replaces an email template or layout. Its type cannot change.
+func UpdateEmailTemplate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		existing, ok := loadEmailTemplate(ctx, c)
+		if !ok {
+			return
+		}
+
+		var tmpl models.EmailTemplate
+		if err := c.BindJSON(&tmpl); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		tmpl.CompanyID = existing.CompanyID
+		tmpl.Type = existing.Type
+		if msg := validateEmailTemplate(ctx, &tmpl); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+
+		tmpl.ID = existing.ID
+		tmpl.CreatedBy = existing.CreatedBy
+		tmpl.CreatedAt = existing.CreatedAt
+		tmpl.UpdatedAt = time.Now()
+
+		if _, err := emailTemplateCollection.ReplaceOne(ctx, bson.M{"_id": existing.ID}, tmpl); err != nil {
+			log.Println("Error updating email template:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while updating email template"})
+			return
+		}
+
+		c.JSON(http.StatusOK, tmpl)
+	}
+}
+
+// DeleteEmailTemplate removes an email template, or a layout no template uses.
+func DeleteEmailTemplate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		tmpl, ok := loadEmailTemplate(ctx, c)
+		if !ok {
+			return
+		}
+
+		if tmpl.Type == "LAYOUT" {
+			count, err := emailTemplateCollection.CountDocuments(ctx, bson.M{"layoutID": tmpl.ID})
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while deleting email template"})
+				return
+			}
+			if count > 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Layout is used by other templates"})
+				return
+			}
+		}
+
+		if _, err := emailTemplateCollection.DeleteOne(ctx, bson.M{"_id": tmpl.ID}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while deleting email template"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Email template deleted successfully"})
+	}
+}
+
+// PreviewEmailTemplate renders a template without sending it. customer_id and interaction_id
+// pick the records to fill it with; sample data stands in for any that are not given. Subject,
+// text_body and html_body may be sent to preview unsaved changes.
+func PreviewEmailTemplate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		tmpl, ok := loadEmailTemplate(ctx, c)
+		if !ok {
+			return
+		}
+		if tmpl.Type == "LAYOUT" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Preview a template that uses this layout instead"})
+			return
+		}
+
+		var requestBody struct {
+			CustomerID    string  `json:"customer_id"`
+			InteractionID string  `json:"interaction_id"`
+			Subject       *string `json:"subject"`
+			TextBody      *string `json:"text_body"`
+			HTMLBody      *string `json:"html_body"`
+		}
+		if c.Request.ContentLength != 0 {
+			if err := c.BindJSON(&requestBody); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		if requestBody.Subject != nil {
+			tmpl.Subject = *requestBody.Subject
+		}
+		if requestBody.TextBody != nil {
+			tmpl.TextBody = *requestBody.TextBody
+		}
+		if requestBody.HTMLBody != nil {
+			tmpl.HTMLBody = *requestBody.HTMLBody
+		}
+
+		data, msg, err := buildEmailTemplateData(ctx, tmpl.CompanyID, requestBody.CustomerID, requestBody.InteractionID, c.GetString("uid"), true)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while loading template data"})
+			return
+		}
+		if msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+
+		content, err := renderEmailTemplate(ctx, tmpl, data)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"subject": content.Subject, "text_body": content.Text, "html_body": content.HTML})
+	}
+}
+
+// renderEmailTemplate renders a template inside its layout. Without a text body, the text
+// version is derived from the HTML one.
+func renderEmailTemplate(ctx context.Context, tmpl models.EmailTemplate, data emailTemplateData) (helper.EmailContent, error) {
+	var layout *helper.EmailContent
+	if !tmpl.LayoutID.IsZero() {
+		var stored models.EmailTemplate
+		if err := emailTemplateCollection.FindOne(ctx, bson.M{"_id": tmpl.LayoutID}).Decode(&stored); err != nil {
+			return helper.EmailContent{}, err
+		}
+		layout = &helper.EmailContent{Text: stored.TextBody, HTML: stored.HTMLBody}
+	}
+	content, err := helper.RenderEmailTemplate(layout, helper.EmailContent{Subject: tmpl.Subject, Text: tmpl.TextBody, HTML: tmpl.HTMLBody}, data)
+	if err != nil {
+		return content, err
+	}
+	if content.Text == "" {
+		content.Text = inbound.HTMLToText(content.HTML)
+	}
+	return content, nil
+}
+
+// buildEmailTemplateData loads the records a template is filled with. The customer and
+// interaction must belong to the company, and the interaction to the customer when both are
+// given. With sample set, made-up records stand in for the ones not given. It returns a
+// message if the request names records that cannot be used.
+func buildEmailTemplateData(ctx context.Context, companyID primitive.ObjectID, customerParam string, interactionParam string, userID string, sample bool) (emailTemplateData, string, error) {
+	data := emailTemplateData{}
+	if sample {
+		data = sampleEmailTemplateData()
+	}
+
+	var company models.Company
+	if err := companyCollection.FindOne(ctx, bson.M{"_id": companyID}).Decode(&company); err != nil && err != mongo.ErrNoDocuments {
+		return data, "", err
+	}
+	data.Company = emailCompany{ID: companyID.Hex(), Name: stringValue(company.Name)}
+
+	var user models.User
+	err := userCollection.FindOne(ctx, bson.M{"user_id": userID}).Decode(&user)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return data, "", err
+	}
+	if err == nil {
+		data.User = emailUser{
+			FirstName: stringValue(user.FirstName),
+			LastName:  stringValue(user.LastName),
+			Name:      strings.TrimSpace(stringValue(user.FirstName) + " " + stringValue(user.LastName)),
+			Email:     stringValue(user.Email),
+			Phone:     stringValue(user.Phone),
+		}
+	}
+
+	var customerID primitive.ObjectID
+	if customerParam != "" {
+		if customerID, err = primitive.ObjectIDFromHex(customerParam); err != nil {
+			return data, "Invalid customer ID", nil
+		}
+		var customer models.Customer
+		err := customerCollection.FindOne(ctx, bson.M{"_id": customerID, "companyID": companyID}).Decode(&customer)
+		if err == mongo.ErrNoDocuments {
+			return data, "Customer not found", nil
+		}
+		if err != nil {
+			return data, "", err
+		}
+		data.Customer = emailCustomer{
+			ID:         customer.ID.Hex(),
+			CustomerID: customer.CustomerID,
+			FirstName:  stringValue(customer.FirstName),
+			LastName:   stringValue(customer.LastName),
+			Name:       strings.TrimSpace(stringValue(customer.FirstName) + " " + stringValue(customer.LastName)),
+			Email:      stringValue(customer.Email),
+			Phone:      stringValue(customer.Phone),
+			Status:     stringValue(customer.Status),
+			Company:    stringValue(customer.Company),
+		}
+	}
+
+	if interactionParam != "" {
+		interactionID, err := primitive.ObjectIDFromHex(interactionParam)
+		if err != nil {
+			return data, "Invalid interaction ID", nil
+		}
+		filter := bson.M{"_id": interactionID, "companyID": companyID}
+		if !customerID.IsZero() {
+			filter["customerID"] = customerID
+		}
+		var interaction models.Interaction
+		err = interactionCollection.FindOne(ctx, filter).Decode(&interaction)
+		if err == mongo.ErrNoDocuments {
+			return data, "Interaction not found", nil
+		}
+		if err != nil {
+			return data, "", err
+		}
+		data.Interaction = emailInteraction{
+			ID:          interaction.ID.Hex(),
+			Type:        interaction.Type,
+			Status:      interaction.Status,
+			Subject:     interaction.Subject,
+			Description: interaction.Description,
+			Priority:    interaction.Priority,
+			Category:    interaction.Category,
+			ScheduledAt: interaction.ScheduledAt,
+			DueAt:       interaction.DueAt,
+			CreatedAt:   interaction.CreatedAt,
+		}
+	}
+	return data, "", nil
+}
+
+// sampleEmailTemplateData fills every field, so that templates can be checked and previewed
+// without real records.
+func sampleEmailTemplateData() emailTemplateData {
+	now := time.Now()
+	return emailTemplateData{
+		Customer: emailCustomer{
+			ID: primitive.NilObjectID.Hex(), CustomerID: "CUST-0001", FirstName: "Jane", LastName: "Doe", Name: "Jane Doe",
+			Email: "jane.doe@example.com", Phone: "+1 555 0100", Status: "CUSTOMER", Company: "Example Ltd",
+		},
+		User:    emailUser{FirstName: "Alex", LastName: "Smith", Name: "Alex Smith", Email: "alex.smith@example.com", Phone: "+1 555 0199"},
+		Company: emailCompany{ID: primitive.NilObjectID.Hex(), Name: "Example Company"},
+		Interaction: emailInteraction{
+			ID: primitive.NilObjectID.Hex(), Type: "TICKET", Status: "OPEN", Subject: "Cannot log in",
+			Description: "I get an error when I sign in.", Priority: "NORMAL", Category: "Access",
+			ScheduledAt: now, DueAt: now, CreatedAt: now,
+		},
+		UnsubscribeURL: helper.PublicURL("/u/sample"),
+	}
+}
+
+// validateEmailTemplate checks a template or layout and fills in defaults. Templates are
+// rendered against sample data, so that unknown fields are reported when saving rather than
+// when sending. It returns an error message if the template is not valid.
+func validateEmailTemplate(ctx context.Context, tmpl *models.EmailTemplate) string {
+	if tmpl.Type == "" {
+		tmpl.Type = "TEMPLATE"
+	}
+	if validationErr := validate.Struct(tmpl); validationErr != nil {
+		return validationErr.Error()
+	}
+	if tmpl.TextBody == "" && tmpl.HTMLBody == "" {
+		return "A text_body or html_body is required"
+	}
+
+	if tmpl.Type == "LAYOUT" {
+		tmpl.Subject = ""
+		tmpl.LayoutID = primitive.NilObjectID
+		if err := helper.CheckEmailLayout(helper.EmailContent{Text: tmpl.TextBody, HTML: tmpl.HTMLBody}); err != nil {
+			return err.Error()
+		}
+		return ""
+	}
+
+	if strings.TrimSpace(tmpl.Subject) == "" {
+		return "A subject is required"
+	}
+	if !tmpl.LayoutID.IsZero() {
+		count, err := emailTemplateCollection.CountDocuments(ctx, bson.M{"_id": tmpl.LayoutID, "companyID": tmpl.CompanyID, "type": "LAYOUT"})
+		if err != nil || count == 0 {
+			return "Layout not found"
+		}
+	}
+	if _, err := renderEmailTemplate(ctx, *tmpl, sampleEmailTemplateData()); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+// loadEmailTemplate finds the template named by the template_id parameter and checks the
+// caller is staff of its company. It writes the error response itself and returns false if the
+// request should stop.
+func loadEmailTemplate(ctx context.Context, c *gin.Context) (models.EmailTemplate, bool) {
+	var tmpl models.EmailTemplate
+	templateID, err := primitive.ObjectIDFromHex(c.Param("template_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template ID"})
+		return tmpl, false
+	}
+	if err := emailTemplateCollection.FindOne(ctx, bson.M{"_id": templateID}).Decode(&tmpl); err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Email template not found"})
+			return tmpl, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving email template"})
+		return tmpl, false
+	}
+	if isCustomerToken(c) || !checkUserAccessToCompany(c.GetString("uid"), tmpl.CompanyID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+		return tmpl, false
+	}
+	return tmpl, true
+}
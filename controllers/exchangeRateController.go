@@ -0,0 +1,199 @@
+package controllers
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SiddharthaKR/golang-jwt-project/database"
+	helper "github.com/SiddharthaKR/golang-jwt-project/helpers"
+	"github.com/SiddharthaKR/golang-jwt-project/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var exchangeRateCollection *mongo.Collection = database.OpenCollection(database.Client, "exchange_rate")
+
+// CreateExchangeRate stores a single rate. Requires an ADMIN token.
+func CreateExchangeRate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := helper.CheckUserType(c, "ADMIN"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var rate models.ExchangeRate
+		if err := c.BindJSON(&rate); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(rate); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+		if !helper.IsValidCurrency(rate.Base) || !helper.IsValidCurrency(rate.Quote) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported currency code"})
+			return
+		}
+
+		rate.ID = primitive.NewObjectID()
+		rate.Source = "MANUAL"
+		rate.CreatedAt = time.Now()
+
+		if err := upsertExchangeRate(ctx, rate); err != nil {
+			log.Println("Error saving exchange rate:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while saving exchange rate"})
+			return
+		}
+
+		c.JSON(http.StatusOK, rate)
+	}
+}
+
+// ImportExchangeRates loads rates from an uploaded CSV file with the columns
+// base,quote,rate,effective_date. Requires an ADMIN token.
+func ImportExchangeRates() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := helper.CheckUserType(c, "ADMIN"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		fileHeader, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A CSV file is required in the 'file' field"})
+			return
+		}
+		file, err := fileHeader.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unable to read uploaded file"})
+			return
+		}
+		defer file.Close()
+
+		reader := csv.NewReader(file)
+		reader.FieldsPerRecord = 4
+		reader.TrimLeadingSpace = true
+
+		imported := 0
+		var rowErrors []string
+		for line := 1; ; line++ {
+			record, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				rowErrors = append(rowErrors, err.Error())
+				continue
+			}
+			if line == 1 && strings.EqualFold(record[0], "base") {
+				continue
+			}
+
+			rate, err := parseExchangeRateRecord(record)
+			if err != nil {
+				rowErrors = append(rowErrors, fmt.Sprintf("line %d: %s", line, err.Error()))
+				continue
+			}
+			if err := upsertExchangeRate(ctx, rate); err != nil {
+				log.Println("Error saving exchange rate:", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while saving exchange rates"})
+				return
+			}
+			imported++
+		}
+
+		c.JSON(http.StatusOK, gin.H{"imported": imported, "errors": rowErrors})
+	}
+}
+
+// GetExchangeRates lists stored rates, optionally filtered by base and quote currency.
+func GetExchangeRates() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		filter := bson.M{}
+		if base := c.Query("base"); base != "" {
+			filter["base"] = strings.ToUpper(base)
+		}
+		if quote := c.Query("quote"); quote != "" {
+			filter["quote"] = strings.ToUpper(quote)
+		}
+
+		opts := options.Find().SetSort(bson.D{{Key: "base", Value: 1}, {Key: "quote", Value: 1}, {Key: "effective_date", Value: -1}})
+		cursor, err := exchangeRateCollection.Find(ctx, filter, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while listing exchange rates"})
+			return
+		}
+		defer cursor.Close(ctx)
+
+		rates := []models.ExchangeRate{}
+		if err = cursor.All(ctx, &rates); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while decoding exchange rates"})
+			return
+		}
+
+		c.JSON(http.StatusOK, rates)
+	}
+}
+
+func parseExchangeRateRecord(record []string) (models.ExchangeRate, error) {
+	var rate models.ExchangeRate
+
+	rate.Base = strings.ToUpper(strings.TrimSpace(record[0]))
+	rate.Quote = strings.ToUpper(strings.TrimSpace(record[1]))
+	if !helper.IsValidCurrency(rate.Base) || !helper.IsValidCurrency(rate.Quote) {
+		return rate, fmt.Errorf("unsupported currency pair %s/%s", rate.Base, rate.Quote)
+	}
+
+	value, err := strconv.ParseFloat(strings.TrimSpace(record[2]), 64)
+	if err != nil || value <= 0 {
+		return rate, fmt.Errorf("invalid rate %q", record[2])
+	}
+	rate.Rate = value
+
+	dateField := strings.TrimSpace(record[3])
+	effective, err := time.Parse("2006-01-02", dateField)
+	if err != nil {
+		effective, err = time.Parse(time.RFC3339, dateField)
+		if err != nil {
+			return rate, fmt.Errorf("invalid effective_date %q", record[3])
+		}
+	}
+	rate.EffectiveDate = effective
+
+	rate.ID = primitive.NewObjectID()
+	rate.Source = "IMPORT"
+	rate.CreatedAt = time.Now()
+	return rate, nil
+}
+
+// upsertExchangeRate replaces any existing rate for the same pair and effective date.
+func upsertExchangeRate(ctx context.Context, rate models.ExchangeRate) error {
+	filter := bson.M{"base": rate.Base, "quote": rate.Quote, "effective_date": rate.EffectiveDate}
+	update := bson.M{
+		"$set": bson.M{"rate": rate.Rate, "source": rate.Source},
+		"$setOnInsert": bson.M{
+			"_id":        rate.ID,
+			"created_at": rate.CreatedAt,
+		},
+	}
+	_, err := exchangeRateCollection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	return err
+}
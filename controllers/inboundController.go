@@ -0,0 +1,463 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/mail"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SiddharthaKR/golang-jwt-project/database"
+	"github.com/SiddharthaKR/golang-jwt-project/events"
+	helper "github.com/SiddharthaKR/golang-jwt-project/helpers"
+	"github.com/SiddharthaKR/golang-jwt-project/inbound"
+	"github.com/SiddharthaKR/golang-jwt-project/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var inboundEmailCollection *mongo.Collection = database.OpenCollection(database.Client, "inbound_email")
+
+// defaultInboundMaxBytes is used when INBOUND_EMAIL_MAX_BYTES is not set.
+const defaultInboundMaxBytes = 25 << 20
+
+// ticketTokenPattern finds the token that ticketSubjectToken puts into email subjects.
+var ticketTokenPattern = regexp.MustCompile(`\[Ticket #([0-9a-fA-F]{24})\]`)
+
+// InboundMaxBytes is the largest inbound email accepted, configurable with INBOUND_EMAIL_MAX_BYTES.
+func InboundMaxBytes() int64 {
+	if limit, err := strconv.ParseInt(os.Getenv("INBOUND_EMAIL_MAX_BYTES"), 10, 64); err == nil && limit > 0 {
+		return limit
+	}
+	return defaultInboundMaxBytes
+}
+
+// ticketSubjectToken returns the token that threads an email reply back onto a ticket.
+func ticketSubjectToken(ticketID primitive.ObjectID) string {
+	return "[Ticket #" + ticketID.Hex() + "]"
+}
+
+// HandleInboundEmail ingests a message received by the SMTP listener. Only failures worth
+// a retry by the sending server are returned; rejected messages are recorded and dropped.
+func HandleInboundEmail(from string, to []string, data []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	record, err := ingestInboundEmail(ctx, to, data)
+	if err != nil {
+		return err
+	}
+	log.Printf("Inbound email from %s to %v: %s %s", from, to, record.Status, record.Detail)
+	return nil
+}
+
+// ReceiveInboundEmail accepts a raw RFC 822 message as the request body, for mail services
+// that forward inbound mail over HTTP. The caller authenticates with the INBOUND_EMAIL_TOKEN
+// in the X-Inbound-Token header; the endpoint is disabled while that is unset. The recipient
+// query parameter (repeatable) gives the envelope recipients; without it the To and Cc
+// headers are used.
+func ReceiveInboundEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := os.Getenv("INBOUND_EMAIL_TOKEN")
+		given := c.GetHeader("X-Inbound-Token")
+		if token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(given)) != 1 {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Invalid inbound email token"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		maxBytes := InboundMaxBytes()
+		data, err := ioutil.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes))
+		if err != nil {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Message exceeds the size limit of " + strconv.FormatInt(maxBytes, 10) + " bytes"})
+			return
+		}
+
+		var recipients []string
+		for _, recipient := range c.QueryArray("recipient") {
+			recipients = append(recipients, strings.ToLower(strings.TrimSpace(recipient)))
+		}
+		record, err := ingestInboundEmail(ctx, recipients, data)
+		if err != nil {
+			log.Println("Error ingesting inbound email:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while ingesting email"})
+			return
+		}
+
+		c.JSON(http.StatusOK, record)
+	}
+}
+
+// GetInboundEmails lists received emails and what became of them, newest first. Filters:
+// status and company_id. Paging: page and recordPerPage. ADMIN only.
+func GetInboundEmails() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := helper.CheckUserType(c, "ADMIN"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		filter := bson.M{}
+		if status := c.Query("status"); status != "" {
+			filter["status"] = status
+		}
+		if companyParam := c.Query("company_id"); companyParam != "" {
+			companyID, err := primitive.ObjectIDFromHex(companyParam)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+				return
+			}
+			filter["companyID"] = companyID
+		}
+		recordPerPage, err := strconv.Atoi(c.Query("recordPerPage"))
+		if err != nil || recordPerPage < 1 {
+			recordPerPage = 10
+		}
+		page, err := strconv.Atoi(c.Query("page"))
+		if err != nil || page < 1 {
+			page = 1
+		}
+
+		total, err := inboundEmailCollection.CountDocuments(ctx, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving inbound emails"})
+			return
+		}
+		cursor, err := inboundEmailCollection.Find(ctx, filter, options.Find().
+			SetSort(bson.D{{Key: "received_at", Value: -1}, {Key: "_id", Value: -1}}).
+			SetSkip(int64((page-1)*recordPerPage)).
+			SetLimit(int64(recordPerPage)))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving inbound emails"})
+			return
+		}
+		emails := []models.InboundEmail{}
+		if err := cursor.All(ctx, &emails); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while decoding inbound emails"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"total_count": total, "emails": emails})
+	}
+}
+
+// ingestInboundEmail turns an email into a ticket, or into a reply on the ticket it answers,
+// and records the outcome. The recipients decide the company and the sender must be one of
+// its customers. The error is only set when the email should be offered again later.
+func ingestInboundEmail(ctx context.Context, recipients []string, raw []byte) (models.InboundEmail, error) {
+	record := models.InboundEmail{ID: primitive.NewObjectID(), To: recipients, ReceivedAt: time.Now()}
+	save := func(status string, detail string) (models.InboundEmail, error) {
+		record.Status, record.Detail = status, detail
+		_, err := inboundEmailCollection.InsertOne(ctx, record)
+		return record, err
+	}
+
+	msg, err := inbound.Parse(raw)
+	if err != nil {
+		return save("INVALID", err.Error())
+	}
+	record.MessageID = msg.MessageID
+	record.From = msg.From.Address
+	record.Subject = msg.Subject
+	if len(record.To) == 0 {
+		record.To = msg.Recipients()
+	}
+
+	if msg.MessageID != "" {
+		count, err := inboundEmailCollection.CountDocuments(ctx, bson.M{
+			"message_id": msg.MessageID,
+			"status":     bson.M{"$in": bson.A{"TICKET_CREATED", "REPLY_ADDED"}},
+		})
+		if err != nil {
+			return record, err
+		}
+		if count > 0 {
+			return save("DUPLICATE", "")
+		}
+	}
+	if msg.AutoReply {
+		return save("AUTO_REPLY", "")
+	}
+
+	company, err := inboundCompany(ctx, record.To)
+	if err == mongo.ErrNoDocuments {
+		return save("UNKNOWN_RECIPIENT", "")
+	}
+	if err != nil {
+		return record, err
+	}
+	record.CompanyID = company.ID
+
+	var customer models.Customer
+	err = customerCollection.FindOne(ctx, bson.M{
+		"companyID": company.ID,
+		"email":     primitive.Regex{Pattern: "^" + regexp.QuoteMeta(msg.From.Address) + "$", Options: "i"},
+	}).Decode(&customer)
+	if err == mongo.ErrNoDocuments {
+		return save("UNKNOWN_SENDER", "")
+	}
+	if err != nil {
+		return record, err
+	}
+	record.CustomerID = customer.ID
+	// Logged once the email has been filed; an email offered again is not logged twice
+	logEmail := func() {
+		email := loggedEmail{
+			Direction:  "INBOUND",
+			From:       msg.From.Address,
+			To:         record.To,
+			Subject:    msg.Subject,
+			Text:       msg.Text,
+			HTML:       msg.HTML,
+			MessageID:  msg.MessageID,
+			InReplyTo:  msg.InReplyTo,
+			References: msg.References,
+			UserID:     customer.ID,
+			At:         record.ReceivedAt,
+		}
+		if err := logEmailInteraction(ctx, customer, email); err != nil {
+			log.Println("Error logging inbound email on customer", customer.ID.Hex(), ":", err)
+		}
+	}
+
+	ticket, err := findInboundTicket(ctx, company.ID, customer.ID, msg)
+	if err == mongo.ErrNoDocuments {
+		ticket, err = createInboundTicket(ctx, company.ID, customer.ID, msg)
+		if err != nil {
+			return record, err
+		}
+		record.TicketID = ticket.ID
+		record.Attachments = len(storeInboundAttachments(ctx, ticket, primitive.NilObjectID, customer.ID, msg))
+		logEmail()
+		return save("TICKET_CREATED", "")
+	}
+	if err != nil {
+		return record, err
+	}
+
+	message := models.TicketMessage{
+		ID:         primitive.NewObjectID(),
+		TicketID:   ticket.ID,
+		CompanyID:  ticket.CompanyID,
+		CustomerID: ticket.CustomerID,
+		AuthorID:   customer.ID,
+		AuthorType: "CUSTOMER",
+		AuthorName: inboundAuthorName(msg, customer),
+		Visibility: "PUBLIC",
+		Body:       inbound.StripQuotedReply(msg.Body()),
+		MessageID:  msg.MessageID,
+		CreatedAt:  time.Now(),
+	}
+	if message.Body == "" {
+		message.Body = "(no text)"
+	}
+	message.Attachments = storeInboundAttachments(ctx, ticket, message.ID, customer.ID, msg)
+	if _, err := ticketMessageCollection.InsertOne(ctx, message); err != nil {
+		return record, err
+	}
+	afterTicketMessage(ctx, ticket, message, customer.ID.Hex())
+
+	record.TicketID = ticket.ID
+	record.TicketMessageID = message.ID
+	record.Attachments = len(message.Attachments)
+	logEmail()
+	return save("REPLY_ADDED", "")
+}
+
+// inboundCompany finds the company an email was sent to: either a company listing one of the
+// recipients in its inbound_emails, or the company whose ID follows the "+" of a recipient such
+// as support+<company_id>@example.com on the INBOUND_EMAIL_DOMAIN.
+func inboundCompany(ctx context.Context, recipients []string) (models.Company, error) {
+	var company models.Company
+	if len(recipients) == 0 {
+		return company, mongo.ErrNoDocuments
+	}
+	addresses := bson.A{}
+	for _, recipient := range recipients {
+		addresses = append(addresses, strings.ToLower(recipient))
+	}
+	err := companyCollection.FindOne(ctx, bson.M{"inbound_emails": bson.M{"$in": addresses}}).Decode(&company)
+	if err != mongo.ErrNoDocuments {
+		return company, err
+	}
+
+	domain := strings.ToLower(os.Getenv("INBOUND_EMAIL_DOMAIN"))
+	for _, recipient := range recipients {
+		at := strings.LastIndexByte(recipient, '@')
+		plus := strings.IndexByte(recipient, '+')
+		if at < 0 || plus < 0 || plus > at || (domain != "" && strings.ToLower(recipient[at+1:]) != domain) {
+			continue
+		}
+		companyID, err := primitive.ObjectIDFromHex(recipient[plus+1 : at])
+		if err != nil {
+			continue
+		}
+		err = companyCollection.FindOne(ctx, bson.M{"_id": companyID}).Decode(&company)
+		if err != mongo.ErrNoDocuments {
+			return company, err
+		}
+	}
+	return company, mongo.ErrNoDocuments
+}
+
+// findInboundTicket finds the open ticket an email answers, from the ticket token in its
+// subject or from the messages named in its In-Reply-To and References headers. Only tickets
+// of the sending customer count, and closed tickets are not reopened by email.
+func findInboundTicket(ctx context.Context, companyID primitive.ObjectID, customerID primitive.ObjectID, msg *inbound.Message) (models.Interaction, error) {
+	var ticket models.Interaction
+	filter := bson.M{"type": "TICKET", "companyID": companyID, "customerID": customerID, "status": bson.M{"$ne": "CLOSED"}}
+
+	if match := ticketTokenPattern.FindStringSubmatch(msg.Subject); match != nil {
+		if ticketID, err := primitive.ObjectIDFromHex(match[1]); err == nil {
+			filter["_id"] = ticketID
+			err := interactionCollection.FindOne(ctx, filter).Decode(&ticket)
+			if err != mongo.ErrNoDocuments {
+				return ticket, err
+			}
+			delete(filter, "_id")
+		}
+	}
+
+	references := bson.A{}
+	for _, id := range append(append([]string{}, msg.InReplyTo...), msg.References...) {
+		references = append(references, id)
+	}
+	if len(references) == 0 {
+		return ticket, mongo.ErrNoDocuments
+	}
+	var ticketIDs bson.A
+	var earlier models.TicketMessage
+	err := ticketMessageCollection.FindOne(ctx, bson.M{"companyID": companyID, "message_id": bson.M{"$in": references}},
+		options.FindOne().SetSort(bson.M{"created_at": -1})).Decode(&earlier)
+	if err == nil {
+		ticketIDs = append(ticketIDs, earlier.TicketID)
+	} else if err != mongo.ErrNoDocuments {
+		return ticket, err
+	}
+	filter["$or"] = bson.A{
+		bson.M{"message_id": bson.M{"$in": references}},
+		bson.M{"_id": bson.M{"$in": append(ticketIDs, primitive.NilObjectID)}},
+	}
+	err = interactionCollection.FindOne(ctx, filter, options.FindOne().SetSort(bson.M{"created_at": -1})).Decode(&ticket)
+	return ticket, err
+}
+
+// createInboundTicket raises a ticket for the customer the same way RaiseTicket does.
+func createInboundTicket(ctx context.Context, companyID primitive.ObjectID, customerID primitive.ObjectID, msg *inbound.Message) (models.Interaction, error) {
+	ticket := models.Interaction{
+		ID:          primitive.NewObjectID(),
+		CustomerID:  customerID,
+		UserID:      customerID,
+		CompanyID:   companyID,
+		Type:        "TICKET",
+		Status:      "NEW",
+		Priority:    "NORMAL",
+		Subject:     msg.Subject,
+		Description: msg.Body(),
+		MessageID:   msg.MessageID,
+		Direction:   "INBOUND",
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+	if ticket.Description == "" {
+		ticket.Description = msg.Subject
+	}
+	if _, err := interactionCollection.InsertOne(ctx, ticket); err != nil {
+		return ticket, err
+	}
+	if err := applySLAPolicy(ctx, ticket); err != nil {
+		log.Println("Error applying SLA policy to ticket:", err)
+	}
+	publishInteractionEvent(ctx, events.InteractionCreated, ticket)
+	return ticket, nil
+}
+
+// storeInboundAttachments stores the attachments of an email as attachments of the ticket and,
+// when messageID is set, of that ticket message. Files over the attachment size limit are skipped.
+func storeInboundAttachments(ctx context.Context, ticket models.Interaction, messageID primitive.ObjectID, customerID primitive.ObjectID, msg *inbound.Message) []models.MessageAttachment {
+	stored := []models.MessageAttachment{}
+	maxBytes := attachmentMaxBytes()
+	for _, file := range msg.Attachments {
+		if int64(len(file.Data)) > maxBytes {
+			log.Printf("Skipping inbound attachment %s of %d bytes", file.FileName, len(file.Data))
+			continue
+		}
+		attachment := models.Attachment{
+			ID:         primitive.NewObjectID(),
+			CompanyID:  ticket.CompanyID,
+			TargetType: "INTERACTION",
+			TargetID:   ticket.ID,
+			MessageID:  messageID,
+			FileName:   file.FileName,
+			Size:       int64(len(file.Data)),
+			UploadedBy: customerID,
+			CreatedAt:  time.Now(),
+		}
+		attachment.StorageKey = ticket.CompanyID.Hex() + "/" + attachment.ID.Hex()
+		if err := storeAttachmentContent(ctx, bytes.NewReader(file.Data), &attachment); err != nil {
+			log.Println("Error storing inbound attachment:", err)
+			continue
+		}
+		if _, err := attachmentCollection.InsertOne(ctx, attachment); err != nil {
+			log.Println("Error saving inbound attachment:", err)
+			continue
+		}
+		stored = append(stored, models.MessageAttachment{
+			AttachmentID: attachment.ID,
+			FileName:     attachment.FileName,
+			ContentType:  attachment.ContentType,
+			Size:         attachment.Size,
+		})
+	}
+	return stored
+}
+
+func inboundAuthorName(msg *inbound.Message, customer models.Customer) string {
+	if customer.FirstName != nil && customer.LastName != nil {
+		return strings.TrimSpace(*customer.FirstName + " " + *customer.LastName)
+	}
+	if msg.From.Name != "" {
+		return msg.From.Name
+	}
+	return msg.From.Address
+}
+
+// normalizeInboundEmails lower-cases and checks the inbound addresses of a company.
+// It returns an error message if one is invalid or already used by another company.
+func normalizeInboundEmails(ctx context.Context, companyID primitive.ObjectID, addresses []string) ([]string, string) {
+	var normalized []string
+	for _, address := range addresses {
+		parsed, err := mail.ParseAddress(address)
+		if err != nil {
+			return nil, fmt.Sprintf("Invalid inbound email %q", address)
+		}
+		normalized = append(normalized, strings.ToLower(parsed.Address))
+	}
+	if len(normalized) == 0 {
+		return normalized, ""
+	}
+	var other models.Company
+	err := companyCollection.FindOne(ctx, bson.M{"_id": bson.M{"$ne": companyID}, "inbound_emails": bson.M{"$in": normalized}}).Decode(&other)
+	if err == nil {
+		return nil, "An inbound email is already used by another company"
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, "Error occurred while checking inbound emails"
+	}
+	return normalized, ""
+}
@@ -2,10 +2,13 @@ package controllers
 
 import (
 	"context"
+	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/SiddharthaKR/golang-jwt-project/database"
+	"github.com/SiddharthaKR/golang-jwt-project/events"
 	helper "github.com/SiddharthaKR/golang-jwt-project/helpers"
 	"github.com/SiddharthaKR/golang-jwt-project/models"
 	"github.com/gin-gonic/gin"
@@ -58,81 +61,38 @@ func CreateLead() gin.HandlerFunc {
 	}
 }
 
-func CreateMeeting() gin.HandlerFunc {
+func UpdateInteractionStatus() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
 
-		var interaction models.Interaction
-
-		// Bind JSON request to interaction model
-		if err := c.BindJSON(&interaction); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
-		}
-
-		// Ensure CustomerID, UserID, and CompanyID are valid ObjectIDs
-		customerID, err := primitive.ObjectIDFromHex(interaction.CustomerID.Hex())
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Customer ID"})
-			return
-		}
-
-		userID := c.GetString("uid")
-		userObjID, err := primitive.ObjectIDFromHex(userID)
+		// Convert interactionID to ObjectID
+		interactionObjectID, err := primitive.ObjectIDFromHex(c.Param("interaction_id"))
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid User ID"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Interaction ID"})
 			return
 		}
-		interaction.UserID = userObjID
-
-		// Get the company ID from the request parameters
-        companyIDParam := c.Param("company_id")
-        companyID, err := primitive.ObjectIDFromHex(companyIDParam)
-        if err != nil {
-            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Company ID"})
-            return
-        }
 
-		// Check if the CompanyID exists
-		var company models.Company
-		err = companyCollection.FindOne(ctx, bson.M{"_id": companyID}).Decode(&company)
-		if err != nil {
+		var existing models.Interaction
+		if err := interactionCollection.FindOne(ctx, bson.M{"_id": interactionObjectID}).Decode(&existing); err != nil {
 			if err == mongo.ErrNoDocuments {
-				c.JSON(http.StatusNotFound, gin.H{"error": "Company not found"})
+				c.JSON(http.StatusNotFound, gin.H{"error": "Interaction not found"})
 				return
 			}
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while checking company"})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving interaction"})
 			return
 		}
 
-		interaction.CustomerID = customerID
-		interaction.CompanyID = companyID
-		interaction.ID = primitive.NewObjectID()
-		interaction.CreatedAt = time.Now()
-		interaction.UpdatedAt = time.Now()
- 
-		result, err := interactionCollection.InsertOne(ctx, interaction)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while creating interaction"})
+		// Only staff of the interaction's company, or the owning customer of a ticket, may change it
+		if !authorizeInteraction(c, existing) || (isCustomerToken(c) && !customerVisible(existing)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this interaction"})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"message": "Meeting created successfully", "interaction_id": result.InsertedID})
-	}
-}
-
-
-func UpdateInteractionStatus() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		interactionID := c.Param("interaction_id")
-
-		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
-		defer cancel()
-
 		// Define a struct to bind the request body
 		var requestBody struct {
-			Status string `json:"status" validate:"required,oneof=OPEN RESOLVED"`
+			Status string `json:"status" validate:"required"`
+			Reason string `json:"reason"` // For meeting cancellations
 		}
 
 		// Bind JSON request to requestBody struct
@@ -141,17 +101,48 @@ func UpdateInteractionStatus() gin.HandlerFunc {
 			return
 		}
 
-		// Validate status
+		// Validate status against the statuses allowed for the interaction's type
 		status := requestBody.Status
-		if status != "OPEN" && status != "RESOLVED" {
+		if !containsString(models.InteractionStatuses[existing.Type], status) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
 			return
 		}
 
-		// Convert interactionID to ObjectID
-		interactionObjectID, err := primitive.ObjectIDFromHex(interactionID)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Interaction ID"})
+		// Cancelling a meeting records it in its history and tells the attendees, as CancelMeeting does
+		if existing.Type == "MEETING" && status == "CANCELLED" {
+			if !containsString(models.ActiveMeetingStatuses, existing.Status) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Only scheduled meetings can be cancelled"})
+				return
+			}
+			if existing.RRule != "" {
+				cancelMeetingSeries(ctx, c, existing, meetingEditRequest{Scope: "series", Reason: requestBody.Reason})
+				return
+			}
+			cancelSingleMeeting(ctx, c, existing, requestBody.Reason)
+			return
+		}
+
+		// Tickets follow their lifecycle; customers may only resolve, close or reopen their own tickets
+		if existing.Type == "TICKET" {
+			if isCustomerToken(c) && status != "RESOLVED" && status != "CLOSED" && !(status == "OPEN" && existing.Status == "RESOLVED") {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Customers may only resolve, close or reopen a ticket"})
+				return
+			}
+			if err := changeTicketStatus(ctx, existing, status, c.GetString("uid")); err != nil {
+				if err == errInvalidTicketTransition {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "Ticket cannot move from " + existing.Status + " to " + status})
+					return
+				}
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while updating interaction"})
+				return
+			}
+			// Any status change by staff counts as the first response
+			if !isCustomerToken(c) {
+				markFirstResponse(ctx, existing.ID)
+			} else {
+				refreshTicketSLA(ctx, existing.ID)
+			}
+			c.JSON(http.StatusOK, gin.H{"message": "Interaction status updated successfully"})
 			return
 		}
 
@@ -171,6 +162,7 @@ func UpdateInteractionStatus() gin.HandlerFunc {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Interaction not found"})
 			return
 		}
+		publishInteractionEvent(ctx, events.InteractionUpdated, existing)
 
 		c.JSON(http.StatusOK, gin.H{"message": "Interaction status updated successfully"})
 	}
@@ -189,8 +181,13 @@ func GetCustomerInteractions() gin.HandlerFunc {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
 
+		filter := bson.M{"customerID": customerID}
+		if interactionType := c.Query("type"); interactionType != "" {
+			filter["type"] = interactionType
+		}
+
 		var interactions []models.Interaction
-		cursor, err := interactionCollection.Find(ctx, bson.M{"customerID": customerID})
+		cursor, err := interactionCollection.Find(ctx, filter)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving interactions"})
 			return
@@ -207,57 +204,98 @@ func GetCustomerInteractions() gin.HandlerFunc {
 }
 
 
+// RaiseTicket lets a customer raise a ticket with a company they belong to. Only the subject,
+// description, priority and category come from the request; everything else is set here.
 func RaiseTicket() gin.HandlerFunc {
     return func(c *gin.Context) {
         var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
         defer cancel()
 
-        var interaction models.Interaction
+        if !isCustomerToken(c) {
+            c.JSON(http.StatusForbidden, gin.H{"error": "Only customers can raise tickets"})
+            return
+        }
 
-        // Bind JSON request to interaction model
-        if err := c.BindJSON(&interaction); err != nil {
+        var requestBody struct {
+            Subject     string `json:"subject"`
+            Description string `json:"description"`
+            Priority    string `json:"priority"`
+            Category    string `json:"category"`
+        }
+        if err := c.BindJSON(&requestBody); err != nil {
             c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
             return
         }
 
         // Get the customer ID from the token (uid)
-        customerID := c.GetString("uid")
-
-        // Convert customer ID to ObjectID
-        customerObjID, err := primitive.ObjectIDFromHex(customerID)
+        customerObjID, err := primitive.ObjectIDFromHex(c.GetString("uid"))
         if err != nil {
             c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Customer ID"})
             return
         }
 
         // Get the company ID from the request parameters
-        companyIDParam := c.Param("company_id")
-        companyID, err := primitive.ObjectIDFromHex(companyIDParam)
+        companyID, err := primitive.ObjectIDFromHex(c.Param("company_id"))
         if err != nil {
             c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Company ID"})
             return
         }
 
-		// Check if the CompanyID exists
-		var company models.Company
-		err = companyCollection.FindOne(ctx, bson.M{"_id": companyID}).Decode(&company)
-		if err != nil {
-			if err == mongo.ErrNoDocuments {
-				c.JSON(http.StatusNotFound, gin.H{"error": "Company not found"})
-				return
-			}
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while checking company"})
-			return
-		}
+        // The customer must belong to the company the ticket is raised with
+        var customer models.Customer
+        err = customerCollection.FindOne(ctx, bson.M{"_id": customerObjID}).Decode(&customer)
+        if err != nil {
+            if err == mongo.ErrNoDocuments {
+                c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+                return
+            }
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while checking customer"})
+            return
+        }
+        if customer.CompanyID != companyID {
+            c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+            return
+        }
 
-        interaction.CustomerID = customerObjID
-        interaction.UserID = customerObjID // Since the customer is raising the ticket
-        interaction.CompanyID = companyID
-        interaction.ID = primitive.NewObjectID()
-        interaction.Type = "TICKET"
-        interaction.Status = "OPEN"
-        interaction.CreatedAt = time.Now()
-        interaction.UpdatedAt = time.Now()
+        if len(requestBody.Subject) > 200 {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "subject must be at most 200 characters"})
+            return
+        }
+        if strings.TrimSpace(requestBody.Subject) == "" && strings.TrimSpace(requestBody.Description) == "" {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "subject or description is required"})
+            return
+        }
+
+        // Priority defaults to NORMAL; category must be one of the company's categories, if it has any
+        priority := requestBody.Priority
+        if priority == "" {
+            priority = "NORMAL"
+        }
+        if !containsString(models.TicketPriorities, priority) {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid priority"})
+            return
+        }
+        if requestBody.Category != "" {
+            if msg := validateTicketCategory(ctx, companyID, requestBody.Category); msg != "" {
+                c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+                return
+            }
+        }
+
+        interaction := models.Interaction{
+            ID:          primitive.NewObjectID(),
+            CustomerID:  customerObjID,
+            UserID:      customerObjID, // Since the customer is raising the ticket
+            CompanyID:   companyID,
+            Type:        "TICKET",
+            Status:      "NEW",
+            Subject:     requestBody.Subject,
+            Description: requestBody.Description,
+            Priority:    priority,
+            Category:    requestBody.Category,
+            CreatedAt:   time.Now(),
+            UpdatedAt:   time.Now(),
+        }
 
         // Insert the ticket into the database
         result, err := interactionCollection.InsertOne(ctx, interaction)
@@ -266,6 +304,12 @@ func RaiseTicket() gin.HandlerFunc {
             return
         }
 
+        // Attach response and resolution targets from the company's SLA policies
+        if err := applySLAPolicy(ctx, interaction); err != nil {
+            log.Println("Error applying SLA policy to ticket:", err)
+        }
+        publishInteractionEvent(ctx, events.InteractionCreated, interaction)
+
         c.JSON(http.StatusOK, gin.H{"message": "Ticket raised successfully", "ticket_id": result.InsertedID})
     }
 }
@@ -314,6 +358,7 @@ func GetInteractionReport() gin.HandlerFunc {
                     }},
                 }},
                 {"count", bson.D{{"$sum", 1}}},
+                {"total_duration_seconds", bson.D{{"$sum", "$duration_seconds"}}},
             }},
         }
 
@@ -388,3 +433,203 @@ func GetConversionRateReport() gin.HandlerFunc {
     }
 }
 
+
+// LogCall records a phone call with a customer.
+func LogCall() gin.HandlerFunc {
+	return logInteraction("CALL", "COMPLETED")
+}
+
+// LogEmail records an email exchanged with a customer outside the CRM.
+func LogEmail() gin.HandlerFunc {
+	return logInteraction("EMAIL", "LOGGED")
+}
+
+// CreateNote records a free-text note against a customer.
+func CreateNote() gin.HandlerFunc {
+	return logInteraction("NOTE", "LOGGED")
+}
+
+// CreateTask records a follow-up task for a customer. The task is assigned to the caller unless an assignee is given.
+func CreateTask() gin.HandlerFunc {
+	return logInteraction("TASK", "OPEN")
+}
+
+// interactionLogRequest holds the fields a caller may set when logging a call, email, note or task.
+// Everything else on an interaction is owned by the server.
+type interactionLogRequest struct {
+	CustomerID      primitive.ObjectID `json:"customer_id"`
+	Status          string             `json:"status"`
+	Description     string             `json:"description"`
+	ScheduledAt     time.Time          `json:"scheduled_at"`     // For scheduled calls
+	Direction       string             `json:"direction"`        // For calls and emails
+	DurationSeconds int                `json:"duration_seconds"` // For calls
+	Outcome         string             `json:"outcome"`          // For calls
+	Subject         string             `json:"subject"`          // For emails
+	MessageID       string             `json:"message_id"`       // For emails
+	From            string             `json:"from"`             // For emails
+	To              []string           `json:"to"`               // For emails
+	DueAt           time.Time          `json:"due_at"`           // For tasks
+	AssigneeID      primitive.ObjectID `json:"assignee_id"`      // For tasks
+}
+
+// logInteraction builds a handler that stores an interaction of the given type for a customer of the company in the URL.
+func logInteraction(interactionType string, defaultStatus string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var requestBody interactionLogRequest
+		if err := c.BindJSON(&requestBody); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		companyID, err := primitive.ObjectIDFromHex(c.Param("company_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Company ID"})
+			return
+		}
+
+		userID := c.GetString("uid")
+		userObjID, err := primitive.ObjectIDFromHex(userID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid User ID"})
+			return
+		}
+		if !checkUserAccessToCompany(userID, companyID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+			return
+		}
+
+		// The customer must belong to the company the interaction is logged against
+		count, err := customerCollection.CountDocuments(ctx, bson.M{"_id": requestBody.CustomerID, "companyID": companyID})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while checking customer"})
+			return
+		}
+		if count == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+			return
+		}
+
+		interaction := models.Interaction{
+			ID:          primitive.NewObjectID(),
+			CustomerID:  requestBody.CustomerID,
+			UserID:      userObjID,
+			CompanyID:   companyID,
+			Type:        interactionType,
+			Status:      requestBody.Status,
+			Description: requestBody.Description,
+			CreatedAt:   time.Now(),
+			UpdatedAt:   time.Now(),
+		}
+		if interaction.Status == "" {
+			interaction.Status = defaultStatus
+		}
+		switch interactionType {
+		case "CALL":
+			interaction.ScheduledAt = requestBody.ScheduledAt
+			interaction.Direction = requestBody.Direction
+			interaction.DurationSeconds = requestBody.DurationSeconds
+			interaction.Outcome = requestBody.Outcome
+		case "EMAIL":
+			interaction.Direction = requestBody.Direction
+			interaction.Subject = requestBody.Subject
+			interaction.MessageID = requestBody.MessageID
+			interaction.From = requestBody.From
+			interaction.To = requestBody.To
+		case "TASK":
+			interaction.DueAt = requestBody.DueAt
+			interaction.AssigneeID = requestBody.AssigneeID
+			if interaction.AssigneeID.IsZero() {
+				interaction.AssigneeID = userObjID
+			} else if !checkUserAccessToCompany(interaction.AssigneeID.Hex(), companyID) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "The assignee does not have access to this company"})
+				return
+			}
+		}
+		if msg := validateInteractionFields(interaction); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+
+		if _, err := interactionCollection.InsertOne(ctx, interaction); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while creating interaction"})
+			return
+		}
+		scheduleInteractionReminder(ctx, interaction, time.Now())
+		publishInteractionEvent(ctx, events.InteractionCreated, interaction)
+
+		c.JSON(http.StatusOK, gin.H{"message": "Interaction created successfully", "interaction_id": interaction.ID})
+	}
+}
+
+// validateInteractionFields applies the per-type rules that struct tags cannot express.
+// It returns an error message, or an empty string if the interaction is valid.
+func validateInteractionFields(interaction models.Interaction) string {
+	if validationErr := validate.Struct(interaction); validationErr != nil {
+		return validationErr.Error()
+	}
+	if !containsString(models.InteractionStatuses[interaction.Type], interaction.Status) {
+		return "Invalid status for " + interaction.Type + " interaction"
+	}
+
+	switch interaction.Type {
+	case "MEETING":
+		if interaction.CustomerID.IsZero() {
+			return "Meeting customer is required"
+		}
+		if interaction.ScheduledAt.IsZero() {
+			return "Meeting start time is required"
+		}
+		if !interaction.EndAt.After(interaction.ScheduledAt) {
+			return "Meeting must end after it starts"
+		}
+		if _, err := time.LoadLocation(interaction.TimeZone); err != nil || interaction.TimeZone == "" {
+			return "Invalid meeting time zone"
+		}
+		if interaction.RRule != "" {
+			if !interaction.SeriesID.IsZero() {
+				return "An occurrence of a recurring meeting cannot recur itself"
+			}
+			if _, err := helper.ParseRRule(interaction.RRule); err != nil {
+				return "Invalid recurrence rule: " + err.Error()
+			}
+		}
+	case "CALL":
+		if interaction.Direction != "INBOUND" && interaction.Direction != "OUTBOUND" {
+			return "Call direction must be INBOUND or OUTBOUND"
+		}
+		if interaction.DurationSeconds < 0 {
+			return "Call duration cannot be negative"
+		}
+		if interaction.Outcome != "" && !containsString(models.CallOutcomes, interaction.Outcome) {
+			return "Invalid call outcome"
+		}
+	case "EMAIL":
+		if interaction.Direction != "INBOUND" && interaction.Direction != "OUTBOUND" {
+			return "Email direction must be INBOUND or OUTBOUND"
+		}
+		if interaction.Subject == "" {
+			return "Email subject is required"
+		}
+	case "NOTE":
+		if interaction.Description == "" {
+			return "Note description is required"
+		}
+	case "TASK":
+		if interaction.DueAt.IsZero() {
+			return "Task due date is required"
+		}
+	}
+	return ""
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	helper "github.com/SiddharthaKR/golang-jwt-project/helpers"
+	"github.com/SiddharthaKR/golang-jwt-project/models"
+	"github.com/SiddharthaKR/golang-jwt-project/scheduler"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// RegisterJobs registers the handlers of all background jobs and creates the recurring ones.
+// slaSchedule is the schedule of the SLA evaluation, e.g. "@every 1m".
+func RegisterJobs(slaSchedule string) {
+	scheduler.Register("sla_evaluation", func(ctx context.Context, job models.Job) error {
+		return EvaluateSLAs(ctx)
+	})
+	scheduler.Register(reminderJobType, sendInteractionReminder)
+	scheduler.Register("customer_rollups", refreshPassedMeetings)
+	scheduler.Register("rollup_repair", repairRollups)
+	scheduler.Register(taskReminderJobType, sendTaskReminder)
+	scheduler.Register(ticketSurveyJobType, sendTicketSurvey)
+	scheduler.Register(scheduledSurveyJobType, sendScheduledSurvey)
+	scheduler.Register(surveyBatchJobType, sendSurveyBatch)
+	scheduler.Register(campaignJobType, sendCampaignBatch)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	recurring := []struct{ name, schedule string }{
+		{"sla_evaluation", slaSchedule},
+		{"customer_rollups", "*/5 * * * *"},
+		{"rollup_repair", "0 3 * * *"},
+	}
+	for _, job := range recurring {
+		if err := scheduler.EnsureRecurring(ctx, job.name, job.name, job.schedule); err != nil {
+			log.Println("Error scheduling job", job.name, ":", err)
+		}
+	}
+}
+
+// GetJobs lists background jobs, optionally filtered by status, type and paused. Requires an ADMIN token.
+func GetJobs() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := helper.CheckUserType(c, "ADMIN"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		filter := bson.M{}
+		if status := c.Query("status"); status != "" {
+			filter["status"] = status
+		}
+		if jobType := c.Query("type"); jobType != "" {
+			filter["type"] = jobType
+		}
+		if paused := c.Query("paused"); paused != "" {
+			filter["paused"] = paused == "true"
+		}
+
+		jobs, err := scheduler.List(ctx, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while listing jobs"})
+			return
+		}
+		c.JSON(http.StatusOK, jobs)
+	}
+}
+
+// GetJob returns a single job by name. Requires an ADMIN token.
+func GetJob() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := helper.CheckUserType(c, "ADMIN"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		job, err := scheduler.Get(ctx, c.Param("name"))
+		respondWithJob(c, job, err)
+	}
+}
+
+// PauseJob stops a job from running until it is resumed. Requires an ADMIN token.
+func PauseJob() gin.HandlerFunc {
+	return setJobPaused(true)
+}
+
+// ResumeJob lets a paused job run again. Requires an ADMIN token.
+func ResumeJob() gin.HandlerFunc {
+	return setJobPaused(false)
+}
+
+func setJobPaused(paused bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := helper.CheckUserType(c, "ADMIN"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		job, err := scheduler.SetPaused(ctx, c.Param("name"), paused)
+		respondWithJob(c, job, err)
+	}
+}
+
+// TriggerJob makes a job due now; it runs on the next poll of the scheduler. Requires an ADMIN token.
+func TriggerJob() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := helper.CheckUserType(c, "ADMIN"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		job, err := scheduler.Trigger(ctx, c.Param("name"))
+		if err == scheduler.ErrRunning {
+			c.JSON(http.StatusConflict, gin.H{"error": "Job is already running"})
+			return
+		}
+		respondWithJob(c, job, err)
+	}
+}
+
+func respondWithJob(c *gin.Context, job models.Job, err error) {
+	if err == scheduler.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while updating job"})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
@@ -0,0 +1,464 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SiddharthaKR/golang-jwt-project/database"
+	"github.com/SiddharthaKR/golang-jwt-project/events"
+	"github.com/SiddharthaKR/golang-jwt-project/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var macroCollection *mongo.Collection = database.OpenCollection(database.Client, "macro")
+
+// maxBulkMacroTickets bounds how many tickets one bulk macro call may change.
+const maxBulkMacroTickets = 100
+
+// macroResult reports how applying a macro to one ticket of a bulk call went.
+type macroResult struct {
+	TicketID string `json:"ticket_id"`
+	Applied  bool   `json:"applied"`
+	Error    string `json:"error,omitempty"`
+}
+
+// CreateMacro adds a macro to a company.
+func CreateMacro() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		companyID, err := primitive.ObjectIDFromHex(c.Param("company_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+			return
+		}
+		userID := c.GetString("uid")
+		if isCustomerToken(c) || !checkUserAccessToCompany(userID, companyID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var macro models.Macro
+		if err := c.BindJSON(&macro); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		macro.CompanyID = companyID
+		if msg := validateMacro(ctx, &macro); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+
+		macro.ID = primitive.NewObjectID()
+		macro.CreatedBy, _ = primitive.ObjectIDFromHex(userID)
+		macro.CreatedAt = time.Now()
+		macro.UpdatedAt = time.Now()
+
+		if _, err := macroCollection.InsertOne(ctx, macro); err != nil {
+			log.Println("Error creating macro:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while creating macro"})
+			return
+		}
+
+		c.JSON(http.StatusOK, macro)
+	}
+}
+
+// GetMacros lists a company's macros by name.
+func GetMacros() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		companyID, err := primitive.ObjectIDFromHex(c.Param("company_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+			return
+		}
+		if isCustomerToken(c) || !checkUserAccessToCompany(c.GetString("uid"), companyID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		cursor, err := macroCollection.Find(ctx, bson.M{"companyID": companyID}, options.Find().SetSort(bson.M{"name": 1}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving macros"})
+			return
+		}
+		macros := []models.Macro{}
+		if err := cursor.All(ctx, &macros); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while decoding macros"})
+			return
+		}
+
+		c.JSON(http.StatusOK, macros)
+	}
+}
+
+// UpdateMacro replaces a macro.
+func UpdateMacro() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		existing, ok := loadMacro(ctx, c)
+		if !ok {
+			return
+		}
+
+		var macro models.Macro
+		if err := c.BindJSON(&macro); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		macro.CompanyID = existing.CompanyID
+		if msg := validateMacro(ctx, &macro); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+
+		macro.ID = existing.ID
+		macro.CreatedBy = existing.CreatedBy
+		macro.CreatedAt = existing.CreatedAt
+		macro.UpdatedAt = time.Now()
+
+		if _, err := macroCollection.ReplaceOne(ctx, bson.M{"_id": existing.ID}, macro); err != nil {
+			log.Println("Error updating macro:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while updating macro"})
+			return
+		}
+
+		c.JSON(http.StatusOK, macro)
+	}
+}
+
+// DeleteMacro removes a macro.
+func DeleteMacro() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		macro, ok := loadMacro(ctx, c)
+		if !ok {
+			return
+		}
+
+		if _, err := macroCollection.DeleteOne(ctx, bson.M{"_id": macro.ID}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while deleting macro"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Macro deleted successfully"})
+	}
+}
+
+// ApplyMacro runs a macro on one ticket and returns the updated ticket.
+func ApplyMacro() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		macro, ok := loadMacro(ctx, c)
+		if !ok {
+			return
+		}
+		ticket, err := findTicket(ctx, c.Param("ticket_id"))
+		if err != nil || ticket.CompanyID != macro.CompanyID {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Ticket not found"})
+			return
+		}
+
+		msg, err := applyMacro(ctx, macro, ticket, agentFromContext(c))
+		if err != nil {
+			log.Println("Error applying macro:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while applying macro"})
+			return
+		}
+		if msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+
+		ticket, err = findTicket(ctx, ticket.ID.Hex())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving ticket"})
+			return
+		}
+		c.JSON(http.StatusOK, ticket)
+	}
+}
+
+// ApplyMacroBulk runs a macro on each of the tickets in ticket_ids, up to 100. A ticket the
+// macro cannot be applied to is reported and skipped; the others are still changed.
+func ApplyMacroBulk() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		macro, ok := loadMacro(ctx, c)
+		if !ok {
+			return
+		}
+
+		var requestBody struct {
+			TicketIDs []string `json:"ticket_ids"`
+		}
+		if err := c.BindJSON(&requestBody); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if len(requestBody.TicketIDs) == 0 || len(requestBody.TicketIDs) > maxBulkMacroTickets {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Give between 1 and " + strconv.Itoa(maxBulkMacroTickets) + " ticket IDs"})
+			return
+		}
+
+		agent := agentFromContext(c)
+		results := []macroResult{}
+		applied := 0
+		for _, ticketIDParam := range requestBody.TicketIDs {
+			result := macroResult{TicketID: ticketIDParam}
+			ticket, err := findTicket(ctx, ticketIDParam)
+			if err != nil || ticket.CompanyID != macro.CompanyID {
+				result.Error = "Ticket not found"
+				results = append(results, result)
+				continue
+			}
+			msg, err := applyMacro(ctx, macro, ticket, agent)
+			if err != nil {
+				log.Println("Error applying macro:", err)
+				msg = "Error occurred while applying macro"
+			}
+			result.Error = msg
+			result.Applied = msg == ""
+			if result.Applied {
+				applied++
+			}
+			results = append(results, result)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"applied_count": applied, "results": results})
+	}
+}
+
+// applyMacro runs the actions of a macro on a ticket: field changes first, then the reply,
+// then the status change, so that a macro can reply and resolve in one step. It checks the
+// whole macro can be applied, including rendering the reply, before changing anything, and
+// returns a message if it cannot.
+func applyMacro(ctx context.Context, macro models.Macro, ticket models.Interaction, agent ticketAgent) (string, error) {
+	set := bson.M{}
+	var tags []string
+	var reply *models.MacroAction
+	status := ""
+	for i, action := range macro.Actions {
+		switch action.Type {
+		case "SET_STATUS":
+			status = action.Value
+		case "SET_PRIORITY":
+			set["priority"] = action.Value
+		case "ASSIGN":
+			assigneeID, _ := primitive.ObjectIDFromHex(action.Value)
+			set["assigneeID"] = assigneeID
+		case "ADD_TAG":
+			tags = append(tags, action.Value)
+		case "POST_REPLY":
+			reply = &macro.Actions[i]
+		}
+	}
+
+	// Work out the status the reply leaves the ticket in, to check the status change against it
+	expected := ticket.Status
+	if reply != nil && reply.Visibility == "PUBLIC" {
+		if ticket.Status == "CLOSED" {
+			return "Ticket is closed", nil
+		}
+		expected = ticketStatusAfterReply(ticket.Status, false)
+	}
+	if status != "" && status != expected && !containsString(models.TicketTransitions[expected], status) {
+		return "Ticket cannot move from " + expected + " to " + status, nil
+	}
+
+	// Assignees are checked again, as they may have lost access since the macro was saved
+	if assigneeID, ok := set["assigneeID"].(primitive.ObjectID); ok && !checkUserAccessToCompany(assigneeID.Hex(), ticket.CompanyID) {
+		return "Assignee no longer has access to this company", nil
+	}
+
+	// The ticket as the field changes leave it, which the reply is rendered against
+	updated := ticket
+	if priority, ok := set["priority"].(string); ok {
+		updated.Priority = priority
+	}
+	if assigneeID, ok := set["assigneeID"].(primitive.ObjectID); ok {
+		updated.AssigneeID = assigneeID
+	}
+	updated.Tags = append([]string(nil), ticket.Tags...)
+	for _, tag := range tags {
+		if !containsString(updated.Tags, tag) {
+			updated.Tags = append(updated.Tags, tag)
+		}
+	}
+
+	// Render and check the reply before anything is changed, so a bad reply changes nothing
+	var message models.TicketMessage
+	if reply != nil {
+		body := reply.Value
+		if !reply.CannedResponseID.IsZero() {
+			var response models.CannedResponse
+			err := cannedResponseCollection.FindOne(ctx, bson.M{"_id": reply.CannedResponseID}).Decode(&response)
+			if err == mongo.ErrNoDocuments {
+				return "The canned response of this macro no longer exists", nil
+			}
+			if err != nil {
+				return "", err
+			}
+			if msg := validateTemplateVariables(response.Body); msg != "" {
+				return msg, nil
+			}
+			body = response.Body
+		}
+		rendered, err := renderTicketTemplate(ctx, body, updated, agent)
+		if err != nil {
+			return "", err
+		}
+		message = models.TicketMessage{
+			ID:         primitive.NewObjectID(),
+			TicketID:   ticket.ID,
+			CompanyID:  ticket.CompanyID,
+			CustomerID: ticket.CustomerID,
+			AuthorType: "USER",
+			AuthorName: strings.TrimSpace(agent.FirstName + " " + agent.LastName),
+			Visibility: reply.Visibility,
+			Body:       strings.TrimSpace(rendered),
+		}
+		message.AuthorID, _ = primitive.ObjectIDFromHex(agent.ID)
+		if validationErr := validate.Struct(message); validationErr != nil {
+			return validationErr.Error(), nil
+		}
+	}
+
+	if len(set) > 0 || len(tags) > 0 {
+		now := time.Now()
+		set["updated_at"] = now
+		update := bson.M{"$set": set}
+		if len(tags) > 0 {
+			update["$addToSet"] = bson.M{"tags": bson.M{"$each": tags}}
+		}
+		if _, err := interactionCollection.UpdateOne(ctx, bson.M{"_id": ticket.ID}, update); err != nil {
+			return "", err
+		}
+		updated.UpdatedAt = now
+		ticket = updated
+		if _, ok := set["priority"]; ok {
+			if err := applySLAPolicy(ctx, ticket); err != nil {
+				log.Println("Error applying SLA policy to ticket:", err)
+			}
+		}
+		publishInteractionEvent(ctx, events.InteractionUpdated, ticket)
+	}
+
+	if reply != nil {
+		message.CreatedAt = time.Now()
+		if _, err := ticketMessageCollection.InsertOne(ctx, message); err != nil {
+			return "", err
+		}
+		afterTicketMessage(ctx, ticket, message, agent.ID)
+		ticket.Status = expected
+	}
+
+	if status != "" && status != ticket.Status {
+		if err := changeTicketStatus(ctx, ticket, status, agent.ID); err != nil {
+			if err == errInvalidTicketTransition {
+				return "Ticket changed while the macro was applied; its status was left unchanged", nil
+			}
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+// validateMacro checks the actions of a macro and fills in defaults. It returns an error
+// message if the macro is not valid.
+func validateMacro(ctx context.Context, macro *models.Macro) string {
+	if validationErr := validate.Struct(macro); validationErr != nil {
+		return validationErr.Error()
+	}
+	seen := map[string]bool{}
+	for i := range macro.Actions {
+		action := &macro.Actions[i]
+		action.Value = strings.TrimSpace(action.Value)
+		if action.Type != "ADD_TAG" && seen[action.Type] {
+			return "A macro may only have one " + action.Type + " action"
+		}
+		seen[action.Type] = true
+
+		switch action.Type {
+		case "SET_STATUS":
+			if !containsString(models.InteractionStatuses["TICKET"], action.Value) {
+				return "Invalid ticket status " + action.Value
+			}
+		case "SET_PRIORITY":
+			if !containsString(models.TicketPriorities, action.Value) {
+				return "Invalid priority " + action.Value
+			}
+		case "ASSIGN":
+			if _, err := primitive.ObjectIDFromHex(action.Value); err != nil {
+				return "Invalid assignee ID"
+			}
+			if !checkUserAccessToCompany(action.Value, macro.CompanyID) {
+				return "Assignee does not have access to this company"
+			}
+		case "ADD_TAG":
+			if action.Value == "" || len(action.Value) > 50 {
+				return "Tags must have between 1 and 50 characters"
+			}
+		case "POST_REPLY":
+			if action.Visibility == "" {
+				action.Visibility = "PUBLIC"
+			}
+			if action.CannedResponseID.IsZero() == (action.Value == "") {
+				return "A reply needs either a value or a canned_response_id"
+			}
+			if !action.CannedResponseID.IsZero() {
+				count, err := cannedResponseCollection.CountDocuments(ctx, bson.M{"_id": action.CannedResponseID, "companyID": macro.CompanyID})
+				if err != nil || count == 0 {
+					return "Canned response not found"
+				}
+			} else if msg := validateTemplateVariables(action.Value); msg != "" {
+				return msg
+			}
+		}
+	}
+	return ""
+}
+
+// loadMacro finds the macro named by the macro_id parameter and checks the caller is staff of
+// its company. It writes the error response itself and returns false if the request should stop.
+func loadMacro(ctx context.Context, c *gin.Context) (models.Macro, bool) {
+	var macro models.Macro
+	macroID, err := primitive.ObjectIDFromHex(c.Param("macro_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid macro ID"})
+		return macro, false
+	}
+	if err := macroCollection.FindOne(ctx, bson.M{"_id": macroID}).Decode(&macro); err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Macro not found"})
+			return macro, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving macro"})
+		return macro, false
+	}
+	if isCustomerToken(c) || !checkUserAccessToCompany(c.GetString("uid"), macro.CompanyID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+		return macro, false
+	}
+	return macro, true
+}
@@ -0,0 +1,77 @@
+package controllers
+
+import (
+	"net/http"
+
+	helper "github.com/SiddharthaKR/golang-jwt-project/helpers"
+	"github.com/SiddharthaKR/golang-jwt-project/mailer"
+	"github.com/gin-gonic/gin"
+)
+
+// GetCapturedEmails lists the messages kept by the memory mail backend, newest first.
+// Filter: to, a recipient address. ADMIN only.
+func GetCapturedEmails() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		capture, ok := loadMemoryMailer(c)
+		if !ok {
+			return
+		}
+		messages := []mailer.CapturedMessage{}
+		to := c.Query("to")
+		for _, message := range capture.Messages() {
+			if to == "" || containsString(message.To, to) {
+				messages = append(messages, message)
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"total_count": len(messages), "messages": messages})
+	}
+}
+
+// GetCapturedEmail returns one captured message, or with ?format=raw the message itself as
+// an .eml file. ADMIN only.
+func GetCapturedEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		capture, ok := loadMemoryMailer(c)
+		if !ok {
+			return
+		}
+		message, found := capture.Get(c.Param("message_id"))
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+			return
+		}
+		if c.Query("format") == "raw" {
+			c.Header("Content-Disposition", `attachment; filename="`+message.ID+`.eml"`)
+			c.Data(http.StatusOK, "message/rfc822", message.Raw)
+			return
+		}
+		c.JSON(http.StatusOK, message)
+	}
+}
+
+// ClearCapturedEmails drops every captured message. ADMIN only.
+func ClearCapturedEmails() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		capture, ok := loadMemoryMailer(c)
+		if !ok {
+			return
+		}
+		capture.Clear()
+		c.JSON(http.StatusOK, gin.H{"message": "Captured emails cleared"})
+	}
+}
+
+// loadMemoryMailer checks the caller is an ADMIN and that mail is being captured in memory.
+// It writes the error response itself and returns false if the request should stop.
+func loadMemoryMailer(c *gin.Context) (*mailer.MemoryMailer, bool) {
+	if err := helper.CheckUserType(c, "ADMIN"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	capture, ok := mailer.Default().(*mailer.MemoryMailer)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Emails are only captured when MAIL_BACKEND is memory"})
+		return nil, false
+	}
+	return capture, true
+}
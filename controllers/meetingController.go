@@ -0,0 +1,541 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/SiddharthaKR/golang-jwt-project/events"
+	helper "github.com/SiddharthaKR/golang-jwt-project/helpers"
+	"github.com/SiddharthaKR/golang-jwt-project/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// defaultMeetingDuration is used when a meeting is created without an end time.
+const defaultMeetingDuration = 30 * time.Minute
+
+// meetingCreateRequest holds the fields a caller may set when creating a meeting. Status,
+// series bookkeeping and history are owned by the server.
+type meetingCreateRequest struct {
+	CustomerID  primitive.ObjectID       `json:"customer_id"`
+	Subject     string                   `json:"subject"`
+	Description string                   `json:"description"`
+	ScheduledAt time.Time                `json:"scheduled_at"`
+	EndAt       time.Time                `json:"end_at"`
+	TimeZone    string                   `json:"time_zone"`
+	Location    string                   `json:"location"`
+	VideoLink   string                   `json:"video_link"`
+	Attendees   []models.MeetingAttendee `json:"attendees"`
+	RRule       string                   `json:"rrule"`
+	ExDates     []time.Time              `json:"exdates"`
+}
+
+// CreateMeeting schedules a meeting with the given customer. The caller is added as an attendee.
+// A meeting with an rrule recurs. Meetings that overlap another meeting of any attendee are
+// rejected with 409 unless allow_conflicts=true is passed.
+func CreateMeeting() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var requestBody meetingCreateRequest
+		if err := c.BindJSON(&requestBody); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		companyID, err := primitive.ObjectIDFromHex(c.Param("company_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Company ID"})
+			return
+		}
+
+		userID := c.GetString("uid")
+		userObjID, err := primitive.ObjectIDFromHex(userID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid User ID"})
+			return
+		}
+		if !checkUserAccessToCompany(userID, companyID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+			return
+		}
+
+		interaction := models.Interaction{
+			CustomerID:  requestBody.CustomerID,
+			Type:        "MEETING",
+			Status:      "SCHEDULED",
+			Subject:     requestBody.Subject,
+			Description: requestBody.Description,
+			ScheduledAt: requestBody.ScheduledAt,
+			EndAt:       requestBody.EndAt,
+			TimeZone:    requestBody.TimeZone,
+			Location:    requestBody.Location,
+			VideoLink:   requestBody.VideoLink,
+			Attendees:   requestBody.Attendees,
+			RRule:       requestBody.RRule,
+			ExDates:     requestBody.ExDates,
+		}
+
+		// The primary customer defaults to the first external attendee
+		if interaction.CustomerID.IsZero() {
+			for _, attendee := range interaction.Attendees {
+				if attendee.Type == "CUSTOMER" {
+					interaction.CustomerID = attendee.ID
+					break
+				}
+			}
+		}
+		interaction.Attendees = append(interaction.Attendees,
+			models.MeetingAttendee{Type: "USER", ID: userObjID},
+			models.MeetingAttendee{Type: "CUSTOMER", ID: interaction.CustomerID},
+		)
+
+		if interaction.TimeZone == "" {
+			interaction.TimeZone = "UTC"
+		}
+		if interaction.EndAt.IsZero() && !interaction.ScheduledAt.IsZero() {
+			interaction.EndAt = interaction.ScheduledAt.Add(defaultMeetingDuration)
+		}
+		if msg := validateInteractionFields(interaction); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+
+		attendees, msg := resolveMeetingAttendees(ctx, companyID, interaction.Attendees)
+		if msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+		interaction.Attendees = attendees
+		if interaction.RRule != "" {
+			interaction.RRule = normalizeRRule(interaction.RRule)
+			interaction.RecurrenceEnd = meetingRecurrenceEnd(interaction)
+		}
+
+		conflicts, err := findMeetingConflicts(ctx, attendees, meetingSlots(interaction), primitive.NilObjectID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while checking for conflicts"})
+			return
+		}
+		if len(conflicts) > 0 && c.Query("allow_conflicts") != "true" {
+			c.JSON(http.StatusConflict, gin.H{"error": "Meeting conflicts with other meetings of its attendees", "conflicts": conflicts})
+			return
+		}
+
+		interaction.UserID = userObjID
+		interaction.CompanyID = companyID
+		interaction.ID = primitive.NewObjectID()
+		interaction.CreatedAt = time.Now()
+		interaction.UpdatedAt = time.Now()
+
+		result, err := interactionCollection.InsertOne(ctx, interaction)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while creating interaction"})
+			return
+		}
+
+		go sendMeetingInvites(interaction, "REQUEST")
+		scheduleInteractionReminder(ctx, interaction, time.Now())
+		publishInteractionEvent(ctx, events.InteractionCreated, interaction)
+
+		c.JSON(http.StatusOK, gin.H{"message": "Meeting created successfully", "interaction_id": result.InsertedID, "conflicts": conflicts})
+	}
+}
+
+// GetMeeting returns a single meeting to its customer or to users with access to its company.
+func GetMeeting() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		meeting, ok := loadMeeting(ctx, c)
+		if !ok {
+			return
+		}
+
+		c.JSON(http.StatusOK, meeting)
+	}
+}
+
+// meetingEditRequest is the body of the reschedule and cancel endpoints. Scope and RecurrenceID
+// choose what to change in a recurring meeting: one occurrence ("this"), that occurrence and
+// all later ones ("following"), or the whole series ("series", the default).
+type meetingEditRequest struct {
+	ScheduledAt  time.Time `json:"scheduled_at"`
+	EndAt        time.Time `json:"end_at"`
+	TimeZone     string    `json:"time_zone"`
+	RRule        string    `json:"rrule"`
+	Scope        string    `json:"scope"`
+	RecurrenceID time.Time `json:"recurrence_id"`
+	Reason       string    `json:"reason"`
+}
+
+// RescheduleMeeting moves a meeting to a new time slot and records the change in its history.
+func RescheduleMeeting() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var requestBody meetingEditRequest
+		if err := c.BindJSON(&requestBody); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		meeting, ok := loadMeeting(ctx, c)
+		if !ok {
+			return
+		}
+		if !containsString(models.ActiveMeetingStatuses, meeting.Status) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Only scheduled meetings can be rescheduled"})
+			return
+		}
+
+		if meeting.RRule != "" {
+			rescheduleMeetingSeries(ctx, c, meeting, requestBody)
+			return
+		}
+		if requestBody.RRule != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Recurrence can only be changed on a recurring meeting"})
+			return
+		}
+		rescheduleSingleMeeting(ctx, c, meeting, requestBody)
+	}
+}
+
+// rescheduleSingleMeeting moves a one-off meeting, or one edited occurrence of a series.
+func rescheduleSingleMeeting(ctx context.Context, c *gin.Context, meeting models.Interaction, requestBody meetingEditRequest) {
+	updated := meeting
+	applyMeetingTimes(&updated, meeting, requestBody)
+	if msg := validateInteractionFields(updated); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	conflicts, err := findMeetingConflicts(ctx, meeting.Attendees, []meetingSlot{{updated.ScheduledAt, updated.EndAt}}, meeting.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while checking for conflicts"})
+		return
+	}
+	if len(conflicts) > 0 && c.Query("allow_conflicts") != "true" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Meeting conflicts with other meetings of its attendees", "conflicts": conflicts})
+		return
+	}
+
+	now := time.Now()
+	change := meetingRescheduleChange(c, meeting, updated, requestBody.Reason, now)
+
+	// Only update the meeting if nobody changed its time in the meantime
+	filter := bson.M{"_id": meeting.ID, "scheduled_at": meeting.ScheduledAt, "status": meeting.Status}
+	update := bson.M{
+		"$set": bson.M{
+			"scheduled_at": updated.ScheduledAt,
+			"end_at":       updated.EndAt,
+			"time_zone":    updated.TimeZone,
+			"updated_at":   now,
+		},
+		"$inc":  bson.M{"sequence": 1},
+		"$push": bson.M{"meeting_history": change},
+	}
+	result, err := interactionCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while rescheduling meeting"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Meeting was changed by someone else, please retry"})
+		return
+	}
+
+	updated.Sequence++
+	updated.UpdatedAt = now
+	go sendMeetingInvites(updated, "REQUEST")
+	cancelInteractionReminder(ctx, meeting.ID, meeting.ScheduledAt)
+	scheduleInteractionReminder(ctx, updated, now)
+	publishInteractionEvent(ctx, events.InteractionUpdated, updated)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Meeting rescheduled successfully", "conflicts": conflicts})
+}
+
+// CancelMeeting cancels a scheduled meeting, keeping it in the history of its attendees.
+func CancelMeeting() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var requestBody meetingEditRequest
+		if err := c.ShouldBindJSON(&requestBody); err != nil && c.Request.ContentLength > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		meeting, ok := loadMeeting(ctx, c)
+		if !ok {
+			return
+		}
+		if !containsString(models.ActiveMeetingStatuses, meeting.Status) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Only scheduled meetings can be cancelled"})
+			return
+		}
+
+		if meeting.RRule != "" {
+			cancelMeetingSeries(ctx, c, meeting, requestBody)
+			return
+		}
+		cancelSingleMeeting(ctx, c, meeting, requestBody.Reason)
+	}
+}
+
+// cancelSingleMeeting cancels a one-off meeting, a whole series, or one edited occurrence of a series.
+// It reports whether the meeting was cancelled.
+func cancelSingleMeeting(ctx context.Context, c *gin.Context, meeting models.Interaction, reason string) bool {
+	now := time.Now()
+	change := models.MeetingChange{
+		Action:       "CANCELLED",
+		FromStart:    meeting.ScheduledAt,
+		FromEnd:      meeting.EndAt,
+		FromTimeZone: meeting.TimeZone,
+		Reason:       reason,
+		ChangedAt:    now,
+	}
+	statusChange := models.StatusChange{From: meeting.Status, To: "CANCELLED", ChangedAt: now}
+	if actorID, err := primitive.ObjectIDFromHex(c.GetString("uid")); err == nil {
+		change.ChangedBy = actorID
+		statusChange.ChangedBy = actorID
+	}
+
+	filter := bson.M{"_id": meeting.ID, "status": meeting.Status}
+	update := bson.M{
+		"$set":  bson.M{"status": "CANCELLED", "updated_at": now},
+		"$inc":  bson.M{"sequence": 1},
+		"$push": bson.M{"meeting_history": change, "status_history": statusChange},
+	}
+	result, err := interactionCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while cancelling meeting"})
+		return false
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Meeting was changed by someone else, please retry"})
+		return false
+	}
+
+	meeting.Status = "CANCELLED"
+	meeting.Sequence++
+	meeting.UpdatedAt = now
+	go sendMeetingInvites(meeting, "CANCEL")
+	cancelInteractionReminder(ctx, meeting.ID, meeting.ScheduledAt)
+	publishInteractionEvent(ctx, events.InteractionUpdated, meeting)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Meeting cancelled successfully"})
+	return true
+}
+
+// GetUserAgenda lists the meetings a user attends between from and to (RFC 3339, default: the next 7 days),
+// with recurring meetings expanded into occurrences.
+// Times are rendered in the time_zone query parameter when given.
+// Regular users can only read their own agenda; managers can read the agendas of users who share
+// a company with them.
+func GetUserAgenda() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.Param("user_id")
+		if isCustomerToken(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized to access this resource"})
+			return
+		}
+		if err := helper.MatchUserTypeToUid(c, userID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if uid := c.GetString("uid"); uid != userID && helper.CheckUserType(c, "ADMIN") != nil && !usersShareCompany(uid, userID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized to access this resource"})
+			return
+		}
+		userObjID, err := primitive.ObjectIDFromHex(userID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid User ID"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		from := time.Now()
+		if value := c.Query("from"); value != "" {
+			if from, err = time.Parse(time.RFC3339, value); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date, expected RFC 3339"})
+				return
+			}
+		}
+		to := from.AddDate(0, 0, 7)
+		if value := c.Query("to"); value != "" {
+			if to, err = time.Parse(time.RFC3339, value); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date, expected RFC 3339"})
+				return
+			}
+		}
+		if !to.After(from) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be after from"})
+			return
+		}
+		location := time.UTC
+		if name := c.Query("time_zone"); name != "" {
+			if location, err = time.LoadLocation(name); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time zone"})
+				return
+			}
+		}
+
+		filter := bson.M{"type": "MEETING", "attendees.id": userObjID}
+		if c.Query("include_cancelled") != "true" {
+			filter["status"] = bson.M{"$ne": "CANCELLED"}
+		}
+
+		meetings, err := loadMeetingOccurrences(ctx, filter, from, to)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving agenda"})
+			return
+		}
+		for i := range meetings {
+			meetings[i].ScheduledAt = meetings[i].ScheduledAt.In(location)
+			meetings[i].EndAt = meetings[i].EndAt.In(location)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"user_id": userID, "from": from.In(location), "to": to.In(location), "meetings": meetings})
+	}
+}
+
+// loadMeeting finds the meeting named by the meeting_id parameter and checks the caller may see it.
+// It writes the error response itself and returns false if the request should stop.
+func loadMeeting(ctx context.Context, c *gin.Context) (models.Interaction, bool) {
+	var meeting models.Interaction
+	meetingID, err := primitive.ObjectIDFromHex(c.Param("meeting_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid meeting ID"})
+		return meeting, false
+	}
+	err = interactionCollection.FindOne(ctx, bson.M{"_id": meetingID, "type": "MEETING"}).Decode(&meeting)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Meeting not found"})
+			return meeting, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving meeting"})
+		return meeting, false
+	}
+	if !authorizeInteraction(c, meeting) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this meeting"})
+		return meeting, false
+	}
+	return meeting, true
+}
+
+// resolveMeetingAttendees removes duplicate attendees, checks that every customer belongs to
+// the company and every user has access to it, and fills in names and emails.
+// It returns an error message, or an empty string if all attendees are valid.
+func resolveMeetingAttendees(ctx context.Context, companyID primitive.ObjectID, attendees []models.MeetingAttendee) ([]models.MeetingAttendee, string) {
+	resolved := []models.MeetingAttendee{}
+	seen := map[primitive.ObjectID]bool{}
+	for _, attendee := range attendees {
+		if seen[attendee.ID] {
+			continue
+		}
+		seen[attendee.ID] = true
+
+		switch attendee.Type {
+		case "CUSTOMER":
+			var customer models.Customer
+			err := customerCollection.FindOne(ctx, bson.M{"_id": attendee.ID, "companyID": companyID}).Decode(&customer)
+			if err != nil {
+				return nil, "Customer " + attendee.ID.Hex() + " not found in this company"
+			}
+			attendee.Name = strings.TrimSpace(stringValue(customer.FirstName) + " " + stringValue(customer.LastName))
+			attendee.Email = stringValue(customer.Email)
+		case "USER":
+			var user models.User
+			if err := userCollection.FindOne(ctx, bson.M{"user_id": attendee.ID.Hex()}).Decode(&user); err != nil {
+				return nil, "User " + attendee.ID.Hex() + " not found"
+			}
+			if !checkUserAccessToCompany(user.UserID, companyID) {
+				return nil, "User " + attendee.ID.Hex() + " does not have access to this company"
+			}
+			attendee.Name = strings.TrimSpace(stringValue(user.FirstName) + " " + stringValue(user.LastName))
+			attendee.Email = stringValue(user.Email)
+		default:
+			return nil, "Attendee type must be USER or CUSTOMER"
+		}
+		resolved = append(resolved, attendee)
+	}
+	return resolved, ""
+}
+
+// findMeetingConflicts returns the active meetings, other than the exclude meeting or series,
+// that overlap any of the slots and share at least one attendee.
+func findMeetingConflicts(ctx context.Context, attendees []models.MeetingAttendee, slots []meetingSlot, exclude primitive.ObjectID) ([]models.MeetingConflict, error) {
+	conflicts := []models.MeetingConflict{}
+	if len(attendees) == 0 || len(slots) == 0 {
+		return conflicts, nil
+	}
+
+	attendeeIDs := make([]primitive.ObjectID, 0, len(attendees))
+	wanted := map[primitive.ObjectID]bool{}
+	for _, attendee := range attendees {
+		attendeeIDs = append(attendeeIDs, attendee.ID)
+		wanted[attendee.ID] = true
+	}
+	from, to := slots[0].Start, slots[0].End
+	for _, slot := range slots {
+		if slot.Start.Before(from) {
+			from = slot.Start
+		}
+		if slot.End.After(to) {
+			to = slot.End
+		}
+	}
+
+	filter := bson.M{
+		"type":         "MEETING",
+		"status":       bson.M{"$in": models.ActiveMeetingStatuses},
+		"attendees.id": bson.M{"$in": attendeeIDs},
+	}
+	if !exclude.IsZero() {
+		filter["_id"] = bson.M{"$ne": exclude}
+		filter["seriesID"] = bson.M{"$ne": exclude}
+	}
+	meetings, err := loadMeetingOccurrences(ctx, filter, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, meeting := range meetings {
+		for _, slot := range slots {
+			if !meeting.ScheduledAt.Before(slot.End) || !meeting.EndAt.After(slot.Start) {
+				continue
+			}
+			for _, attendee := range meeting.Attendees {
+				if wanted[attendee.ID] {
+					conflicts = append(conflicts, models.MeetingConflict{
+						MeetingID:   meeting.ID,
+						AttendeeID:  attendee.ID,
+						ScheduledAt: meeting.ScheduledAt,
+						EndAt:       meeting.EndAt,
+					})
+				}
+			}
+			break
+		}
+	}
+	return conflicts, nil
+}
+
+func stringValue(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
@@ -0,0 +1,136 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	helper "github.com/SiddharthaKR/golang-jwt-project/helpers"
+	"github.com/SiddharthaKR/golang-jwt-project/models"
+	"github.com/SiddharthaKR/golang-jwt-project/outbox"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GetOutboxMessage returns the delivery status of a queued email to the user who sent it,
+// staff of its company, or an ADMIN.
+func GetOutboxMessage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		msg, ok := loadOutboxMessage(ctx, c)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, msg)
+	}
+}
+
+// GetOutboxMessages lists queued and sent emails, newest first. Filters: status, source and
+// company_id. Paging: page and recordPerPage. ADMIN only.
+func GetOutboxMessages() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := helper.CheckUserType(c, "ADMIN"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		filter := bson.M{}
+		for _, field := range []string{"status", "source"} {
+			if value := c.Query(field); value != "" {
+				filter[field] = value
+			}
+		}
+		if companyParam := c.Query("company_id"); companyParam != "" {
+			companyID, err := primitive.ObjectIDFromHex(companyParam)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+				return
+			}
+			filter["companyID"] = companyID
+		}
+		recordPerPage, err := strconv.Atoi(c.Query("recordPerPage"))
+		if err != nil || recordPerPage < 1 {
+			recordPerPage = 10
+		}
+		page, err := strconv.Atoi(c.Query("page"))
+		if err != nil || page < 1 {
+			page = 1
+		}
+
+		messages, total, err := outbox.List(ctx, filter, int64((page-1)*recordPerPage), int64(recordPerPage))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving outbox messages"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"total_count": total, "messages": messages})
+	}
+}
+
+// RetryOutboxMessage queues a DEAD email again. ADMIN only.
+func RetryOutboxMessage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := helper.CheckUserType(c, "ADMIN"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		messageID, err := primitive.ObjectIDFromHex(c.Param("message_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+			return
+		}
+		msg, err := outbox.Retry(ctx, messageID)
+		switch err {
+		case nil:
+		case outbox.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		case outbox.ErrNotDead:
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrying outbox message"})
+			return
+		}
+
+		c.JSON(http.StatusOK, msg)
+	}
+}
+
+// loadOutboxMessage finds the message named by the message_id parameter and checks the caller
+// may see it. It writes the error response itself and returns false if the request should stop.
+func loadOutboxMessage(ctx context.Context, c *gin.Context) (models.OutboxMessage, bool) {
+	messageID, err := primitive.ObjectIDFromHex(c.Param("message_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return models.OutboxMessage{}, false
+	}
+	msg, err := outbox.Get(ctx, messageID)
+	if err == outbox.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Outbox message not found"})
+		return msg, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving outbox message"})
+		return msg, false
+	}
+
+	uid := c.GetString("uid")
+	allowed := !isCustomerToken(c) && (msg.CreatedBy == uid ||
+		helper.CheckUserType(c, "ADMIN") == nil ||
+		(!msg.CompanyID.IsZero() && checkUserAccessToCompany(uid, msg.CompanyID)))
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this message"})
+		return msg, false
+	}
+	return msg, true
+}
@@ -0,0 +1,699 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/SiddharthaKR/golang-jwt-project/events"
+	helper "github.com/SiddharthaKR/golang-jwt-project/helpers"
+	"github.com/SiddharthaKR/golang-jwt-project/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// conflictHorizon and maxConflictOccurrences limit how much of a recurring meeting
+// is checked for conflicts.
+const conflictHorizon = 365 * 24 * time.Hour
+const maxConflictOccurrences = 200
+
+// A recurring meeting is stored once, as a series with an RRule and ExDates. Occurrences are
+// expanded when meetings are read. An occurrence that is moved or cancelled on its own is stored
+// as a separate meeting with SeriesID and RecurrenceID set, which replaces that occurrence.
+
+type meetingSlot struct {
+	Start time.Time
+	End   time.Time
+}
+
+// rescheduleMeetingSeries applies a reschedule to one occurrence, the following occurrences
+// or the whole of a recurring meeting.
+func rescheduleMeetingSeries(ctx context.Context, c *gin.Context, series models.Interaction, requestBody meetingEditRequest) {
+	switch requestBody.Scope {
+	case "", "series":
+		rescheduleWholeSeries(ctx, c, series, requestBody)
+	case "this":
+		if requestBody.RecurrenceID.IsZero() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "recurrence_id is required to change one occurrence"})
+			return
+		}
+		if requestBody.RRule != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Recurrence can only be changed for the series or following occurrences"})
+			return
+		}
+		if override, err := findMeetingOverride(ctx, series.ID, requestBody.RecurrenceID); err == nil {
+			if !containsString(models.ActiveMeetingStatuses, override.Status) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "This occurrence has been cancelled"})
+				return
+			}
+			rescheduleSingleMeeting(ctx, c, override, requestBody)
+			return
+		}
+		if !isMeetingOccurrence(series, requestBody.RecurrenceID) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Occurrence not found"})
+			return
+		}
+		createMeetingOverride(ctx, c, series, requestBody)
+	case "following":
+		if requestBody.RecurrenceID.IsZero() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "recurrence_id is required to change following occurrences"})
+			return
+		}
+		if requestBody.RecurrenceID.Equal(series.ScheduledAt) {
+			rescheduleWholeSeries(ctx, c, series, requestBody)
+			return
+		}
+		if !isMeetingOccurrence(series, requestBody.RecurrenceID) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Occurrence not found"})
+			return
+		}
+		splitMeetingSeries(ctx, c, series, requestBody)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "scope must be this, following or series"})
+	}
+}
+
+// cancelMeetingSeries cancels one occurrence, the following occurrences or the whole of a recurring meeting.
+func cancelMeetingSeries(ctx context.Context, c *gin.Context, series models.Interaction, requestBody meetingEditRequest) {
+	scope := requestBody.Scope
+	if scope == "following" && requestBody.RecurrenceID.Equal(series.ScheduledAt) {
+		scope = "series"
+	}
+
+	switch scope {
+	case "", "series":
+		if !cancelSingleMeeting(ctx, c, series, requestBody.Reason) {
+			return
+		}
+		// The series cancellation covers its edited occurrences too
+		filter := bson.M{"seriesID": series.ID, "status": bson.M{"$in": models.ActiveMeetingStatuses}}
+		if _, err := interactionCollection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"status": "CANCELLED", "updated_at": time.Now()}}); err != nil {
+			log.Println("Error cancelling occurrences of meeting", series.ID.Hex(), err)
+		}
+		publishInteractionEvent(ctx, events.InteractionUpdated, series)
+		return
+	case "this", "following":
+		if requestBody.RecurrenceID.IsZero() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "recurrence_id is required to cancel part of a series"})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "scope must be this, following or series"})
+		return
+	}
+
+	if scope == "this" {
+		if override, err := findMeetingOverride(ctx, series.ID, requestBody.RecurrenceID); err == nil {
+			if !containsString(models.ActiveMeetingStatuses, override.Status) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "This occurrence has already been cancelled"})
+				return
+			}
+			cancelSingleMeeting(ctx, c, override, requestBody.Reason)
+			return
+		}
+	}
+	if !isMeetingOccurrence(series, requestBody.RecurrenceID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Occurrence not found"})
+		return
+	}
+
+	now := time.Now()
+	duration := series.EndAt.Sub(series.ScheduledAt)
+	change := models.MeetingChange{
+		Action:       "CANCELLED",
+		FromStart:    requestBody.RecurrenceID,
+		FromEnd:      requestBody.RecurrenceID.Add(duration),
+		FromTimeZone: series.TimeZone,
+		Reason:       requestBody.Reason,
+		ChangedAt:    now,
+	}
+	if actorID, err := primitive.ObjectIDFromHex(c.GetString("uid")); err == nil {
+		change.ChangedBy = actorID
+	}
+
+	filter := bson.M{"_id": series.ID, "status": series.Status, "rrule": series.RRule}
+	var update bson.M
+	updated := series
+	if scope == "this" {
+		update = bson.M{
+			"$set":      bson.M{"updated_at": now},
+			"$addToSet": bson.M{"exdates": requestBody.RecurrenceID},
+			"$inc":      bson.M{"sequence": 1},
+			"$push":     bson.M{"meeting_history": change},
+		}
+	} else {
+		before, _, err := splitRecurrenceRule(series, requestBody.RecurrenceID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recurrence rule: " + err.Error()})
+			return
+		}
+		updated.RRule = before
+		updated.ExDates = timesBefore(series.ExDates, requestBody.RecurrenceID)
+		updated.RecurrenceEnd = meetingRecurrenceEnd(updated)
+		update = bson.M{
+			"$set": bson.M{
+				"rrule":          updated.RRule,
+				"exdates":        updated.ExDates,
+				"recurrence_end": updated.RecurrenceEnd,
+				"updated_at":     now,
+			},
+			"$inc":  bson.M{"sequence": 1},
+			"$push": bson.M{"meeting_history": change},
+		}
+	}
+
+	result, err := interactionCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while cancelling meeting"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Meeting was changed by someone else, please retry"})
+		return
+	}
+
+	updated.Sequence++
+	updated.UpdatedAt = now
+	if scope == "this" {
+		occurrence := meetingOccurrence(updated, requestBody.RecurrenceID)
+		occurrence.Status = "CANCELLED"
+		go sendMeetingInvites(occurrence, "CANCEL")
+		publishInteractionEvent(ctx, events.InteractionUpdated, updated)
+		c.JSON(http.StatusOK, gin.H{"message": "Occurrence cancelled successfully"})
+		return
+	}
+
+	overrides := bson.M{
+		"seriesID":      series.ID,
+		"recurrence_id": bson.M{"$gte": requestBody.RecurrenceID},
+		"status":        bson.M{"$in": models.ActiveMeetingStatuses},
+	}
+	if _, err := interactionCollection.UpdateMany(ctx, overrides, bson.M{"$set": bson.M{"status": "CANCELLED", "updated_at": now}}); err != nil {
+		log.Println("Error cancelling occurrences of meeting", series.ID.Hex(), err)
+	}
+	go sendMeetingInvites(updated, "REQUEST")
+	publishInteractionEvent(ctx, events.InteractionUpdated, updated)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Following occurrences cancelled successfully"})
+}
+
+// rescheduleWholeSeries moves every occurrence of a series, and optionally changes its rule.
+// Skipped and edited occurrences move along with the series.
+func rescheduleWholeSeries(ctx context.Context, c *gin.Context, series models.Interaction, requestBody meetingEditRequest) {
+	updated := series
+	applyMeetingTimes(&updated, series, requestBody)
+	if requestBody.RRule != "" {
+		updated.RRule = requestBody.RRule
+	}
+	if msg := validateInteractionFields(updated); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	updated.RRule = normalizeRRule(updated.RRule)
+
+	shift := occurrenceShifter(series, updated)
+	updated.ExDates = nil
+	for _, exdate := range series.ExDates {
+		updated.ExDates = append(updated.ExDates, shift(exdate))
+	}
+	updated.RecurrenceEnd = meetingRecurrenceEnd(updated)
+
+	conflicts, err := findMeetingConflicts(ctx, series.Attendees, meetingSlots(updated), series.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while checking for conflicts"})
+		return
+	}
+	if len(conflicts) > 0 && c.Query("allow_conflicts") != "true" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Meeting conflicts with other meetings of its attendees", "conflicts": conflicts})
+		return
+	}
+
+	now := time.Now()
+	change := meetingRescheduleChange(c, series, updated, requestBody.Reason, now)
+	filter := bson.M{"_id": series.ID, "scheduled_at": series.ScheduledAt, "status": series.Status, "rrule": series.RRule}
+	update := bson.M{
+		"$set": bson.M{
+			"scheduled_at":   updated.ScheduledAt,
+			"end_at":         updated.EndAt,
+			"time_zone":      updated.TimeZone,
+			"rrule":          updated.RRule,
+			"exdates":        updated.ExDates,
+			"recurrence_end": updated.RecurrenceEnd,
+			"updated_at":     now,
+		},
+		"$inc":  bson.M{"sequence": 1},
+		"$push": bson.M{"meeting_history": change},
+	}
+	result, err := interactionCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while rescheduling meeting"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Meeting was changed by someone else, please retry"})
+		return
+	}
+
+	moveMeetingOverrides(ctx, series.ID, series.ID, time.Time{}, shift)
+
+	updated.Sequence++
+	updated.UpdatedAt = now
+	go sendMeetingInvites(updated, "REQUEST")
+	scheduleInteractionReminder(ctx, updated, now)
+	publishInteractionEvent(ctx, events.InteractionUpdated, updated)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Meeting rescheduled successfully", "conflicts": conflicts})
+}
+
+// splitMeetingSeries ends a series before the given occurrence and starts a new series there
+// with the new time and rule.
+func splitMeetingSeries(ctx context.Context, c *gin.Context, series models.Interaction, requestBody meetingEditRequest) {
+	at := requestBody.RecurrenceID
+	before, after, err := splitRecurrenceRule(series, at)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recurrence rule: " + err.Error()})
+		return
+	}
+
+	occurrence := meetingOccurrence(series, at)
+	next := series
+	next.ID = primitive.NewObjectID()
+	next.ScheduledAt = occurrence.ScheduledAt
+	next.EndAt = occurrence.EndAt
+	applyMeetingTimes(&next, occurrence, requestBody)
+	next.RRule = after
+	if requestBody.RRule != "" {
+		next.RRule = requestBody.RRule
+	}
+	if msg := validateInteractionFields(next); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	next.RRule = normalizeRRule(next.RRule)
+
+	shift := occurrenceShifter(occurrence, next)
+	next.ExDates = nil
+	for _, exdate := range series.ExDates {
+		if !exdate.Before(at) {
+			next.ExDates = append(next.ExDates, shift(exdate))
+		}
+	}
+	next.RecurrenceEnd = meetingRecurrenceEnd(next)
+
+	conflicts, err := findMeetingConflicts(ctx, series.Attendees, meetingSlots(next), series.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while checking for conflicts"})
+		return
+	}
+	if len(conflicts) > 0 && c.Query("allow_conflicts") != "true" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Meeting conflicts with other meetings of its attendees", "conflicts": conflicts})
+		return
+	}
+
+	now := time.Now()
+	change := meetingRescheduleChange(c, occurrence, next, requestBody.Reason, now)
+	truncated := series
+	truncated.RRule = before
+	truncated.ExDates = timesBefore(series.ExDates, at)
+	truncated.RecurrenceEnd = meetingRecurrenceEnd(truncated)
+
+	filter := bson.M{"_id": series.ID, "scheduled_at": series.ScheduledAt, "status": series.Status, "rrule": series.RRule}
+	update := bson.M{
+		"$set": bson.M{
+			"rrule":          truncated.RRule,
+			"exdates":        truncated.ExDates,
+			"recurrence_end": truncated.RecurrenceEnd,
+			"updated_at":     now,
+		},
+		"$inc":  bson.M{"sequence": 1},
+		"$push": bson.M{"meeting_history": change},
+	}
+	result, err := interactionCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while rescheduling meeting"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Meeting was changed by someone else, please retry"})
+		return
+	}
+
+	next.Sequence = 0
+	next.ExternalUID = ""
+	next.StatusHistory = nil
+	next.MeetingHistory = []models.MeetingChange{change}
+	next.CreatedAt = now
+	next.UpdatedAt = now
+	if _, err := interactionCollection.InsertOne(ctx, next); err != nil {
+		log.Println("Error creating new series for meeting", series.ID.Hex(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while creating the new series"})
+		return
+	}
+
+	moveMeetingOverrides(ctx, series.ID, next.ID, at, shift)
+
+	truncated.Sequence++
+	truncated.UpdatedAt = now
+	go sendMeetingInvites(truncated, "REQUEST")
+	go sendMeetingInvites(next, "REQUEST")
+	scheduleInteractionReminder(ctx, next, now)
+	publishInteractionEvent(ctx, events.InteractionCreated, next)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Following occurrences rescheduled successfully", "interaction_id": next.ID, "conflicts": conflicts})
+}
+
+// createMeetingOverride moves a single occurrence of a series by storing it as its own meeting.
+func createMeetingOverride(ctx context.Context, c *gin.Context, series models.Interaction, requestBody meetingEditRequest) {
+	occurrence := meetingOccurrence(series, requestBody.RecurrenceID)
+	override := occurrence
+	override.ID = primitive.NewObjectID()
+	applyMeetingTimes(&override, occurrence, requestBody)
+	if msg := validateInteractionFields(override); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	conflicts, err := findMeetingConflicts(ctx, override.Attendees, []meetingSlot{{override.ScheduledAt, override.EndAt}}, series.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while checking for conflicts"})
+		return
+	}
+	if len(conflicts) > 0 && c.Query("allow_conflicts") != "true" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Meeting conflicts with other meetings of its attendees", "conflicts": conflicts})
+		return
+	}
+
+	now := time.Now()
+	// Calendar apps only accept an occurrence update with a sequence above the series'
+	override.Sequence = series.Sequence + 1
+	override.MeetingHistory = []models.MeetingChange{meetingRescheduleChange(c, occurrence, override, requestBody.Reason, now)}
+	override.CreatedAt = now
+	override.UpdatedAt = now
+	if _, err := interactionCollection.InsertOne(ctx, override); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while rescheduling occurrence"})
+		return
+	}
+
+	go sendMeetingInvites(override, "REQUEST")
+	scheduleInteractionReminder(ctx, override, now)
+	publishInteractionEvent(ctx, events.InteractionCreated, override)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Occurrence rescheduled successfully", "interaction_id": override.ID, "conflicts": conflicts})
+}
+
+// loadMeetingOccurrences returns the meetings matching filter that overlap [from, to),
+// with recurring meetings expanded into their occurrences, sorted by start time.
+func loadMeetingOccurrences(ctx context.Context, filter bson.M, from time.Time, to time.Time) ([]models.Interaction, error) {
+	single := bson.M{}
+	series := bson.M{}
+	for key, value := range filter {
+		single[key] = value
+		series[key] = value
+	}
+	single["rrule"] = bson.M{"$exists": false}
+	single["scheduled_at"] = bson.M{"$lt": to}
+	single["end_at"] = bson.M{"$gt": from}
+	series["rrule"] = bson.M{"$exists": true}
+	series["scheduled_at"] = bson.M{"$lt": to}
+	series["$or"] = bson.A{bson.M{"recurrence_end": nil}, bson.M{"recurrence_end": bson.M{"$gt": from}}}
+
+	meetings, err := findMeetings(ctx, single)
+	if err != nil {
+		return nil, err
+	}
+	seriesList, err := findMeetings(ctx, series)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(seriesList) > 0 {
+		seriesIDs := make([]primitive.ObjectID, 0, len(seriesList))
+		for _, s := range seriesList {
+			seriesIDs = append(seriesIDs, s.ID)
+		}
+		edited, err := editedOccurrences(ctx, seriesIDs)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range seriesList {
+			meetings = append(meetings, expandMeetingSeries(s, from, to, edited[s.ID])...)
+		}
+	}
+
+	sort.SliceStable(meetings, func(i, j int) bool { return meetings[i].ScheduledAt.Before(meetings[j].ScheduledAt) })
+	return meetings, nil
+}
+
+// expandMeetingSeries returns the occurrences of a series that overlap [from, to),
+// leaving out skipped ones and the given edited ones.
+func expandMeetingSeries(series models.Interaction, from time.Time, to time.Time, edited []time.Time) []models.Interaction {
+	rule, err := helper.ParseRRule(series.RRule)
+	if err != nil {
+		log.Println("Invalid recurrence rule on meeting", series.ID.Hex(), err)
+		return nil
+	}
+
+	duration := series.EndAt.Sub(series.ScheduledAt)
+	var occurrences []models.Interaction
+	for _, start := range rule.Between(series.ScheduledAt, meetingLocation(series), from.Add(-duration), to, series.ExDates) {
+		if helper.ContainsTime(edited, start) || !start.Add(duration).After(from) {
+			continue
+		}
+		occurrences = append(occurrences, meetingOccurrence(series, start))
+	}
+	return occurrences
+}
+
+// meetingOccurrence returns the occurrence of a series starting at start. It keeps the
+// series' ID, so clients can address it with the series ID and its recurrence_id.
+func meetingOccurrence(series models.Interaction, start time.Time) models.Interaction {
+	occurrence := series
+	occurrence.SeriesID = series.ID
+	occurrence.RecurrenceID = start
+	occurrence.ScheduledAt = start
+	occurrence.EndAt = start.Add(series.EndAt.Sub(series.ScheduledAt))
+	occurrence.RRule = ""
+	occurrence.ExDates = nil
+	occurrence.RecurrenceEnd = nil
+	occurrence.MeetingHistory = nil
+	occurrence.StatusHistory = nil
+	return occurrence
+}
+
+// meetingSlots returns the time slots a meeting occupies, up to conflictHorizon ahead for a series.
+func meetingSlots(meeting models.Interaction) []meetingSlot {
+	single := []meetingSlot{{meeting.ScheduledAt, meeting.EndAt}}
+	if meeting.RRule == "" {
+		return single
+	}
+	rule, err := helper.ParseRRule(meeting.RRule)
+	if err != nil {
+		return single
+	}
+
+	duration := meeting.EndAt.Sub(meeting.ScheduledAt)
+	var slots []meetingSlot
+	rule.Each(meeting.ScheduledAt, meetingLocation(meeting), func(start time.Time) bool {
+		if start.Sub(meeting.ScheduledAt) > conflictHorizon || len(slots) >= maxConflictOccurrences {
+			return false
+		}
+		if !helper.ContainsTime(meeting.ExDates, start) {
+			slots = append(slots, meetingSlot{start, start.Add(duration)})
+		}
+		return true
+	})
+	return slots
+}
+
+// meetingRecurrenceEnd returns when the last occurrence of a series ends, or nil if it never does.
+func meetingRecurrenceEnd(meeting models.Interaction) *time.Time {
+	rule, err := helper.ParseRRule(meeting.RRule)
+	if err != nil {
+		return nil
+	}
+	last, ok := rule.Last(meeting.ScheduledAt, meetingLocation(meeting))
+	if !ok {
+		return nil
+	}
+	end := last.Add(meeting.EndAt.Sub(meeting.ScheduledAt))
+	return &end
+}
+
+// isMeetingOccurrence reports whether start is a (not skipped) occurrence of the series.
+func isMeetingOccurrence(series models.Interaction, start time.Time) bool {
+	rule, err := helper.ParseRRule(series.RRule)
+	if err != nil {
+		return false
+	}
+	return len(rule.Between(series.ScheduledAt, meetingLocation(series), start, start.Add(time.Second), series.ExDates)) > 0
+}
+
+// splitRecurrenceRule divides a series' rule at an occurrence into the rule for the
+// occurrences before it and the rule for that occurrence and the ones after.
+func splitRecurrenceRule(series models.Interaction, at time.Time) (string, string, error) {
+	rule, err := helper.ParseRRule(series.RRule)
+	if err != nil {
+		return "", "", err
+	}
+	after := rule
+	if rule.Count > 0 {
+		before := 0
+		rule.Each(series.ScheduledAt, meetingLocation(series), func(start time.Time) bool {
+			if !start.Before(at) {
+				return false
+			}
+			before++
+			return true
+		})
+		rule.Count = before
+		after.Count -= before
+	} else {
+		rule.Until = at.Add(-time.Second)
+	}
+	return rule.String(), after.String(), nil
+}
+
+// applyMeetingTimes sets the start, end and time zone from a reschedule request,
+// keeping the length and time zone of from where the request leaves them out.
+func applyMeetingTimes(meeting *models.Interaction, from models.Interaction, requestBody meetingEditRequest) {
+	duration := from.EndAt.Sub(from.ScheduledAt)
+	if duration <= 0 {
+		duration = defaultMeetingDuration
+	}
+	if !requestBody.ScheduledAt.IsZero() {
+		meeting.ScheduledAt = requestBody.ScheduledAt
+		meeting.EndAt = requestBody.EndAt
+		if meeting.EndAt.IsZero() {
+			meeting.EndAt = meeting.ScheduledAt.Add(duration)
+		}
+	} else if !requestBody.EndAt.IsZero() {
+		meeting.EndAt = requestBody.EndAt
+	}
+	if requestBody.TimeZone != "" {
+		meeting.TimeZone = requestBody.TimeZone
+	}
+	if meeting.TimeZone == "" {
+		meeting.TimeZone = "UTC"
+	}
+}
+
+// occurrenceShifter returns a function that maps an occurrence start of before to the matching
+// start of after: the same number of days later, at after's wall-clock time.
+func occurrenceShifter(before models.Interaction, after models.Interaction) func(time.Time) time.Time {
+	oldLocation, newLocation := meetingLocation(before), meetingLocation(after)
+	oldStart, newStart := before.ScheduledAt.In(oldLocation), after.ScheduledAt.In(newLocation)
+	oldDay := time.Date(oldStart.Year(), oldStart.Month(), oldStart.Day(), 0, 0, 0, 0, time.UTC)
+	newDay := time.Date(newStart.Year(), newStart.Month(), newStart.Day(), 0, 0, 0, 0, time.UTC)
+	days := int(newDay.Sub(oldDay).Hours() / 24)
+
+	return func(t time.Time) time.Time {
+		local := t.In(oldLocation)
+		return time.Date(local.Year(), local.Month(), local.Day()+days, newStart.Hour(), newStart.Minute(), newStart.Second(), 0, newLocation)
+	}
+}
+
+// moveMeetingOverrides reattaches the edited occurrences of a series starting at or after
+// since to another series, shifting their recurrence IDs to match.
+func moveMeetingOverrides(ctx context.Context, fromSeries primitive.ObjectID, toSeries primitive.ObjectID, since time.Time, shift func(time.Time) time.Time) {
+	filter := bson.M{"seriesID": fromSeries, "recurrence_id": bson.M{"$gte": since}}
+	overrides, err := findMeetings(ctx, filter)
+	if err != nil {
+		log.Println("Error loading occurrences of meeting", fromSeries.Hex(), err)
+		return
+	}
+	for _, override := range overrides {
+		update := bson.M{"$set": bson.M{"seriesID": toSeries, "recurrence_id": shift(override.RecurrenceID)}}
+		if _, err := interactionCollection.UpdateOne(ctx, bson.M{"_id": override.ID}, update); err != nil {
+			log.Println("Error moving occurrence", override.ID.Hex(), err)
+		}
+	}
+}
+
+func meetingRescheduleChange(c *gin.Context, from models.Interaction, to models.Interaction, reason string, now time.Time) models.MeetingChange {
+	change := models.MeetingChange{
+		Action:       "RESCHEDULED",
+		FromStart:    from.ScheduledAt,
+		FromEnd:      from.EndAt,
+		ToStart:      to.ScheduledAt,
+		ToEnd:        to.EndAt,
+		FromTimeZone: from.TimeZone,
+		ToTimeZone:   to.TimeZone,
+		Reason:       reason,
+		ChangedAt:    now,
+	}
+	if actorID, err := primitive.ObjectIDFromHex(c.GetString("uid")); err == nil {
+		change.ChangedBy = actorID
+	}
+	return change
+}
+
+func findMeetingOverride(ctx context.Context, seriesID primitive.ObjectID, recurrenceID time.Time) (models.Interaction, error) {
+	var override models.Interaction
+	err := interactionCollection.FindOne(ctx, bson.M{"seriesID": seriesID, "recurrence_id": recurrenceID}).Decode(&override)
+	return override, err
+}
+
+// editedOccurrences returns the recurrence IDs of the stored occurrences of each series.
+func editedOccurrences(ctx context.Context, seriesIDs []primitive.ObjectID) (map[primitive.ObjectID][]time.Time, error) {
+	projection := options.Find().SetProjection(bson.M{"seriesID": 1, "recurrence_id": 1})
+	cursor, err := interactionCollection.Find(ctx, bson.M{"seriesID": bson.M{"$in": seriesIDs}}, projection)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var overrides []models.Interaction
+	if err := cursor.All(ctx, &overrides); err != nil {
+		return nil, err
+	}
+	edited := map[primitive.ObjectID][]time.Time{}
+	for _, override := range overrides {
+		edited[override.SeriesID] = append(edited[override.SeriesID], override.RecurrenceID)
+	}
+	return edited, nil
+}
+
+func findMeetings(ctx context.Context, filter bson.M) ([]models.Interaction, error) {
+	cursor, err := interactionCollection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var meetings []models.Interaction
+	if err := cursor.All(ctx, &meetings); err != nil {
+		return nil, err
+	}
+	return meetings, nil
+}
+
+func meetingLocation(meeting models.Interaction) *time.Location {
+	location, err := time.LoadLocation(meeting.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// normalizeRRule returns a rule in canonical form, or unchanged if it does not parse.
+func normalizeRRule(value string) string {
+	rule, err := helper.ParseRRule(value)
+	if err != nil {
+		return value
+	}
+	return rule.String()
+}
+
+func timesBefore(times []time.Time, limit time.Time) []time.Time {
+	var before []time.Time
+	for _, t := range times {
+		if t.Before(limit) {
+			before = append(before, t)
+		}
+	}
+	return before
+}
@@ -0,0 +1,220 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	helper "github.com/SiddharthaKR/golang-jwt-project/helpers"
+	"github.com/SiddharthaKR/golang-jwt-project/models"
+	"github.com/SiddharthaKR/golang-jwt-project/outbox"
+	"github.com/SiddharthaKR/golang-jwt-project/scheduler"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// reminderJobType is the job type of interaction reminders. Each reminder is a one-shot job
+// named after the interaction and the start time it reminds of. A reminder for a recurring
+// meeting schedules the reminder for the next occurrence when it runs.
+const reminderJobType = "interaction_reminder"
+
+// defaultReminderMinutes is used when REMINDER_MINUTES_BEFORE is not set.
+const defaultReminderMinutes = 15
+
+// reminderLead returns how long before an interaction its reminder is sent, or 0 if reminders are disabled.
+func reminderLead() time.Duration {
+	minutes := defaultReminderMinutes
+	if value := os.Getenv("REMINDER_MINUTES_BEFORE"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			minutes = n
+		}
+	}
+	if minutes <= 0 {
+		return 0
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+func reminderJobName(interactionID primitive.ObjectID, start time.Time) string {
+	return fmt.Sprintf("reminder:%s:%d", interactionID.Hex(), start.Unix())
+}
+
+// scheduleInteractionReminder schedules the reminder for the next start of an interaction
+// after the given time. Interactions without a start time or that are no longer scheduled
+// get none.
+func scheduleInteractionReminder(ctx context.Context, interaction models.Interaction, after time.Time) {
+	lead := reminderLead()
+	if lead == 0 || interaction.ScheduledAt.IsZero() || !containsString(models.ActiveMeetingStatuses, interaction.Status) {
+		return
+	}
+
+	start, ok := nextInteractionStart(interaction, after)
+	if !ok {
+		return
+	}
+	payload := map[string]string{
+		"interaction_id": interaction.ID.Hex(),
+		"start":          start.UTC().Format(time.RFC3339Nano),
+	}
+	if err := scheduler.ScheduleOnce(ctx, reminderJobName(interaction.ID, start), reminderJobType, start.Add(-lead), payload); err != nil {
+		log.Println("Error scheduling reminder for interaction", interaction.ID.Hex(), err)
+	}
+}
+
+// cancelInteractionReminder drops the pending reminder for a start time that no longer applies.
+func cancelInteractionReminder(ctx context.Context, interactionID primitive.ObjectID, start time.Time) {
+	if err := scheduler.Cancel(ctx, reminderJobName(interactionID, start)); err != nil {
+		log.Println("Error cancelling reminder for interaction", interactionID.Hex(), err)
+	}
+}
+
+// nextInteractionStart returns the first start of an interaction after the given time,
+// expanding the recurrence rule of a series.
+func nextInteractionStart(interaction models.Interaction, after time.Time) (time.Time, bool) {
+	if interaction.RRule == "" {
+		return interaction.ScheduledAt, interaction.ScheduledAt.After(after)
+	}
+	rule, err := helper.ParseRRule(interaction.RRule)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	var next time.Time
+	rule.Each(interaction.ScheduledAt, meetingLocation(interaction), func(start time.Time) bool {
+		if start.After(after) && !helper.ContainsTime(interaction.ExDates, start) {
+			next = start
+			return false
+		}
+		return true
+	})
+	return next, !next.IsZero()
+}
+
+// sendInteractionReminder is the handler of reminder jobs. Reminders whose interaction was
+// cancelled, moved or has already started are dropped without an error.
+func sendInteractionReminder(ctx context.Context, job models.Job) error {
+	interactionID, err := primitive.ObjectIDFromHex(job.Payload["interaction_id"])
+	if err != nil {
+		return fmt.Errorf("invalid interaction_id %q", job.Payload["interaction_id"])
+	}
+	start, err := time.Parse(time.RFC3339, job.Payload["start"])
+	if err != nil {
+		return fmt.Errorf("invalid start %q", job.Payload["start"])
+	}
+
+	var interaction models.Interaction
+	if err := interactionCollection.FindOne(ctx, bson.M{"_id": interactionID}).Decode(&interaction); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		return err
+	}
+	if !containsString(models.ActiveMeetingStatuses, interaction.Status) {
+		return nil
+	}
+
+	if interaction.RRule != "" {
+		// Line up the reminder after this one before sending, so a failed send cannot break the chain
+		scheduleInteractionReminder(ctx, interaction, start)
+
+		if !isMeetingOccurrence(interaction, start) {
+			return nil
+		}
+		// Occurrences edited on their own have reminders of their own
+		if _, err := findMeetingOverride(ctx, interaction.ID, start); err != mongo.ErrNoDocuments {
+			return err
+		}
+		interaction = meetingOccurrence(interaction, start)
+	} else if interaction.ScheduledAt.Unix() != start.Unix() {
+		// Compared in seconds, like the job name, as reminders queued before the payload kept
+		// fractional seconds carry a truncated start
+		return nil
+	}
+	if !time.Now().Before(start) {
+		return nil
+	}
+
+	to, err := reminderRecipients(ctx, interaction)
+	if err != nil {
+		return err
+	}
+	if len(to) == 0 {
+		return nil
+	}
+	subject, body := reminderEmail(interaction)
+	// Keyed on the job, so a retried job does not queue the reminder twice
+	msg := models.OutboxMessage{
+		ID:        outbox.KeyID(job.Name),
+		CompanyID: interaction.CompanyID,
+		Source:    reminderJobType,
+		To:        to,
+		Subject:   subject,
+		Text:      body,
+	}
+	if err := outbox.Enqueue(ctx, &msg); err != nil && !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+	return nil
+}
+
+// reminderRecipients returns the addresses a reminder goes to: the attendees of a meeting,
+// or the owner and assignee of any other interaction.
+func reminderRecipients(ctx context.Context, interaction models.Interaction) ([]string, error) {
+	var to []string
+	for _, attendee := range interaction.Attendees {
+		if attendee.Email != "" && !containsString(to, attendee.Email) {
+			to = append(to, attendee.Email)
+		}
+	}
+	if len(interaction.Attendees) > 0 {
+		return to, nil
+	}
+
+	userIDs := bson.A{interaction.UserID.Hex()}
+	if !interaction.AssigneeID.IsZero() {
+		userIDs = append(userIDs, interaction.AssigneeID.Hex())
+	}
+	cursor, err := userCollection.Find(ctx, bson.M{"user_id": bson.M{"$in": userIDs}})
+	if err != nil {
+		return nil, err
+	}
+	var users []models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		if user.Email != nil && !containsString(to, *user.Email) {
+			to = append(to, *user.Email)
+		}
+	}
+	return to, nil
+}
+
+func reminderEmail(interaction models.Interaction) (string, string) {
+	location := meetingLocation(interaction)
+	title := interaction.Subject
+	if title == "" {
+		title = interaction.Description
+	}
+	if title == "" {
+		title = "Scheduled " + interaction.Type
+	}
+
+	subject := fmt.Sprintf("Reminder: %s at %s", title, interaction.ScheduledAt.In(location).Format("15:04 MST"))
+	body := fmt.Sprintf("%s\n\nWhen: %s (%s)\n", title,
+		interaction.ScheduledAt.In(location).Format("Mon Jan 2, 2006 15:04"), location.String())
+	if interaction.Location != "" {
+		body += "Where: " + interaction.Location + "\n"
+	}
+	if interaction.VideoLink != "" {
+		body += "Join: " + interaction.VideoLink + "\n"
+	}
+	if interaction.Description != "" && interaction.Description != title {
+		body += "\n" + interaction.Description + "\n"
+	}
+	return subject, body
+}
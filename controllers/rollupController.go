@@ -0,0 +1,279 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/SiddharthaKR/golang-jwt-project/events"
+	helper "github.com/SiddharthaKR/golang-jwt-project/helpers"
+	"github.com/SiddharthaKR/golang-jwt-project/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Customers and companies carry rollups of their interactions (last interaction, open tickets, ...).
+// They are recomputed from the interactions whenever an interaction or customer event is published,
+// so a missed event is corrected by the next one; RepairRollups recomputes everything.
+
+// RegisterEventHandlers subscribes the handlers that keep rollups up to date.
+func RegisterEventHandlers() {
+	events.Subscribe(events.InteractionCreated, refreshInteractionRollups)
+	events.Subscribe(events.InteractionUpdated, refreshInteractionRollups)
+	events.Subscribe(events.CustomerCreated, refreshCustomerEventRollups)
+	events.Subscribe(events.CustomerDeleted, refreshCustomerEventRollups)
+	events.Subscribe(events.EmailSent, logSentEmail)
+}
+
+// publishInteractionEvent announces that an interaction was created or changed.
+func publishInteractionEvent(ctx context.Context, eventType string, interaction models.Interaction) {
+	events.Publish(ctx, events.Event{
+		Type:          eventType,
+		CompanyID:     interaction.CompanyID,
+		CustomerID:    interaction.CustomerID,
+		InteractionID: interaction.ID,
+	})
+}
+
+// refreshInteractionRollups recomputes the rollups of the interaction's customers and company.
+// Every customer attending a meeting is refreshed, not just its primary customer.
+func refreshInteractionRollups(ctx context.Context, event events.Event) error {
+	customerIDs := []primitive.ObjectID{event.CustomerID}
+	var interaction models.Interaction
+	err := interactionCollection.FindOne(ctx, bson.M{"_id": event.InteractionID}).Decode(&interaction)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return err
+	}
+	for _, attendee := range interaction.Attendees {
+		if attendee.Type == "CUSTOMER" && !containsObjectID(customerIDs, attendee.ID) {
+			customerIDs = append(customerIDs, attendee.ID)
+		}
+	}
+
+	for _, customerID := range customerIDs {
+		if customerID.IsZero() {
+			continue
+		}
+		if err := refreshCustomerRollups(ctx, customerID); err != nil {
+			return err
+		}
+	}
+	return refreshCompanyRollups(ctx, event.CompanyID)
+}
+
+func refreshCustomerEventRollups(ctx context.Context, event events.Event) error {
+	if event.Type == events.CustomerCreated {
+		if err := refreshCustomerRollups(ctx, event.CustomerID); err != nil {
+			return err
+		}
+	}
+	return refreshCompanyRollups(ctx, event.CompanyID)
+}
+
+// refreshCustomerRollups recomputes the last interaction, open tickets, total interactions and
+// next meeting of a customer.
+func refreshCustomerRollups(ctx context.Context, customerID primitive.ObjectID) error {
+	now := time.Now()
+	involved := bson.M{"$or": bson.A{bson.M{"customerID": customerID}, bson.M{"attendees.id": customerID}}}
+
+	// Occurrences edited on their own belong to a series that is already counted
+	total, err := interactionCollection.CountDocuments(ctx, bson.M{"$and": bson.A{involved, bson.M{"seriesID": bson.M{"$exists": false}}}})
+	if err != nil {
+		return err
+	}
+	openTickets, err := interactionCollection.CountDocuments(ctx, bson.M{
+		"customerID": customerID,
+		"type":       "TICKET",
+		"status":     bson.M{"$in": models.OpenTicketStatuses},
+	})
+	if err != nil {
+		return err
+	}
+	last, err := lastInteractionAt(ctx, involved, now)
+	if err != nil {
+		return err
+	}
+
+	upcoming, err := loadMeetingOccurrences(ctx, bson.M{
+		"type":         "MEETING",
+		"status":       bson.M{"$in": models.ActiveMeetingStatuses},
+		"attendees.id": customerID,
+	}, now, now.Add(conflictHorizon))
+	if err != nil {
+		return err
+	}
+
+	set := bson.M{
+		"open_tickets":       openTickets,
+		"total_interactions": total,
+	}
+	if !last.IsZero() {
+		set["last_interaction"] = last
+	}
+	update := bson.M{"$set": set}
+	update["$unset"] = bson.M{"next_meeting_at": "", "next_meetingID": ""}
+	// Occurrences are sorted by start; skip meetings that are already under way
+	for _, meeting := range upcoming {
+		if meeting.ScheduledAt.After(now) {
+			set["next_meeting_at"] = meeting.ScheduledAt
+			set["next_meetingID"] = meeting.ID
+			delete(update, "$unset")
+			break
+		}
+	}
+	_, err = customerCollection.UpdateOne(ctx, bson.M{"_id": customerID}, update)
+	return err
+}
+
+// lastInteractionAt returns when the most recent interaction matching filter took place:
+// its start for meetings and scheduled calls that have started, otherwise when it was logged.
+// Cancelled and future interactions do not count.
+func lastInteractionAt(ctx context.Context, filter bson.M, now time.Time) (time.Time, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"$and": bson.A{filter, bson.M{
+			"status": bson.M{"$ne": "CANCELLED"},
+			"rrule":  bson.M{"$exists": false},
+		}}}}},
+		{{Key: "$project", Value: bson.M{"occurred_at": bson.M{"$ifNull": bson.A{"$scheduled_at", "$created_at"}}}}},
+		{{Key: "$match", Value: bson.M{"occurred_at": bson.M{"$lte": now}}}},
+		{{Key: "$group", Value: bson.M{"_id": nil, "last": bson.M{"$max": "$occurred_at"}}}},
+	}
+	cursor, err := interactionCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var results []struct {
+		Last time.Time `bson:"last"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return time.Time{}, err
+	}
+	var last time.Time
+	if len(results) > 0 {
+		last = results[0].Last
+	}
+
+	// A series took place at its most recent past occurrence
+	series, err := findMeetings(ctx, bson.M{"$and": bson.A{filter, bson.M{
+		"status":       bson.M{"$ne": "CANCELLED"},
+		"rrule":        bson.M{"$exists": true},
+		"scheduled_at": bson.M{"$lte": now},
+	}}})
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, s := range series {
+		rule, err := helper.ParseRRule(s.RRule)
+		if err != nil {
+			continue
+		}
+		rule.Each(s.ScheduledAt, meetingLocation(s), func(start time.Time) bool {
+			if start.After(now) {
+				return false
+			}
+			if start.After(last) && !helper.ContainsTime(s.ExDates, start) {
+				last = start
+			}
+			return true
+		})
+	}
+	return last, nil
+}
+
+// refreshCompanyRollups recomputes the customer count and open tickets of a company.
+func refreshCompanyRollups(ctx context.Context, companyID primitive.ObjectID) error {
+	if companyID.IsZero() {
+		return nil
+	}
+	customers, err := customerCollection.CountDocuments(ctx, bson.M{"companyID": companyID})
+	if err != nil {
+		return err
+	}
+	openTickets, err := interactionCollection.CountDocuments(ctx, bson.M{
+		"companyID": companyID,
+		"type":      "TICKET",
+		"status":    bson.M{"$in": models.OpenTicketStatuses},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = companyCollection.UpdateOne(ctx, bson.M{"_id": companyID}, bson.M{"$set": bson.M{
+		"customer_count": customers,
+		"open_tickets":   openTickets,
+	}})
+	return err
+}
+
+// refreshPassedMeetings is the handler of the customer_rollups job. A customer's next meeting
+// and last interaction change when a meeting starts, without any event being published.
+func refreshPassedMeetings(ctx context.Context, job models.Job) error {
+	cursor, err := customerCollection.Find(ctx, bson.M{"next_meeting_at": bson.M{"$lte": time.Now()}},
+		options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return err
+	}
+	var customers []models.Customer
+	if err := cursor.All(ctx, &customers); err != nil {
+		return err
+	}
+	for _, customer := range customers {
+		if err := refreshCustomerRollups(ctx, customer.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RepairRollups recomputes the rollups of every customer and company.
+func RepairRollups(ctx context.Context) error {
+	cursor, err := customerCollection.Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	customers := 0
+	for cursor.Next(ctx) {
+		var customer models.Customer
+		if err := cursor.Decode(&customer); err != nil {
+			return err
+		}
+		if err := refreshCustomerRollups(ctx, customer.ID); err != nil {
+			return err
+		}
+		customers++
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+
+	companyIDs, err := companyCollection.Distinct(ctx, "_id", bson.M{})
+	if err != nil {
+		return err
+	}
+	for _, id := range companyIDs {
+		if companyID, ok := id.(primitive.ObjectID); ok {
+			if err := refreshCompanyRollups(ctx, companyID); err != nil {
+				return err
+			}
+		}
+	}
+	log.Printf("Recomputed rollups of %d customers and %d companies", customers, len(companyIDs))
+	return nil
+}
+
+// repairRollups is the handler of the rollup_repair job.
+func repairRollups(ctx context.Context, job models.Job) error {
+	return RepairRollups(ctx)
+}
+
+func containsObjectID(ids []primitive.ObjectID, id primitive.ObjectID) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,566 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/SiddharthaKR/golang-jwt-project/database"
+	helper "github.com/SiddharthaKR/golang-jwt-project/helpers"
+	"github.com/SiddharthaKR/golang-jwt-project/models"
+	"github.com/SiddharthaKR/golang-jwt-project/outbox"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var slaPolicyCollection *mongo.Collection = database.OpenCollection(database.Client, "sla_policy")
+
+const defaultAtRiskPercent = 80
+
+// CreateSLAPolicy adds an SLA policy to a company. Staff only.
+func CreateSLAPolicy() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		companyID, err := primitive.ObjectIDFromHex(c.Param("company_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+			return
+		}
+		if isCustomerToken(c) || !checkUserAccessToCompany(c.GetString("uid"), companyID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var policy models.SLAPolicy
+		if err := c.BindJSON(&policy); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if msg := validateSLAPolicy(policy, companyID); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+
+		policy.ID = primitive.NewObjectID()
+		policy.CompanyID = companyID
+		if policy.AtRiskPercent == 0 {
+			policy.AtRiskPercent = defaultAtRiskPercent
+		}
+		policy.CreatedAt = time.Now()
+		policy.UpdatedAt = time.Now()
+
+		if _, err := slaPolicyCollection.InsertOne(ctx, policy); err != nil {
+			log.Println("Error creating SLA policy:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while creating SLA policy"})
+			return
+		}
+
+		c.JSON(http.StatusOK, policy)
+	}
+}
+
+// GetSLAPolicies lists a company's SLA policies. Staff only.
+func GetSLAPolicies() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		companyID, err := primitive.ObjectIDFromHex(c.Param("company_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+			return
+		}
+		if isCustomerToken(c) || !checkUserAccessToCompany(c.GetString("uid"), companyID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		cursor, err := slaPolicyCollection.Find(ctx, bson.M{"companyID": companyID})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving SLA policies"})
+			return
+		}
+		defer cursor.Close(ctx)
+
+		policies := []models.SLAPolicy{}
+		if err = cursor.All(ctx, &policies); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while decoding SLA policies"})
+			return
+		}
+
+		c.JSON(http.StatusOK, policies)
+	}
+}
+
+// UpdateSLAPolicy replaces an SLA policy. Tickets already covered keep their due times.
+func UpdateSLAPolicy() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		policyID, err := primitive.ObjectIDFromHex(c.Param("policy_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid policy ID"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var existing models.SLAPolicy
+		if err := slaPolicyCollection.FindOne(ctx, bson.M{"_id": policyID}).Decode(&existing); err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "SLA policy not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving SLA policy"})
+			return
+		}
+		if isCustomerToken(c) || !checkUserAccessToCompany(c.GetString("uid"), existing.CompanyID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+			return
+		}
+
+		var policy models.SLAPolicy
+		if err := c.BindJSON(&policy); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if msg := validateSLAPolicy(policy, existing.CompanyID); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+
+		policy.ID = existing.ID
+		policy.CompanyID = existing.CompanyID
+		if policy.AtRiskPercent == 0 {
+			policy.AtRiskPercent = defaultAtRiskPercent
+		}
+		policy.CreatedAt = existing.CreatedAt
+		policy.UpdatedAt = time.Now()
+
+		if _, err := slaPolicyCollection.ReplaceOne(ctx, bson.M{"_id": policyID}, policy); err != nil {
+			log.Println("Error updating SLA policy:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while updating SLA policy"})
+			return
+		}
+
+		c.JSON(http.StatusOK, policy)
+	}
+}
+
+// DeleteSLAPolicy removes an SLA policy.
+func DeleteSLAPolicy() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		policyID, err := primitive.ObjectIDFromHex(c.Param("policy_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid policy ID"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var existing models.SLAPolicy
+		if err := slaPolicyCollection.FindOne(ctx, bson.M{"_id": policyID}).Decode(&existing); err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "SLA policy not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving SLA policy"})
+			return
+		}
+		if isCustomerToken(c) || !checkUserAccessToCompany(c.GetString("uid"), existing.CompanyID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+			return
+		}
+
+		if _, err := slaPolicyCollection.DeleteOne(ctx, bson.M{"_id": policyID}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while deleting SLA policy"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "SLA policy deleted successfully"})
+	}
+}
+
+// GetSLAReport summarises SLA outcomes for a company's tickets by priority.
+func GetSLAReport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		companyID, err := primitive.ObjectIDFromHex(c.Query("company_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+			return
+		}
+		if isCustomerToken(c) || !checkUserAccessToCompany(c.GetString("uid"), companyID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		match := bson.M{"companyID": companyID, "type": "TICKET", "sla": bson.M{"$exists": true}}
+		dateFilter := bson.M{}
+		if startDate := c.Query("start_date"); startDate != "" {
+			start, _ := time.Parse(time.RFC3339, startDate)
+			dateFilter["$gte"] = start
+		}
+		if endDate := c.Query("end_date"); endDate != "" {
+			end, _ := time.Parse(time.RFC3339, endDate)
+			dateFilter["$lte"] = end
+		}
+		if len(dateFilter) > 0 {
+			match["created_at"] = dateFilter
+		}
+
+		countState := func(field string, state string) bson.M {
+			return bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{field, state}}, 1, 0}}}
+		}
+		breached := bson.M{"$or": bson.A{
+			bson.M{"$eq": bson.A{"$sla.first_response_state", "BREACHED"}},
+			bson.M{"$eq": bson.A{"$sla.resolution_state", "BREACHED"}},
+		}}
+		pipeline := mongo.Pipeline{
+			bson.D{{Key: "$match", Value: match}},
+			bson.D{{Key: "$group", Value: bson.M{
+				"_id":                     "$priority",
+				"tickets":                 bson.M{"$sum": 1},
+				"first_response_met":      countState("$sla.first_response_state", "MET"),
+				"first_response_at_risk":  countState("$sla.first_response_state", "AT_RISK"),
+				"first_response_breached": countState("$sla.first_response_state", "BREACHED"),
+				"resolution_met":          countState("$sla.resolution_state", "MET"),
+				"resolution_at_risk":      countState("$sla.resolution_state", "AT_RISK"),
+				"resolution_breached":     countState("$sla.resolution_state", "BREACHED"),
+				"breached_ticket_ids":     bson.M{"$push": bson.M{"$cond": bson.A{breached, "$_id", "$$REMOVE"}}},
+			}}},
+			bson.D{{Key: "$sort", Value: bson.M{"_id": 1}}},
+		}
+
+		cursor, err := interactionCollection.Aggregate(ctx, pipeline)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching SLA report"})
+			return
+		}
+
+		var results []bson.M
+		if err = cursor.All(ctx, &results); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error decoding SLA report"})
+			return
+		}
+
+		c.JSON(http.StatusOK, results)
+	}
+}
+
+// validateSLAPolicy returns an error message, or an empty string if the policy is usable for
+// the company. REASSIGN escalations must name a user with access to the company.
+func validateSLAPolicy(policy models.SLAPolicy, companyID primitive.ObjectID) string {
+	if validationErr := validate.Struct(policy); validationErr != nil {
+		return validationErr.Error()
+	}
+	if err := helper.ValidateBusinessHours(policy.BusinessHours); err != nil {
+		return "Business hours need a valid time zone, at least one day and a start before the end"
+	}
+	for _, escalation := range policy.Escalations {
+		if escalation.Action != "REASSIGN" {
+			continue
+		}
+		if escalation.AssigneeID.IsZero() {
+			return "REASSIGN escalations need an assignee_id"
+		}
+		if !checkUserAccessToCompany(escalation.AssigneeID.Hex(), companyID) {
+			return "The assignee " + escalation.AssigneeID.Hex() + " does not have access to this company"
+		}
+	}
+	return ""
+}
+
+// findSLAPolicy returns the active policy that best matches a ticket. A policy for the exact
+// priority and category wins over one for the priority alone, which wins over a catch-all.
+func findSLAPolicy(ctx context.Context, companyID primitive.ObjectID, priority string, category string) (*models.SLAPolicy, error) {
+	cursor, err := slaPolicyCollection.Find(ctx, bson.M{"companyID": companyID, "active": true})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var policies []models.SLAPolicy
+	if err = cursor.All(ctx, &policies); err != nil {
+		return nil, err
+	}
+
+	var best *models.SLAPolicy
+	bestScore := -1
+	for i := range policies {
+		policy := &policies[i]
+		if (policy.Priority != "" && policy.Priority != priority) || (policy.Category != "" && policy.Category != category) {
+			continue
+		}
+		score := 0
+		if policy.Priority != "" {
+			score += 2
+		}
+		if policy.Category != "" {
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = policy, score
+		}
+	}
+	return best, nil
+}
+
+// applySLAPolicy computes due times for a ticket from the policy that matches it now.
+// Due times are measured from the ticket's creation, so a priority change moves them.
+func applySLAPolicy(ctx context.Context, ticket models.Interaction) error {
+	policy, err := findSLAPolicy(ctx, ticket.CompanyID, ticket.Priority, ticket.Category)
+	if err != nil {
+		return err
+	}
+	if policy == nil {
+		_, err = interactionCollection.UpdateOne(ctx, bson.M{"_id": ticket.ID}, bson.M{"$unset": bson.M{"sla": ""}})
+		return err
+	}
+
+	firstResponseDue, err := helper.AddBusinessMinutes(ticket.CreatedAt, policy.FirstResponseMinutes, policy.BusinessHours)
+	if err != nil {
+		return err
+	}
+	resolutionDue, err := helper.AddBusinessMinutes(ticket.CreatedAt, policy.ResolutionMinutes, policy.BusinessHours)
+	if err != nil {
+		return err
+	}
+
+	sla := models.TicketSLA{
+		PolicyID:           policy.ID,
+		FirstResponseDueAt: firstResponseDue,
+		ResolutionDueAt:    resolutionDue,
+		FirstResponseState: "PENDING",
+		ResolutionState:    "PENDING",
+	}
+	if ticket.SLA != nil {
+		sla.EscalationsApplied = ticket.SLA.EscalationsApplied
+	}
+	ticket.SLA = &sla
+
+	if _, err = interactionCollection.UpdateOne(ctx, bson.M{"_id": ticket.ID}, bson.M{"$set": bson.M{"sla": sla}}); err != nil {
+		return err
+	}
+	return evaluateTicketSLA(ctx, ticket, *policy, time.Now())
+}
+
+// markFirstResponse records the first staff response on a ticket and re-evaluates its SLA.
+func markFirstResponse(ctx context.Context, ticketID primitive.ObjectID) {
+	_, err := interactionCollection.UpdateOne(ctx,
+		bson.M{"_id": ticketID, "first_responded_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"first_responded_at": time.Now()}},
+	)
+	if err != nil {
+		log.Println("Error recording first response:", err)
+		return
+	}
+	refreshTicketSLA(ctx, ticketID)
+}
+
+// refreshTicketSLA re-evaluates a ticket's SLA after it has changed.
+func refreshTicketSLA(ctx context.Context, ticketID primitive.ObjectID) {
+	var ticket models.Interaction
+	if err := interactionCollection.FindOne(ctx, bson.M{"_id": ticketID}).Decode(&ticket); err != nil || ticket.SLA == nil {
+		return
+	}
+	var policy models.SLAPolicy
+	if err := slaPolicyCollection.FindOne(ctx, bson.M{"_id": ticket.SLA.PolicyID}).Decode(&policy); err != nil {
+		return
+	}
+	if err := evaluateTicketSLA(ctx, ticket, policy, time.Now()); err != nil {
+		log.Println("Error evaluating SLA:", err)
+	}
+}
+
+// slaTargetState works out where a single target stands. Breaches are final.
+func slaTargetState(current string, doneAt time.Time, dueAt time.Time, start time.Time, targetMinutes int, policy models.SLAPolicy, now time.Time) string {
+	if current == "BREACHED" {
+		return current
+	}
+	if !doneAt.IsZero() {
+		if doneAt.After(dueAt) {
+			return "BREACHED"
+		}
+		return "MET"
+	}
+	if now.After(dueAt) {
+		return "BREACHED"
+	}
+	elapsed, err := helper.BusinessMinutesBetween(start, now, policy.BusinessHours)
+	if err == nil && elapsed*100 >= targetMinutes*policy.AtRiskPercent {
+		return "AT_RISK"
+	}
+	return "PENDING"
+}
+
+// evaluateTicketSLA refreshes a ticket's SLA states and runs any escalations that are now due.
+func evaluateTicketSLA(ctx context.Context, ticket models.Interaction, policy models.SLAPolicy, now time.Time) error {
+	if ticket.SLA == nil {
+		return nil
+	}
+	sla := *ticket.SLA
+
+	resolvedAt := time.Time{}
+	if ticket.Status == "RESOLVED" || ticket.Status == "CLOSED" {
+		resolvedAt = ticket.ResolvedAt
+		if resolvedAt.IsZero() {
+			resolvedAt = ticket.ClosedAt
+		}
+	}
+
+	sla.FirstResponseState = slaTargetState(sla.FirstResponseState, ticket.FirstRespondedAt, sla.FirstResponseDueAt, ticket.CreatedAt, policy.FirstResponseMinutes, policy, now)
+	sla.ResolutionState = slaTargetState(sla.ResolutionState, resolvedAt, sla.ResolutionDueAt, ticket.CreatedAt, policy.ResolutionMinutes, policy, now)
+	if sla.FirstResponseState == "BREACHED" && sla.FirstResponseBreach.IsZero() {
+		sla.FirstResponseBreach = now
+	}
+	if sla.ResolutionState == "BREACHED" && sla.ResolutionBreach.IsZero() {
+		sla.ResolutionBreach = now
+	}
+	sla.EvaluatedAt = now
+
+	set := bson.M{}
+	for i, escalation := range policy.Escalations {
+		state := sla.ResolutionState
+		if escalation.Target == "FIRST_RESPONSE" {
+			state = sla.FirstResponseState
+		}
+		triggered := state == "BREACHED" || (escalation.Trigger == "AT_RISK" && state == "AT_RISK")
+		key := fmt.Sprintf("%d:%s:%s:%s", i, escalation.Target, escalation.Trigger, escalation.Action)
+		if !triggered || containsString(sla.EscalationsApplied, key) {
+			continue
+		}
+
+		switch escalation.Action {
+		case "REASSIGN":
+			// The assignee may have lost access to the company since the policy was saved
+			if checkUserAccessToCompany(escalation.AssigneeID.Hex(), ticket.CompanyID) {
+				set["assigneeID"] = escalation.AssigneeID
+			} else {
+				log.Println("Skipping SLA reassignment of ticket", ticket.ID.Hex(), "to user without access", escalation.AssigneeID.Hex())
+			}
+		case "RAISE_PRIORITY":
+			if next := nextTicketPriority(ticket.Priority); next != ticket.Priority {
+				set["priority"] = next
+				ticket.Priority = next
+			}
+		case "NOTIFY_MANAGER":
+			notifySLAEscalation(ctx, ticket, escalation, key, state)
+		}
+		sla.EscalationsApplied = append(sla.EscalationsApplied, key)
+	}
+	set["sla"] = sla
+
+	_, err := interactionCollection.UpdateOne(ctx, bson.M{"_id": ticket.ID}, bson.M{"$set": set})
+	return err
+}
+
+func nextTicketPriority(priority string) string {
+	for i, p := range models.TicketPriorities {
+		if p == priority && i+1 < len(models.TicketPriorities) {
+			return models.TicketPriorities[i+1]
+		}
+	}
+	return priority
+}
+
+// notifySLAEscalation emails the escalation address, or every manager of the ticket's company.
+// key identifies the escalation within the policy.
+func notifySLAEscalation(ctx context.Context, ticket models.Interaction, escalation models.SLAEscalation, key string, state string) {
+	var to []string
+	if escalation.NotifyEmail != "" {
+		to = append(to, escalation.NotifyEmail)
+	} else {
+		cursor, err := userCollection.Find(ctx, bson.M{"user_type": "MANAGER", "CompanyIDs": ticket.CompanyID})
+		if err != nil {
+			log.Println("Error finding managers for SLA escalation:", err)
+			return
+		}
+		var managers []models.User
+		if err = cursor.All(ctx, &managers); err != nil {
+			log.Println("Error decoding managers for SLA escalation:", err)
+			return
+		}
+		for _, manager := range managers {
+			if manager.Email != nil {
+				to = append(to, *manager.Email)
+			}
+		}
+	}
+	if len(to) == 0 {
+		log.Println("No recipients for SLA escalation on ticket", ticket.ID.Hex())
+		return
+	}
+
+	target := "resolution"
+	if escalation.Target == "FIRST_RESPONSE" {
+		target = "first response"
+	}
+	subject := fmt.Sprintf("SLA %s: ticket %s", state, ticket.ID.Hex())
+	body := fmt.Sprintf("The %s target for ticket %s (priority %s) is %s.\n\n%s",
+		target, ticket.ID.Hex(), ticket.Priority, state, ticket.Description)
+	// Keyed on the ticket and escalation, so a sweep that fails after queueing it does not
+	// queue it again
+	msg := models.OutboxMessage{
+		ID:        outbox.KeyID("sla_escalation:" + ticket.ID.Hex() + ":" + key),
+		CompanyID: ticket.CompanyID,
+		Source:    "sla_escalation",
+		To:        to,
+		Subject:   subject,
+		Text:      body,
+	}
+	if err := outbox.Enqueue(ctx, &msg); err != nil && !mongo.IsDuplicateKeyError(err) {
+		log.Println("Error queueing SLA escalation email:", err)
+	}
+}
+
+// EvaluateSLAs re-evaluates every ticket whose SLA targets are still running.
+func EvaluateSLAs(ctx context.Context) error {
+	cursor, err := interactionCollection.Find(ctx, bson.M{
+		"type": "TICKET",
+		"sla":  bson.M{"$exists": true},
+		"$or": bson.A{
+			bson.M{"sla.first_response_state": bson.M{"$in": bson.A{"PENDING", "AT_RISK"}}},
+			bson.M{"sla.resolution_state": bson.M{"$in": bson.A{"PENDING", "AT_RISK"}}},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	policies := map[primitive.ObjectID]*models.SLAPolicy{}
+	now := time.Now()
+	for cursor.Next(ctx) {
+		var ticket models.Interaction
+		if err := cursor.Decode(&ticket); err != nil {
+			log.Println("Error decoding ticket for SLA evaluation:", err)
+			continue
+		}
+
+		policy, ok := policies[ticket.SLA.PolicyID]
+		if !ok {
+			var found models.SLAPolicy
+			if err := slaPolicyCollection.FindOne(ctx, bson.M{"_id": ticket.SLA.PolicyID}).Decode(&found); err == nil {
+				policy = &found
+			}
+			policies[ticket.SLA.PolicyID] = policy
+		}
+		if policy == nil {
+			continue
+		}
+
+		if err := evaluateTicketSLA(ctx, ticket, *policy, now); err != nil {
+			log.Println("Error evaluating SLA for ticket", ticket.ID.Hex(), ":", err)
+		}
+	}
+	return cursor.Err()
+}
@@ -0,0 +1,357 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/mail"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SiddharthaKR/golang-jwt-project/database"
+	helper "github.com/SiddharthaKR/golang-jwt-project/helpers"
+	"github.com/SiddharthaKR/golang-jwt-project/models"
+	"github.com/SiddharthaKR/golang-jwt-project/outbox"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var suppressionCollection *mongo.Collection = database.OpenCollection(database.Client, "suppression")
+
+// maxFeedbackEvents bounds how many notifications one feedback request may carry.
+const maxFeedbackEvents = 1000
+
+// emailFeedback is a bounce or complaint notification from a mail service.
+type emailFeedback struct {
+	Type       string     `json:"type"`        // BOUNCE or COMPLAINT
+	Email      string     `json:"email"`       // The recipient that bounced or complained
+	BounceType string     `json:"bounce_type"` // HARD (the default) or SOFT
+	MessageID  string     `json:"message_id"`  // Message-ID of the email, if known
+	Detail     string     `json:"detail"`      // e.g. the SMTP diagnostic
+	OccurredAt *time.Time `json:"occurred_at"`
+}
+
+// emailFeedbackResult reports what was done with one notification.
+type emailFeedbackResult struct {
+	Email      string `json:"email"`
+	Type       string `json:"type"`
+	Suppressed bool   `json:"suppressed"` // A new suppression was added
+	OutboxID   string `json:"outbox_id,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// GetSuppressions lists suppressed addresses, newest first. Staff pass the company_id they
+// work for and see its suppressions and those of every company; ADMIN users may leave it out to
+// see all. Filters: email and reason. Paging: page and recordPerPage.
+func GetSuppressions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		filter := bson.M{}
+		if companyParam := c.Query("company_id"); companyParam != "" {
+			companyID, err := primitive.ObjectIDFromHex(companyParam)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+				return
+			}
+			if isCustomerToken(c) || !checkUserAccessToCompany(c.GetString("uid"), companyID) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+				return
+			}
+			filter["companyID"] = bson.M{"$in": bson.A{primitive.NilObjectID, companyID}}
+		} else if err := helper.CheckUserType(c, "ADMIN"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "company_id is required"})
+			return
+		}
+		if email := c.Query("email"); email != "" {
+			filter["email"] = strings.ToLower(strings.TrimSpace(email))
+		}
+		if reason := c.Query("reason"); reason != "" {
+			filter["reason"] = strings.ToUpper(reason)
+		}
+		recordPerPage, err := strconv.Atoi(c.Query("recordPerPage"))
+		if err != nil || recordPerPage < 1 {
+			recordPerPage = 20
+		}
+		page, err := strconv.Atoi(c.Query("page"))
+		if err != nil || page < 1 {
+			page = 1
+		}
+
+		total, err := suppressionCollection.CountDocuments(ctx, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while counting suppressions"})
+			return
+		}
+		cursor, err := suppressionCollection.Find(ctx, filter, options.Find().
+			SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+			SetSkip(int64((page-1)*recordPerPage)).
+			SetLimit(int64(recordPerPage)))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving suppressions"})
+			return
+		}
+		suppressions := []models.Suppression{}
+		if err := cursor.All(ctx, &suppressions); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while decoding suppressions"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"total_count": total, "suppressions": suppressions})
+	}
+}
+
+// CreateSuppression suppresses an address by hand. Staff suppress it for a company they work
+// for; only ADMIN users may leave company_id out to suppress it for every company.
+func CreateSuppression() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var requestBody struct {
+			Email     string `json:"email"`
+			CompanyID string `json:"company_id"`
+			Reason    string `json:"reason"` // MANUAL by default
+			Detail    string `json:"detail"`
+		}
+		if err := c.BindJSON(&requestBody); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		addr, err := mail.ParseAddress(requestBody.Email)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email address"})
+			return
+		}
+		reason := strings.ToUpper(requestBody.Reason)
+		if reason == "" {
+			reason = "MANUAL"
+		}
+		if !containsString(models.SuppressionReasons, reason) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reason " + requestBody.Reason})
+			return
+		}
+		if len(requestBody.Detail) > 500 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "detail must be at most 500 characters"})
+			return
+		}
+
+		var companyID primitive.ObjectID
+		if requestBody.CompanyID != "" {
+			if companyID, err = primitive.ObjectIDFromHex(requestBody.CompanyID); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+				return
+			}
+			if isCustomerToken(c) || !checkUserAccessToCompany(c.GetString("uid"), companyID) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+				return
+			}
+		} else if err := helper.CheckUserType(c, "ADMIN"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "company_id is required"})
+			return
+		}
+
+		suppression := models.Suppression{
+			ID:        primitive.NewObjectID(),
+			Email:     strings.ToLower(addr.Address),
+			CompanyID: companyID,
+			Reason:    reason,
+			Source:    "manual",
+			Detail:    requestBody.Detail,
+			CreatedBy: c.GetString("uid"),
+			CreatedAt: time.Now(),
+		}
+		created, err := helper.AddSuppression(ctx, suppression)
+		if err != nil {
+			log.Println("Error adding suppression:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while adding suppression"})
+			return
+		}
+		if !created {
+			c.JSON(http.StatusConflict, gin.H{"error": "The address is already suppressed"})
+			return
+		}
+		c.JSON(http.StatusOK, suppression)
+	}
+}
+
+// DeleteSuppression takes an address off the suppression list. Suppressions for every company
+// can only be removed by ADMIN users. Removing an unsubscribe does not record consent; the
+// customer has to grant it.
+func DeleteSuppression() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		suppressionID, err := primitive.ObjectIDFromHex(c.Param("suppression_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid suppression ID"})
+			return
+		}
+		var suppression models.Suppression
+		if err := suppressionCollection.FindOne(ctx, bson.M{"_id": suppressionID}).Decode(&suppression); err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Suppression not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving suppression"})
+			return
+		}
+		if suppression.CompanyID.IsZero() {
+			if err := helper.CheckUserType(c, "ADMIN"); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		} else if isCustomerToken(c) || !checkUserAccessToCompany(c.GetString("uid"), suppression.CompanyID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+			return
+		}
+
+		if _, err := suppressionCollection.DeleteOne(ctx, bson.M{"_id": suppression.ID}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while deleting suppression"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Suppression deleted successfully"})
+	}
+}
+
+// ReceiveEmailFeedback accepts bounce and complaint notifications from a mail service, as one
+// JSON object or an array of them. The caller authenticates with the EMAIL_FEEDBACK_TOKEN in
+// the X-Feedback-Token header; the endpoint is disabled while that is unset. Hard bounces and
+// complaints suppress the address for every company. Soft bounces are only noted on the email.
+func ReceiveEmailFeedback() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := os.Getenv("EMAIL_FEEDBACK_TOKEN")
+		given := c.GetHeader("X-Feedback-Token")
+		if token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(given)) != 1 {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Invalid feedback token"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		data, err := ioutil.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, 5<<20))
+		if err != nil {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Request body is too large"})
+			return
+		}
+		var notifications []emailFeedback
+		if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+			err = json.Unmarshal(trimmed, &notifications)
+		} else {
+			var notification emailFeedback
+			err = json.Unmarshal(trimmed, &notification)
+			notifications = []emailFeedback{notification}
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+		if len(notifications) > maxFeedbackEvents {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "At most " + strconv.Itoa(maxFeedbackEvents) + " notifications per request"})
+			return
+		}
+
+		results := make([]emailFeedbackResult, 0, len(notifications))
+		for _, notification := range notifications {
+			result, err := processEmailFeedback(ctx, notification)
+			if err != nil {
+				log.Println("Error processing email feedback for", notification.Email, ":", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while processing feedback"})
+				return
+			}
+			results = append(results, result)
+		}
+		c.JSON(http.StatusOK, gin.H{"results": results})
+	}
+}
+
+// processEmailFeedback applies one bounce or complaint. The email it is about, found by
+// Message-ID, is marked bounced or complained about. A complaint also withdraws the customer's
+// EMAIL MARKETING consent. Invalid notifications are reported in the result, not as an error.
+func processEmailFeedback(ctx context.Context, feedback emailFeedback) (emailFeedbackResult, error) {
+	result := emailFeedbackResult{Email: feedback.Email, Type: strings.ToUpper(feedback.Type)}
+	addr, err := mail.ParseAddress(feedback.Email)
+	if err != nil {
+		result.Error = "Invalid email address"
+		return result, nil
+	}
+	bounceType := strings.ToUpper(feedback.BounceType)
+	switch {
+	case result.Type == "BOUNCE" && (bounceType == "" || bounceType == "HARD" || bounceType == "PERMANENT"):
+	case result.Type == "BOUNCE" && (bounceType == "SOFT" || bounceType == "TRANSIENT"):
+	case result.Type == "COMPLAINT":
+	default:
+		result.Error = "Unknown feedback type"
+		return result, nil
+	}
+	at := time.Now()
+	if feedback.OccurredAt != nil {
+		at = *feedback.OccurredAt
+	}
+
+	var msg models.OutboxMessage
+	if messageID := strings.Trim(strings.TrimSpace(feedback.MessageID), "<>"); messageID != "" {
+		msg, err = outbox.GetByMessageID(ctx, messageID)
+		if err != nil && err != outbox.ErrNotFound {
+			return result, err
+		}
+		if err == nil {
+			result.OutboxID = msg.ID.Hex()
+			if err := outbox.RecordEvent(ctx, msg.ID, result.Type, at); err != nil {
+				return result, err
+			}
+		}
+	}
+	if result.Type == "BOUNCE" && (bounceType == "SOFT" || bounceType == "TRANSIENT") {
+		return result, nil
+	}
+
+	result.Suppressed, err = helper.AddSuppression(ctx, models.Suppression{
+		Email:      addr.Address,
+		Reason:     result.Type,
+		Source:     "feedback",
+		Detail:     feedback.Detail,
+		OutboxID:   msg.ID,
+		CampaignID: msg.CampaignID,
+		CreatedAt:  at,
+	})
+	if err != nil || result.Type != "COMPLAINT" || msg.CustomerID.IsZero() {
+		return result, err
+	}
+
+	var customer models.Customer
+	if err := customerCollection.FindOne(ctx, bson.M{"_id": msg.CustomerID}).Decode(&customer); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return result, nil
+		}
+		return result, err
+	}
+	withdrawn, err := hasWithdrawnEmailMarketing(ctx, customer.ID)
+	if err != nil || withdrawn {
+		return result, err
+	}
+	consent := models.Consent{
+		ID:         primitive.NewObjectID(),
+		CustomerID: customer.ID,
+		CompanyID:  customer.CompanyID,
+		Channel:    "EMAIL",
+		Purpose:    "MARKETING",
+		Status:     "WITHDRAWN",
+		Source:     "complaint",
+		RecordedAt: at,
+		CreatedAt:  time.Now(),
+	}
+	return result, recordConsent(ctx, customer, consent, msg.ID)
+}
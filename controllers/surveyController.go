@@ -0,0 +1,970 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SiddharthaKR/golang-jwt-project/database"
+	helper "github.com/SiddharthaKR/golang-jwt-project/helpers"
+	"github.com/SiddharthaKR/golang-jwt-project/models"
+	"github.com/SiddharthaKR/golang-jwt-project/outbox"
+	"github.com/SiddharthaKR/golang-jwt-project/scheduler"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var surveyCollection *mongo.Collection = database.OpenCollection(database.Client, "survey")
+var surveyResponseCollection *mongo.Collection = database.OpenCollection(database.Client, "survey_response")
+
+// Surveys are sent by background jobs: ticketSurveyJobType is a one-shot job per resolution of
+// a ticket, scheduledSurveyJobType a recurring job per SCHEDULE survey named "survey:<survey_id>".
+const ticketSurveyJobType = "ticket_survey"
+const scheduledSurveyJobType = "scheduled_survey"
+
+// surveyBatchJobType queues the emails of a run of a scheduled survey, surveyRatePerMinute at
+// a time, as a chain of one-shot jobs named "survey_batch:<survey_id>:<run>:<batch>".
+const surveyBatchJobType = "survey_batch"
+const surveyRatePerMinute = 60
+
+// surveyLinkTTL is how long the response links in a survey email stay valid.
+const surveyLinkTTL = 30 * 24 * time.Hour
+
+// defaultSurveyDelayMinutes is used when SURVEY_DELAY_MINUTES is not set. The delay gives
+// agents a chance to reopen a ticket before its survey goes out.
+const defaultSurveyDelayMinutes = 60
+
+const maxSurveyCommentLength = 2000
+
+var defaultSurveyQuestions = map[string]string{
+	"CSAT": "How satisfied are you with the support you received?",
+	"NPS":  "How likely are you to recommend us to a friend or colleague?",
+}
+
+// CreateSurvey adds a survey to a company. Staff only.
+func CreateSurvey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		companyID, err := primitive.ObjectIDFromHex(c.Param("company_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+			return
+		}
+		if isCustomerToken(c) || !checkUserAccessToCompany(c.GetString("uid"), companyID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var survey models.Survey
+		if err := c.BindJSON(&survey); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if msg := validateSurvey(survey); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+
+		survey.ID = primitive.NewObjectID()
+		survey.CompanyID = companyID
+		survey.CreatedAt = time.Now()
+		survey.UpdatedAt = time.Now()
+
+		if _, err := surveyCollection.InsertOne(ctx, survey); err != nil {
+			log.Println("Error creating survey:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while creating survey"})
+			return
+		}
+		if err := syncSurveySchedule(ctx, survey); err != nil {
+			log.Println("Error scheduling survey", survey.ID.Hex(), err)
+		}
+
+		c.JSON(http.StatusOK, survey)
+	}
+}
+
+// GetSurveys lists a company's surveys. Staff only.
+func GetSurveys() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		companyID, err := primitive.ObjectIDFromHex(c.Param("company_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+			return
+		}
+		if isCustomerToken(c) || !checkUserAccessToCompany(c.GetString("uid"), companyID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		cursor, err := surveyCollection.Find(ctx, bson.M{"companyID": companyID})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving surveys"})
+			return
+		}
+		defer cursor.Close(ctx)
+
+		surveys := []models.Survey{}
+		if err = cursor.All(ctx, &surveys); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while decoding surveys"})
+			return
+		}
+
+		c.JSON(http.StatusOK, surveys)
+	}
+}
+
+// UpdateSurvey replaces a survey. Set active to false to stop sending it; its type cannot
+// change once it has been sent, so that reports stay comparable.
+func UpdateSurvey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		existing, ok := loadSurvey(ctx, c)
+		if !ok {
+			return
+		}
+
+		var survey models.Survey
+		if err := c.BindJSON(&survey); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if msg := validateSurvey(survey); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+		if survey.Type != existing.Type {
+			sent, err := surveyResponseCollection.CountDocuments(ctx, bson.M{"surveyID": existing.ID})
+			if err != nil || sent > 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "The type of a survey that has been sent cannot change"})
+				return
+			}
+		}
+
+		survey.ID = existing.ID
+		survey.CompanyID = existing.CompanyID
+		survey.CreatedAt = existing.CreatedAt
+		survey.UpdatedAt = time.Now()
+
+		if _, err := surveyCollection.ReplaceOne(ctx, bson.M{"_id": existing.ID}, survey); err != nil {
+			log.Println("Error updating survey:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while updating survey"})
+			return
+		}
+		if err := syncSurveySchedule(ctx, survey); err != nil {
+			log.Println("Error scheduling survey", survey.ID.Hex(), err)
+		}
+
+		c.JSON(http.StatusOK, survey)
+	}
+}
+
+// GetSurveyResponses lists the surveys sent for a survey definition, newest first.
+// Filters: customer_id, interaction_id and responded=true|false. Paging: page and recordPerPage.
+func GetSurveyResponses() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		survey, ok := loadSurvey(ctx, c)
+		if !ok {
+			return
+		}
+
+		filter := bson.M{"surveyID": survey.ID, "pending": bson.M{"$ne": true}}
+		for param, field := range map[string]string{"customer_id": "customerID", "interaction_id": "interactionID"} {
+			if value := c.Query(param); value != "" {
+				id, err := primitive.ObjectIDFromHex(value)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param})
+					return
+				}
+				filter[field] = id
+			}
+		}
+		switch c.Query("responded") {
+		case "true":
+			filter["responded_at"] = bson.M{"$exists": true}
+		case "false":
+			filter["responded_at"] = bson.M{"$exists": false}
+		}
+
+		recordPerPage, err := strconv.Atoi(c.Query("recordPerPage"))
+		if err != nil || recordPerPage < 1 {
+			recordPerPage = 10
+		}
+		page, err := strconv.Atoi(c.Query("page"))
+		if err != nil || page < 1 {
+			page = 1
+		}
+
+		total, err := surveyResponseCollection.CountDocuments(ctx, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving survey responses"})
+			return
+		}
+		cursor, err := surveyResponseCollection.Find(ctx, filter, options.Find().
+			SetSort(bson.D{{Key: "sent_at", Value: -1}, {Key: "_id", Value: -1}}).
+			SetSkip(int64((page-1)*recordPerPage)).
+			SetLimit(int64(recordPerPage)))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving survey responses"})
+			return
+		}
+		responses := []models.SurveyResponse{}
+		if err := cursor.All(ctx, &responses); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while decoding survey responses"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"total_count": total, "responses": responses})
+	}
+}
+
+// GetSurveyReport summarises survey scores of one type (CSAT or NPS), grouped by agent,
+// company or period (day, week or month of sending). company_id is required unless the
+// caller is an ADMIN, who may report across companies.
+func GetSurveyReport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		surveyType := c.Query("type")
+		if surveyType != "CSAT" && surveyType != "NPS" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "type must be CSAT or NPS"})
+			return
+		}
+		match := bson.M{"survey_type": surveyType, "pending": bson.M{"$ne": true}}
+
+		if companyParam := c.Query("company_id"); companyParam != "" {
+			companyID, err := primitive.ObjectIDFromHex(companyParam)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+				return
+			}
+			if isCustomerToken(c) || !checkUserAccessToCompany(c.GetString("uid"), companyID) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+				return
+			}
+			match["companyID"] = companyID
+		} else if err := helper.CheckUserType(c, "ADMIN"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "company_id is required"})
+			return
+		}
+		if surveyParam := c.Query("survey_id"); surveyParam != "" {
+			surveyID, err := primitive.ObjectIDFromHex(surveyParam)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid survey ID"})
+				return
+			}
+			match["surveyID"] = surveyID
+		}
+		dateFilter := bson.M{}
+		if startDate := c.Query("start_date"); startDate != "" {
+			start, _ := time.Parse(time.RFC3339, startDate)
+			dateFilter["$gte"] = start
+		}
+		if endDate := c.Query("end_date"); endDate != "" {
+			end, _ := time.Parse(time.RFC3339, endDate)
+			dateFilter["$lte"] = end
+		}
+		if len(dateFilter) > 0 {
+			match["sent_at"] = dateFilter
+		}
+
+		groupBy := c.DefaultQuery("group_by", "period")
+		var key interface{}
+		switch groupBy {
+		case "agent":
+			key = "$agentID"
+		case "company":
+			key = "$companyID"
+		case "period":
+			formats := map[string]string{"day": "%Y-%m-%d", "week": "%G-W%V", "month": "%Y-%m"}
+			format, ok := formats[c.DefaultQuery("period", "month")]
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "period must be day, week or month"})
+				return
+			}
+			key = bson.M{"$dateToString": bson.M{"format": format, "date": "$sent_at"}}
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "group_by must be agent, company or period"})
+			return
+		}
+
+		countScores := func(min int, max int) bson.M {
+			inRange := bson.M{"$and": bson.A{
+				bson.M{"$gte": bson.A{"$score", min}},
+				bson.M{"$lte": bson.A{"$score", max}},
+			}}
+			return bson.M{"$sum": bson.M{"$cond": bson.A{inRange, 1, 0}}}
+		}
+		group := bson.M{
+			"_id":         key,
+			"sent":        bson.M{"$sum": 1},
+			"responses":   bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$gt": bson.A{"$score", nil}}, 1, 0}}},
+			"total_score": bson.M{"$sum": "$score"},
+		}
+		if surveyType == "NPS" {
+			group["promoters"] = countScores(9, 10)
+			group["passives"] = countScores(7, 8)
+			group["detractors"] = countScores(0, 6)
+		} else {
+			group["satisfied"] = countScores(4, 5)
+		}
+		pipeline := mongo.Pipeline{
+			bson.D{{Key: "$match", Value: match}},
+			bson.D{{Key: "$group", Value: group}},
+			bson.D{{Key: "$sort", Value: bson.M{"_id": 1}}},
+		}
+
+		cursor, err := surveyResponseCollection.Aggregate(ctx, pipeline)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching survey report"})
+			return
+		}
+		var groups []surveyReportGroup
+		if err = cursor.All(ctx, &groups); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error decoding survey report"})
+			return
+		}
+
+		names := surveyReportNames(ctx, groupBy, groups)
+		results := []gin.H{}
+		for _, g := range groups {
+			row := gin.H{"sent": g.Sent, "responses": g.Responses}
+			switch key := g.Key.(type) {
+			case primitive.ObjectID:
+				row[groupBy+"_id"] = key
+				row["name"] = names[key]
+			case string:
+				row[groupBy] = key
+			default:
+				// Surveys sent without an agent, such as scheduled NPS surveys
+				row[groupBy+"_id"] = nil
+			}
+			if g.Sent > 0 {
+				row["response_rate"] = percentage(g.Responses, g.Sent)
+			}
+			if g.Responses > 0 {
+				row["average_score"] = float64(g.TotalScore) / float64(g.Responses)
+				if surveyType == "NPS" {
+					row["promoters"], row["passives"], row["detractors"] = g.Promoters, g.Passives, g.Detractors
+					row["nps"] = percentage(g.Promoters, g.Responses) - percentage(g.Detractors, g.Responses)
+				} else {
+					row["satisfied"] = g.Satisfied
+					row["csat"] = percentage(g.Satisfied, g.Responses)
+				}
+			}
+			results = append(results, row)
+		}
+
+		c.JSON(http.StatusOK, results)
+	}
+}
+
+// RespondToSurvey records a customer's answer to a survey. It is public: the signed link in
+// the survey email is the only credential. GET records the score of the clicked link and shows
+// a form to add a comment, which POSTs back to the same URL. Answers can be changed until the
+// link expires.
+func RespondToSurvey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		responseID := c.Param("response_id")
+		if !helper.VerifyExpiring("survey:"+responseID, c.Query("expires"), c.Query("signature")) {
+			renderSurveyPage(c, http.StatusForbidden, surveyPage{Message: "This survey link is invalid or has expired."})
+			return
+		}
+		objectID, err := primitive.ObjectIDFromHex(responseID)
+		if err != nil {
+			renderSurveyPage(c, http.StatusBadRequest, surveyPage{Message: "This survey link is invalid."})
+			return
+		}
+		var response models.SurveyResponse
+		if err := surveyResponseCollection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&response); err != nil {
+			renderSurveyPage(c, http.StatusNotFound, surveyPage{Message: "This survey no longer exists."})
+			return
+		}
+
+		scoreParam := c.Query("score")
+		comment := ""
+		if c.Request.Method == http.MethodPost {
+			scoreParam = c.PostForm("score")
+			comment = strings.TrimSpace(c.PostForm("comment"))
+			if len(comment) > maxSurveyCommentLength {
+				comment = comment[:maxSurveyCommentLength]
+			}
+		}
+
+		page := surveyPage{Action: c.Request.URL.String()}
+		set := bson.M{}
+		if scoreParam != "" {
+			score, err := strconv.Atoi(scoreParam)
+			min, max := models.SurveyScoreRange(response.SurveyType)
+			if err != nil || score < min || score > max {
+				renderSurveyPage(c, http.StatusBadRequest, surveyPage{Message: fmt.Sprintf("Please choose a score from %d to %d.", min, max)})
+				return
+			}
+			set["score"] = score
+			page.Score = scoreParam
+		} else if response.Score != nil {
+			page.Score = strconv.Itoa(*response.Score)
+		}
+		if c.Request.Method == http.MethodPost {
+			set["comment"] = comment
+		}
+		if len(set) > 0 && page.Score != "" {
+			set["responded_at"] = time.Now()
+			if _, err := surveyResponseCollection.UpdateOne(ctx, bson.M{"_id": objectID}, bson.M{"$set": set}); err != nil {
+				log.Println("Error saving survey response:", err)
+				renderSurveyPage(c, http.StatusInternalServerError, surveyPage{Message: "Your answer could not be saved, please try again."})
+				return
+			}
+		}
+
+		switch {
+		case c.Request.Method == http.MethodPost:
+			page.Message = "Thank you for your feedback!"
+			page.Action = ""
+		case page.Score != "":
+			page.Message = "Thank you! Would you like to tell us more?"
+		default:
+			page.Message = "Please use one of the score links in the email."
+			page.Action = ""
+		}
+		renderSurveyPage(c, http.StatusOK, page)
+	}
+}
+
+// validateSurvey returns an error message, or an empty string if the survey is usable.
+func validateSurvey(survey models.Survey) string {
+	if validationErr := validate.Struct(survey); validationErr != nil {
+		return validationErr.Error()
+	}
+	if survey.Trigger == "SCHEDULE" {
+		if survey.Schedule == "" {
+			return "schedule is required for SCHEDULE surveys"
+		}
+		if _, err := scheduler.ParseSchedule(survey.Schedule); err != nil {
+			return "Invalid schedule: " + err.Error()
+		}
+	}
+	return ""
+}
+
+// loadSurvey finds the survey named by the survey_id parameter and checks the caller is staff
+// of its company. It writes the error response itself and returns false if the request should stop.
+func loadSurvey(ctx context.Context, c *gin.Context) (models.Survey, bool) {
+	var survey models.Survey
+	surveyID, err := primitive.ObjectIDFromHex(c.Param("survey_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid survey ID"})
+		return survey, false
+	}
+	if err := surveyCollection.FindOne(ctx, bson.M{"_id": surveyID}).Decode(&survey); err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Survey not found"})
+			return survey, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving survey"})
+		return survey, false
+	}
+	if isCustomerToken(c) || !checkUserAccessToCompany(c.GetString("uid"), survey.CompanyID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+		return survey, false
+	}
+	return survey, true
+}
+
+func scheduledSurveyJobName(surveyID primitive.ObjectID) string {
+	return "survey:" + surveyID.Hex()
+}
+
+// syncSurveySchedule keeps the recurring job of a survey in line with it: active SCHEDULE
+// surveys run on their schedule, any other survey's job is paused.
+func syncSurveySchedule(ctx context.Context, survey models.Survey) error {
+	name := scheduledSurveyJobName(survey.ID)
+	if survey.Trigger == "SCHEDULE" {
+		if err := scheduler.EnsureRecurring(ctx, name, scheduledSurveyJobType, survey.Schedule); err != nil {
+			return err
+		}
+		_, err := scheduler.SetPaused(ctx, name, !survey.Active)
+		return err
+	}
+	if _, err := scheduler.SetPaused(ctx, name, true); err != scheduler.ErrNotFound {
+		return err
+	}
+	return nil
+}
+
+// surveyDelay returns how long after a ticket is resolved its survey is sent.
+func surveyDelay() time.Duration {
+	minutes := defaultSurveyDelayMinutes
+	if value := os.Getenv("SURVEY_DELAY_MINUTES"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+			minutes = n
+		}
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// scheduleTicketSurvey schedules the survey for a ticket that was just resolved, if its company
+// has an active TICKET_RESOLVED survey. The agent is the ticket's assignee, or the user who
+// resolved it.
+func scheduleTicketSurvey(ctx context.Context, ticket models.Interaction, resolvedAt time.Time, actor string) {
+	count, err := surveyCollection.CountDocuments(ctx, bson.M{"companyID": ticket.CompanyID, "trigger": "TICKET_RESOLVED", "active": true})
+	if err != nil || count == 0 {
+		return
+	}
+	agentID := actor
+	if !ticket.AssigneeID.IsZero() {
+		agentID = ticket.AssigneeID.Hex()
+	}
+	payload := map[string]string{
+		"ticket_id": ticket.ID.Hex(),
+		"agent_id":  agentID,
+	}
+	name := fmt.Sprintf("ticket_survey:%s:%d", ticket.ID.Hex(), resolvedAt.Unix())
+	if err := scheduler.ScheduleOnce(ctx, name, ticketSurveyJobType, resolvedAt.Add(surveyDelay()), payload); err != nil {
+		log.Println("Error scheduling survey for ticket", ticket.ID.Hex(), err)
+	}
+}
+
+// sendTicketSurvey is the handler of ticket survey jobs. It sends the company's newest active
+// TICKET_RESOLVED survey, unless the ticket was reopened or has already been surveyed.
+func sendTicketSurvey(ctx context.Context, job models.Job) error {
+	ticket, err := findTicket(ctx, job.Payload["ticket_id"])
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		return err
+	}
+	if ticket.Status != "RESOLVED" && ticket.Status != "CLOSED" {
+		return nil
+	}
+
+	var survey models.Survey
+	err = surveyCollection.FindOne(ctx, bson.M{"companyID": ticket.CompanyID, "trigger": "TICKET_RESOLVED", "active": true},
+		options.FindOne().SetSort(bson.M{"updated_at": -1})).Decode(&survey)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	sent, err := surveyResponseCollection.CountDocuments(ctx, bson.M{"surveyID": survey.ID, "interactionID": ticket.ID})
+	if err != nil || sent > 0 {
+		return err
+	}
+
+	var customer models.Customer
+	if err := customerCollection.FindOne(ctx, bson.M{"_id": ticket.CustomerID}).Decode(&customer); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		return err
+	}
+	agentID, _ := primitive.ObjectIDFromHex(job.Payload["agent_id"])
+	return sendSurvey(ctx, survey, customer, ticket.ID, agentID)
+}
+
+// sendScheduledSurvey is the handler of scheduled survey jobs. It records a pending response
+// for every customer of the company with an email address and starts the batches that queue
+// their emails. Customers recorded since the job last succeeded are skipped, so a retry does
+// not survey anyone twice.
+func sendScheduledSurvey(ctx context.Context, job models.Job) error {
+	surveyID, err := primitive.ObjectIDFromHex(strings.TrimPrefix(job.Name, "survey:"))
+	if err != nil {
+		return fmt.Errorf("invalid survey job name %q", job.Name)
+	}
+	var survey models.Survey
+	if err := surveyCollection.FindOne(ctx, bson.M{"_id": surveyID}).Decode(&survey); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		return err
+	}
+	if !survey.Active || survey.Trigger != "SCHEDULE" {
+		return nil
+	}
+
+	filter := bson.M{"surveyID": survey.ID}
+	if !job.LastSuccessAt.IsZero() {
+		filter["sent_at"] = bson.M{"$gt": job.LastSuccessAt}
+	}
+	surveyed, err := surveyResponseCollection.Distinct(ctx, "customerID", filter)
+	if err != nil {
+		return err
+	}
+	skip := map[primitive.ObjectID]bool{}
+	for _, id := range surveyed {
+		if customerID, ok := id.(primitive.ObjectID); ok {
+			skip[customerID] = true
+		}
+	}
+
+	cursor, err := customerCollection.Find(ctx, bson.M{"companyID": survey.CompanyID, "email": bson.M{"$nin": bson.A{nil, ""}}},
+		options.Find().SetProjection(bson.M{"email": 1}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	var responses []interface{}
+	flush := func() error {
+		if len(responses) == 0 {
+			return nil
+		}
+		_, err := surveyResponseCollection.InsertMany(ctx, responses)
+		responses = responses[:0]
+		return err
+	}
+	for cursor.Next(ctx) {
+		var customer models.Customer
+		if err := cursor.Decode(&customer); err != nil {
+			return err
+		}
+		if skip[customer.ID] {
+			continue
+		}
+		responses = append(responses, models.SurveyResponse{
+			ID:         primitive.NewObjectID(),
+			SurveyID:   survey.ID,
+			SurveyType: survey.Type,
+			CompanyID:  survey.CompanyID,
+			CustomerID: customer.ID,
+			Email:      *customer.Email,
+			Pending:    true,
+			SentAt:     time.Now(),
+		})
+		if len(responses) == 500 {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	run := int64(0)
+	if !job.LastSuccessAt.IsZero() {
+		run = job.LastSuccessAt.Unix()
+	}
+	return scheduleSurveyBatch(ctx, survey.ID, run, 0, time.Now())
+}
+
+// sendSurveyBatch is the handler of survey batch jobs. Every batch queues up to
+// surveyRatePerMinute pending responses of a scheduled survey, spread over the minute, and
+// schedules the next batch a minute later until none are left. Responses of customers that
+// are gone or whose address is suppressed are dropped, and so are all pending responses of a
+// survey that was deactivated. A response's outbox message has the response's ID, so a
+// retried batch does not queue anyone twice.
+func sendSurveyBatch(ctx context.Context, job models.Job) error {
+	surveyID, err := primitive.ObjectIDFromHex(job.Payload["survey_id"])
+	if err != nil {
+		return fmt.Errorf("invalid survey batch payload %v", job.Payload)
+	}
+	run, _ := strconv.ParseInt(job.Payload["run"], 10, 64)
+	batch, _ := strconv.Atoi(job.Payload["batch"])
+
+	var survey models.Survey
+	err = surveyCollection.FindOne(ctx, bson.M{"_id": surveyID}).Decode(&survey)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return err
+	}
+	if err == mongo.ErrNoDocuments || !survey.Active || survey.Trigger != "SCHEDULE" {
+		_, err := surveyResponseCollection.DeleteMany(ctx, bson.M{"surveyID": surveyID, "pending": true})
+		return err
+	}
+
+	cursor, err := surveyResponseCollection.Find(ctx, bson.M{"surveyID": survey.ID, "pending": true}, options.Find().
+		SetSort(bson.M{"_id": 1}).
+		SetLimit(surveyRatePerMinute))
+	if err != nil {
+		return err
+	}
+	var responses []models.SurveyResponse
+	if err := cursor.All(ctx, &responses); err != nil {
+		return err
+	}
+	customerIDs := make([]primitive.ObjectID, 0, len(responses))
+	addresses := make([]string, 0, len(responses))
+	for _, response := range responses {
+		customerIDs = append(customerIDs, response.CustomerID)
+		addresses = append(addresses, response.Email)
+	}
+	suppressed, err := helper.SuppressedAddresses(ctx, helper.SuppressionScope{CompanyID: survey.CompanyID, Marketing: true}, addresses)
+	if err != nil {
+		return err
+	}
+	cursor, err = customerCollection.Find(ctx, bson.M{"_id": bson.M{"$in": customerIDs}})
+	if err != nil {
+		return err
+	}
+	var found []models.Customer
+	if err := cursor.All(ctx, &found); err != nil {
+		return err
+	}
+	customers := map[primitive.ObjectID]models.Customer{}
+	for _, customer := range found {
+		customers[customer.ID] = customer
+	}
+
+	start := time.Now().UTC()
+	spacing := time.Minute / surveyRatePerMinute
+	for i, response := range responses {
+		customer, ok := customers[response.CustomerID]
+		if _, isSuppressed := suppressed[strings.ToLower(response.Email)]; !ok || isSuppressed {
+			if _, err := surveyResponseCollection.DeleteOne(ctx, bson.M{"_id": response.ID, "pending": true}); err != nil {
+				return err
+			}
+			continue
+		}
+		msg := surveyMessage(survey, customer, response)
+		msg.NextAttemptAt = start.Add(time.Duration(i) * spacing)
+		if err := outbox.Enqueue(ctx, &msg); err != nil && !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+		if _, err := surveyResponseCollection.UpdateOne(ctx, bson.M{"_id": response.ID, "pending": true}, bson.M{"$unset": bson.M{"pending": ""}}); err != nil {
+			return err
+		}
+	}
+
+	pending, err := surveyResponseCollection.CountDocuments(ctx, bson.M{"surveyID": survey.ID, "pending": true})
+	if err != nil {
+		return err
+	}
+	if pending > 0 {
+		return scheduleSurveyBatch(ctx, survey.ID, run, batch+1, start.Add(time.Minute))
+	}
+	return nil
+}
+
+// scheduleSurveyBatch schedules a batch of a run of a scheduled survey. Runs are told apart by
+// when the survey's job last succeeded before them, which its retries share.
+func scheduleSurveyBatch(ctx context.Context, surveyID primitive.ObjectID, run int64, batch int, runAt time.Time) error {
+	payload := map[string]string{
+		"survey_id": surveyID.Hex(),
+		"run":       strconv.FormatInt(run, 10),
+		"batch":     strconv.Itoa(batch),
+	}
+	name := fmt.Sprintf("survey_batch:%s:%d:%d", surveyID.Hex(), run, batch)
+	return scheduler.ScheduleOnce(ctx, name, surveyBatchJobType, runAt, payload)
+}
+
+// sendSurvey records a survey for a customer and queues its email. Customers without an email
+// address, or whose address is suppressed, are skipped.
+func sendSurvey(ctx context.Context, survey models.Survey, customer models.Customer, interactionID primitive.ObjectID, agentID primitive.ObjectID) error {
+	if customer.Email == nil || *customer.Email == "" {
+		return nil
+	}
+	suppressed, err := helper.SuppressedAddresses(ctx, helper.SuppressionScope{CompanyID: survey.CompanyID}, []string{*customer.Email})
+	if err != nil {
+		return err
+	}
+	if len(suppressed) > 0 {
+		return nil
+	}
+	response := models.SurveyResponse{
+		ID:            primitive.NewObjectID(),
+		SurveyID:      survey.ID,
+		SurveyType:    survey.Type,
+		CompanyID:     survey.CompanyID,
+		CustomerID:    customer.ID,
+		InteractionID: interactionID,
+		AgentID:       agentID,
+		Email:         *customer.Email,
+		SentAt:        time.Now(),
+	}
+	if _, err := surveyResponseCollection.InsertOne(ctx, response); err != nil {
+		return err
+	}
+
+	msg := surveyMessage(survey, customer, response)
+	if err := outbox.Enqueue(ctx, &msg); err != nil {
+		// Drop the record so that the retry sends the survey again
+		if _, deleteErr := surveyResponseCollection.DeleteOne(ctx, bson.M{"_id": response.ID}); deleteErr != nil {
+			log.Println("Error removing unsent survey", response.ID.Hex(), deleteErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// surveyMessage builds the email of a survey response, with one signed link per score. The
+// outbox message has the response's ID. Scheduled surveys go to every customer, so unsubscribes
+// apply to them and they carry an unsubscribe link and the List-Unsubscribe headers.
+func surveyMessage(survey models.Survey, customer models.Customer, response models.SurveyResponse) models.OutboxMessage {
+	subject, body := surveyEmail(survey, customer, response)
+	msg := models.OutboxMessage{
+		ID:         response.ID,
+		CompanyID:  survey.CompanyID,
+		CustomerID: customer.ID,
+		Source:     "survey",
+		To:         []string{response.Email},
+		Subject:    subject,
+		Text:       body,
+	}
+	if survey.Trigger == "SCHEDULE" {
+		url := unsubscribeURL(response.ID)
+		content := helper.EmailContent{Text: body}
+		addUnsubscribeFooter(&content, url)
+		msg.Marketing = true
+		msg.Text = content.Text
+		msg.Headers = map[string]string{
+			"List-Unsubscribe":      "<" + url + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		}
+	}
+	return msg
+}
+
+func surveyEmail(survey models.Survey, customer models.Customer, response models.SurveyResponse) (string, string) {
+	question := survey.Question
+	if question == "" {
+		question = defaultSurveyQuestions[survey.Type]
+	}
+	expires, signature := helper.SignExpiring("survey:"+response.ID.Hex(), surveyLinkTTL)
+
+	greeting := "Hello"
+	if customer.FirstName != nil && *customer.FirstName != "" {
+		greeting += " " + *customer.FirstName
+	}
+	body := fmt.Sprintf("%s,\n\n%s\n\nClick a score to answer:\n", greeting, question)
+	min, max := models.SurveyScoreRange(survey.Type)
+	for score := max; score >= min; score-- {
+		url := helper.PublicURL(fmt.Sprintf("/feedback/%s?score=%d&expires=%s&signature=%s", response.ID.Hex(), score, expires, signature))
+		body += fmt.Sprintf("%2d: %s\n", score, url)
+	}
+	body += "\nThank you for your time.\n"
+	return question, body
+}
+
+// surveyReportGroup is one row of the survey report aggregation.
+type surveyReportGroup struct {
+	Key        interface{} `bson:"_id"`
+	Sent       int         `bson:"sent"`
+	Responses  int         `bson:"responses"`
+	TotalScore int         `bson:"total_score"`
+	Satisfied  int         `bson:"satisfied"`
+	Promoters  int         `bson:"promoters"`
+	Passives   int         `bson:"passives"`
+	Detractors int         `bson:"detractors"`
+}
+
+// surveyReportNames looks up the names of the agents or companies a report is grouped by.
+func surveyReportNames(ctx context.Context, groupBy string, groups []surveyReportGroup) map[primitive.ObjectID]string {
+	names := map[primitive.ObjectID]string{}
+	var ids []primitive.ObjectID
+	for _, g := range groups {
+		if id, ok := g.Key.(primitive.ObjectID); ok {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return names
+	}
+
+	switch groupBy {
+	case "agent":
+		userIDs := bson.A{}
+		for _, id := range ids {
+			userIDs = append(userIDs, id.Hex())
+		}
+		cursor, err := userCollection.Find(ctx, bson.M{"user_id": bson.M{"$in": userIDs}})
+		if err != nil {
+			return names
+		}
+		var users []models.User
+		if err := cursor.All(ctx, &users); err != nil {
+			return names
+		}
+		for _, user := range users {
+			id, err := primitive.ObjectIDFromHex(user.UserID)
+			if err != nil || user.FirstName == nil {
+				continue
+			}
+			name := *user.FirstName
+			if user.LastName != nil {
+				name += " " + *user.LastName
+			}
+			names[id] = name
+		}
+	case "company":
+		cursor, err := companyCollection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+		if err != nil {
+			return names
+		}
+		var companies []models.Company
+		if err := cursor.All(ctx, &companies); err != nil {
+			return names
+		}
+		for _, company := range companies {
+			if company.Name != nil {
+				names[company.ID] = *company.Name
+			}
+		}
+	}
+	return names
+}
+
+func percentage(part int, whole int) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return float64(part) * 100 / float64(whole)
+}
+
+// surveyPage is what the survey response page shows. Action is the URL the comment form
+// posts to; the form is hidden when it is empty.
+type surveyPage struct {
+	Message string
+	Score   string
+	Action  string
+}
+
+var surveyPageTemplate = template.Must(template.New("survey").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>Feedback</title></head>
+<body style="font-family: sans-serif; max-width: 32em; margin: 3em auto;">
+<p>{{.Message}}</p>
+{{if .Action}}<form method="post" action="{{.Action}}">
+<input type="hidden" name="score" value="{{.Score}}">
+<p><textarea name="comment" rows="5" style="width: 100%;" maxlength="2000" placeholder="Your comment"></textarea></p>
+<p><button type="submit">Send</button></p>
+</form>{{end}}
+</body>
+</html>
+`))
+
+func renderSurveyPage(c *gin.Context, status int, page surveyPage) {
+	var buf bytes.Buffer
+	if err := surveyPageTemplate.Execute(&buf, page); err != nil {
+		c.String(http.StatusInternalServerError, "Error rendering page")
+		return
+	}
+	c.Data(status, "text/html; charset=utf-8", buf.Bytes())
+}
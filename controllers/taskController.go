@@ -0,0 +1,644 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/SiddharthaKR/golang-jwt-project/database"
+	helper "github.com/SiddharthaKR/golang-jwt-project/helpers"
+	"github.com/SiddharthaKR/golang-jwt-project/models"
+	"github.com/SiddharthaKR/golang-jwt-project/outbox"
+	"github.com/SiddharthaKR/golang-jwt-project/scheduler"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var taskCollection *mongo.Collection = database.OpenCollection(database.Client, "task")
+
+var taskIndexesOnce sync.Once
+
+// taskReminderJobType is the job type of task reminders, sent REMINDER_MINUTES_BEFORE a task is due.
+const taskReminderJobType = "task_reminder"
+
+// taskRequest is the body of task create and update requests. Omitted fields are left unchanged on update.
+type taskRequest struct {
+	TargetType  *string    `json:"target_type"`
+	TargetID    *string    `json:"target_id"`
+	Title       *string    `json:"title"`
+	Description *string    `json:"description"`
+	DueAt       *time.Time `json:"due_at"`
+	TimeZone    *string    `json:"time_zone"`
+	Priority    *string    `json:"priority"`
+	AssigneeID  *string    `json:"assignee_id"`
+	Recurrence  *string    `json:"recurrence"`
+}
+
+// CreateCompanyTask creates a task in a company. It is assigned to the caller unless an assignee is given.
+func CreateCompanyTask() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var requestBody taskRequest
+		if err := c.BindJSON(&requestBody); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		companyID, err := primitive.ObjectIDFromHex(c.Param("company_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Company ID"})
+			return
+		}
+		userID := c.GetString("uid")
+		userObjID, err := primitive.ObjectIDFromHex(userID)
+		if err != nil || isCustomerToken(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized to access this resource"})
+			return
+		}
+		if !checkUserAccessToCompany(userID, companyID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+			return
+		}
+
+		now := time.Now()
+		task := models.Task{
+			ID:         primitive.NewObjectID(),
+			CompanyID:  companyID,
+			Priority:   "NORMAL",
+			Status:     "OPEN",
+			TimeZone:   "UTC",
+			AssigneeID: userObjID,
+			CreatedBy:  userObjID,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		}
+		if status, msg := applyTaskRequest(ctx, &task, requestBody); msg != "" {
+			c.JSON(status, gin.H{"error": msg})
+			return
+		}
+
+		if _, err := taskCollection.InsertOne(ctx, task); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while creating task"})
+			return
+		}
+		scheduleTaskReminder(ctx, task)
+
+		c.JSON(http.StatusOK, task)
+	}
+}
+
+// GetCompanyTasks lists the tasks of a company, soonest due first. Filters: status, assignee_id,
+// target_type with target_id, customer_id, and overdue=true for open tasks past their due date.
+func GetCompanyTasks() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		companyID, err := primitive.ObjectIDFromHex(c.Param("company_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Company ID"})
+			return
+		}
+		if isCustomerToken(c) || !checkUserAccessToCompany(c.GetString("uid"), companyID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+			return
+		}
+
+		filter := bson.M{"companyID": companyID}
+		if status := c.Query("status"); status != "" {
+			filter["status"] = status
+		}
+		if c.Query("overdue") == "true" {
+			filter["status"] = "OPEN"
+			filter["due_at"] = bson.M{"$lt": time.Now()}
+		}
+		for param, field := range map[string]string{"assignee_id": "assigneeID", "target_id": "targetID", "customer_id": "customerID"} {
+			if value := c.Query(param); value != "" {
+				id, err := primitive.ObjectIDFromHex(value)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param})
+					return
+				}
+				filter[field] = id
+			}
+		}
+		if targetType := c.Query("target_type"); targetType != "" {
+			filter["target_type"] = targetType
+		}
+
+		tasks, err := findTasks(ctx, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving tasks"})
+			return
+		}
+		c.JSON(http.StatusOK, tasks)
+	}
+}
+
+// GetUserTasks lists the tasks assigned to a user ("my tasks"), open ones by default.
+// Pass status to see other tasks. Regular users can only read their own tasks.
+func GetUserTasks() gin.HandlerFunc {
+	return userTasks(false)
+}
+
+// GetUserOverdueTasks lists the open tasks of a user that are past their due date.
+func GetUserOverdueTasks() gin.HandlerFunc {
+	return userTasks(true)
+}
+
+func userTasks(overdue bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.Param("user_id")
+		if isCustomerToken(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized to access this resource"})
+			return
+		}
+		if err := helper.MatchUserTypeToUid(c, userID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userObjID, err := primitive.ObjectIDFromHex(userID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid User ID"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		filter := bson.M{"assigneeID": userObjID, "status": "OPEN"}
+		if overdue {
+			filter["due_at"] = bson.M{"$lt": time.Now()}
+		} else if status := c.Query("status"); status != "" {
+			filter["status"] = status
+		}
+
+		tasks, err := findTasks(ctx, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving tasks"})
+			return
+		}
+		c.JSON(http.StatusOK, tasks)
+	}
+}
+
+// GetTaskByID returns a single task to users with access to its company.
+func GetTaskByID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		task, ok := loadTask(ctx, c)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, task)
+	}
+}
+
+// UpdateTaskDetails changes the fields of a task given in the request.
+func UpdateTaskDetails() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var requestBody taskRequest
+		if err := c.BindJSON(&requestBody); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		task, ok := loadTask(ctx, c)
+		if !ok {
+			return
+		}
+		previousDue := task.DueAt
+		previousUpdate := task.UpdatedAt
+
+		if status, msg := applyTaskRequest(ctx, &task, requestBody); msg != "" {
+			c.JSON(status, gin.H{"error": msg})
+			return
+		}
+		task.UpdatedAt = time.Now()
+
+		// Match on the loaded status and update time so that a concurrent change, such as a
+		// completion, is not overwritten with the old values
+		result, err := taskCollection.ReplaceOne(ctx, bson.M{"_id": task.ID, "status": task.Status, "updated_at": previousUpdate}, task)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while updating task"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Task was changed by someone else, please retry"})
+			return
+		}
+		if !task.DueAt.Equal(previousDue) {
+			cancelTaskReminder(ctx, task.ID, previousDue)
+		}
+		scheduleTaskReminder(ctx, task)
+
+		c.JSON(http.StatusOK, task)
+	}
+}
+
+// UpdateTaskState completes, cancels or reopens a task. Completing a recurring task creates
+// the next task of the series, which is returned as next_task.
+func UpdateTaskState() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var requestBody struct {
+			Status string `json:"status" validate:"required"`
+		}
+		if err := c.BindJSON(&requestBody); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !containsString(models.TaskStatuses, requestBody.Status) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
+			return
+		}
+		task, ok := loadTask(ctx, c)
+		if !ok {
+			return
+		}
+		// Completing a completed task again succeeds, and creates its next task if that is missing
+		if task.Status == "COMPLETED" && requestBody.Status == "COMPLETED" {
+			response := gin.H{"message": "Task is already completed"}
+			if task.Recurrence != "" {
+				next, ok, err := createNextTask(ctx, task, task.CompletedAt)
+				if err != nil {
+					log.Println("Error creating next task after", task.ID.Hex(), err)
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Task is completed, but the next task could not be created"})
+					return
+				}
+				if ok {
+					response["next_task"] = next
+				}
+			}
+			c.JSON(http.StatusOK, response)
+			return
+		}
+		if task.Status == requestBody.Status {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Task is already " + task.Status})
+			return
+		}
+
+		now := time.Now()
+		set := bson.M{"status": requestBody.Status, "updated_at": now}
+		update := bson.M{"$set": set}
+		if requestBody.Status == "COMPLETED" {
+			set["completed_at"] = now
+			if actorID, err := primitive.ObjectIDFromHex(c.GetString("uid")); err == nil {
+				set["completedBy"] = actorID
+			}
+		} else {
+			update["$unset"] = bson.M{"completed_at": "", "completedBy": ""}
+		}
+
+		// Match on the old status so that a recurring task cannot be completed twice
+		result, err := taskCollection.UpdateOne(ctx, bson.M{"_id": task.ID, "status": task.Status}, update)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while updating task"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Task was changed by someone else, please retry"})
+			return
+		}
+
+		task.Status = requestBody.Status
+		if task.Status == "OPEN" {
+			scheduleTaskReminder(ctx, task)
+		} else {
+			cancelTaskReminder(ctx, task.ID, task.DueAt)
+		}
+
+		response := gin.H{"message": "Task updated successfully"}
+		if task.Status == "COMPLETED" && task.Recurrence != "" {
+			next, ok, err := createNextTask(ctx, task, now)
+			if err != nil {
+				log.Println("Error creating next task after", task.ID.Hex(), err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Task completed, but the next task could not be created"})
+				return
+			}
+			if ok {
+				response["next_task"] = next
+			}
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// applyTaskRequest copies the fields given in the request onto the task and validates the result.
+// It returns an HTTP status and error message when the request is invalid.
+func applyTaskRequest(ctx context.Context, task *models.Task, requestBody taskRequest) (int, string) {
+	if requestBody.Title != nil {
+		task.Title = *requestBody.Title
+	}
+	if requestBody.Description != nil {
+		task.Description = *requestBody.Description
+	}
+	if requestBody.DueAt != nil {
+		task.DueAt = *requestBody.DueAt
+	}
+	if requestBody.TimeZone != nil {
+		task.TimeZone = *requestBody.TimeZone
+	}
+	if requestBody.Priority != nil {
+		task.Priority = *requestBody.Priority
+	}
+	if requestBody.Recurrence != nil {
+		task.Recurrence = normalizeRRule(*requestBody.Recurrence)
+	}
+
+	if requestBody.AssigneeID != nil {
+		assigneeID, err := primitive.ObjectIDFromHex(*requestBody.AssigneeID)
+		if err != nil {
+			return http.StatusBadRequest, "Invalid assignee ID"
+		}
+		if !checkUserAccessToCompany(*requestBody.AssigneeID, task.CompanyID) {
+			return http.StatusBadRequest, "Assignee does not have access to this company"
+		}
+		task.AssigneeID = assigneeID
+	}
+
+	if requestBody.TargetType != nil || requestBody.TargetID != nil {
+		task.TargetType, task.TargetID, task.CustomerID = "", primitive.NilObjectID, primitive.NilObjectID
+		if requestBody.TargetType != nil && *requestBody.TargetType != "" {
+			if requestBody.TargetID == nil {
+				return http.StatusBadRequest, "target_id is required with target_type"
+			}
+			targetID, err := primitive.ObjectIDFromHex(*requestBody.TargetID)
+			if err != nil {
+				return http.StatusBadRequest, "Invalid target ID"
+			}
+			customerID, status, msg := resolveTaskTarget(ctx, task.CompanyID, *requestBody.TargetType, targetID)
+			if msg != "" {
+				return status, msg
+			}
+			task.TargetType, task.TargetID, task.CustomerID = *requestBody.TargetType, targetID, customerID
+		}
+	}
+
+	if validationErr := validate.Struct(task); validationErr != nil {
+		return http.StatusBadRequest, validationErr.Error()
+	}
+	if _, err := time.LoadLocation(task.TimeZone); err != nil {
+		return http.StatusBadRequest, "Invalid time zone"
+	}
+	if task.Recurrence != "" {
+		if _, err := helper.ParseRRule(task.Recurrence); err != nil {
+			return http.StatusBadRequest, "Invalid recurrence rule: " + err.Error()
+		}
+	}
+	return http.StatusOK, ""
+}
+
+// resolveTaskTarget checks that a task target belongs to the company and returns its customer, if any.
+func resolveTaskTarget(ctx context.Context, companyID primitive.ObjectID, targetType string, targetID primitive.ObjectID) (primitive.ObjectID, int, string) {
+	switch targetType {
+	case "CUSTOMER":
+		count, err := customerCollection.CountDocuments(ctx, bson.M{"_id": targetID, "companyID": companyID})
+		if err != nil || count == 0 {
+			return primitive.NilObjectID, http.StatusNotFound, "Customer not found"
+		}
+		return targetID, http.StatusOK, ""
+	case "LEAD":
+		count, err := leadCollection.CountDocuments(ctx, bson.M{"_id": targetID, "company_id": companyID})
+		if err != nil || count == 0 {
+			return primitive.NilObjectID, http.StatusNotFound, "Lead not found"
+		}
+		return primitive.NilObjectID, http.StatusOK, ""
+	case "DEAL":
+		var deal models.Deal
+		if err := dealCollection.FindOne(ctx, bson.M{"_id": targetID, "companyID": companyID}).Decode(&deal); err != nil {
+			return primitive.NilObjectID, http.StatusNotFound, "Deal not found"
+		}
+		return deal.CustomerID, http.StatusOK, ""
+	case "TICKET":
+		var ticket models.Interaction
+		if err := interactionCollection.FindOne(ctx, bson.M{"_id": targetID, "type": "TICKET", "companyID": companyID}).Decode(&ticket); err != nil {
+			return primitive.NilObjectID, http.StatusNotFound, "Ticket not found"
+		}
+		return ticket.CustomerID, http.StatusOK, ""
+	}
+	return primitive.NilObjectID, http.StatusBadRequest, "target_type must be CUSTOMER, LEAD, DEAL or TICKET"
+}
+
+// createNextTask creates the task that follows a completed recurring task. The next due date
+// is the first occurrence of the rule, counted from the completed task's due date, after both
+// that due date and the time of completion. It reports false when the series has ended, or when
+// the task already has its next task. The unique index on previousID keeps concurrent
+// completions from creating two.
+func createNextTask(ctx context.Context, task models.Task, completedAt time.Time) (models.Task, bool, error) {
+	ensureTaskIndexes()
+	followed, err := taskCollection.CountDocuments(ctx, bson.M{"previousID": task.ID})
+	if err != nil {
+		return task, false, err
+	}
+	if followed > 0 {
+		return task, false, nil
+	}
+	rule, err := helper.ParseRRule(task.Recurrence)
+	if err != nil {
+		return task, false, err
+	}
+	location, err := time.LoadLocation(task.TimeZone)
+	if err != nil {
+		location = time.UTC
+	}
+
+	// The rule restarts at every task, so COUNT is carried over as the number of tasks left
+	after := task.DueAt
+	if completedAt.After(after) {
+		after = completedAt
+	}
+	var due time.Time
+	skipped := 0
+	rule.Each(task.DueAt, location, func(start time.Time) bool {
+		if start.After(after) {
+			due = start
+			return false
+		}
+		skipped++
+		return true
+	})
+	if due.IsZero() {
+		return task, false, nil
+	}
+	if rule.Count > 0 {
+		rule.Count -= skipped
+	}
+
+	now := time.Now()
+	next := task
+	next.ID = primitive.NewObjectID()
+	next.DueAt = due
+	next.Status = "OPEN"
+	next.Recurrence = rule.String()
+	next.PreviousID = task.ID
+	next.CompletedAt = time.Time{}
+	next.CompletedBy = primitive.NilObjectID
+	next.CreatedAt = now
+	next.UpdatedAt = now
+	if _, err := taskCollection.InsertOne(ctx, next); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			// Another request created the next task first
+			return task, false, nil
+		}
+		return task, false, err
+	}
+	scheduleTaskReminder(ctx, next)
+	return next, true, nil
+}
+
+// ensureTaskIndexes creates the index that gives a recurring task one next task at most.
+func ensureTaskIndexes() {
+	taskIndexesOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		_, err := taskCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys: bson.M{"previousID": 1},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"previousID": bson.M{"$exists": true}}),
+		})
+		if err != nil {
+			log.Println("Error creating task indexes:", err)
+		}
+	})
+}
+
+// loadTask finds the task named by the task_id parameter and checks the caller may see it.
+// It writes the error response itself and returns false if the request should stop.
+func loadTask(ctx context.Context, c *gin.Context) (models.Task, bool) {
+	var task models.Task
+	taskID, err := primitive.ObjectIDFromHex(c.Param("task_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+		return task, false
+	}
+	if err := taskCollection.FindOne(ctx, bson.M{"_id": taskID}).Decode(&task); err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+			return task, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving task"})
+		return task, false
+	}
+	if isCustomerToken(c) || !checkUserAccessToCompany(c.GetString("uid"), task.CompanyID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this task"})
+		return task, false
+	}
+	return task, true
+}
+
+func findTasks(ctx context.Context, filter bson.M) ([]models.Task, error) {
+	cursor, err := taskCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "due_at", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	tasks := []models.Task{}
+	if err := cursor.All(ctx, &tasks); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+func taskReminderJobName(taskID primitive.ObjectID, due time.Time) string {
+	return fmt.Sprintf("task_reminder:%s:%d", taskID.Hex(), due.Unix())
+}
+
+// scheduleTaskReminder schedules the reminder email for an open task that is not yet due.
+func scheduleTaskReminder(ctx context.Context, task models.Task) {
+	lead := reminderLead()
+	if lead == 0 || task.Status != "OPEN" || !task.DueAt.After(time.Now()) {
+		return
+	}
+	payload := map[string]string{
+		"task_id": task.ID.Hex(),
+		"due_at":  task.DueAt.UTC().Format(time.RFC3339Nano),
+	}
+	if err := scheduler.ScheduleOnce(ctx, taskReminderJobName(task.ID, task.DueAt), taskReminderJobType, task.DueAt.Add(-lead), payload); err != nil {
+		log.Println("Error scheduling reminder for task", task.ID.Hex(), err)
+	}
+}
+
+func cancelTaskReminder(ctx context.Context, taskID primitive.ObjectID, due time.Time) {
+	if err := scheduler.Cancel(ctx, taskReminderJobName(taskID, due)); err != nil {
+		log.Println("Error cancelling reminder for task", taskID.Hex(), err)
+	}
+}
+
+// sendTaskReminder is the handler of task reminder jobs. It emails the assignee unless the task
+// was completed, cancelled or moved in the meantime.
+func sendTaskReminder(ctx context.Context, job models.Job) error {
+	taskID, err := primitive.ObjectIDFromHex(job.Payload["task_id"])
+	if err != nil {
+		return fmt.Errorf("invalid task_id %q", job.Payload["task_id"])
+	}
+	due, err := time.Parse(time.RFC3339, job.Payload["due_at"])
+	if err != nil {
+		return fmt.Errorf("invalid due_at %q", job.Payload["due_at"])
+	}
+
+	var task models.Task
+	if err := taskCollection.FindOne(ctx, bson.M{"_id": taskID}).Decode(&task); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		return err
+	}
+	// Compared in seconds, like the job name; older payloads dropped fractional seconds
+	if task.Status != "OPEN" || task.DueAt.Unix() != due.Unix() {
+		return nil
+	}
+
+	var assignee models.User
+	if err := userCollection.FindOne(ctx, bson.M{"user_id": task.AssigneeID.Hex()}).Decode(&assignee); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		return err
+	}
+	if assignee.Email == nil || *assignee.Email == "" {
+		return nil
+	}
+
+	location, err := time.LoadLocation(task.TimeZone)
+	if err != nil {
+		location = time.UTC
+	}
+	subject := "Task due: " + task.Title
+	body := fmt.Sprintf("%s\n\nDue: %s (%s)\nPriority: %s\n", task.Title,
+		task.DueAt.In(location).Format("Mon Jan 2, 2006 15:04"), location.String(), task.Priority)
+	if task.TargetType != "" {
+		body += fmt.Sprintf("Linked to: %s %s\n", typeLabel(task.TargetType), task.TargetID.Hex())
+	}
+	if task.Description != "" {
+		body += "\n" + task.Description + "\n"
+	}
+	// Keyed on the job, so a retried job does not queue the reminder twice
+	msg := models.OutboxMessage{
+		ID:        outbox.KeyID(job.Name),
+		CompanyID: task.CompanyID,
+		Source:    taskReminderJobType,
+		To:        []string{*assignee.Email},
+		Subject:   subject,
+		Text:      body,
+	}
+	if err := outbox.Enqueue(ctx, &msg); err != nil && !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,377 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/SiddharthaKR/golang-jwt-project/database"
+	"github.com/SiddharthaKR/golang-jwt-project/events"
+	"github.com/SiddharthaKR/golang-jwt-project/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var ticketCategoryCollection *mongo.Collection = database.OpenCollection(database.Client, "ticket_category")
+
+var errInvalidTicketTransition = errors.New("ticket cannot move to that status")
+
+// isCustomerToken reports whether the request was made with a token issued by CustomerLogin.
+func isCustomerToken(c *gin.Context) bool {
+	return c.GetString("user_type") == "CUSTOMER"
+}
+
+// authorizeInteraction checks that the caller is the customer the interaction belongs to,
+// or a user with access to the interaction's company.
+func authorizeInteraction(c *gin.Context, interaction models.Interaction) bool {
+	uid := c.GetString("uid")
+	if isCustomerToken(c) {
+		return interaction.CustomerID.Hex() == uid
+	}
+	return checkUserAccessToCompany(uid, interaction.CompanyID)
+}
+
+// customerVisible reports whether customers may see an interaction of their own. Only tickets
+// are shared with them; calls, emails, notes, tasks and meetings are the company's records.
+func customerVisible(interaction models.Interaction) bool {
+	return interaction.Type == "TICKET"
+}
+
+// findTicket loads a TICKET interaction by its hex ID.
+func findTicket(ctx context.Context, ticketIDParam string) (models.Interaction, error) {
+	var ticket models.Interaction
+	ticketID, err := primitive.ObjectIDFromHex(ticketIDParam)
+	if err != nil {
+		return ticket, err
+	}
+	err = interactionCollection.FindOne(ctx, bson.M{"_id": ticketID, "type": "TICKET"}).Decode(&ticket)
+	return ticket, err
+}
+
+// changeTicketStatus moves a ticket to a new status if the transition is allowed,
+// maintaining its resolution timestamps, reopen count and status history.
+func changeTicketStatus(ctx context.Context, ticket models.Interaction, to string, actor string) error {
+	if !containsString(models.TicketTransitions[ticket.Status], to) {
+		return errInvalidTicketTransition
+	}
+
+	now := time.Now()
+	change := models.StatusChange{From: ticket.Status, To: to, ChangedAt: now}
+	if actorID, err := primitive.ObjectIDFromHex(actor); err == nil {
+		change.ChangedBy = actorID
+	}
+
+	update := bson.M{
+		"$set":  bson.M{"status": to, "updated_at": now},
+		"$push": bson.M{"status_history": change},
+	}
+	set := update["$set"].(bson.M)
+	switch to {
+	case "RESOLVED":
+		set["resolved_at"] = now
+	case "CLOSED":
+		set["closed_at"] = now
+	case "OPEN":
+		if ticket.Status == "RESOLVED" {
+			update["$inc"] = bson.M{"reopen_count": 1}
+			update["$unset"] = bson.M{"resolved_at": ""}
+		}
+	}
+
+	// Match on the old status so that concurrent changes cannot skip a transition check
+	result, err := interactionCollection.UpdateOne(ctx, bson.M{"_id": ticket.ID, "status": ticket.Status}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errInvalidTicketTransition
+	}
+	publishInteractionEvent(ctx, events.InteractionUpdated, ticket)
+	if to == "RESOLVED" {
+		scheduleTicketSurvey(ctx, ticket, now, actor)
+	}
+	return nil
+}
+
+// ticketStatusAfterReply returns the status a ticket should move to when a reply is posted on it.
+// A customer reply reopens a ticket that was waiting on them or already resolved;
+// the first public staff reply takes a NEW ticket into OPEN.
+func ticketStatusAfterReply(status string, fromCustomer bool) string {
+	if fromCustomer {
+		switch status {
+		case "PENDING_CUSTOMER", "RESOLVED":
+			return "OPEN"
+		}
+		return status
+	}
+	if status == "NEW" {
+		return "OPEN"
+	}
+	return status
+}
+
+// GetTicket returns a single ticket to its customer or to staff of its company.
+func GetTicket() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		ticket, err := findTicket(ctx, c.Param("ticket_id"))
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Ticket not found"})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ticket ID"})
+			return
+		}
+		if !authorizeInteraction(c, ticket) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this ticket"})
+			return
+		}
+
+		c.JSON(http.StatusOK, ticket)
+	}
+}
+
+// GetCompanyTickets lists a company's tickets for staff, filterable by status, priority, category, tag and assignee.
+func GetCompanyTickets() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		companyID, err := primitive.ObjectIDFromHex(c.Param("company_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+			return
+		}
+		if isCustomerToken(c) || !checkUserAccessToCompany(c.GetString("uid"), companyID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		filter := bson.M{"companyID": companyID, "type": "TICKET"}
+		for _, field := range []string{"status", "priority", "category"} {
+			if value := c.Query(field); value != "" {
+				filter[field] = value
+			}
+		}
+		if tag := c.Query("tag"); tag != "" {
+			filter["tags"] = tag
+		}
+		if assignee := c.Query("assignee_id"); assignee != "" {
+			assigneeID, err := primitive.ObjectIDFromHex(assignee)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assignee ID"})
+				return
+			}
+			filter["assigneeID"] = assigneeID
+		}
+
+		cursor, err := interactionCollection.Find(ctx, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving tickets"})
+			return
+		}
+		defer cursor.Close(ctx)
+
+		tickets := []models.Interaction{}
+		if err = cursor.All(ctx, &tickets); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while decoding tickets"})
+			return
+		}
+
+		c.JSON(http.StatusOK, tickets)
+	}
+}
+
+// UpdateTicket changes a ticket's priority, category or assignee. Staff only.
+func UpdateTicket() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var requestBody struct {
+			Priority   string `json:"priority"`
+			Category   string `json:"category"`
+			AssigneeID string `json:"assignee_id"`
+		}
+		if err := c.BindJSON(&requestBody); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ticket, err := findTicket(ctx, c.Param("ticket_id"))
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Ticket not found"})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ticket ID"})
+			return
+		}
+		if isCustomerToken(c) || !authorizeInteraction(c, ticket) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this ticket"})
+			return
+		}
+
+		update := bson.M{}
+		if requestBody.Priority != "" {
+			if !containsString(models.TicketPriorities, requestBody.Priority) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid priority"})
+				return
+			}
+			update["priority"] = requestBody.Priority
+		}
+		if requestBody.Category != "" {
+			if msg := validateTicketCategory(ctx, ticket.CompanyID, requestBody.Category); msg != "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+				return
+			}
+			update["category"] = requestBody.Category
+		}
+		if requestBody.AssigneeID != "" {
+			assigneeID, err := primitive.ObjectIDFromHex(requestBody.AssigneeID)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assignee ID"})
+				return
+			}
+			if !checkUserAccessToCompany(requestBody.AssigneeID, ticket.CompanyID) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Assignee does not have access to this company"})
+				return
+			}
+			update["assigneeID"] = assigneeID
+		}
+
+		if len(update) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
+			return
+		}
+		update["updated_at"] = time.Now()
+
+		if _, err := interactionCollection.UpdateOne(ctx, bson.M{"_id": ticket.ID}, bson.M{"$set": update}); err != nil {
+			log.Println("Error updating ticket:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while updating ticket"})
+			return
+		}
+
+		// Priority and category decide which SLA policy applies
+		if requestBody.Priority != "" || requestBody.Category != "" {
+			if requestBody.Priority != "" {
+				ticket.Priority = requestBody.Priority
+			}
+			if requestBody.Category != "" {
+				ticket.Category = requestBody.Category
+			}
+			if err := applySLAPolicy(ctx, ticket); err != nil {
+				log.Println("Error applying SLA policy to ticket:", err)
+			}
+		}
+		publishInteractionEvent(ctx, events.InteractionUpdated, ticket)
+
+		c.JSON(http.StatusOK, gin.H{"message": "Ticket updated successfully"})
+	}
+}
+
+// CreateTicketCategory adds a ticket category to a company. Once a company has categories,
+// tickets may only use those.
+func CreateTicketCategory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		companyID, err := primitive.ObjectIDFromHex(c.Param("company_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+			return
+		}
+		if isCustomerToken(c) || !checkUserAccessToCompany(c.GetString("uid"), companyID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var category models.TicketCategory
+		if err := c.BindJSON(&category); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(category); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		count, err := ticketCategoryCollection.CountDocuments(ctx, bson.M{"companyID": companyID, "name": category.Name})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while checking category"})
+			return
+		}
+		if count > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Category already exists"})
+			return
+		}
+
+		category.ID = primitive.NewObjectID()
+		category.CompanyID = companyID
+		category.CreatedAt = time.Now()
+
+		if _, err := ticketCategoryCollection.InsertOne(ctx, category); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while creating category"})
+			return
+		}
+
+		c.JSON(http.StatusOK, category)
+	}
+}
+
+// GetTicketCategories lists a company's ticket categories.
+func GetTicketCategories() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		companyID, err := primitive.ObjectIDFromHex(c.Param("company_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		cursor, err := ticketCategoryCollection.Find(ctx, bson.M{"companyID": companyID})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving categories"})
+			return
+		}
+		defer cursor.Close(ctx)
+
+		categories := []models.TicketCategory{}
+		if err = cursor.All(ctx, &categories); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while decoding categories"})
+			return
+		}
+
+		c.JSON(http.StatusOK, categories)
+	}
+}
+
+// validateTicketCategory checks a category against the company's list, if it has one.
+// It returns an error message, or an empty string if the category may be used.
+func validateTicketCategory(ctx context.Context, companyID primitive.ObjectID, category string) string {
+	total, err := ticketCategoryCollection.CountDocuments(ctx, bson.M{"companyID": companyID})
+	if err != nil {
+		return "Error occurred while checking category"
+	}
+	if total == 0 {
+		return ""
+	}
+	count, err := ticketCategoryCollection.CountDocuments(ctx, bson.M{"companyID": companyID, "name": category})
+	if err != nil {
+		return "Error occurred while checking category"
+	}
+	if count == 0 {
+		return "Unknown ticket category"
+	}
+	return ""
+}
@@ -0,0 +1,283 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/SiddharthaKR/golang-jwt-project/database"
+	"github.com/SiddharthaKR/golang-jwt-project/models"
+	"github.com/SiddharthaKR/golang-jwt-project/outbox"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ticketMessageCollection *mongo.Collection = database.OpenCollection(database.Client, "ticket_message")
+
+// maxMessageAttachments bounds the attachment_ids of one ticket message.
+const maxMessageAttachments = 20
+
+// PostTicketMessage adds a reply or internal note to a ticket.
+// Customers may only post public replies on their own tickets. Files are uploaded to the ticket
+// first and referenced by attachment_ids; each can belong to one message.
+func PostTicketMessage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var requestBody struct {
+			Body          string   `json:"body"`
+			Visibility    string   `json:"visibility"`
+			AttachmentIDs []string `json:"attachment_ids"`
+		}
+		if err := c.BindJSON(&requestBody); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		message := models.TicketMessage{Body: requestBody.Body, Visibility: requestBody.Visibility}
+		if message.Visibility == "" {
+			message.Visibility = "PUBLIC"
+		}
+		if validationErr := validate.Struct(message); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+		if len(requestBody.AttachmentIDs) > maxMessageAttachments {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("A message can have at most %d attachments", maxMessageAttachments)})
+			return
+		}
+
+		ticket, err := findTicket(ctx, c.Param("ticket_id"))
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Ticket not found"})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ticket ID"})
+			return
+		}
+		if !authorizeInteraction(c, ticket) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this ticket"})
+			return
+		}
+
+		fromCustomer := isCustomerToken(c)
+		if fromCustomer && message.Visibility != "PUBLIC" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Customers cannot post internal notes"})
+			return
+		}
+		if ticket.Status == "CLOSED" && message.Visibility == "PUBLIC" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Ticket is closed; raise a new ticket instead"})
+			return
+		}
+
+		uid := c.GetString("uid")
+		authorID, err := primitive.ObjectIDFromHex(uid)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid User ID"})
+			return
+		}
+
+		message.ID = primitive.NewObjectID()
+		attachments, msg, err := loadMessageAttachments(ctx, ticket, message, requestBody.AttachmentIDs)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving attachments"})
+			return
+		}
+		if msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+		message.Attachments = attachments
+
+		message.TicketID = ticket.ID
+		message.CompanyID = ticket.CompanyID
+		message.CustomerID = ticket.CustomerID
+		message.AuthorID = authorID
+		message.AuthorType = "USER"
+		if fromCustomer {
+			message.AuthorType = "CUSTOMER"
+		}
+		message.AuthorName = strings.TrimSpace(c.GetString("first_name") + " " + c.GetString("last_name"))
+		message.CreatedAt = time.Now()
+
+		if _, err := ticketMessageCollection.InsertOne(ctx, message); err != nil {
+			log.Println("Error saving ticket message:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while saving message"})
+			return
+		}
+		if err := linkMessageAttachments(ctx, message); err != nil {
+			log.Println("Error linking attachments to ticket message:", err)
+		}
+
+		afterTicketMessage(ctx, ticket, message, uid)
+
+		c.JSON(http.StatusOK, message)
+	}
+}
+
+// loadMessageAttachments looks up the attachments a new message refers to. Each must have been
+// uploaded to the ticket and not be part of another message, and a public message cannot carry
+// internal files. The returned metadata comes from the stored attachments. It returns an error
+// message, or an empty string if all attachments are usable.
+func loadMessageAttachments(ctx context.Context, ticket models.Interaction, message models.TicketMessage, attachmentIDs []string) ([]models.MessageAttachment, string, error) {
+	var attachments []models.MessageAttachment
+	seen := map[primitive.ObjectID]bool{}
+	for _, idParam := range attachmentIDs {
+		attachmentID, err := primitive.ObjectIDFromHex(idParam)
+		if err != nil {
+			return nil, "Invalid attachment ID " + idParam, nil
+		}
+		if seen[attachmentID] {
+			continue
+		}
+		seen[attachmentID] = true
+
+		var attachment models.Attachment
+		err = attachmentCollection.FindOne(ctx, bson.M{"_id": attachmentID, "target_type": "INTERACTION", "targetID": ticket.ID}).Decode(&attachment)
+		if err == mongo.ErrNoDocuments {
+			return nil, "Attachment " + idParam + " was not uploaded to this ticket", nil
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		if !attachment.MessageID.IsZero() {
+			return nil, "Attachment " + idParam + " belongs to another message", nil
+		}
+		if attachment.Internal && message.Visibility == "PUBLIC" {
+			return nil, "Attachment " + idParam + " is internal and cannot be added to a public message", nil
+		}
+		attachments = append(attachments, models.MessageAttachment{
+			AttachmentID: attachment.ID,
+			FileName:     attachment.FileName,
+			ContentType:  attachment.ContentType,
+			Size:         attachment.Size,
+		})
+	}
+	return attachments, "", nil
+}
+
+// linkMessageAttachments records on each attachment of a saved message that it belongs to the
+// message. Files of internal notes become internal.
+func linkMessageAttachments(ctx context.Context, message models.TicketMessage) error {
+	if len(message.Attachments) == 0 {
+		return nil
+	}
+	ids := bson.A{}
+	for _, attachment := range message.Attachments {
+		ids = append(ids, attachment.AttachmentID)
+	}
+	set := bson.M{"messageID": message.ID}
+	if message.Visibility == "INTERNAL" {
+		set["internal"] = true
+	}
+	_, err := attachmentCollection.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": ids}, "messageID": bson.M{"$exists": false}}, bson.M{"$set": set})
+	return err
+}
+
+// afterTicketMessage updates a ticket once a message has been saved on it and notifies the other side.
+// Public replies move the ticket along: a customer reply reopens it, and a staff reply counts
+// as the first response.
+func afterTicketMessage(ctx context.Context, ticket models.Interaction, message models.TicketMessage, actor string) {
+	fromCustomer := message.AuthorType == "CUSTOMER"
+	if message.Visibility == "PUBLIC" {
+		if next := ticketStatusAfterReply(ticket.Status, fromCustomer); next != ticket.Status {
+			if err := changeTicketStatus(ctx, ticket, next, actor); err != nil {
+				log.Println("Error updating ticket status after reply:", err)
+			}
+		}
+		if fromCustomer {
+			refreshTicketSLA(ctx, ticket.ID)
+		} else {
+			markFirstResponse(ctx, ticket.ID)
+		}
+	}
+	if _, err := interactionCollection.UpdateOne(ctx, bson.M{"_id": ticket.ID}, bson.M{"$set": bson.M{"updated_at": time.Now()}}); err != nil {
+		log.Println("Error touching ticket after message:", err)
+	}
+
+	go notifyTicketMessage(ticket, message)
+}
+
+// GetTicketMessages returns a ticket's conversation, oldest first. Customers only see public messages.
+func GetTicketMessages() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		ticket, err := findTicket(ctx, c.Param("ticket_id"))
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Ticket not found"})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ticket ID"})
+			return
+		}
+		if !authorizeInteraction(c, ticket) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this ticket"})
+			return
+		}
+
+		filter := bson.M{"ticketID": ticket.ID}
+		if isCustomerToken(c) {
+			filter["visibility"] = "PUBLIC"
+		}
+
+		cursor, err := ticketMessageCollection.Find(ctx, filter, options.Find().SetSort(bson.M{"created_at": 1}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving messages"})
+			return
+		}
+		defer cursor.Close(ctx)
+
+		messages := []models.TicketMessage{}
+		if err = cursor.All(ctx, &messages); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while decoding messages"})
+			return
+		}
+
+		c.JSON(http.StatusOK, messages)
+	}
+}
+
+// notifyTicketMessage emails the other side of the conversation about a new message.
+// Customer replies and internal notes go to the ticket's assignee; staff public replies go to the customer.
+func notifyTicketMessage(ticket models.Interaction, message models.TicketMessage) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var to []string
+	if message.AuthorType == "USER" && message.Visibility == "PUBLIC" {
+		var customer models.Customer
+		if err := customerCollection.FindOne(ctx, bson.M{"_id": ticket.CustomerID}).Decode(&customer); err == nil && customer.Email != nil {
+			to = append(to, *customer.Email)
+		}
+	} else if !ticket.AssigneeID.IsZero() && ticket.AssigneeID != message.AuthorID {
+		var assignee models.User
+		if err := userCollection.FindOne(ctx, bson.M{"user_id": ticket.AssigneeID.Hex()}).Decode(&assignee); err == nil && assignee.Email != nil {
+			to = append(to, *assignee.Email)
+		}
+	}
+	if len(to) == 0 {
+		return
+	}
+
+	kind := "reply"
+	if message.Visibility == "INTERNAL" {
+		kind = "internal note"
+	}
+	// The token in the subject threads email replies back onto the ticket
+	subject := fmt.Sprintf("New %s on ticket %s", kind, ticketSubjectToken(ticket.ID))
+	body := fmt.Sprintf("%s wrote:\n\n%s", message.AuthorName, message.Body)
+	msg := models.OutboxMessage{CompanyID: ticket.CompanyID, Source: "ticket_message", To: to, Subject: subject, Text: body}
+	if err := outbox.Enqueue(ctx, &msg); err != nil {
+		log.Println("Error queueing ticket message notification:", err)
+	}
+}
@@ -0,0 +1,538 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SiddharthaKR/golang-jwt-project/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// maxTimelineWindow caps page * recordPerPage. Every source is read up to the end of the
+// requested page before the sources are merged, so deeper pages need a narrower date range.
+const maxTimelineWindow = 2000
+
+// timelineQuery selects the events of one customer.
+type timelineQuery struct {
+	CustomerID primitive.ObjectID
+	Window     bson.M // Range on the event time
+	Types      []string
+	Limit      int64 // Newest events each source has to return
+}
+
+func (q timelineQuery) wants(eventType string) bool {
+	return len(q.Types) == 0 || containsString(q.Types, eventType)
+}
+
+// timelineSource loads the newest q.Limit events of its types, and counts all of them.
+type timelineSource func(ctx context.Context, q timelineQuery) ([]models.TimelineEvent, int64, error)
+
+var timelineSources = []timelineSource{
+	interactionTimeline,
+	statusChangeTimeline,
+	meetingChangeTimeline,
+	ticketMessageTimeline,
+	dealTimeline,
+	dealStageTimeline,
+	customerChangeTimeline,
+	emailEventTimeline,
+}
+
+// GetCustomerTimeline returns everything that happened with a customer, newest first:
+// interactions, emails, status changes, meeting changes, ticket messages, deals and changes
+// to the customer record. Filters: type (comma-separated event types), start_date and
+// end_date (RFC 3339). Paging: page and recordPerPage (default 20, at most 100).
+// Staff only; internal ticket notes are included.
+func GetCustomerTimeline() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		customerID, err := primitive.ObjectIDFromHex(c.Param("customer_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Customer ID"})
+			return
+		}
+		if isCustomerToken(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized to access this resource"})
+			return
+		}
+
+		var customer models.Customer
+		if err := customerCollection.FindOne(ctx, bson.M{"_id": customerID}).Decode(&customer); err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while retrieving customer"})
+			return
+		}
+		if !checkUserAccessToCompany(c.GetString("uid"), customer.CompanyID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this company"})
+			return
+		}
+
+		recordPerPage, err := strconv.Atoi(c.Query("recordPerPage"))
+		if err != nil || recordPerPage < 1 {
+			recordPerPage = 20
+		}
+		if recordPerPage > 100 {
+			recordPerPage = 100
+		}
+		page, err := strconv.Atoi(c.Query("page"))
+		if err != nil || page < 1 {
+			page = 1
+		}
+		if page*recordPerPage > maxTimelineWindow {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Page is too deep, narrow the date range instead"})
+			return
+		}
+
+		query := timelineQuery{CustomerID: customerID, Window: bson.M{}, Limit: int64(page * recordPerPage)}
+		if value := c.Query("start_date"); value != "" {
+			start, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "start_date must be RFC 3339"})
+				return
+			}
+			query.Window["$gte"] = start
+		}
+		if value := c.Query("end_date"); value != "" {
+			end, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "end_date must be RFC 3339"})
+				return
+			}
+			query.Window["$lte"] = end
+		}
+		if value := c.Query("type"); value != "" {
+			for _, eventType := range strings.Split(value, ",") {
+				eventType = strings.ToUpper(strings.TrimSpace(eventType))
+				if !containsString(models.TimelineEventTypes, eventType) {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown event type " + eventType})
+					return
+				}
+				query.Types = append(query.Types, eventType)
+			}
+		}
+
+		var timeline []models.TimelineEvent
+		var total int64
+		for _, source := range timelineSources {
+			events, count, err := source(ctx, query)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while loading timeline"})
+				return
+			}
+			timeline = append(timeline, events...)
+			total += count
+		}
+		sort.SliceStable(timeline, func(i, j int) bool {
+			if !timeline[i].OccurredAt.Equal(timeline[j].OccurredAt) {
+				return timeline[i].OccurredAt.After(timeline[j].OccurredAt)
+			}
+			return timeline[i].ID > timeline[j].ID
+		})
+
+		start := (page - 1) * recordPerPage
+		if start > len(timeline) {
+			start = len(timeline)
+		}
+		end := start + recordPerPage
+		if end > len(timeline) {
+			end = len(timeline)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"total_count": total, "events": timeline[start:end]})
+	}
+}
+
+// pageTimeline appends to pipeline a stage that returns the newest q.Limit documents by
+// timeField along with the number of all matching documents.
+func pageTimeline(ctx context.Context, collection *mongo.Collection, pipeline mongo.Pipeline, timeField string, q timelineQuery) ([]bson.Raw, int64, error) {
+	if len(q.Window) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: bson.M{timeField: q.Window}}})
+	}
+	pipeline = append(pipeline, bson.D{{Key: "$facet", Value: bson.M{
+		"items": bson.A{
+			bson.M{"$sort": bson.D{{Key: timeField, Value: -1}, {Key: "_id", Value: -1}, {Key: "index", Value: -1}}},
+			bson.M{"$limit": q.Limit},
+		},
+		"total": bson.A{bson.M{"$count": "n"}},
+	}}})
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, 0, err
+	}
+	var results []struct {
+		Items []bson.Raw `bson:"items"`
+		Total []struct {
+			N int64 `bson:"n"`
+		} `bson:"total"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, 0, err
+	}
+	if len(results) == 0 {
+		return nil, 0, nil
+	}
+	var total int64
+	if len(results[0].Total) > 0 {
+		total = results[0].Total[0].N
+	}
+	return results[0].Items, total, nil
+}
+
+// unwindHistory returns the stages that turn each entry of a history array into its own
+// document, keeping the entry's position as "index".
+func unwindHistory(match bson.M, field string) mongo.Pipeline {
+	return mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$unwind", Value: bson.M{"path": "$" + field, "includeArrayIndex": "index"}}},
+	}
+}
+
+// customerInteractions matches the interactions of a customer, including meetings they attend.
+func customerInteractions(customerID primitive.ObjectID) bson.M {
+	return bson.M{"$or": bson.A{bson.M{"customerID": customerID}, bson.M{"attendees.id": customerID}}}
+}
+
+func interactionTimeline(ctx context.Context, q timelineQuery) ([]models.TimelineEvent, int64, error) {
+	wantInteractions, wantEmails := q.wants("INTERACTION"), q.wants("EMAIL")
+	if !wantInteractions && !wantEmails {
+		return nil, 0, nil
+	}
+	// Occurrences edited on their own show up as meeting changes
+	match := bson.M{"$and": bson.A{customerInteractions(q.CustomerID), bson.M{"seriesID": bson.M{"$exists": false}}}}
+	if !wantEmails {
+		match["type"] = bson.M{"$ne": "EMAIL"}
+	} else if !wantInteractions {
+		match["type"] = "EMAIL"
+	}
+
+	items, total, err := pageTimeline(ctx, interactionCollection, mongo.Pipeline{{{Key: "$match", Value: match}}}, "created_at", q)
+	if err != nil {
+		return nil, 0, err
+	}
+	events := make([]models.TimelineEvent, 0, len(items))
+	for _, raw := range items {
+		var interaction models.Interaction
+		if err := bson.Unmarshal(raw, &interaction); err != nil {
+			return nil, 0, err
+		}
+		eventType := "INTERACTION"
+		if interaction.Type == "EMAIL" {
+			eventType = "EMAIL"
+		}
+		events = append(events, models.TimelineEvent{
+			ID:         "interaction:" + interaction.ID.Hex(),
+			Type:       eventType,
+			OccurredAt: interaction.CreatedAt,
+			ActorID:    objectIDString(interaction.UserID),
+			Summary:    interactionSummary(interaction),
+			Data:       interaction,
+		})
+	}
+	return events, total, nil
+}
+
+func statusChangeTimeline(ctx context.Context, q timelineQuery) ([]models.TimelineEvent, int64, error) {
+	if !q.wants("STATUS_CHANGE") {
+		return nil, 0, nil
+	}
+	pipeline := unwindHistory(customerInteractions(q.CustomerID), "status_history")
+	items, total, err := pageTimeline(ctx, interactionCollection, pipeline, "status_history.changed_at", q)
+	if err != nil {
+		return nil, 0, err
+	}
+	events := make([]models.TimelineEvent, 0, len(items))
+	for _, raw := range items {
+		var entry struct {
+			ID     primitive.ObjectID  `bson:"_id"`
+			Type   string              `bson:"type"`
+			Change models.StatusChange `bson:"status_history"`
+			Index  int                 `bson:"index"`
+		}
+		if err := bson.Unmarshal(raw, &entry); err != nil {
+			return nil, 0, err
+		}
+		events = append(events, models.TimelineEvent{
+			ID:         historyEventID("status", entry.ID, entry.Index),
+			Type:       "STATUS_CHANGE",
+			OccurredAt: entry.Change.ChangedAt,
+			ActorID:    objectIDString(entry.Change.ChangedBy),
+			Summary:    fmt.Sprintf("%s moved from %s to %s", typeLabel(entry.Type), entry.Change.From, entry.Change.To),
+			Data:       gin.H{"interaction_id": entry.ID, "interaction_type": entry.Type, "from": entry.Change.From, "to": entry.Change.To},
+		})
+	}
+	return events, total, nil
+}
+
+func meetingChangeTimeline(ctx context.Context, q timelineQuery) ([]models.TimelineEvent, int64, error) {
+	if !q.wants("MEETING_CHANGE") {
+		return nil, 0, nil
+	}
+	pipeline := unwindHistory(customerInteractions(q.CustomerID), "meeting_history")
+	items, total, err := pageTimeline(ctx, interactionCollection, pipeline, "meeting_history.changed_at", q)
+	if err != nil {
+		return nil, 0, err
+	}
+	events := make([]models.TimelineEvent, 0, len(items))
+	for _, raw := range items {
+		var entry struct {
+			ID       primitive.ObjectID   `bson:"_id"`
+			SeriesID primitive.ObjectID   `bson:"seriesID"`
+			Change   models.MeetingChange `bson:"meeting_history"`
+			Index    int                  `bson:"index"`
+		}
+		if err := bson.Unmarshal(raw, &entry); err != nil {
+			return nil, 0, err
+		}
+		summary := "Meeting rescheduled"
+		if entry.Change.Action == "CANCELLED" {
+			summary = "Meeting cancelled"
+		}
+		if entry.Change.Reason != "" {
+			summary += ": " + entry.Change.Reason
+		}
+		data := gin.H{"interaction_id": entry.ID, "change": entry.Change}
+		if !entry.SeriesID.IsZero() {
+			data["series_id"] = entry.SeriesID
+		}
+		events = append(events, models.TimelineEvent{
+			ID:         historyEventID("meeting", entry.ID, entry.Index),
+			Type:       "MEETING_CHANGE",
+			OccurredAt: entry.Change.ChangedAt,
+			ActorID:    objectIDString(entry.Change.ChangedBy),
+			Summary:    summary,
+			Data:       data,
+		})
+	}
+	return events, total, nil
+}
+
+func ticketMessageTimeline(ctx context.Context, q timelineQuery) ([]models.TimelineEvent, int64, error) {
+	if !q.wants("TICKET_MESSAGE") {
+		return nil, 0, nil
+	}
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: bson.M{"customerID": q.CustomerID}}}}
+	items, total, err := pageTimeline(ctx, ticketMessageCollection, pipeline, "created_at", q)
+	if err != nil {
+		return nil, 0, err
+	}
+	events := make([]models.TimelineEvent, 0, len(items))
+	for _, raw := range items {
+		var message models.TicketMessage
+		if err := bson.Unmarshal(raw, &message); err != nil {
+			return nil, 0, err
+		}
+		summary := message.AuthorName + " replied on a ticket"
+		if message.Visibility == "INTERNAL" {
+			summary = message.AuthorName + " added an internal note on a ticket"
+		}
+		events = append(events, models.TimelineEvent{
+			ID:         "message:" + message.ID.Hex(),
+			Type:       "TICKET_MESSAGE",
+			OccurredAt: message.CreatedAt,
+			ActorID:    objectIDString(message.AuthorID),
+			Summary:    summary,
+			Data:       message,
+		})
+	}
+	return events, total, nil
+}
+
+func dealTimeline(ctx context.Context, q timelineQuery) ([]models.TimelineEvent, int64, error) {
+	if !q.wants("DEAL_CREATED") {
+		return nil, 0, nil
+	}
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: bson.M{"customerID": q.CustomerID}}}}
+	items, total, err := pageTimeline(ctx, dealCollection, pipeline, "created_at", q)
+	if err != nil {
+		return nil, 0, err
+	}
+	events := make([]models.TimelineEvent, 0, len(items))
+	for _, raw := range items {
+		var deal models.Deal
+		if err := bson.Unmarshal(raw, &deal); err != nil {
+			return nil, 0, err
+		}
+		deal.StageHistory = nil
+		events = append(events, models.TimelineEvent{
+			ID:         "deal:" + deal.ID.Hex(),
+			Type:       "DEAL_CREATED",
+			OccurredAt: deal.CreatedAt,
+			ActorID:    objectIDString(deal.OwnerID),
+			Summary:    "Deal opened: " + deal.Title,
+			Data:       deal,
+		})
+	}
+	return events, total, nil
+}
+
+func dealStageTimeline(ctx context.Context, q timelineQuery) ([]models.TimelineEvent, int64, error) {
+	if !q.wants("DEAL_STAGE_CHANGE") {
+		return nil, 0, nil
+	}
+	pipeline := unwindHistory(bson.M{"customerID": q.CustomerID}, "stage_history")
+	items, total, err := pageTimeline(ctx, dealCollection, pipeline, "stage_history.changed_at", q)
+	if err != nil {
+		return nil, 0, err
+	}
+	events := make([]models.TimelineEvent, 0, len(items))
+	for _, raw := range items {
+		var entry struct {
+			ID     primitive.ObjectID     `bson:"_id"`
+			Title  string                 `bson:"title"`
+			Change models.DealStageChange `bson:"stage_history"`
+			Index  int                    `bson:"index"`
+		}
+		if err := bson.Unmarshal(raw, &entry); err != nil {
+			return nil, 0, err
+		}
+		events = append(events, models.TimelineEvent{
+			ID:         historyEventID("deal_stage", entry.ID, entry.Index),
+			Type:       "DEAL_STAGE_CHANGE",
+			OccurredAt: entry.Change.ChangedAt,
+			ActorID:    objectIDString(entry.Change.ChangedBy),
+			Summary:    fmt.Sprintf("Deal %s moved from %s to %s", entry.Title, entry.Change.From, entry.Change.To),
+			Data:       gin.H{"deal_id": entry.ID, "title": entry.Title, "from": entry.Change.From, "to": entry.Change.To},
+		})
+	}
+	return events, total, nil
+}
+
+func emailEventTimeline(ctx context.Context, q timelineQuery) ([]models.TimelineEvent, int64, error) {
+	wantOpens, wantClicks := q.wants("EMAIL_OPENED"), q.wants("EMAIL_CLICKED")
+	if !wantOpens && !wantClicks {
+		return nil, 0, nil
+	}
+	match := bson.M{"customerID": q.CustomerID}
+	if !wantClicks {
+		match["type"] = "OPEN"
+	} else if !wantOpens {
+		match["type"] = "CLICK"
+	}
+	items, total, err := pageTimeline(ctx, emailEventCollection, mongo.Pipeline{{{Key: "$match", Value: match}}}, "occurred_at", q)
+	if err != nil {
+		return nil, 0, err
+	}
+	events := make([]models.TimelineEvent, 0, len(items))
+	for _, raw := range items {
+		var event models.EmailEvent
+		if err := bson.Unmarshal(raw, &event); err != nil {
+			return nil, 0, err
+		}
+		eventType, summary := "EMAIL_OPENED", "Opened email: "+event.Subject
+		if event.Type == "CLICK" {
+			eventType, summary = "EMAIL_CLICKED", "Clicked "+event.URL+" in email: "+event.Subject
+		}
+		events = append(events, models.TimelineEvent{
+			ID:         "email_event:" + event.ID.Hex(),
+			Type:       eventType,
+			OccurredAt: event.OccurredAt,
+			Summary:    summary,
+			Data:       event,
+		})
+	}
+	return events, total, nil
+}
+
+func customerChangeTimeline(ctx context.Context, q timelineQuery) ([]models.TimelineEvent, int64, error) {
+	wantTransitions, wantFields := q.wants("LEAD_TRANSITION"), q.wants("FIELD_CHANGE")
+	if !wantTransitions && !wantFields {
+		return nil, 0, nil
+	}
+	match := bson.M{"customerID": q.CustomerID}
+	if !wantFields {
+		match["field"] = "status"
+	} else if !wantTransitions {
+		match["field"] = bson.M{"$ne": "status"}
+	}
+
+	items, total, err := pageTimeline(ctx, customerChangeCollection, mongo.Pipeline{{{Key: "$match", Value: match}}}, "changed_at", q)
+	if err != nil {
+		return nil, 0, err
+	}
+	events := make([]models.TimelineEvent, 0, len(items))
+	for _, raw := range items {
+		var change models.CustomerChange
+		if err := bson.Unmarshal(raw, &change); err != nil {
+			return nil, 0, err
+		}
+		event := models.TimelineEvent{
+			ID:         "change:" + change.ID.Hex(),
+			Type:       "FIELD_CHANGE",
+			OccurredAt: change.ChangedAt,
+			ActorID:    objectIDString(change.ChangedBy),
+			Summary:    "Changed " + strings.Replace(change.Field, "_", " ", -1),
+			Data:       change,
+		}
+		if change.Field == "status" {
+			event.Type = "LEAD_TRANSITION"
+			event.Summary = fmt.Sprintf("Moved from %s to %s", change.From, change.To)
+		}
+		events = append(events, event)
+	}
+	return events, total, nil
+}
+
+// interactionSummary describes an interaction in one line.
+func interactionSummary(interaction models.Interaction) string {
+	detail := interaction.Subject
+	if detail == "" {
+		detail = interaction.Description
+	}
+	if len(detail) > 120 {
+		detail = detail[:117] + "..."
+	}
+
+	var summary string
+	switch interaction.Type {
+	case "MEETING":
+		summary = "Meeting scheduled for " + interaction.ScheduledAt.In(meetingLocation(interaction)).Format("Mon Jan 2, 2006 15:04 MST")
+	case "CALL":
+		summary = typeLabel(interaction.Direction) + " call"
+		if interaction.Outcome != "" {
+			summary += " (" + strings.ToLower(strings.Replace(interaction.Outcome, "_", " ", -1)) + ")"
+		}
+	case "EMAIL":
+		summary = typeLabel(interaction.Direction) + " email"
+	case "TICKET":
+		summary = "Ticket raised"
+	default:
+		summary = typeLabel(interaction.Type)
+	}
+	if detail != "" {
+		summary += ": " + detail
+	}
+	return summary
+}
+
+// typeLabel turns an upper-case constant such as "INBOUND" into "Inbound".
+func typeLabel(value string) string {
+	if value == "" {
+		return ""
+	}
+	return value[:1] + strings.ToLower(value[1:])
+}
+
+func historyEventID(kind string, id primitive.ObjectID, index int) string {
+	return fmt.Sprintf("%s:%s:%04d", kind, id.Hex(), index)
+}
+
+func objectIDString(id primitive.ObjectID) string {
+	if id.IsZero() {
+		return ""
+	}
+	return id.Hex()
+}
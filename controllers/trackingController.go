@@ -0,0 +1,223 @@
+package controllers
+
+import (
+	"context"
+	"html"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SiddharthaKR/golang-jwt-project/database"
+	helper "github.com/SiddharthaKR/golang-jwt-project/helpers"
+	"github.com/SiddharthaKR/golang-jwt-project/models"
+	"github.com/SiddharthaKR/golang-jwt-project/outbox"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var emailEventCollection *mongo.Collection = database.OpenCollection(database.Client, "email_event")
+
+// trackingPixel is a transparent 1x1 GIF.
+var trackingPixel = []byte{
+	0x47, 0x49, 0x46, 0x38, 0x39, 0x61, 0x01, 0x00, 0x01, 0x00, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0xff, 0xff, 0xff, 0x21, 0xf9, 0x04, 0x01, 0x00, 0x00, 0x00, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00,
+	0x01, 0x00, 0x01, 0x00, 0x00, 0x02, 0x02, 0x44, 0x01, 0x00, 0x3b,
+}
+
+var (
+	htmlLinkPattern  = regexp.MustCompile(`(?i)(<a\s[^>]*?href\s*=\s*)("https?://[^"]*"|'https?://[^']*')`)
+	textLinkPattern  = regexp.MustCompile(`https?://[^\s<>"']+`)
+	closeBodyPattern = regexp.MustCompile(`(?i)</body\s*>`)
+)
+
+// TrackEmailOpen serves the tracking pixel of an email and records the open. The pixel is
+// served even for an invalid token, so a mail client never shows a broken image.
+func TrackEmailOpen() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		token := strings.TrimSuffix(c.Param("token"), ".gif")
+		if outboxID, _, ok := parseTrackingToken(token, false); ok {
+			if msg, err := outbox.Get(ctx, outboxID); err == nil {
+				recordEmailEvent(ctx, c, msg, "OPEN", "")
+			}
+		}
+		c.Header("Cache-Control", "no-store, no-cache, must-revalidate, private")
+		c.Header("Expires", "0")
+		c.Data(http.StatusOK, "image/gif", trackingPixel)
+	}
+}
+
+// TrackEmailClick records a click on a tracked link and redirects to the link's target.
+// Targets are stored with the message, so a token can only lead to a link that was sent.
+func TrackEmailClick() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		outboxID, index, ok := parseTrackingToken(c.Param("token"), true)
+		if !ok {
+			c.String(http.StatusNotFound, "This link is invalid.")
+			return
+		}
+		msg, err := outbox.Get(ctx, outboxID)
+		if err != nil || index >= len(msg.TrackedLinks) {
+			c.String(http.StatusNotFound, "This link is invalid.")
+			return
+		}
+		target := msg.TrackedLinks[index]
+		recordEmailEvent(ctx, c, msg, "CLICK", target)
+		c.Redirect(http.StatusFound, target)
+	}
+}
+
+// GetOutboxMessageEvents lists the opens and clicks of a tracked email, newest first.
+// Paging: page and recordPerPage. Available to whoever can read the message.
+func GetOutboxMessageEvents() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		msg, ok := loadOutboxMessage(ctx, c)
+		if !ok {
+			return
+		}
+
+		recordPerPage, err := strconv.Atoi(c.Query("recordPerPage"))
+		if err != nil || recordPerPage < 1 {
+			recordPerPage = 20
+		}
+		page, err := strconv.Atoi(c.Query("page"))
+		if err != nil || page < 1 {
+			page = 1
+		}
+
+		filter := bson.M{"outboxID": msg.ID}
+		total, err := emailEventCollection.CountDocuments(ctx, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while counting email events"})
+			return
+		}
+		cursor, err := emailEventCollection.Find(ctx, filter, options.Find().
+			SetSort(bson.D{{Key: "occurred_at", Value: -1}, {Key: "_id", Value: -1}}).
+			SetSkip(int64((page-1)*recordPerPage)).
+			SetLimit(int64(recordPerPage)))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while listing email events"})
+			return
+		}
+		events := []models.EmailEvent{}
+		if err := cursor.All(ctx, &events); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while decoding email events"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"total_count": total, "opens": msg.Opens, "clicks": msg.Clicks, "events": events})
+	}
+}
+
+// addEmailTracking rewrites the links of a message through signed click redirects and adds an
+// open pixel to its HTML body. Plain text bodies get click tracking only; unsubscribe links are
+// left alone. The message ID is assigned here, since the tokens carry it.
+func addEmailTracking(msg *models.OutboxMessage) {
+	if msg.ID.IsZero() {
+		msg.ID = primitive.NewObjectID()
+	}
+	indexes := map[string]int{}
+	trackLink := func(target string) string {
+		if strings.HasPrefix(target, helper.PublicURL("/u/")) {
+			// Unsubscribe links must keep working as they are
+			return target
+		}
+		index, ok := indexes[target]
+		if !ok {
+			index = len(msg.TrackedLinks)
+			indexes[target] = index
+			msg.TrackedLinks = append(msg.TrackedLinks, target)
+		}
+		return helper.PublicURL("/t/c/" + clickTrackingToken(msg.ID, index))
+	}
+
+	if msg.HTML != "" {
+		msg.HTML = htmlLinkPattern.ReplaceAllStringFunc(msg.HTML, func(match string) string {
+			parts := htmlLinkPattern.FindStringSubmatch(match)
+			target := html.UnescapeString(parts[2][1 : len(parts[2])-1])
+			return parts[1] + `"` + html.EscapeString(trackLink(target)) + `"`
+		})
+		pixel := `<img src="` + helper.PublicURL("/t/o/"+openTrackingToken(msg.ID)+".gif") + `" width="1" height="1" alt="" style="border:0">`
+		if loc := closeBodyPattern.FindStringIndex(msg.HTML); loc != nil {
+			msg.HTML = msg.HTML[:loc[0]] + pixel + msg.HTML[loc[0]:]
+		} else {
+			msg.HTML += pixel
+		}
+	}
+	msg.Text = textLinkPattern.ReplaceAllStringFunc(msg.Text, func(target string) string {
+		// Punctuation ending a sentence is not part of the link
+		trimmed := strings.TrimRight(target, ".,;:!?)")
+		return trackLink(trimmed) + target[len(trimmed):]
+	})
+}
+
+func openTrackingToken(outboxID primitive.ObjectID) string {
+	return outboxID.Hex() + "." + helper.Sign("open:"+outboxID.Hex())
+}
+
+func clickTrackingToken(outboxID primitive.ObjectID, index int) string {
+	payload := outboxID.Hex() + "." + strconv.Itoa(index)
+	return payload + "." + helper.Sign("click:"+payload)
+}
+
+// parseTrackingToken checks the signature of an open or click token and returns the message
+// ID and, for clicks, the link index.
+func parseTrackingToken(token string, click bool) (primitive.ObjectID, int, bool) {
+	parts := strings.Split(token, ".")
+	index := 0
+	if click {
+		if len(parts) != 3 || !helper.VerifySignature("click:"+parts[0]+"."+parts[1], parts[2]) {
+			return primitive.NilObjectID, 0, false
+		}
+		var err error
+		if index, err = strconv.Atoi(parts[1]); err != nil || index < 0 {
+			return primitive.NilObjectID, 0, false
+		}
+	} else if len(parts) != 2 || !helper.VerifySignature("open:"+parts[0], parts[1]) {
+		return primitive.NilObjectID, 0, false
+	}
+	outboxID, err := primitive.ObjectIDFromHex(parts[0])
+	if err != nil {
+		return primitive.NilObjectID, 0, false
+	}
+	return outboxID, index, true
+}
+
+// recordEmailEvent stores an open or click and counts it on the message. Failures are only
+// logged; the recipient still gets the pixel or the redirect.
+func recordEmailEvent(ctx context.Context, c *gin.Context, msg models.OutboxMessage, eventType string, url string) {
+	now := time.Now().UTC()
+	event := models.EmailEvent{
+		ID:         primitive.NewObjectID(),
+		Type:       eventType,
+		OutboxID:   msg.ID,
+		CompanyID:  msg.CompanyID,
+		CustomerID: msg.CustomerID,
+		CampaignID: msg.CampaignID,
+		Subject:    msg.Subject,
+		URL:        url,
+		IP:         c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+		OccurredAt: now,
+	}
+	if _, err := emailEventCollection.InsertOne(ctx, event); err != nil {
+		log.Println("Error recording email event:", err)
+		return
+	}
+	if err := outbox.RecordEvent(ctx, msg.ID, eventType, now); err != nil {
+		log.Println("Error counting email event:", err)
+	}
+}
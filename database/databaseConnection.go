@@ -12,12 +12,17 @@ import(
 )
 
 func DBinstance() *mongo.Client{
+	// The variables may also come from the environment, as in containers and in tests
 	err := godotenv.Load(".env")
 	if err!=nil{
-		log.Fatal("Error loading .env file")
+		log.Println("No .env file, using the environment")
 	}
 
 	MongoDb := os.Getenv("MONGODB_URL")
+	if MongoDb == "" {
+		// The client connects lazily, so packages can be loaded without a database
+		MongoDb = "mongodb://localhost:27017"
+	}
 
 	client, err:= mongo.NewClient(options.Client().ApplyURI(MongoDb))
 	if err != nil {
@@ -0,0 +1,62 @@
+// Package events is an in-process bus for domain events. Handlers run synchronously in the
+// order they subscribed, so read models they maintain are current when the request returns.
+package events
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	InteractionCreated = "interaction.created"
+	InteractionUpdated = "interaction.updated"
+	CustomerCreated    = "customer.created"
+	CustomerDeleted    = "customer.deleted"
+	EmailSent          = "email.sent"
+)
+
+// Event describes something that happened to a record. IDs that do not apply are left zero.
+type Event struct {
+	Type          string
+	CompanyID     primitive.ObjectID
+	CustomerID    primitive.ObjectID
+	InteractionID primitive.ObjectID
+	OutboxID      primitive.ObjectID // For email events
+	OccurredAt    time.Time
+}
+
+// Handler reacts to an event. Errors are logged; they do not undo the change that was published.
+type Handler func(ctx context.Context, event Event) error
+
+var (
+	mu       sync.RWMutex
+	handlers = map[string][]Handler{}
+)
+
+// Subscribe adds a handler for an event type.
+func Subscribe(eventType string, handler Handler) {
+	mu.Lock()
+	defer mu.Unlock()
+	handlers[eventType] = append(handlers[eventType], handler)
+}
+
+// Publish runs the handlers of the event's type.
+func Publish(ctx context.Context, event Event) {
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now()
+	}
+
+	mu.RLock()
+	subscribed := handlers[event.Type]
+	mu.RUnlock()
+
+	for _, handler := range subscribed {
+		if err := handler(ctx, event); err != nil {
+			log.Printf("Error handling %s event: %v", event.Type, err)
+		}
+	}
+}
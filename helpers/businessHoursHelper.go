@@ -0,0 +1,152 @@
+package helper
+
+import (
+	"errors"
+	"time"
+
+	// Embedded so IANA time zones resolve in minimal containers without tzdata installed.
+	_ "time/tzdata"
+
+	"github.com/SiddharthaKR/golang-jwt-project/models"
+)
+
+var ErrInvalidBusinessHours = errors.New("business hours are invalid")
+
+// businessWindow is a parsed models.BusinessHours.
+type businessWindow struct {
+	location    *time.Location
+	days        map[time.Weekday]bool
+	startHour   int // local wall clock time
+	startMinute int
+	endHour     int
+	endMinute   int
+	aroundClock bool
+}
+
+func parseBusinessHours(hours models.BusinessHours) (businessWindow, error) {
+	window := businessWindow{location: time.UTC}
+
+	if hours.TimeZone != "" {
+		loc, err := time.LoadLocation(hours.TimeZone)
+		if err != nil {
+			return window, ErrInvalidBusinessHours
+		}
+		window.location = loc
+	}
+
+	if len(hours.Days) == 0 && hours.Start == "" && hours.End == "" {
+		window.aroundClock = true
+		return window, nil
+	}
+
+	start, err := time.Parse("15:04", hours.Start)
+	if err != nil {
+		return window, ErrInvalidBusinessHours
+	}
+	end, err := time.Parse("15:04", hours.End)
+	if err != nil || !end.After(start) || len(hours.Days) == 0 {
+		return window, ErrInvalidBusinessHours
+	}
+	window.startHour, window.startMinute = start.Hour(), start.Minute()
+	window.endHour, window.endMinute = end.Hour(), end.Minute()
+
+	window.days = map[time.Weekday]bool{}
+	for _, day := range hours.Days {
+		if day < 0 || day > 6 {
+			return window, ErrInvalidBusinessHours
+		}
+		window.days[time.Weekday(day)] = true
+	}
+	return window, nil
+}
+
+// ValidateBusinessHours reports whether hours can be used for SLA calculations.
+func ValidateBusinessHours(hours models.BusinessHours) error {
+	_, err := parseBusinessHours(hours)
+	return err
+}
+
+// dayBounds returns the working period of the local day containing t. Opening and closing
+// are built from the wall clock, not as offsets from midnight, so they stay put on days
+// when the clocks change.
+func (w businessWindow) dayBounds(t time.Time) (time.Time, time.Time, bool) {
+	local := t.In(w.location)
+	y, m, d := local.Date()
+	if !w.days[local.Weekday()] {
+		midnight := time.Date(y, m, d, 0, 0, 0, 0, w.location)
+		return midnight, midnight, false
+	}
+	return time.Date(y, m, d, w.startHour, w.startMinute, 0, 0, w.location),
+		time.Date(y, m, d, w.endHour, w.endMinute, 0, 0, w.location), true
+}
+
+// nextDay returns local midnight of the day after t.
+func (w businessWindow) nextDay(t time.Time) time.Time {
+	local := t.In(w.location)
+	return time.Date(local.Year(), local.Month(), local.Day()+1, 0, 0, 0, 0, w.location)
+}
+
+// AddBusinessMinutes returns the time at which the given number of business minutes
+// have elapsed after start.
+func AddBusinessMinutes(start time.Time, minutes int, hours models.BusinessHours) (time.Time, error) {
+	window, err := parseBusinessHours(hours)
+	if err != nil {
+		return start, err
+	}
+	remaining := time.Duration(minutes) * time.Minute
+	if window.aroundClock {
+		return start.Add(remaining), nil
+	}
+
+	t := start
+	// Bound the walk; a validated schedule always has working time within a week.
+	for i := 0; i < 366*5; i++ {
+		openAt, closeAt, working := window.dayBounds(t)
+		if working && t.Before(closeAt) {
+			if t.Before(openAt) {
+				t = openAt
+			}
+			available := closeAt.Sub(t)
+			if remaining <= available {
+				return t.Add(remaining), nil
+			}
+			remaining -= available
+		}
+		t = window.nextDay(t)
+	}
+	return start, ErrInvalidBusinessHours
+}
+
+// BusinessMinutesBetween counts the business minutes elapsed from start to end.
+func BusinessMinutesBetween(start time.Time, end time.Time, hours models.BusinessHours) (int, error) {
+	window, err := parseBusinessHours(hours)
+	if err != nil {
+		return 0, err
+	}
+	if !end.After(start) {
+		return 0, nil
+	}
+	if window.aroundClock {
+		return int(end.Sub(start) / time.Minute), nil
+	}
+
+	var elapsed time.Duration
+	for t := start; t.Before(end); t = window.nextDay(t) {
+		openAt, closeAt, working := window.dayBounds(t)
+		if !working {
+			continue
+		}
+		from := t
+		if from.Before(openAt) {
+			from = openAt
+		}
+		to := closeAt
+		if end.Before(to) {
+			to = end
+		}
+		if to.After(from) {
+			elapsed += to.Sub(from)
+		}
+	}
+	return int(elapsed / time.Minute), nil
+}
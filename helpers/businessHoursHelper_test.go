@@ -0,0 +1,95 @@
+package helper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SiddharthaKR/golang-jwt-project/models"
+)
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("loading %s: %v", name, err)
+	}
+	return loc
+}
+
+func TestAddBusinessMinutes(t *testing.T) {
+	london := mustLoadLocation(t, "Europe/London")
+	newYork := mustLoadLocation(t, "America/New_York")
+	weekdays := models.BusinessHours{TimeZone: "Europe/London", Days: []int{1, 2, 3, 4, 5}, Start: "09:00", End: "17:00"}
+	everyDay := models.BusinessHours{TimeZone: "Europe/London", Days: []int{0, 1, 2, 3, 4, 5, 6}, Start: "09:00", End: "17:00"}
+	everyDayNewYork := models.BusinessHours{TimeZone: "America/New_York", Days: []int{0, 1, 2, 3, 4, 5, 6}, Start: "09:00", End: "17:00"}
+
+	tests := []struct {
+		name    string
+		start   time.Time
+		minutes int
+		hours   models.BusinessHours
+		want    time.Time
+	}{
+		{"within the day", time.Date(2024, 8, 19, 10, 0, 0, 0, london), 60, weekdays, time.Date(2024, 8, 19, 11, 0, 0, 0, london)},
+		{"before opening", time.Date(2024, 8, 19, 7, 0, 0, 0, london), 30, weekdays, time.Date(2024, 8, 19, 9, 30, 0, 0, london)},
+		{"after closing", time.Date(2024, 8, 19, 18, 0, 0, 0, london), 30, weekdays, time.Date(2024, 8, 20, 9, 30, 0, 0, london)},
+		{"up to closing", time.Date(2024, 8, 19, 16, 0, 0, 0, london), 60, weekdays, time.Date(2024, 8, 19, 17, 0, 0, 0, london)},
+		{"across the weekend", time.Date(2024, 8, 23, 16, 0, 0, 0, london), 120, weekdays, time.Date(2024, 8, 26, 10, 0, 0, 0, london)},
+		{"starting on a weekend", time.Date(2024, 8, 24, 12, 0, 0, 0, london), 60, weekdays, time.Date(2024, 8, 26, 10, 0, 0, 0, london)},
+		{"a full week", time.Date(2024, 8, 19, 9, 0, 0, 0, london), 5 * 8 * 60, weekdays, time.Date(2024, 8, 23, 17, 0, 0, 0, london)},
+		{"from another zone", time.Date(2024, 8, 19, 8, 0, 0, 0, time.UTC), 30, weekdays, time.Date(2024, 8, 19, 9, 30, 0, 0, london)},
+		{"into the day clocks go forward", time.Date(2024, 3, 30, 16, 0, 0, 0, london), 120, everyDay, time.Date(2024, 3, 31, 10, 0, 0, 0, london)},
+		{"into the day clocks go back", time.Date(2024, 10, 26, 16, 0, 0, 0, london), 120, everyDay, time.Date(2024, 10, 27, 10, 0, 0, 0, london)},
+		{"on the day clocks go forward", time.Date(2024, 3, 31, 0, 0, 0, 0, london), 60, everyDay, time.Date(2024, 3, 31, 10, 0, 0, 0, london)},
+		{"on the day clocks go back", time.Date(2024, 10, 27, 0, 0, 0, 0, london), 60, everyDay, time.Date(2024, 10, 27, 10, 0, 0, 0, london)},
+		{"across a US clock change", time.Date(2024, 3, 9, 16, 0, 0, 0, newYork), 120, everyDayNewYork, time.Date(2024, 3, 10, 10, 0, 0, 0, newYork)},
+		{"around the clock", time.Date(2024, 8, 24, 12, 0, 0, 0, time.UTC), 90, models.BusinessHours{}, time.Date(2024, 8, 24, 13, 30, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := AddBusinessMinutes(tt.start, tt.minutes, tt.hours)
+			if err != nil {
+				t.Fatalf("AddBusinessMinutes() error = %v", err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("AddBusinessMinutes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBusinessMinutesBetween(t *testing.T) {
+	london := mustLoadLocation(t, "Europe/London")
+	weekdays := models.BusinessHours{TimeZone: "Europe/London", Days: []int{1, 2, 3, 4, 5}, Start: "09:00", End: "17:00"}
+	everyDay := models.BusinessHours{TimeZone: "Europe/London", Days: []int{0, 1, 2, 3, 4, 5, 6}, Start: "09:00", End: "17:00"}
+
+	tests := []struct {
+		name  string
+		start time.Time
+		end   time.Time
+		hours models.BusinessHours
+		want  int
+	}{
+		{"within the day", time.Date(2024, 8, 19, 10, 0, 0, 0, london), time.Date(2024, 8, 19, 12, 0, 0, 0, london), weekdays, 120},
+		{"before opening to after closing", time.Date(2024, 8, 19, 7, 0, 0, 0, london), time.Date(2024, 8, 19, 18, 0, 0, 0, london), weekdays, 480},
+		{"after closing to the next morning", time.Date(2024, 8, 19, 18, 0, 0, 0, london), time.Date(2024, 8, 20, 10, 0, 0, 0, london), weekdays, 60},
+		{"across the weekend", time.Date(2024, 8, 23, 16, 0, 0, 0, london), time.Date(2024, 8, 26, 10, 0, 0, 0, london), weekdays, 120},
+		{"only the weekend", time.Date(2024, 8, 24, 0, 0, 0, 0, london), time.Date(2024, 8, 26, 0, 0, 0, 0, london), weekdays, 0},
+		{"end before start", time.Date(2024, 8, 19, 12, 0, 0, 0, london), time.Date(2024, 8, 19, 10, 0, 0, 0, london), weekdays, 0},
+		{"on the day clocks go forward", time.Date(2024, 3, 31, 0, 0, 0, 0, london), time.Date(2024, 3, 31, 10, 0, 0, 0, london), everyDay, 60},
+		{"on the day clocks go back", time.Date(2024, 10, 27, 0, 0, 0, 0, london), time.Date(2024, 10, 27, 10, 0, 0, 0, london), everyDay, 60},
+		{"across a clock change", time.Date(2024, 3, 30, 16, 0, 0, 0, london), time.Date(2024, 3, 31, 10, 0, 0, 0, london), everyDay, 120},
+		{"around the clock", time.Date(2024, 8, 24, 12, 0, 0, 0, time.UTC), time.Date(2024, 8, 24, 13, 30, 0, 0, time.UTC), models.BusinessHours{}, 90},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := BusinessMinutesBetween(tt.start, tt.end, tt.hours)
+			if err != nil {
+				t.Fatalf("BusinessMinutesBetween() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("BusinessMinutesBetween() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/SiddharthaKR/golang-jwt-project/database"
+	"github.com/SiddharthaKR/golang-jwt-project/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DefaultReportingCurrency is used for companies that have not chosen one.
+const DefaultReportingCurrency = "USD"
+
+var exchangeRateCollection *mongo.Collection = database.OpenCollection(database.Client, "exchange_rate")
+
+// currencyExponents maps ISO 4217 codes to the number of minor-unit digits.
+var currencyExponents = map[string]int{
+	"AED": 2, "ARS": 2, "AUD": 2, "BHD": 3, "BRL": 2, "CAD": 2, "CHF": 2, "CLP": 0,
+	"CNY": 2, "CZK": 2, "DKK": 2, "EGP": 2, "EUR": 2, "GBP": 2, "HKD": 2, "HUF": 2,
+	"IDR": 2, "ILS": 2, "INR": 2, "ISK": 0, "JOD": 3, "JPY": 0, "KRW": 0, "KWD": 3,
+	"MXN": 2, "MYR": 2, "NGN": 2, "NOK": 2, "NZD": 2, "OMR": 3, "PHP": 2, "PKR": 2,
+	"PLN": 2, "QAR": 2, "RON": 2, "RUB": 2, "SAR": 2, "SEK": 2, "SGD": 2, "THB": 2,
+	"TND": 3, "TRY": 2, "TWD": 2, "UAH": 2, "USD": 2, "VND": 0, "ZAR": 2,
+}
+
+var ErrNoExchangeRate = errors.New("no exchange rate available")
+
+// IsValidCurrency reports whether code is a supported ISO 4217 currency code.
+func IsValidCurrency(code string) bool {
+	_, ok := currencyExponents[code]
+	return ok
+}
+
+// CurrencyExponent returns the number of minor-unit digits for a currency.
+func CurrencyExponent(code string) int {
+	if exp, ok := currencyExponents[code]; ok {
+		return exp
+	}
+	return 2
+}
+
+// FormatMoney renders an amount in major units, e.g. "12.50 USD".
+func FormatMoney(m models.Money) string {
+	exp := CurrencyExponent(m.Currency)
+	if exp == 0 {
+		return fmt.Sprintf("%d %s", m.Amount, m.Currency)
+	}
+	major := float64(m.Amount) / math.Pow10(exp)
+	return fmt.Sprintf("%.*f %s", exp, major, m.Currency)
+}
+
+// GetExchangeRate returns the rate from base to quote effective at the given time.
+// A stored inverse rate is used when no direct rate exists.
+func GetExchangeRate(ctx context.Context, base string, quote string, at time.Time) (float64, error) {
+	if base == quote {
+		return 1, nil
+	}
+
+	opts := options.FindOne().SetSort(bson.M{"effective_date": -1})
+
+	var rate models.ExchangeRate
+	err := exchangeRateCollection.FindOne(ctx, bson.M{
+		"base":           base,
+		"quote":          quote,
+		"effective_date": bson.M{"$lte": at},
+	}, opts).Decode(&rate)
+	if err == nil {
+		return rate.Rate, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return 0, err
+	}
+
+	err = exchangeRateCollection.FindOne(ctx, bson.M{
+		"base":           quote,
+		"quote":          base,
+		"effective_date": bson.M{"$lte": at},
+	}, opts).Decode(&rate)
+	if err == mongo.ErrNoDocuments {
+		return 0, fmt.Errorf("%w: %s to %s on %s", ErrNoExchangeRate, base, quote, at.Format("2006-01-02"))
+	}
+	if err != nil {
+		return 0, err
+	}
+	return 1 / rate.Rate, nil
+}
+
+// ConvertMoney converts m into the target currency at the rate effective at the given time.
+func ConvertMoney(ctx context.Context, m models.Money, to string, at time.Time) (models.Money, error) {
+	if m.Currency == to {
+		return m, nil
+	}
+	rate, err := GetExchangeRate(ctx, m.Currency, to, at)
+	if err != nil {
+		return models.Money{}, err
+	}
+	major := float64(m.Amount) / math.Pow10(CurrencyExponent(m.Currency))
+	converted := math.Round(major * rate * math.Pow10(CurrencyExponent(to)))
+	return models.Money{Amount: int64(converted), Currency: to}, nil
+}
@@ -1,25 +1,19 @@
 package helper
 
 import (
-    "net/smtp"
+    "net/mail"
     "os"
 )
 
-// sendEmail sends an email using SMTP
-func SendEmail(to []string, subject string, body string) error {
-    auth := smtp.PlainAuth(
-        "",
-        os.Getenv("FROM_EMAIL"),
-        os.Getenv("FROM_EMAIL_PASSWORD"),
-        os.Getenv("FROM_EMAIL_SMTP"),
-    )
-
-    message := "Subject: " + subject + "\n" + body
-    return smtp.SendMail(
-        os.Getenv("SMTP_ADDR"),
-        auth,
-        os.Getenv("FROM_EMAIL"),
-        to,
-        []byte(message),
-    )
+// DefaultFromAddress returns FROM_EMAIL, with FROM_NAME as its display name when set.
+// Without FROM_EMAIL, as in development with the memory backend, it is noreply@localhost.
+func DefaultFromAddress() string {
+    from := mail.Address{Name: os.Getenv("FROM_NAME"), Address: os.Getenv("FROM_EMAIL")}
+    if from.Address == "" {
+        from.Address = "noreply@localhost"
+    }
+    if from.Name == "" {
+        return from.Address
+    }
+    return from.String()
 }
@@ -0,0 +1,113 @@
+package helper
+
+import (
+	"bytes"
+	"errors"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+)
+
+// EmailContent is the subject and bodies of an email, either as template sources or rendered.
+type EmailContent struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// layoutContentMarker stands in for the content when checking that a layout includes it.
+const layoutContentMarker = "EmailLayoutContent7f3a9c"
+
+// RenderEmailTemplate executes the templates in tmpl against data. The subject and text body
+// use text/template, the HTML body html/template so that values are escaped. When layout is
+// given, its bodies wrap the template's: the layout includes them with {{template "content" .}}.
+func RenderEmailTemplate(layout *EmailContent, tmpl EmailContent, data interface{}) (EmailContent, error) {
+	var rendered EmailContent
+	subject, err := renderText("subject", "", tmpl.Subject, data)
+	if err != nil {
+		return rendered, err
+	}
+	// Headers cannot span lines
+	rendered.Subject = strings.Join(strings.Fields(subject), " ")
+
+	textLayout, htmlLayout := "", ""
+	if layout != nil {
+		textLayout, htmlLayout = layout.Text, layout.HTML
+	}
+	if tmpl.Text != "" {
+		if rendered.Text, err = renderText("text", textLayout, tmpl.Text, data); err != nil {
+			return rendered, err
+		}
+	}
+	if tmpl.HTML != "" {
+		if rendered.HTML, err = renderHTML(htmlLayout, tmpl.HTML, data); err != nil {
+			return rendered, err
+		}
+	}
+	return rendered, nil
+}
+
+// CheckEmailLayout parses the bodies of a layout and checks that each includes the content.
+func CheckEmailLayout(layout EmailContent) error {
+	if layout.Text != "" {
+		out, err := renderText("text", layout.Text, layoutContentMarker, nil)
+		if err != nil {
+			return err
+		}
+		if !strings.Contains(out, layoutContentMarker) {
+			return errors.New(`text layout must include {{template "content" .}}`)
+		}
+	}
+	if layout.HTML != "" {
+		out, err := renderHTML(layout.HTML, layoutContentMarker, nil)
+		if err != nil {
+			return err
+		}
+		if !strings.Contains(out, layoutContentMarker) {
+			return errors.New(`HTML layout must include {{template "content" .}}`)
+		}
+	}
+	return nil
+}
+
+func renderText(name string, layout string, content string, data interface{}) (string, error) {
+	var t *texttemplate.Template
+	var err error
+	if layout == "" {
+		t, err = texttemplate.New(name).Parse(content)
+	} else {
+		t, err = texttemplate.New(name).Parse(layout)
+		if err == nil {
+			_, err = t.New("content").Parse(content)
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	if err := t.ExecuteTemplate(&out, name, data); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+func renderHTML(layout string, content string, data interface{}) (string, error) {
+	var t *htmltemplate.Template
+	var err error
+	if layout == "" {
+		t, err = htmltemplate.New("html").Parse(content)
+	} else {
+		t, err = htmltemplate.New("html").Parse(layout)
+		if err == nil {
+			_, err = t.New("content").Parse(content)
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	if err := t.ExecuteTemplate(&out, "html", data); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
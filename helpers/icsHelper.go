@@ -0,0 +1,488 @@
+package helper
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const icsProductID = "-//golang-jwt-project//CRM//EN"
+
+// ICSPerson is an organizer or attendee of an event.
+type ICSPerson struct {
+	Name  string
+	Email string
+}
+
+// ICSEvent is the subset of an RFC 5545 VEVENT that the CRM reads and writes.
+type ICSEvent struct {
+	UID          string
+	Sequence     int
+	Start        time.Time
+	End          time.Time
+	AllDay       bool
+	Summary      string
+	Description  string
+	Location     string
+	URL          string
+	Status       string // TENTATIVE, CONFIRMED or CANCELLED
+	Organizer    ICSPerson
+	Attendees    []ICSPerson
+	Created      time.Time
+	LastModified time.Time
+
+	// Recurrence. When TimeZone is set, times are written as local times in that zone
+	// so that recurring events keep their wall-clock time across daylight saving changes.
+	TimeZone     string
+	RRule        string
+	ExDates      []time.Time
+	RecurrenceID time.Time // Start of the occurrence this event overrides
+}
+
+// BuildICS renders events as an iCalendar object. method is REQUEST or CANCEL for
+// invitations, or empty for a subscribable feed. Times are written in UTC unless an
+// event has a TimeZone, in which case a VTIMEZONE is included for it.
+func BuildICS(method string, calendarName string, events []ICSEvent) string {
+	var b strings.Builder
+	writeICSLine(&b, "BEGIN:VCALENDAR")
+	writeICSLine(&b, "VERSION:2.0")
+	writeICSLine(&b, "PRODID:"+icsProductID)
+	writeICSLine(&b, "CALSCALE:GREGORIAN")
+	if method != "" {
+		writeICSLine(&b, "METHOD:"+method)
+	}
+	if calendarName != "" {
+		writeICSLine(&b, "X-WR-CALNAME:"+escapeICSText(calendarName))
+	}
+
+	zones := map[string]int{}
+	var zoneNames []string
+	for _, event := range events {
+		if event.TimeZone == "" || event.TimeZone == "UTC" {
+			continue
+		}
+		if year, seen := zones[event.TimeZone]; !seen || event.Start.Year() < year {
+			if !seen {
+				zoneNames = append(zoneNames, event.TimeZone)
+			}
+			zones[event.TimeZone] = event.Start.Year()
+		}
+	}
+	for _, name := range zoneNames {
+		writeVTimezone(&b, name, zones[name])
+	}
+
+	stamp := formatICSTime(time.Now())
+	for _, event := range events {
+		location := icsLocation(event.TimeZone)
+		writeICSLine(&b, "BEGIN:VEVENT")
+		writeICSLine(&b, "UID:"+event.UID)
+		writeICSLine(&b, "DTSTAMP:"+stamp)
+		writeICSLine(&b, "SEQUENCE:"+strconv.Itoa(event.Sequence))
+		if event.AllDay {
+			writeICSLine(&b, "DTSTART;VALUE=DATE:"+event.Start.Format("20060102"))
+			writeICSLine(&b, "DTEND;VALUE=DATE:"+event.End.Format("20060102"))
+		} else {
+			writeICSLine(&b, "DTSTART"+formatICSZonedTime(event.Start, location))
+			writeICSLine(&b, "DTEND"+formatICSZonedTime(event.End, location))
+		}
+		if !event.RecurrenceID.IsZero() {
+			writeICSLine(&b, "RECURRENCE-ID"+formatICSZonedTime(event.RecurrenceID, location))
+		}
+		if event.RRule != "" {
+			writeICSLine(&b, "RRULE:"+event.RRule)
+		}
+		for _, exdate := range event.ExDates {
+			writeICSLine(&b, "EXDATE"+formatICSZonedTime(exdate, location))
+		}
+		writeICSLine(&b, "SUMMARY:"+escapeICSText(event.Summary))
+		if event.Description != "" {
+			writeICSLine(&b, "DESCRIPTION:"+escapeICSText(event.Description))
+		}
+		if event.Location != "" {
+			writeICSLine(&b, "LOCATION:"+escapeICSText(event.Location))
+		}
+		if event.URL != "" {
+			writeICSLine(&b, "URL:"+event.URL)
+		}
+		if event.Status != "" {
+			writeICSLine(&b, "STATUS:"+event.Status)
+		}
+		if event.Organizer.Email != "" {
+			writeICSLine(&b, "ORGANIZER"+icsNameParam(event.Organizer.Name)+":mailto:"+event.Organizer.Email)
+		}
+		for _, attendee := range event.Attendees {
+			if attendee.Email == "" {
+				continue
+			}
+			writeICSLine(&b, "ATTENDEE;ROLE=REQ-PARTICIPANT;PARTSTAT=NEEDS-ACTION;RSVP=TRUE"+icsNameParam(attendee.Name)+":mailto:"+attendee.Email)
+		}
+		if !event.Created.IsZero() {
+			writeICSLine(&b, "CREATED:"+formatICSTime(event.Created))
+		}
+		if !event.LastModified.IsZero() {
+			writeICSLine(&b, "LAST-MODIFIED:"+formatICSTime(event.LastModified))
+		}
+		writeICSLine(&b, "END:VEVENT")
+	}
+	writeICSLine(&b, "END:VCALENDAR")
+	return b.String()
+}
+
+// ParseICS reads the VEVENTs of an iCalendar stream. Events without a start time are skipped.
+func ParseICS(r io.Reader) ([]ICSEvent, error) {
+	lines, err := unfoldICSLines(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []ICSEvent
+	var current *ICSEvent
+	var duration time.Duration
+	for _, line := range lines {
+		name, params, value, ok := splitICSLine(line)
+		if !ok {
+			continue
+		}
+
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VEVENT"):
+			current = &ICSEvent{}
+			duration = 0
+			continue
+		case name == "END" && strings.EqualFold(value, "VEVENT"):
+			if current != nil && !current.Start.IsZero() {
+				if current.End.IsZero() {
+					switch {
+					case duration > 0:
+						current.End = current.Start.Add(duration)
+					case current.AllDay:
+						current.End = current.Start.AddDate(0, 0, 1)
+					default:
+						current.End = current.Start
+					}
+				}
+				events = append(events, *current)
+			}
+			current = nil
+			continue
+		}
+		if current == nil {
+			continue
+		}
+
+		switch name {
+		case "UID":
+			current.UID = value
+		case "SEQUENCE":
+			current.Sequence, _ = strconv.Atoi(value)
+		case "SUMMARY":
+			current.Summary = unescapeICSText(value)
+		case "DESCRIPTION":
+			current.Description = unescapeICSText(value)
+		case "LOCATION":
+			current.Location = unescapeICSText(value)
+		case "URL":
+			current.URL = value
+		case "STATUS":
+			current.Status = strings.ToUpper(value)
+		case "DTSTART":
+			start, allDay, err := parseICSTime(value, params)
+			if err != nil {
+				return nil, fmt.Errorf("invalid DTSTART %q: %v", value, err)
+			}
+			current.Start, current.AllDay = start, allDay
+			if tzid := params["TZID"]; tzid != "" {
+				current.TimeZone = tzid
+			}
+		case "DTEND":
+			end, _, err := parseICSTime(value, params)
+			if err != nil {
+				return nil, fmt.Errorf("invalid DTEND %q: %v", value, err)
+			}
+			current.End = end
+		case "DURATION":
+			if duration, err = parseICSDuration(value); err != nil {
+				return nil, fmt.Errorf("invalid DURATION %q: %v", value, err)
+			}
+		case "RRULE":
+			current.RRule = value
+		case "EXDATE":
+			for _, item := range strings.Split(value, ",") {
+				exdate, _, err := parseICSTime(item, params)
+				if err != nil {
+					return nil, fmt.Errorf("invalid EXDATE %q: %v", item, err)
+				}
+				current.ExDates = append(current.ExDates, exdate)
+			}
+		case "RECURRENCE-ID":
+			recurrenceID, _, err := parseICSTime(value, params)
+			if err != nil {
+				return nil, fmt.Errorf("invalid RECURRENCE-ID %q: %v", value, err)
+			}
+			current.RecurrenceID = recurrenceID
+		case "ORGANIZER":
+			current.Organizer = ICSPerson{Name: params["CN"], Email: mailtoAddress(value)}
+		case "ATTENDEE":
+			current.Attendees = append(current.Attendees, ICSPerson{Name: params["CN"], Email: mailtoAddress(value)})
+		}
+	}
+	return events, nil
+}
+
+// writeICSLine writes a content line, folding it at 75 octets as RFC 5545 requires.
+func writeICSLine(b *strings.Builder, line string) {
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		// Do not split a multi-byte UTF-8 sequence
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		b.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		// Continuation lines start with a space, which counts towards the limit
+		limit = 74
+	}
+	b.WriteString(line + "\r\n")
+}
+
+func unfoldICSLines(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// splitICSLine splits "NAME;PARAM=value:VALUE" into its parts. Parameter values may be quoted.
+func splitICSLine(line string) (string, map[string]string, string, bool) {
+	inQuotes := false
+	colon := -1
+	for i, r := range line {
+		if r == '"' {
+			inQuotes = !inQuotes
+		} else if r == ':' && !inQuotes {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return "", nil, "", false
+	}
+
+	parts := strings.Split(line[:colon], ";")
+	params := map[string]string{}
+	for _, param := range parts[1:] {
+		if eq := strings.Index(param, "="); eq > 0 {
+			params[strings.ToUpper(param[:eq])] = strings.Trim(param[eq+1:], `"`)
+		}
+	}
+	return strings.ToUpper(parts[0]), params, line[colon+1:], true
+}
+
+func parseICSTime(value string, params map[string]string) (time.Time, bool, error) {
+	if params["VALUE"] == "DATE" || len(value) == 8 {
+		t, err := time.ParseInLocation("20060102", value, time.UTC)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		return t, false, err
+	}
+	location := time.UTC
+	if tzid := params["TZID"]; tzid != "" {
+		loc, err := time.LoadLocation(tzid)
+		if err != nil {
+			return time.Time{}, false, err
+		}
+		location = loc
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, location)
+	return t, false, err
+}
+
+// parseICSDuration parses the RFC 5545 duration format, e.g. PT1H30M or P1D.
+func parseICSDuration(value string) (time.Duration, error) {
+	value = strings.TrimPrefix(value, "+")
+	if !strings.HasPrefix(value, "P") {
+		return 0, errors.New("duration must start with P")
+	}
+	var total time.Duration
+	number := ""
+	inTime := false
+	for _, r := range value[1:] {
+		switch {
+		case r >= '0' && r <= '9':
+			number += string(r)
+			continue
+		case r == 'T':
+			inTime = true
+			continue
+		}
+		n, err := strconv.Atoi(number)
+		if err != nil {
+			return 0, errors.New("missing number in duration")
+		}
+		number = ""
+		switch {
+		case r == 'W':
+			total += time.Duration(n) * 7 * 24 * time.Hour
+		case r == 'D':
+			total += time.Duration(n) * 24 * time.Hour
+		case r == 'H' && inTime:
+			total += time.Duration(n) * time.Hour
+		case r == 'M' && inTime:
+			total += time.Duration(n) * time.Minute
+		case r == 'S' && inTime:
+			total += time.Duration(n) * time.Second
+		default:
+			return 0, fmt.Errorf("unexpected %q in duration", r)
+		}
+	}
+	return total, nil
+}
+
+func formatICSTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// formatICSZonedTime formats the parameters and value of a date-time property,
+// e.g. ";TZID=Europe/Berlin:20240825T090000" or ":20240825T070000Z".
+func formatICSZonedTime(t time.Time, location *time.Location) string {
+	if location == nil {
+		return ":" + formatICSTime(t)
+	}
+	return ";TZID=" + location.String() + ":" + t.In(location).Format("20060102T150405")
+}
+
+// icsLocation returns the location for a TZID, or nil for UTC and unknown zones.
+func icsLocation(name string) *time.Location {
+	if name == "" || name == "UTC" {
+		return nil
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil
+	}
+	return location
+}
+
+// writeVTimezone describes a zone's standard and daylight time as yearly rules,
+// derived from its offset changes in the given year.
+func writeVTimezone(b *strings.Builder, name string, year int) {
+	location := icsLocation(name)
+	if location == nil {
+		return
+	}
+	writeICSLine(b, "BEGIN:VTIMEZONE")
+	writeICSLine(b, "TZID:"+name)
+
+	transitions := zoneTransitions(location, year)
+	if len(transitions) == 0 {
+		abbreviation, offset := time.Date(year, time.January, 1, 0, 0, 0, 0, location).Zone()
+		writeICSLine(b, "BEGIN:STANDARD")
+		writeICSLine(b, "DTSTART:19700101T000000")
+		writeICSLine(b, "TZOFFSETFROM:"+formatICSOffset(offset))
+		writeICSLine(b, "TZOFFSETTO:"+formatICSOffset(offset))
+		writeICSLine(b, "TZNAME:"+abbreviation)
+		writeICSLine(b, "END:STANDARD")
+	}
+	for _, transition := range transitions {
+		_, offsetFrom := transition.Add(-time.Second).In(location).Zone()
+		abbreviation, offsetTo := transition.In(location).Zone()
+		component := "STANDARD"
+		if offsetTo > offsetFrom {
+			component = "DAYLIGHT"
+		}
+
+		// The rule's local time is the wall-clock time just before the change
+		local := transition.In(time.FixedZone("", offsetFrom))
+		daysInMonth := time.Date(local.Year(), local.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+		ordinal := (local.Day()-1)/7 + 1
+		if local.Day()+7 > daysInMonth {
+			ordinal = -1
+		}
+
+		writeICSLine(b, "BEGIN:"+component)
+		writeICSLine(b, "DTSTART:"+local.Format("20060102T150405"))
+		writeICSLine(b, fmt.Sprintf("RRULE:FREQ=YEARLY;BYMONTH=%d;BYDAY=%d%s", int(local.Month()), ordinal, strings.ToUpper(local.Weekday().String()[:2])))
+		writeICSLine(b, "TZOFFSETFROM:"+formatICSOffset(offsetFrom))
+		writeICSLine(b, "TZOFFSETTO:"+formatICSOffset(offsetTo))
+		writeICSLine(b, "TZNAME:"+abbreviation)
+		writeICSLine(b, "END:"+component)
+	}
+	writeICSLine(b, "END:VTIMEZONE")
+}
+
+// zoneTransitions returns the instants in year at which location's UTC offset changes.
+func zoneTransitions(location *time.Location, year int) []time.Time {
+	var transitions []time.Time
+	start := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(1, 0, 0)
+	for day := start; day.Before(end); day = day.Add(24 * time.Hour) {
+		next := day.Add(24 * time.Hour)
+		_, before := day.In(location).Zone()
+		_, after := next.In(location).Zone()
+		if before == after {
+			continue
+		}
+		// Narrow the change down to the second
+		low, high := day, next
+		for high.Sub(low) > time.Second {
+			mid := low.Add(high.Sub(low) / 2)
+			if _, offset := mid.In(location).Zone(); offset == before {
+				low = mid
+			} else {
+				high = mid
+			}
+		}
+		transitions = append(transitions, high)
+	}
+	return transitions
+}
+
+func formatICSOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign = "-"
+		seconds = -seconds
+	}
+	return fmt.Sprintf("%s%02d%02d", sign, seconds/3600, (seconds%3600)/60)
+}
+
+func icsNameParam(name string) string {
+	if name == "" {
+		return ""
+	}
+	return `;CN="` + strings.NewReplacer(`"`, "'", "\r", "", "\n", " ").Replace(name) + `"`
+}
+
+func mailtoAddress(value string) string {
+	if len(value) > 7 && strings.EqualFold(value[:7], "mailto:") {
+		return value[7:]
+	}
+	return value
+}
+
+var icsTextEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+var icsTextUnescaper = strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+
+func escapeICSText(text string) string {
+	return icsTextEscaper.Replace(text)
+}
+
+func unescapeICSText(text string) string {
+	return icsTextUnescaper.Replace(text)
+}
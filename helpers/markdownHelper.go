@@ -0,0 +1,228 @@
+package helper
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// RenderMarkdown renders Markdown to HTML that is safe to embed in a page. It supports
+// headings, paragraphs, bulleted and numbered lists, block quotes, fenced code blocks,
+// horizontal rules, and inline code, bold, italics and links. Raw HTML is not supported:
+// all text is escaped and only the tags above are produced. Links are kept only for
+// http, https, mailto and relative URLs.
+func RenderMarkdown(source string) string {
+	lines := strings.Split(strings.ReplaceAll(source, "\r\n", "\n"), "\n")
+	var out strings.Builder
+	renderMarkdownBlocks(&out, lines)
+	return out.String()
+}
+
+var (
+	markdownHeading     = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	markdownRule        = regexp.MustCompile(`^\s{0,3}([-*_])(\s*([-*_])){2,}\s*$`)
+	markdownBullet      = regexp.MustCompile(`^\s{0,3}[-*+]\s+(.*)$`)
+	markdownNumbered    = regexp.MustCompile(`^\s{0,3}\d{1,9}[.)]\s+(.*)$`)
+	markdownFence       = regexp.MustCompile("^\\s{0,3}(```|~~~)\\s*([A-Za-z0-9_+-]*)")
+	markdownStrong      = regexp.MustCompile(`\*\*(\S(?:.*?\S)?)\*\*|__(\S(?:.*?\S)?)__`)
+	markdownEmphasis    = regexp.MustCompile(`\*(\S(?:[^*]*?\S)?)\*|(^|[^\w])_(\S(?:[^_]*?\S)?)_([^\w]|$)`)
+	markdownSafeSchemes = map[string]bool{"http": true, "https": true, "mailto": true}
+)
+
+func renderMarkdownBlocks(out *strings.Builder, lines []string) {
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "":
+			i++
+
+		case markdownFence.MatchString(line):
+			match := markdownFence.FindStringSubmatch(line)
+			fence := match[1]
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), fence); i++ {
+				code = append(code, lines[i])
+			}
+			i++ // closing fence
+			out.WriteString("<pre><code")
+			if match[2] != "" {
+				out.WriteString(` class="language-` + match[2] + `"`)
+			}
+			out.WriteString(">" + html.EscapeString(strings.Join(code, "\n")) + "</code></pre>\n")
+
+		case markdownHeading.MatchString(trimmed):
+			match := markdownHeading.FindStringSubmatch(trimmed)
+			level := string('0' + rune(len(match[1])))
+			out.WriteString("<h" + level + ">" + renderMarkdownInline(match[2]) + "</h" + level + ">\n")
+			i++
+
+		case markdownRule.MatchString(line):
+			out.WriteString("<hr>\n")
+			i++
+
+		case strings.HasPrefix(trimmed, ">"):
+			var quoted []string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">"); i++ {
+				text := strings.TrimPrefix(strings.TrimSpace(lines[i]), ">")
+				quoted = append(quoted, strings.TrimPrefix(text, " "))
+			}
+			out.WriteString("<blockquote>\n")
+			renderMarkdownBlocks(out, quoted)
+			out.WriteString("</blockquote>\n")
+
+		case markdownBullet.MatchString(line), markdownNumbered.MatchString(line):
+			item, tag := markdownBullet, "ul"
+			if !markdownBullet.MatchString(line) {
+				item, tag = markdownNumbered, "ol"
+			}
+			out.WriteString("<" + tag + ">\n")
+			for i < len(lines) && item.MatchString(lines[i]) {
+				text := item.FindStringSubmatch(lines[i])[1]
+				// Indented lines continue the item
+				for i++; i < len(lines) && isMarkdownContinuation(lines[i]); i++ {
+					text += "\n" + strings.TrimSpace(lines[i])
+				}
+				out.WriteString("<li>" + renderMarkdownInline(text) + "</li>\n")
+			}
+			out.WriteString("</" + tag + ">\n")
+
+		default:
+			var paragraph []string
+			for ; i < len(lines) && isMarkdownParagraphLine(lines[i]); i++ {
+				text := lines[i]
+				if strings.HasSuffix(text, "  ") {
+					paragraph = append(paragraph, renderMarkdownInline(strings.TrimSpace(text))+"<br>")
+					continue
+				}
+				paragraph = append(paragraph, renderMarkdownInline(strings.TrimSpace(text)))
+			}
+			out.WriteString("<p>" + strings.Join(paragraph, "\n") + "</p>\n")
+		}
+	}
+}
+
+func isMarkdownContinuation(line string) bool {
+	return strings.TrimSpace(line) != "" && (strings.HasPrefix(line, "  ") || strings.HasPrefix(line, "\t")) &&
+		!markdownBullet.MatchString(line) && !markdownNumbered.MatchString(line)
+}
+
+// isMarkdownParagraphLine reports whether a line continues a paragraph rather than starting another block.
+func isMarkdownParagraphLine(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return trimmed != "" && !strings.HasPrefix(trimmed, ">") &&
+		!markdownFence.MatchString(line) && !markdownHeading.MatchString(trimmed) && !markdownRule.MatchString(line) &&
+		!markdownBullet.MatchString(line) && !markdownNumbered.MatchString(line)
+}
+
+// renderMarkdownInline renders code spans, links and emphasis within a line of text.
+func renderMarkdownInline(text string) string {
+	var out, plain strings.Builder
+	flush := func() {
+		out.WriteString(renderMarkdownEmphasis(html.EscapeString(plain.String())))
+		plain.Reset()
+	}
+
+	for i := 0; i < len(text); {
+		switch text[i] {
+		case '`':
+			if end := strings.IndexByte(text[i+1:], '`'); end >= 0 {
+				flush()
+				out.WriteString("<code>" + html.EscapeString(text[i+1:i+1+end]) + "</code>")
+				i += end + 2
+				continue
+			}
+		case '\\':
+			if i+1 < len(text) && strings.IndexByte("\\`*_[]()#+-.!>", text[i+1]) >= 0 {
+				// Escaped characters are written as entities so emphasis cannot pick them up
+				flush()
+				out.WriteString("&#" + strconv.Itoa(int(text[i+1])) + ";")
+				i += 2
+				continue
+			}
+		case '[':
+			if label, target, length, ok := parseMarkdownLink(text[i:]); ok {
+				flush()
+				if href, safe := safeMarkdownURL(target); safe {
+					out.WriteString(`<a href="` + html.EscapeString(href) + `" rel="nofollow noopener">` + renderMarkdownInline(label) + "</a>")
+				} else {
+					out.WriteString(renderMarkdownInline(label))
+				}
+				i += length
+				continue
+			}
+		}
+		plain.WriteByte(text[i])
+		i++
+	}
+	flush()
+	return out.String()
+}
+
+// parseMarkdownLink parses "[label](target)" at the start of text and returns its length.
+func parseMarkdownLink(text string) (string, string, int, bool) {
+	depth := 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				if i+1 >= len(text) || text[i+1] != '(' {
+					return "", "", 0, false
+				}
+				end := strings.IndexByte(text[i+2:], ')')
+				if end < 0 {
+					return "", "", 0, false
+				}
+				target := strings.TrimSpace(text[i+2 : i+2+end])
+				// Drop an optional title: [label](url "title")
+				if space := strings.IndexAny(target, " \t"); space >= 0 {
+					target = target[:space]
+				}
+				return text[1:i], strings.Trim(target, "<>"), i + 3 + end, true
+			}
+		}
+	}
+	return "", "", 0, false
+}
+
+// safeMarkdownURL returns the URL if it is relative or uses an allowed scheme.
+func safeMarkdownURL(target string) (string, bool) {
+	if target == "" || strings.ContainsAny(target, "\x00\n\r\t") {
+		return "", false
+	}
+	parsed, err := url.Parse(target)
+	if err != nil {
+		return "", false
+	}
+	if parsed.Scheme == "" {
+		// Relative links only; "//host" would switch to another site, and browsers read a
+		// backslash as a slash, so "/\host" and "\\host" would too
+		lead := target
+		if len(lead) > 2 {
+			lead = lead[:2]
+		}
+		return target, !strings.HasPrefix(target, "//") && !strings.Contains(lead, `\`)
+	}
+	return target, markdownSafeSchemes[strings.ToLower(parsed.Scheme)]
+}
+
+// renderMarkdownEmphasis turns **bold**, __bold__, *italic* and _italic_ into tags. The text
+// is already escaped, so the inserted tags are the only markup in it.
+func renderMarkdownEmphasis(text string) string {
+	text = markdownStrong.ReplaceAllStringFunc(text, func(match string) string {
+		return "<strong>" + match[2:len(match)-2] + "</strong>"
+	})
+	return markdownEmphasis.ReplaceAllStringFunc(text, func(match string) string {
+		parts := markdownEmphasis.FindStringSubmatch(match)
+		if parts[1] != "" {
+			return "<em>" + parts[1] + "</em>"
+		}
+		return parts[2] + "<em>" + parts[3] + "</em>" + parts[4]
+	})
+}
@@ -0,0 +1,65 @@
+package helper
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSafeMarkdownURL(t *testing.T) {
+	tests := []struct {
+		target string
+		safe   bool
+	}{
+		{"https://example.com/docs", true},
+		{"http://example.com", true},
+		{"HTTPS://example.com", true},
+		{"mailto:help@example.com", true},
+		{"/articles/reset-password", true},
+		{"articles/reset-password", true},
+		{"#billing", true},
+		{"?page=2", true},
+		{"/docs\\windows", true},
+		{"", false},
+		{"javascript:alert(1)", false},
+		{"JavaScript:alert(1)", false},
+		{"java\tscript:alert(1)", false},
+		{"data:text/html;base64,PHNjcmlwdD4=", false},
+		{"vbscript:msgbox", false},
+		{"//evil.com", false},
+		{"/\\evil.com", false},
+		{"\\\\evil.com", false},
+		{"\\/evil.com", false},
+		{"\x00javascript:alert(1)", false},
+		{"/docs\nmore", false},
+	}
+	for _, tt := range tests {
+		if _, safe := safeMarkdownURL(tt.target); safe != tt.safe {
+			t.Errorf("safeMarkdownURL(%q) safe = %v, want %v", tt.target, safe, tt.safe)
+		}
+	}
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"heading", "# Title", "<h1>Title</h1>"},
+		{"emphasis", "**bold** and *italic*", "<p><strong>bold</strong> and <em>italic</em></p>"},
+		{"safe link", "[docs](https://example.com)", `<p><a href="https://example.com" rel="nofollow noopener">docs</a></p>`},
+		{"script link", "[click](javascript:alert(1))", "<p>click)</p>"},
+		{"protocol-relative link", "[click](//evil.com)", "<p>click</p>"},
+		{"backslash link", "[click](/\\evil.com)", "<p>click</p>"},
+		{"raw html", "<script>alert(1)</script>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>"},
+		{"quoted href", `[x](https://example.com/"onmouseover="alert(1))`, `<p><a href="https://example.com/&#34;onmouseover=&#34;alert(1" rel="nofollow noopener">x</a>)</p>`},
+		{"code span", "`<b>`", "<p><code>&lt;b&gt;</code></p>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := strings.TrimSpace(RenderMarkdown(tt.source)); got != tt.want {
+				t.Errorf("RenderMarkdown(%q) = %q, want %q", tt.source, got, tt.want)
+			}
+		})
+	}
+}
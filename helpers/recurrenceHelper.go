@@ -0,0 +1,412 @@
+package helper
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxRecurrencePeriods bounds how many days, weeks, months or years an expansion walks through,
+// so a rule that never matches cannot loop forever.
+const maxRecurrencePeriods = 100000
+
+var rruleWeekdays = map[string]time.Weekday{
+	"MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday, "TH": time.Thursday,
+	"FR": time.Friday, "SA": time.Saturday, "SU": time.Sunday,
+}
+
+// WeekdayNum is a BYDAY entry such as MO, 1MO (first Monday) or -1FR (last Friday).
+type WeekdayNum struct {
+	N   int
+	Day time.Weekday
+}
+
+// RRule is a parsed RFC 5545 recurrence rule. It supports FREQ DAILY, WEEKLY, MONTHLY and YEARLY
+// with INTERVAL, COUNT, UNTIL, BYDAY, BYMONTHDAY and BYMONTH. Weeks start on Monday.
+type RRule struct {
+	Freq       string
+	Interval   int
+	Count      int
+	Until      time.Time
+	ByDay      []WeekdayNum
+	ByMonthDay []int
+	ByMonth    []int
+}
+
+// ParseRRule parses a rule such as "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=10". A leading "RRULE:" is allowed.
+func ParseRRule(value string) (RRule, error) {
+	rule := RRule{Interval: 1}
+	value = strings.TrimPrefix(strings.TrimSpace(value), "RRULE:")
+	if value == "" {
+		return rule, errors.New("empty recurrence rule")
+	}
+
+	for _, part := range strings.Split(value, ";") {
+		eq := strings.Index(part, "=")
+		if eq <= 0 {
+			return rule, fmt.Errorf("invalid rule part %q", part)
+		}
+		key, val := strings.ToUpper(part[:eq]), strings.ToUpper(part[eq+1:])
+
+		var err error
+		switch key {
+		case "FREQ":
+			if val != "DAILY" && val != "WEEKLY" && val != "MONTHLY" && val != "YEARLY" {
+				return rule, fmt.Errorf("unsupported FREQ %q", val)
+			}
+			rule.Freq = val
+		case "INTERVAL":
+			if rule.Interval, err = strconv.Atoi(val); err != nil || rule.Interval < 1 {
+				return rule, errors.New("INTERVAL must be a positive number")
+			}
+		case "COUNT":
+			if rule.Count, err = strconv.Atoi(val); err != nil || rule.Count < 1 {
+				return rule, errors.New("COUNT must be a positive number")
+			}
+		case "UNTIL":
+			if rule.Until, err = parseRRuleUntil(val); err != nil {
+				return rule, fmt.Errorf("invalid UNTIL %q", val)
+			}
+		case "BYDAY":
+			for _, day := range strings.Split(val, ",") {
+				weekdayNum, err := parseWeekdayNum(day)
+				if err != nil {
+					return rule, err
+				}
+				rule.ByDay = append(rule.ByDay, weekdayNum)
+			}
+		case "BYMONTHDAY":
+			if rule.ByMonthDay, err = parseRRuleInts(val, -31, 31); err != nil {
+				return rule, fmt.Errorf("invalid BYMONTHDAY %q", val)
+			}
+		case "BYMONTH":
+			if rule.ByMonth, err = parseRRuleInts(val, 1, 12); err != nil {
+				return rule, fmt.Errorf("invalid BYMONTH %q", val)
+			}
+		case "WKST":
+			if val != "MO" {
+				return rule, errors.New("only WKST=MO is supported")
+			}
+		default:
+			return rule, fmt.Errorf("unsupported rule part %s", key)
+		}
+	}
+
+	if rule.Freq == "" {
+		return rule, errors.New("FREQ is required")
+	}
+	if rule.Count > 0 && !rule.Until.IsZero() {
+		return rule, errors.New("COUNT and UNTIL cannot both be set")
+	}
+	for _, day := range rule.ByDay {
+		if day.N != 0 && rule.Freq != "MONTHLY" && rule.Freq != "YEARLY" {
+			return rule, errors.New("numbered BYDAY is only allowed with FREQ=MONTHLY or FREQ=YEARLY")
+		}
+	}
+	return rule, nil
+}
+
+// String formats the rule in canonical RFC 5545 form, without the "RRULE:" prefix.
+func (r RRule) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+	if len(r.ByMonth) > 0 {
+		parts = append(parts, "BYMONTH="+joinRRuleInts(r.ByMonth))
+	}
+	if len(r.ByMonthDay) > 0 {
+		parts = append(parts, "BYMONTHDAY="+joinRRuleInts(r.ByMonthDay))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, 0, len(r.ByDay))
+		for _, day := range r.ByDay {
+			prefix := ""
+			if day.N != 0 {
+				prefix = strconv.Itoa(day.N)
+			}
+			days = append(days, prefix+strings.ToUpper(day.Day.String()[:2]))
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Each calls fn with every occurrence of the rule, in order, until fn returns false or the rule ends.
+// Occurrences keep dtstart's wall-clock time in loc, so they follow daylight saving changes.
+// dtstart itself is always the first occurrence.
+func (r RRule) Each(dtstart time.Time, loc *time.Location, fn func(time.Time) bool) {
+	local := dtstart.In(loc)
+	hour, minute, second := local.Clock()
+	count := 0
+
+	emit := func(t time.Time) bool {
+		if !r.Until.IsZero() && t.After(r.Until) {
+			return false
+		}
+		count++
+		if r.Count > 0 && count > r.Count {
+			return false
+		}
+		return fn(t)
+	}
+	if !emit(dtstart) {
+		return
+	}
+
+	for period := 0; period < maxRecurrencePeriods; period++ {
+		for _, day := range r.periodDays(local, period) {
+			t := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, second, 0, loc)
+			if !t.After(dtstart) {
+				continue
+			}
+			if !emit(t) {
+				return
+			}
+		}
+	}
+}
+
+// Between returns the occurrences starting in [from, to), skipping the given exception dates.
+func (r RRule) Between(dtstart time.Time, loc *time.Location, from time.Time, to time.Time, exdates []time.Time) []time.Time {
+	var occurrences []time.Time
+	r.Each(dtstart, loc, func(t time.Time) bool {
+		if !t.Before(to) {
+			return false
+		}
+		if !t.Before(from) && !ContainsTime(exdates, t) {
+			occurrences = append(occurrences, t)
+		}
+		return true
+	})
+	return occurrences
+}
+
+// Last returns the final occurrence of a rule with COUNT or UNTIL. ok is false for endless rules.
+func (r RRule) Last(dtstart time.Time, loc *time.Location) (last time.Time, ok bool) {
+	if r.Count == 0 && r.Until.IsZero() {
+		return time.Time{}, false
+	}
+	r.Each(dtstart, loc, func(t time.Time) bool {
+		last = t
+		return true
+	})
+	return last, true
+}
+
+// periodDays returns the candidate dates, at midnight UTC, of the period-th day, week, month
+// or year after the one containing start.
+func (r RRule) periodDays(start time.Time, period int) []time.Time {
+	step := period * r.Interval
+	var days []time.Time
+
+	switch r.Freq {
+	case "DAILY":
+		day := time.Date(start.Year(), start.Month(), start.Day()+step, 0, 0, 0, 0, time.UTC)
+		if r.matchesMonth(day) && r.matchesMonthDay(day) && r.matchesWeekday(day) {
+			days = append(days, day)
+		}
+	case "WEEKLY":
+		offset := (int(start.Weekday()) + 6) % 7 // days since Monday
+		monday := time.Date(start.Year(), start.Month(), start.Day()-offset+7*step, 0, 0, 0, 0, time.UTC)
+		for i := 0; i < 7; i++ {
+			day := monday.AddDate(0, 0, i)
+			if len(r.ByDay) == 0 && day.Weekday() != start.Weekday() {
+				continue
+			}
+			if r.matchesWeekday(day) && r.matchesMonth(day) {
+				days = append(days, day)
+			}
+		}
+	case "MONTHLY":
+		first := time.Date(start.Year(), start.Month()+time.Month(step), 1, 0, 0, 0, 0, time.UTC)
+		if r.matchesMonth(first) {
+			days = r.daysIn(monthDates(first.Year(), first.Month()), start)
+		}
+	case "YEARLY":
+		year := start.Year() + step
+		if len(r.ByMonth) == 0 && len(r.ByDay) > 0 && len(r.ByMonthDay) == 0 {
+			// BYDAY alone in a yearly rule counts weekdays through the whole year
+			var all []time.Time
+			for month := time.January; month <= time.December; month++ {
+				all = append(all, monthDates(year, month)...)
+			}
+			return r.daysIn(all, start)
+		}
+		months := r.ByMonth
+		if len(months) == 0 {
+			months = []int{int(start.Month())}
+		}
+		for _, month := range months {
+			days = append(days, r.daysIn(monthDates(year, time.Month(month)), start)...)
+		}
+		sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+	}
+	return days
+}
+
+// daysIn picks the dates of a month (or year) that match BYMONTHDAY and BYDAY,
+// defaulting to start's day of the month.
+func (r RRule) daysIn(dates []time.Time, start time.Time) []time.Time {
+	var days []time.Time
+	switch {
+	case len(r.ByMonthDay) > 0:
+		for _, day := range dates {
+			if r.matchesMonthDay(day) && r.matchesWeekday(day) {
+				days = append(days, day)
+			}
+		}
+	case len(r.ByDay) > 0:
+		for _, day := range dates {
+			for _, weekday := range r.ByDay {
+				if day.Weekday() == weekday.Day && weekdayOrdinalMatches(dates, day, weekday.N) {
+					days = append(days, day)
+					break
+				}
+			}
+		}
+	default:
+		for _, day := range dates {
+			if day.Day() == start.Day() {
+				days = append(days, day)
+			}
+		}
+	}
+	return days
+}
+
+func (r RRule) matchesMonth(day time.Time) bool {
+	if len(r.ByMonth) == 0 {
+		return true
+	}
+	for _, month := range r.ByMonth {
+		if time.Month(month) == day.Month() {
+			return true
+		}
+	}
+	return false
+}
+
+func (r RRule) matchesMonthDay(day time.Time) bool {
+	if len(r.ByMonthDay) == 0 {
+		return true
+	}
+	daysInMonth := time.Date(day.Year(), day.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	for _, monthDay := range r.ByMonthDay {
+		if monthDay == day.Day() || (monthDay < 0 && daysInMonth+monthDay+1 == day.Day()) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r RRule) matchesWeekday(day time.Time) bool {
+	if len(r.ByDay) == 0 {
+		return true
+	}
+	for _, weekday := range r.ByDay {
+		if weekday.Day == day.Weekday() {
+			return true
+		}
+	}
+	return false
+}
+
+// weekdayOrdinalMatches reports whether day is the n-th of its weekday within dates
+// (counting from the end when n is negative). n == 0 matches every such weekday.
+func weekdayOrdinalMatches(dates []time.Time, day time.Time, n int) bool {
+	if n == 0 {
+		return true
+	}
+	var same []time.Time
+	for _, d := range dates {
+		if d.Weekday() == day.Weekday() {
+			same = append(same, d)
+		}
+	}
+	index := n - 1
+	if n < 0 {
+		index = len(same) + n
+	}
+	return index >= 0 && index < len(same) && same[index].Equal(day)
+}
+
+func monthDates(year int, month time.Month) []time.Time {
+	var dates []time.Time
+	for day := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC); day.Month() == month; day = day.AddDate(0, 0, 1) {
+		dates = append(dates, day)
+	}
+	return dates
+}
+
+func parseWeekdayNum(value string) (WeekdayNum, error) {
+	value = strings.TrimSpace(value)
+	if len(value) < 2 {
+		return WeekdayNum{}, fmt.Errorf("invalid BYDAY %q", value)
+	}
+	day, ok := rruleWeekdays[value[len(value)-2:]]
+	if !ok {
+		return WeekdayNum{}, fmt.Errorf("invalid BYDAY %q", value)
+	}
+	weekdayNum := WeekdayNum{Day: day}
+	if prefix := value[:len(value)-2]; prefix != "" {
+		n, err := strconv.Atoi(prefix)
+		if err != nil || n == 0 || n < -53 || n > 53 {
+			return WeekdayNum{}, fmt.Errorf("invalid BYDAY %q", value)
+		}
+		weekdayNum.N = n
+	}
+	return weekdayNum, nil
+}
+
+func parseRRuleUntil(value string) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405Z", "20060102T150405", "20060102"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			if layout == "20060102" {
+				// A date-only UNTIL includes the whole day
+				t = t.Add(24*time.Hour - time.Second)
+			}
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New("invalid date")
+}
+
+func parseRRuleInts(value string, min int, max int) ([]int, error) {
+	var values []int
+	for _, part := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || n == 0 || n < min || n > max {
+			return nil, errors.New("out of range")
+		}
+		values = append(values, n)
+	}
+	return values, nil
+}
+
+func joinRRuleInts(values []int) string {
+	parts := make([]string, 0, len(values))
+	for _, v := range values {
+		parts = append(parts, strconv.Itoa(v))
+	}
+	return strings.Join(parts, ",")
+}
+
+// ContainsTime reports whether times has an instant equal to t, whatever its location.
+func ContainsTime(times []time.Time, t time.Time) bool {
+	for _, candidate := range times {
+		if candidate.Equal(t) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+package helper
+
+import (
+	"testing"
+	"time"
+)
+
+func expandRRule(t *testing.T, value string, dtstart time.Time, limit int) []time.Time {
+	t.Helper()
+	rule, err := ParseRRule(value)
+	if err != nil {
+		t.Fatalf("ParseRRule(%q): %v", value, err)
+	}
+	var occurrences []time.Time
+	rule.Each(dtstart, dtstart.Location(), func(start time.Time) bool {
+		occurrences = append(occurrences, start)
+		return len(occurrences) < limit
+	})
+	return occurrences
+}
+
+func TestRRuleEach(t *testing.T) {
+	london := mustLoadLocation(t, "Europe/London")
+	at := func(year int, month time.Month, day int, hour int) time.Time {
+		return time.Date(year, month, day, hour, 0, 0, 0, london)
+	}
+
+	tests := []struct {
+		name    string
+		rule    string
+		dtstart time.Time
+		want    []time.Time
+	}{
+		{"daily", "FREQ=DAILY;COUNT=3", at(2024, 1, 1, 9),
+			[]time.Time{at(2024, 1, 1, 9), at(2024, 1, 2, 9), at(2024, 1, 3, 9)}},
+		{"weekly on two days", "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=4", at(2024, 1, 1, 9),
+			[]time.Time{at(2024, 1, 1, 9), at(2024, 1, 3, 9), at(2024, 1, 8, 9), at(2024, 1, 10, 9)}},
+		{"every other week", "FREQ=WEEKLY;INTERVAL=2;COUNT=3", at(2024, 1, 1, 9),
+			[]time.Time{at(2024, 1, 1, 9), at(2024, 1, 15, 9), at(2024, 1, 29, 9)}},
+		{"until", "FREQ=DAILY;UNTIL=20240103T090000Z", at(2024, 1, 1, 9),
+			[]time.Time{at(2024, 1, 1, 9), at(2024, 1, 2, 9), at(2024, 1, 3, 9)}},
+		{"last day of the month", "FREQ=MONTHLY;BYMONTHDAY=-1;COUNT=3", at(2024, 1, 31, 9),
+			[]time.Time{at(2024, 1, 31, 9), at(2024, 2, 29, 9), at(2024, 3, 31, 9)}},
+		{"31st skips short months", "FREQ=MONTHLY;BYMONTHDAY=31;COUNT=3", at(2024, 1, 31, 9),
+			[]time.Time{at(2024, 1, 31, 9), at(2024, 3, 31, 9), at(2024, 5, 31, 9)}},
+		{"second Tuesday", "FREQ=MONTHLY;BYDAY=2TU;COUNT=3", at(2024, 1, 9, 9),
+			[]time.Time{at(2024, 1, 9, 9), at(2024, 2, 13, 9), at(2024, 3, 12, 9)}},
+		{"last Friday", "FREQ=MONTHLY;BYDAY=-1FR;COUNT=3", at(2024, 1, 26, 9),
+			[]time.Time{at(2024, 1, 26, 9), at(2024, 2, 23, 9), at(2024, 3, 29, 9)}},
+		{"leap day", "FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=29;COUNT=2", at(2024, 2, 29, 9),
+			[]time.Time{at(2024, 2, 29, 9), at(2028, 2, 29, 9)}},
+		{"across daylight saving", "FREQ=DAILY;COUNT=3", at(2024, 3, 30, 9),
+			[]time.Time{at(2024, 3, 30, 9), at(2024, 3, 31, 9), at(2024, 4, 1, 9)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := expandRRule(t, tt.rule, tt.dtstart, 10)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d occurrences %v, want %d %v", len(got), got, len(tt.want), tt.want)
+			}
+			for i := range got {
+				if !got[i].Equal(tt.want[i]) {
+					t.Errorf("occurrence %d = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRRuleBetweenSkipsExDates(t *testing.T) {
+	rule, err := ParseRRule("FREQ=DAILY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dtstart := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	exdate := time.Date(2024, 1, 3, 10, 0, 0, 0, time.FixedZone("CET", 3600))
+
+	got := rule.Between(dtstart, time.UTC, dtstart.AddDate(0, 0, 1), dtstart.AddDate(0, 0, 4), []time.Time{exdate})
+	want := []time.Time{dtstart.AddDate(0, 0, 1), dtstart.AddDate(0, 0, 3)}
+	if len(got) != len(want) {
+		t.Fatalf("Between = %v, want %v", got, want)
+	}
+	for i := range got {
+		if !got[i].Equal(want[i]) {
+			t.Errorf("occurrence %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestParseRRule(t *testing.T) {
+	rule, err := ParseRRule("RRULE:freq=weekly;byday=we,mo;interval=2;count=5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := rule.String(), "FREQ=WEEKLY;INTERVAL=2;COUNT=5;BYDAY=WE,MO"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	for _, value := range []string{
+		"",
+		"COUNT=3",
+		"FREQ=HOURLY",
+		"FREQ=DAILY;INTERVAL=0",
+		"FREQ=DAILY;COUNT=2;UNTIL=20240101T000000Z",
+		"FREQ=WEEKLY;BYDAY=1MO",
+		"FREQ=MONTHLY;BYMONTHDAY=32",
+		"FREQ=DAILY;WKST=SU",
+	} {
+		if _, err := ParseRRule(value); err == nil {
+			t.Errorf("ParseRRule(%q) succeeded, want an error", value)
+		}
+	}
+}
+
+func TestContainsTime(t *testing.T) {
+	instant := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	times := []time.Time{instant.Add(time.Hour), instant.In(time.FixedZone("CET", 3600))}
+	if !ContainsTime(times, instant) {
+		t.Error("ContainsTime did not match the same instant in another zone")
+	}
+	if ContainsTime(times, instant.Add(time.Minute)) {
+		t.Error("ContainsTime matched an instant that is not in the list")
+	}
+}
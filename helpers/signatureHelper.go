@@ -0,0 +1,37 @@
+package helper
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"time"
+)
+
+// Sign returns a URL-safe HMAC-SHA256 signature of payload keyed with SECRET_KEY.
+func Sign(payload string) string {
+	mac := hmac.New(sha256.New, []byte(SECRET_KEY))
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature reports whether signature was produced by Sign for payload.
+func VerifySignature(payload string, signature string) bool {
+	return hmac.Equal([]byte(Sign(payload)), []byte(signature))
+}
+
+// SignExpiring signs payload together with an expiry time and returns the expiry as a
+// Unix timestamp string alongside the signature.
+func SignExpiring(payload string, ttl time.Duration) (string, string) {
+	expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	return expires, Sign(payload + "|" + expires)
+}
+
+// VerifyExpiring checks a signature produced by SignExpiring and that it has not expired.
+func VerifyExpiring(payload string, expires string, signature string) bool {
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return false
+	}
+	return VerifySignature(payload+"|"+expires, signature)
+}
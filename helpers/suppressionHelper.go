@@ -0,0 +1,154 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/mail"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SiddharthaKR/golang-jwt-project/database"
+	"github.com/SiddharthaKR/golang-jwt-project/mailer"
+	"github.com/SiddharthaKR/golang-jwt-project/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var suppressionCollection *mongo.Collection = database.OpenCollection(database.Client, "suppression")
+
+var suppressionIndexesOnce sync.Once
+
+// ErrSuppressed is returned when every recipient of a message is on the suppression list.
+var ErrSuppressed = errors.New("all recipients are on the suppression list")
+
+// SuppressionScope says which suppressions apply to a message: those of every company, those
+// of CompanyID, and UNSUBSCRIBE suppressions only if the message is marketing.
+type SuppressionScope struct {
+	CompanyID primitive.ObjectID // Company the message is sent for; zero for system email
+	Marketing bool
+}
+
+// SuppressedAddresses returns the suppressions that apply to any of the addresses in the
+// scope, keyed by lower-case address.
+func SuppressedAddresses(ctx context.Context, scope SuppressionScope, addresses []string) (map[string]models.Suppression, error) {
+	suppressed := map[string]models.Suppression{}
+	if len(addresses) == 0 {
+		return suppressed, nil
+	}
+	emails := bson.A{}
+	for _, address := range addresses {
+		emails = append(emails, strings.ToLower(address))
+	}
+	filter := bson.M{
+		"email":     bson.M{"$in": emails},
+		"companyID": bson.M{"$in": bson.A{primitive.NilObjectID, scope.CompanyID}},
+	}
+	if !scope.Marketing {
+		filter["reason"] = bson.M{"$ne": "UNSUBSCRIBE"}
+	}
+	cursor, err := suppressionCollection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var suppressions []models.Suppression
+	if err := cursor.All(ctx, &suppressions); err != nil {
+		return nil, err
+	}
+	for _, suppression := range suppressions {
+		suppressed[suppression.Email] = suppression
+	}
+	return suppressed, nil
+}
+
+// AddSuppression puts an address on the suppression list unless it is already suppressed for
+// the same company. It reports whether a new entry was added.
+func AddSuppression(ctx context.Context, suppression models.Suppression) (bool, error) {
+	ensureSuppressionIndexes()
+	suppression.Email = strings.ToLower(strings.TrimSpace(suppression.Email))
+	if suppression.ID.IsZero() {
+		suppression.ID = primitive.NewObjectID()
+	}
+	if suppression.CreatedAt.IsZero() {
+		suppression.CreatedAt = time.Now()
+	}
+	result, err := suppressionCollection.UpdateOne(ctx,
+		bson.M{"email": suppression.Email, "companyID": suppression.CompanyID},
+		bson.M{"$setOnInsert": suppression},
+		options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		// Added by a concurrent call
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return result.UpsertedCount > 0, nil
+}
+
+// RemoveSuppression takes an address off the suppression list of a company, if it is there for
+// reason.
+func RemoveSuppression(ctx context.Context, email string, companyID primitive.ObjectID, reason string) error {
+	_, err := suppressionCollection.DeleteOne(ctx, bson.M{"email": strings.ToLower(strings.TrimSpace(email)), "companyID": companyID, "reason": reason})
+	return err
+}
+
+// RemoveSuppressedRecipients drops the To, Cc and Bcc entries that are suppressed in the scope.
+// Entries that are not valid addresses are kept for the message check to report. It returns
+// ErrSuppressed if no recipient is left.
+func RemoveSuppressedRecipients(ctx context.Context, msg *mailer.Message, scope SuppressionScope) error {
+	var addresses []string
+	for _, list := range [][]string{msg.To, msg.Cc, msg.Bcc} {
+		for _, entry := range list {
+			if addr, err := mail.ParseAddress(entry); err == nil {
+				addresses = append(addresses, addr.Address)
+			}
+		}
+	}
+	suppressed, err := SuppressedAddresses(ctx, scope, addresses)
+	if err != nil {
+		return err
+	}
+	if len(suppressed) == 0 {
+		return nil
+	}
+
+	keep := func(list []string) []string {
+		var kept []string
+		for _, entry := range list {
+			if addr, err := mail.ParseAddress(entry); err == nil {
+				if suppression, ok := suppressed[strings.ToLower(addr.Address)]; ok {
+					log.Printf("Not sending %q to %s: suppressed (%s)", msg.Subject, addr.Address, suppression.Reason)
+					continue
+				}
+			}
+			kept = append(kept, entry)
+		}
+		return kept
+	}
+	msg.To, msg.Cc, msg.Bcc = keep(msg.To), keep(msg.Cc), keep(msg.Bcc)
+	if len(msg.To)+len(msg.Cc)+len(msg.Bcc) == 0 {
+		return ErrSuppressed
+	}
+	return nil
+}
+
+// ensureSuppressionIndexes creates the index that keeps an address on a company's suppression
+// list once, which lookups by address also use.
+func ensureSuppressionIndexes() {
+	suppressionIndexesOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		_, err := suppressionCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys:    bson.D{{Key: "email", Value: 1}, {Key: "companyID", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		})
+		if err != nil {
+			log.Println("Error creating suppression index:", err)
+		}
+	})
+}
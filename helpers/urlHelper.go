@@ -0,0 +1,20 @@
+package helper
+
+import (
+	"os"
+	"strings"
+)
+
+// PublicURL turns a path into an absolute URL that recipients outside the API can open.
+// The base comes from PUBLIC_BASE_URL and falls back to localhost on PORT.
+func PublicURL(path string) string {
+	base := os.Getenv("PUBLIC_BASE_URL")
+	if base == "" {
+		port := os.Getenv("PORT")
+		if port == "" {
+			port = "8000"
+		}
+		base = "http://localhost:" + port
+	}
+	return strings.TrimRight(base, "/") + "/" + strings.TrimLeft(path, "/")
+}
@@ -0,0 +1,314 @@
+// Package inbound receives email: it parses RFC 822 messages and runs a small SMTP listener
+// that hands every message it accepts to a handler.
+package inbound
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// maxPartDepth and maxParts bound how much MIME structure a message may have.
+const maxPartDepth = 10
+const maxParts = 200
+
+// Address is a mailbox with an optional display name. Addresses are lower-cased.
+type Address struct {
+	Name    string
+	Address string
+}
+
+// Attachment is a file carried by a message, already decoded.
+type Attachment struct {
+	FileName    string
+	ContentType string
+	ContentID   string // Set for inline parts referenced from the HTML body.
+	Data        []byte
+}
+
+// Message is the part of an email the CRM cares about.
+type Message struct {
+	MessageID   string   // Without angle brackets.
+	InReplyTo   []string // Without angle brackets.
+	References  []string // Without angle brackets, oldest first.
+	From        Address
+	To          []Address
+	Cc          []Address
+	Subject     string
+	Date        time.Time
+	Text        string // The text/plain body, if there is one.
+	HTML        string // The text/html body, if there is one.
+	Attachments []Attachment
+	AutoReply   bool // The message says it was sent automatically, e.g. an out-of-office reply.
+}
+
+var errTooManyParts = errors.New("message has too many MIME parts")
+
+var messageIDPattern = regexp.MustCompile(`<([^<>\s]+)>`)
+
+var wordDecoder = &mime.WordDecoder{CharsetReader: charsetReader}
+
+// Parse reads a raw RFC 822 message. Multipart bodies are walked recursively: the first
+// text/plain and text/html parts become the body, and every part with a file name, an
+// attachment disposition or a non-text type becomes an attachment.
+func Parse(raw []byte) (*Message, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	parser := mail.AddressParser{WordDecoder: wordDecoder}
+	m := &Message{}
+	m.Subject = decodeHeader(msg.Header.Get("Subject"))
+	if from, err := parser.Parse(msg.Header.Get("From")); err == nil {
+		m.From = Address{Name: from.Name, Address: strings.ToLower(from.Address)}
+	} else {
+		return nil, fmt.Errorf("invalid From header: %v", err)
+	}
+	m.To = parseAddressList(parser, msg.Header.Get("To"))
+	m.Cc = parseAddressList(parser, msg.Header.Get("Cc"))
+	m.MessageID = firstMessageID(msg.Header.Get("Message-Id"))
+	m.InReplyTo = messageIDs(msg.Header.Get("In-Reply-To"))
+	m.References = messageIDs(msg.Header.Get("References"))
+	if date, err := msg.Header.Date(); err == nil {
+		m.Date = date
+	}
+	autoSubmitted := strings.ToLower(msg.Header.Get("Auto-Submitted"))
+	m.AutoReply = (autoSubmitted != "" && autoSubmitted != "no") ||
+		msg.Header.Get("X-Autoreply") != "" || msg.Header.Get("X-Autorespond") != "" ||
+		strings.EqualFold(msg.Header.Get("Precedence"), "auto_reply")
+
+	parts := 0
+	err = m.walk(textproto.MIMEHeader(msg.Header), msg.Body, 0, &parts)
+	return m, err
+}
+
+// Body returns the text of the message, converting the HTML body when there is no plain text one.
+func (m *Message) Body() string {
+	if strings.TrimSpace(m.Text) != "" {
+		return strings.TrimSpace(m.Text)
+	}
+	return HTMLToText(m.HTML)
+}
+
+// Recipients returns the addresses of the To and Cc headers.
+func (m *Message) Recipients() []string {
+	var addresses []string
+	for _, a := range append(append([]Address{}, m.To...), m.Cc...) {
+		addresses = append(addresses, a.Address)
+	}
+	return addresses
+}
+
+func (m *Message) walk(header textproto.MIMEHeader, body io.Reader, depth int, parts *int) error {
+	*parts++
+	if *parts > maxParts || depth > maxPartDepth {
+		return errTooManyParts
+	}
+
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := m.walk(part.Header, part, depth+1, parts); err != nil {
+				return err
+			}
+		}
+	}
+
+	data, err := ioutil.ReadAll(decodeTransfer(header.Get("Content-Transfer-Encoding"), body))
+	if err != nil {
+		return err
+	}
+
+	disposition, dispositionParams, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	fileName := dispositionParams["filename"]
+	if fileName == "" {
+		fileName = params["name"]
+	}
+	fileName = decodeHeader(fileName)
+
+	isText := mediaType == "text/plain" || mediaType == "text/html"
+	if isText && disposition != "attachment" && fileName == "" {
+		text := toUTF8(params["charset"], data)
+		if mediaType == "text/plain" && m.Text == "" {
+			m.Text = text
+			return nil
+		}
+		if mediaType == "text/html" && m.HTML == "" {
+			m.HTML = text
+			return nil
+		}
+	}
+
+	if fileName == "" {
+		fileName = "attachment"
+		if mediaType == "message/rfc822" {
+			fileName = "message.eml"
+		} else if extensions, _ := mime.ExtensionsByType(mediaType); len(extensions) > 0 {
+			fileName += extensions[0]
+		}
+	}
+	m.Attachments = append(m.Attachments, Attachment{
+		FileName:    fileName,
+		ContentType: mediaType,
+		ContentID:   strings.Trim(header.Get("Content-Id"), "<> "),
+		Data:        data,
+	})
+	return nil
+}
+
+func decodeTransfer(encoding string, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, &base64Cleaner{r: body})
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	}
+	return body
+}
+
+// base64Cleaner drops the line breaks and stray characters that mailers put into base64 bodies.
+type base64Cleaner struct {
+	r io.Reader
+}
+
+func (b *base64Cleaner) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	kept := 0
+	for _, c := range p[:n] {
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '+' || c == '/' || c == '=' {
+			p[kept] = c
+			kept++
+		}
+	}
+	if kept == 0 && err == nil && n > 0 {
+		// Nothing usable in this chunk; read on rather than report an empty read
+		return b.Read(p)
+	}
+	return kept, err
+}
+
+func decodeHeader(value string) string {
+	decoded, err := wordDecoder.DecodeHeader(value)
+	if err != nil {
+		return value
+	}
+	return decoded
+}
+
+func parseAddressList(parser mail.AddressParser, value string) []Address {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+	list, err := parser.ParseList(value)
+	if err != nil {
+		return nil
+	}
+	addresses := make([]Address, 0, len(list))
+	for _, a := range list {
+		addresses = append(addresses, Address{Name: a.Name, Address: strings.ToLower(a.Address)})
+	}
+	return addresses
+}
+
+func messageIDs(value string) []string {
+	var ids []string
+	for _, match := range messageIDPattern.FindAllStringSubmatch(value, -1) {
+		ids = append(ids, match[1])
+	}
+	return ids
+}
+
+func firstMessageID(value string) string {
+	if ids := messageIDs(value); len(ids) > 0 {
+		return ids[0]
+	}
+	return strings.TrimSpace(value)
+}
+
+// charsetReader converts the single-byte charsets common in mail to UTF-8 for header decoding.
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	data, err := ioutil.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	return strings.NewReader(toUTF8(charset, data)), nil
+}
+
+// toUTF8 converts a body in the given charset to UTF-8. ISO-8859-1 and Windows-1252 are
+// converted byte by byte; other charsets are assumed to be UTF-8 already.
+func toUTF8(charset string, data []byte) string {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "latin1", "windows-1252", "cp1252":
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return string(runes)
+	}
+	return string(bytes.ToValidUTF8(data, []byte("�")))
+}
+
+var (
+	htmlDropped   = regexp.MustCompile(`(?is)<(script|style|head)[^>]*>.*?</(script|style|head)>`)
+	htmlBreaks    = regexp.MustCompile(`(?i)<(br|/p|/div|/li|/tr|/h[1-6])\s*/?>`)
+	htmlTags      = regexp.MustCompile(`(?s)<[^>]*>`)
+	blankLineRuns = regexp.MustCompile(`\n{3,}`)
+)
+
+// HTMLToText turns an HTML body into plain text for messages that have no text part.
+func HTMLToText(body string) string {
+	text := htmlDropped.ReplaceAllString(body, "")
+	text = htmlBreaks.ReplaceAllString(text, "\n")
+	text = htmlTags.ReplaceAllString(text, "")
+	text = html.UnescapeString(text)
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	return strings.TrimSpace(blankLineRuns.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
+
+var quoteHeader = regexp.MustCompile(`(?m)^(On .{1,200}wrote:|-+\s*Original Message\s*-+|From: .+)\s*$`)
+
+// StripQuotedReply removes the quoted earlier conversation a mail client adds below a reply,
+// so that only the new text is kept. A body that is nothing but a quote is returned whole.
+func StripQuotedReply(body string) string {
+	body = strings.ReplaceAll(body, "\r\n", "\n")
+	if loc := quoteHeader.FindStringIndex(body); loc != nil && strings.TrimSpace(body[:loc[0]]) != "" {
+		body = body[:loc[0]]
+	}
+	lines := strings.Split(body, "\n")
+	end := len(lines)
+	for end > 0 && (strings.HasPrefix(strings.TrimSpace(lines[end-1]), ">") || strings.TrimSpace(lines[end-1]) == "") {
+		end--
+	}
+	if end == 0 {
+		return strings.TrimSpace(body)
+	}
+	return strings.TrimSpace(strings.Join(lines[:end], "\n"))
+}
@@ -0,0 +1,201 @@
+package inbound
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Handler receives each message the SMTP server accepts: the envelope sender, the envelope
+// recipients and the raw message. An error makes the server answer with a temporary failure,
+// so the sending server retries later.
+type Handler func(from string, to []string, data []byte) error
+
+// Server is a minimal SMTP server (RFC 5321) that only receives mail for local handling; it
+// never relays. It has no TLS or authentication, so it belongs behind the organisation's
+// mail exchanger or on a private network.
+type Server struct {
+	Addr          string        // TCP address to listen on, e.g. ":2525".
+	Hostname      string        // Name announced in the greeting.
+	MaxBytes      int64         // Largest message accepted.
+	MaxRecipients int           // Most RCPT commands per message.
+	Timeout       time.Duration // How long a client may stay silent.
+	Handler       Handler
+}
+
+const maxCommandErrors = 10
+
+// ListenAndServe accepts connections until the listener fails.
+func (s *Server) ListenAndServe() error {
+	listener, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	log.Println("Inbound SMTP listening on", s.Addr)
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Temporary() {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		go s.serve(conn)
+	}
+}
+
+// session is the state of one SMTP transaction.
+type session struct {
+	helo string
+	from string
+	to   []string
+	mail bool
+}
+
+func (s *Server) serve(conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	reply := func(code int, message string) {
+		conn.SetWriteDeadline(time.Now().Add(s.Timeout))
+		text.PrintfLine("%d %s", code, message)
+	}
+
+	reply(220, s.Hostname+" ESMTP ready")
+	var state session
+	errorCount := 0
+	for errorCount < maxCommandErrors {
+		conn.SetReadDeadline(time.Now().Add(s.Timeout))
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg := line, ""
+		if i := strings.IndexByte(line, ' '); i >= 0 {
+			verb, arg = line[:i], strings.TrimSpace(line[i+1:])
+		}
+
+		switch strings.ToUpper(verb) {
+		case "HELO":
+			state = session{helo: arg}
+			reply(250, s.Hostname)
+		case "EHLO":
+			state = session{helo: arg}
+			conn.SetWriteDeadline(time.Now().Add(s.Timeout))
+			text.PrintfLine("250-%s", s.Hostname)
+			text.PrintfLine("250-SIZE %d", s.MaxBytes)
+			text.PrintfLine("250-8BITMIME")
+			text.PrintfLine("250 PIPELINING")
+		case "MAIL":
+			from, params, ok := parsePath(arg, "FROM:")
+			if state.helo == "" {
+				reply(503, "Send HELO or EHLO first")
+				errorCount++
+				continue
+			}
+			if !ok {
+				reply(501, "Syntax: MAIL FROM:<address>")
+				errorCount++
+				continue
+			}
+			if size, err := strconv.ParseInt(params["SIZE"], 10, 64); err == nil && size > s.MaxBytes {
+				reply(552, "Message size exceeds fixed limit")
+				continue
+			}
+			state = session{helo: state.helo, from: from, mail: true}
+			reply(250, "OK")
+		case "RCPT":
+			to, _, ok := parsePath(arg, "TO:")
+			if !state.mail {
+				reply(503, "Send MAIL first")
+				errorCount++
+				continue
+			}
+			if !ok || to == "" {
+				reply(501, "Syntax: RCPT TO:<address>")
+				errorCount++
+				continue
+			}
+			if len(state.to) >= s.MaxRecipients {
+				reply(452, "Too many recipients")
+				continue
+			}
+			state.to = append(state.to, strings.ToLower(to))
+			reply(250, "OK")
+		case "DATA":
+			if len(state.to) == 0 {
+				reply(503, "Send RCPT first")
+				errorCount++
+				continue
+			}
+			reply(354, "End data with <CR><LF>.<CR><LF>")
+			conn.SetReadDeadline(time.Now().Add(10 * s.Timeout))
+			code, message := s.receive(text.DotReader(), state)
+			reply(code, message)
+			state = session{helo: state.helo}
+		case "RSET":
+			state = session{helo: state.helo}
+			reply(250, "OK")
+		case "NOOP":
+			reply(250, "OK")
+		case "VRFY":
+			reply(252, "Cannot verify user, but will accept message")
+		case "QUIT":
+			reply(221, "Bye")
+			return
+		default:
+			reply(502, "Command not implemented")
+			errorCount++
+		}
+	}
+	reply(421, "Too many errors, closing connection")
+}
+
+// receive reads the message of a DATA command and hands it to the handler.
+func (s *Server) receive(body io.Reader, state session) (int, string) {
+	data, err := ioutil.ReadAll(io.LimitReader(body, s.MaxBytes+1))
+	if err != nil {
+		return 451, "Error reading message"
+	}
+	if int64(len(data)) > s.MaxBytes {
+		// Read the rest so the connection stays in step with the client
+		io.Copy(ioutil.Discard, body)
+		return 552, "Message size exceeds fixed limit"
+	}
+	if err := s.Handler(state.from, state.to, data); err != nil {
+		log.Println("Error handling inbound message:", err)
+		return 451, "Requested action aborted: local error in processing"
+	}
+	return 250, "OK: message accepted"
+}
+
+// parsePath parses the "FROM:<address> SIZE=123" argument of MAIL and RCPT.
+func parsePath(arg string, prefix string) (string, map[string]string, bool) {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return "", nil, false
+	}
+	rest := strings.TrimSpace(arg[len(prefix):])
+	if !strings.HasPrefix(rest, "<") {
+		return "", nil, false
+	}
+	end := strings.IndexByte(rest, '>')
+	if end < 0 {
+		return "", nil, false
+	}
+	params := map[string]string{}
+	for _, field := range strings.Fields(rest[end+1:]) {
+		key, value := field, ""
+		if i := strings.IndexByte(field, '='); i >= 0 {
+			key, value = field[:i], field[i+1:]
+		}
+		params[strings.ToUpper(key)] = value
+	}
+	return rest[1:end], params, true
+}
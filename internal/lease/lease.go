@@ -0,0 +1,78 @@
+// Package lease holds what the scheduler and the outbox share to claim documents across
+// replicas: a document is claimed by atomically setting locked_by to this replica's InstanceID,
+// lock_token to a token new to the claim and locked_until to when the claim expires, and it is
+// released by the holder of the token when the work is done. Claims of replicas that die
+// expire, and failed work is retried with Backoff.
+package lease
+
+import (
+	"context"
+	crand "crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// InstanceID identifies this replica as the holder of a lease.
+var InstanceID = fmt.Sprintf("%s-%d-%d", hostname(), os.Getpid(), rand.New(rand.NewSource(time.Now().UnixNano())).Int63())
+
+// Expired matches documents left in status by a holder whose lease ran out before now.
+func Expired(status string, now time.Time) bson.M {
+	return bson.M{"status": status, "locked_until": bson.M{"$lt": now}}
+}
+
+// Take adds the fields that claim a document for this replica until now plus duration to the
+// $set of a claiming update. Each claim gets a new lock_token, which the claimed document
+// returned by the update carries and Release needs.
+func Take(set bson.M, now time.Time, duration time.Duration) bson.M {
+	set["locked_by"] = InstanceID
+	set["lock_token"] = newToken()
+	set["locked_until"] = now.Add(duration)
+	return set
+}
+
+// Release applies set to a document still held under token and drops the lease. If the lease
+// expired and another claim took over, even one by this replica, that claim's outcome wins
+// and nothing is modified.
+func Release(ctx context.Context, collection *mongo.Collection, id primitive.ObjectID, token string, set bson.M) (*mongo.UpdateResult, error) {
+	return collection.UpdateOne(ctx, bson.M{"_id": id, "lock_token": token}, bson.M{
+		"$set":   set,
+		"$unset": bson.M{"locked_by": "", "lock_token": "", "locked_until": ""},
+	})
+}
+
+// Backoff doubles the retry delay from base with each attempt, up to max, and adds up to 20% jitter.
+func Backoff(attempt int, base time.Duration, max time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay)/5+1))
+}
+
+// newToken returns a random token that tells claims apart.
+func newToken() string {
+	b := make([]byte, 16)
+	if _, err := crand.Read(b); err != nil {
+		// Unique enough to keep this replica's claims apart
+		return fmt.Sprintf("%s-%d", InstanceID, time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return "unknown"
+	}
+	return name
+}
@@ -0,0 +1,268 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultDKIMHeaders are the header fields signed when DKIMSigner.Headers is empty. Fields
+// the message does not have are skipped.
+var DefaultDKIMHeaders = []string{
+	"From", "Reply-To", "To", "Cc", "Subject", "Date", "Message-ID", "In-Reply-To", "References",
+	"MIME-Version", "Content-Type", "Content-Transfer-Encoding", "List-Unsubscribe", "List-Unsubscribe-Post",
+}
+
+// DKIMSigner adds DKIM-Signature headers (RFC 6376) with relaxed/relaxed canonicalization.
+// RSA keys sign with rsa-sha256, Ed25519 keys with ed25519-sha256 (RFC 8463).
+type DKIMSigner struct {
+	Domain   string // d=, the domain publishing the key
+	Selector string // s=, the key is published at <selector>._domainkey.<domain>
+	Key      crypto.Signer
+	Headers  []string
+}
+
+var (
+	dkimOnce   sync.Once
+	dkimSigner *DKIMSigner
+)
+
+// DefaultDKIMSigner returns the signer configured with DKIMConfigFromEnv, or nil when DKIM is
+// not configured. A configuration error is logged once and leaves messages unsigned.
+func DefaultDKIMSigner() *DKIMSigner {
+	dkimOnce.Do(func() {
+		signer, err := DKIMConfigFromEnv()
+		if err != nil {
+			log.Println("Invalid DKIM configuration, messages will not be signed:", err)
+			return
+		}
+		dkimSigner = signer
+	})
+	return dkimSigner
+}
+
+// DKIMConfigFromEnv configures signing from DKIM_DOMAIN, DKIM_SELECTOR and the PEM encoded
+// private key in DKIM_PRIVATE_KEY or the file named by DKIM_PRIVATE_KEY_FILE. It returns nil
+// without an error when DKIM_DOMAIN is not set.
+func DKIMConfigFromEnv() (*DKIMSigner, error) {
+	domain := os.Getenv("DKIM_DOMAIN")
+	if domain == "" {
+		return nil, nil
+	}
+	selector := os.Getenv("DKIM_SELECTOR")
+	if selector == "" {
+		return nil, errors.New("DKIM_SELECTOR is not set")
+	}
+	keyPEM := []byte(strings.ReplaceAll(os.Getenv("DKIM_PRIVATE_KEY"), `\n`, "\n"))
+	if file := os.Getenv("DKIM_PRIVATE_KEY_FILE"); file != "" {
+		var err error
+		if keyPEM, err = ioutil.ReadFile(file); err != nil {
+			return nil, err
+		}
+	}
+	key, err := ParseDKIMKey(keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	return &DKIMSigner{Domain: domain, Selector: selector, Key: key}, nil
+}
+
+// ParseDKIMKey reads an RSA (PKCS #1 or PKCS #8) or Ed25519 (PKCS #8) private key in PEM form.
+func ParseDKIMKey(keyPEM []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("DKIM private key is not PEM encoded")
+	}
+	if block.Type == "RSA PRIVATE KEY" {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return key, nil
+	case ed25519.PrivateKey:
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported DKIM key type %T", key)
+}
+
+// Sign returns msg with a DKIM-Signature header prepended. Bare LF line endings are turned
+// into CRLF first, since that is how the message travels over SMTP.
+func (s *DKIMSigner) Sign(msg []byte) ([]byte, error) {
+	msg = bytes.ReplaceAll(msg, []byte("\r\n"), []byte("\n"))
+	msg = bytes.ReplaceAll(msg, []byte("\n"), []byte("\r\n"))
+
+	var header, body []byte
+	if end := bytes.Index(msg, []byte("\r\n\r\n")); end >= 0 {
+		header, body = msg[:end+2], msg[end+4:]
+	} else {
+		header = msg
+	}
+	fields := splitHeaderFields(header)
+
+	var algorithm string
+	switch s.Key.(type) {
+	case *rsa.PrivateKey:
+		algorithm = "rsa-sha256"
+	case ed25519.PrivateKey:
+		algorithm = "ed25519-sha256"
+	default:
+		return nil, fmt.Errorf("unsupported DKIM key type %T", s.Key)
+	}
+
+	names := s.Headers
+	if len(names) == 0 {
+		names = DefaultDKIMHeaders
+	}
+	// Each name signs the last unsigned instance of that field, working upwards (RFC 6376 5.4.2)
+	used := map[int]bool{}
+	var signedNames []string
+	var signed bytes.Buffer
+	for _, name := range names {
+		for i := len(fields) - 1; i >= 0; i-- {
+			if !used[i] && strings.EqualFold(fields[i].name, name) {
+				used[i] = true
+				signedNames = append(signedNames, name)
+				signed.WriteString(relaxedHeader(fields[i].name, fields[i].value) + "\r\n")
+				break
+			}
+		}
+	}
+	if !containsFold(signedNames, "From") {
+		return nil, errors.New("DKIM signing requires a From header")
+	}
+
+	bodyHash := sha256.Sum256(relaxedBody(body))
+	tags := []string{
+		"v=1",
+		"a=" + algorithm,
+		"c=relaxed/relaxed",
+		"d=" + s.Domain,
+		"s=" + s.Selector,
+		"t=" + strconv.FormatInt(time.Now().Unix(), 10),
+		"h=" + strings.Join(signedNames, ":"),
+		"bh=" + base64.StdEncoding.EncodeToString(bodyHash[:]),
+		"b=",
+	}
+	value := strings.Join(tags, "; ")
+	signed.WriteString(relaxedHeader("DKIM-Signature", value))
+
+	digest := sha256.Sum256(signed.Bytes())
+	var signature []byte
+	var err error
+	if _, ok := s.Key.(ed25519.PrivateKey); ok {
+		// Ed25519 signs the SHA-256 digest itself (RFC 8463 section 3)
+		signature, err = s.Key.Sign(rand.Reader, digest[:], crypto.Hash(0))
+	} else {
+		signature, err = s.Key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Whitespace inside b= is ignored by verifiers, so the signature can be folded freely
+	encoded := base64.StdEncoding.EncodeToString(signature)
+	var chunks []string
+	for len(encoded) > 64 {
+		chunks = append(chunks, encoded[:64])
+		encoded = encoded[64:]
+	}
+	chunks = append(chunks, encoded)
+
+	var out bytes.Buffer
+	writeHeader(&out, "DKIM-Signature", value+strings.Join(chunks, " "))
+	out.Write(msg)
+	return out.Bytes(), nil
+}
+
+type headerField struct {
+	name, value string
+}
+
+// splitHeaderFields splits a header block into fields, keeping folded lines with their field.
+func splitHeaderFields(header []byte) []headerField {
+	var fields []headerField
+	for _, line := range strings.SplitAfter(string(header), "\r\n") {
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(fields) > 0 {
+			fields[len(fields)-1].value += line
+			continue
+		}
+		if colon := strings.Index(line, ":"); colon > 0 {
+			fields = append(fields, headerField{name: line[:colon], value: line[colon+1:]})
+		}
+	}
+	return fields
+}
+
+// relaxedHeader canonicalizes a header field: lower case name, unfolded value with runs of
+// whitespace collapsed and no whitespace around the colon (RFC 6376 3.4.2).
+func relaxedHeader(name, value string) string {
+	value = strings.ReplaceAll(value, "\r\n", "")
+	return strings.ToLower(strings.TrimSpace(name)) + ":" + strings.TrimSpace(collapseWhitespace(value))
+}
+
+// relaxedBody canonicalizes the body: whitespace runs collapsed, trailing whitespace and empty
+// lines at the end removed (RFC 6376 3.4.4).
+func relaxedBody(body []byte) []byte {
+	lines := strings.Split(string(body), "\r\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(collapseWhitespace(line), " ")
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+func collapseWhitespace(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range s {
+		if r == ' ' || r == '\t' {
+			space = true
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(r)
+	}
+	if space {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,150 @@
+package mailer
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+// The signing key and message of RFC 8463 appendix A.
+const (
+	rfc8463Seed      = "nWGxne/9WmC6hEr0kuwsxERJxWl7MmkZcDusAxyuf2A="
+	rfc8463PublicKey = "11qYAYKxCrfVS/7TyWQHOg7hcvPapiMlrwIaaPcHURo="
+	rfc8463Header    = "From: Joe SixPack <joe@football.example.com>\r\n" +
+		"To: Suzie Q <suzie@shopping.example.net>\r\n" +
+		"Subject: Is dinner ready?\r\n" +
+		"Date: Fri, 11 Jul 2003 21:00:37 -0700 (PDT)\r\n" +
+		"Message-ID: <20030712040037.46341.5F8J@football.example.com>\r\n"
+	rfc8463Body = "Hi.\r\n\r\nWe lost the game.  Are you hungry yet?\r\n\r\nJoe.\r\n"
+)
+
+func rfc8463Key(t *testing.T) (ed25519.PrivateKey, ed25519.PublicKey) {
+	t.Helper()
+	seed, err := base64.StdEncoding.DecodeString(rfc8463Seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := base64.StdEncoding.DecodeString(rfc8463PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ed25519.NewKeyFromSeed(seed), ed25519.PublicKey(public)
+}
+
+// TestDKIMRelaxedCanonicalization checks the canonicalization against the signed example of
+// RFC 8463, whose DKIM-Signature header is folded over several lines.
+func TestDKIMRelaxedCanonicalization(t *testing.T) {
+	_, public := rfc8463Key(t)
+
+	bodyHash := sha256.Sum256(relaxedBody([]byte(rfc8463Body)))
+	if got, want := base64.StdEncoding.EncodeToString(bodyHash[:]), "2jUSOH9NhtVGCQWNr9BrIAPreKQjO6Sn7XIkfJVOzv8="; got != want {
+		t.Errorf("body hash = %s, want %s", got, want)
+	}
+
+	var signed strings.Builder
+	for _, field := range splitHeaderFields([]byte(rfc8463Header)) {
+		signed.WriteString(relaxedHeader(field.name, field.value) + "\r\n")
+	}
+	signed.WriteString(relaxedHeader("DKIM-Signature", " v=1; a=ed25519-sha256; c=relaxed/relaxed;\r\n"+
+		" d=football.example.com; i=@football.example.com;\r\n"+
+		" q=dns/txt; s=brisbane; t=1528637909; h=from : to :\r\n"+
+		" subject : date : message-id : from : subject : date;\r\n"+
+		" bh=2jUSOH9NhtVGCQWNr9BrIAPreKQjO6Sn7XIkfJVOzv8=;\r\n"+
+		" b="))
+
+	signature, _ := base64.StdEncoding.DecodeString("/gCrinpcQOoIfuHNQIbq4pgh9kyIK3AQUdt9OdqQehSwhEIug4D11BusFa3bT3FY5OsU7ZbnKELq+eXdp1Q1Dw==")
+	digest := sha256.Sum256([]byte(signed.String()))
+	if !ed25519.Verify(public, digest[:], signature) {
+		t.Error("the RFC 8463 signature does not verify against the canonicalized header")
+	}
+}
+
+func TestDKIMRelaxedHeader(t *testing.T) {
+	tests := []struct {
+		name, value, want string
+	}{
+		{"Subject", " Is dinner ready?", "subject:Is dinner ready?"},
+		{"SUBJECT ", "\t Is  dinner\t ready? \t", "subject:Is dinner ready?"},
+		{"Subject", " Is dinner\r\n ready?", "subject:Is dinner ready?"},
+		{"Subject", " Is dinner\r\n\tready?\r\n", "subject:Is dinner ready?"},
+	}
+	for _, tt := range tests {
+		if got := relaxedHeader(tt.name, tt.value); got != tt.want {
+			t.Errorf("relaxedHeader(%q, %q) = %q, want %q", tt.name, tt.value, got, tt.want)
+		}
+	}
+}
+
+// TestDKIMSign signs a message with a long, folded subject and verifies the result the way a
+// receiver would, after the message has been refolded in transit. The message has a second
+// Subject, and only the last one is signed.
+func TestDKIMSign(t *testing.T) {
+	private, public := rfc8463Key(t)
+	signer := &DKIMSigner{Domain: "football.example.com", Selector: "brisbane", Key: private}
+
+	header := rfc8463Header + "Subject: Tickets for the game on Saturday, and whether we should\r\n" +
+		"  book a table somewhere afterwards\r\n"
+	signedMsg, err := signer.Sign([]byte(header + "\r\n" + rfc8463Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	end := strings.Index(string(signedMsg), "\r\n\r\n")
+	for _, line := range strings.Split(string(signedMsg[:end]), "\r\n") {
+		if len(line) > 78 {
+			t.Errorf("header line longer than 78 characters: %q", line)
+		}
+	}
+
+	// Refold the subject and change the whitespace, as relays may do
+	transit := strings.Replace(string(signedMsg), "whether we should\r\n  book", "whether  we\r\n\tshould book", 1)
+	transit = strings.Replace(transit, "Hi.\r\n", "Hi. \t\r\n", 1)
+	verifyDKIM(t, []byte(transit), public)
+}
+
+// verifyDKIM checks the first DKIM-Signature of msg with the given key.
+func verifyDKIM(t *testing.T, msg []byte, public ed25519.PublicKey) {
+	t.Helper()
+	end := strings.Index(string(msg), "\r\n\r\n")
+	fields := splitHeaderFields(msg[:end+2])
+	body := msg[end+4:]
+	if len(fields) == 0 || !strings.EqualFold(fields[0].name, "DKIM-Signature") {
+		t.Fatal("message does not start with a DKIM-Signature header")
+	}
+
+	tags := map[string]string{}
+	for _, tag := range strings.Split(relaxedHeader("", fields[0].value)[1:], ";") {
+		if eq := strings.Index(tag, "="); eq > 0 {
+			tags[strings.TrimSpace(tag[:eq])] = strings.ReplaceAll(strings.TrimSpace(tag[eq+1:]), " ", "")
+		}
+	}
+	bodyHash := sha256.Sum256(relaxedBody(body))
+	if tags["bh"] != base64.StdEncoding.EncodeToString(bodyHash[:]) {
+		t.Fatalf("body hash %s does not match the body", tags["bh"])
+	}
+
+	used := map[int]bool{}
+	var signed strings.Builder
+	for _, name := range strings.Split(tags["h"], ":") {
+		for i := len(fields) - 1; i > 0; i-- {
+			if !used[i] && strings.EqualFold(fields[i].name, name) {
+				used[i] = true
+				signed.WriteString(relaxedHeader(fields[i].name, fields[i].value) + "\r\n")
+				break
+			}
+		}
+	}
+	value := fields[0].value
+	signed.WriteString(relaxedHeader("DKIM-Signature", value[:strings.LastIndex(value, "b=")+2]))
+
+	signature, err := base64.StdEncoding.DecodeString(tags["b"])
+	if err != nil {
+		t.Fatalf("invalid b= tag: %v", err)
+	}
+	digest := sha256.Sum256([]byte(signed.String()))
+	if !ed25519.Verify(public, digest[:], signature) {
+		t.Error("signature does not verify")
+	}
+}
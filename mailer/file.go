@@ -0,0 +1,102 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// File formats of the file backend.
+const (
+	FormatEML     = "eml"     // One .eml file per message in the directory
+	FormatMaildir = "maildir" // A maildir: messages are delivered to new/ through tmp/
+)
+
+var fileCounter uint64
+
+// FileMailer writes each message to a directory instead of delivering it. Mail clients can
+// open the .eml files, and a maildir can be read by any maildir-aware client.
+type FileMailer struct {
+	Dir    string
+	Format string
+}
+
+// NewFileMailer creates the directory, and the maildir subdirectories if format is maildir.
+func NewFileMailer(dir string, format string) (*FileMailer, error) {
+	format = strings.ToLower(format)
+	if format == "" {
+		format = FormatEML
+	}
+	if format != FormatEML && format != FormatMaildir {
+		return nil, fmt.Errorf("unknown MAIL_FILE_FORMAT %q", format)
+	}
+	dirs := []string{dir}
+	if format == FormatMaildir {
+		dirs = []string{filepath.Join(dir, "tmp"), filepath.Join(dir, "new"), filepath.Join(dir, "cur")}
+	}
+	for _, d := range dirs {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			return nil, err
+		}
+	}
+	return &FileMailer{Dir: dir, Format: format}, nil
+}
+
+// Send writes the message to a new file. The envelope is recorded in X-Envelope headers,
+// since the message itself may not name every recipient.
+func (f *FileMailer) Send(ctx context.Context, from string, to []string, msg []byte) error {
+	envelope := "X-Envelope-From: " + from + "\r\nX-Envelope-To: " + strings.Join(to, ", ") + "\r\n"
+	data := append([]byte(envelope), msg...)
+	name := uniqueFileName()
+
+	if f.Format == FormatMaildir {
+		// Write to tmp/ first and rename into new/, so readers never see half a message
+		tmp := filepath.Join(f.Dir, "tmp", name)
+		if err := ioutil.WriteFile(tmp, data, 0o644); err != nil {
+			return err
+		}
+		return os.Rename(tmp, filepath.Join(f.Dir, "new", name))
+	}
+	path := filepath.Join(f.Dir, name+".eml")
+	if err := ioutil.WriteFile(path, data, 0o644); err != nil {
+		return err
+	}
+	log.Println("Email written to", path)
+	return nil
+}
+
+// uniqueFileName follows the maildir convention of time, process and counter plus host name.
+func uniqueFileName() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "localhost"
+	}
+	host = strings.NewReplacer("/", "_", ":", "_").Replace(host)
+	now := time.Now()
+	return fmt.Sprintf("%d.M%dP%dQ%d.%s", now.Unix(), now.Nanosecond()/1000, os.Getpid(), atomic.AddUint64(&fileCounter, 1), host)
+}
+
+// LogMailer only logs a summary of each message, for environments that must not send mail.
+type LogMailer struct{}
+
+// Send logs the envelope, subject and size of the message.
+func (LogMailer) Send(ctx context.Context, from string, to []string, msg []byte) error {
+	subject := ""
+	for _, line := range strings.Split(string(msg), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(strings.ToLower(line), "subject:") {
+			subject = strings.TrimSpace(line[len("subject:"):])
+		}
+	}
+	log.Printf("Email not sent (MAIL_BACKEND=log): from %s to %s, subject %q, %d bytes", from, strings.Join(to, ", "), subject, len(msg))
+	return nil
+}
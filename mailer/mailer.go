@@ -0,0 +1,113 @@
+// Package mailer hands finished email messages to a transport. The backend is chosen with
+// MAIL_BACKEND: smtp (the default) sends through an SMTP server, memory keeps messages for
+// inspection, file writes them to disk and log only logs them.
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mailer delivers a raw RFC 5322 message to the envelope recipients.
+type Mailer interface {
+	Send(ctx context.Context, from string, to []string, msg []byte) error
+}
+
+var (
+	defaultMu     sync.Mutex
+	defaultMailer Mailer
+)
+
+// SetDefault sets the mailer Default returns.
+func SetDefault(m Mailer) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultMailer = m
+}
+
+// Default returns the mailer set with SetDefault, or configures one from the environment on
+// first use. If the configuration is invalid every send fails with the configuration error.
+func Default() Mailer {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	if defaultMailer == nil {
+		m, err := FromEnv()
+		if err != nil {
+			log.Println("Invalid mail configuration:", err)
+			m = brokenMailer{err: err}
+		}
+		defaultMailer = m
+	}
+	return defaultMailer
+}
+
+// FromEnv builds the mailer selected by MAIL_BACKEND.
+func FromEnv() (Mailer, error) {
+	switch backend := strings.ToLower(os.Getenv("MAIL_BACKEND")); backend {
+	case "", "smtp":
+		return SMTPConfigFromEnv()
+	case "memory":
+		return NewMemoryMailer(envInt("MAIL_MEMORY_LIMIT", 1000)), nil
+	case "file":
+		dir := os.Getenv("MAIL_FILE_DIR")
+		if dir == "" {
+			dir = "mail"
+		}
+		return NewFileMailer(dir, os.Getenv("MAIL_FILE_FORMAT"))
+	case "log":
+		return LogMailer{}, nil
+	default:
+		return nil, fmt.Errorf("unknown MAIL_BACKEND %q", backend)
+	}
+}
+
+// SendMessage builds msg, signs it when DKIM is configured and hands it to the default mailer.
+func SendMessage(ctx context.Context, msg *Message) error {
+	from, err := msg.Sender()
+	if err != nil {
+		return err
+	}
+	to, err := msg.Recipients()
+	if err != nil {
+		return err
+	}
+	raw, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+	if signer := DefaultDKIMSigner(); signer != nil {
+		if raw, err = signer.Sign(raw); err != nil {
+			return err
+		}
+	}
+	return Default().Send(ctx, from, to, raw)
+}
+
+// brokenMailer stands in for a mailer whose configuration could not be loaded.
+type brokenMailer struct {
+	err error
+}
+
+func (b brokenMailer) Send(ctx context.Context, from string, to []string, msg []byte) error {
+	return b.err
+}
+
+func envInt(name string, fallback int) int {
+	if value, err := strconv.Atoi(os.Getenv(name)); err == nil && value > 0 {
+		return value
+	}
+	return fallback
+}
+
+func envDuration(name string, fallback time.Duration) time.Duration {
+	if seconds, err := strconv.Atoi(os.Getenv(name)); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return fallback
+}
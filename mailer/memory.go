@@ -0,0 +1,105 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"mime"
+	"net/mail"
+	"sync"
+	"time"
+
+	"github.com/SiddharthaKR/golang-jwt-project/inbound"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CapturedMessage is a message kept by the memory backend.
+type CapturedMessage struct {
+	ID      string    `json:"id"`
+	From    string    `json:"from"`
+	To      []string  `json:"to"`
+	Subject string    `json:"subject"`
+	Text    string    `json:"text,omitempty"`
+	HTML    string    `json:"html,omitempty"`
+	Files   []string  `json:"attachments,omitempty"`
+	Size    int       `json:"size"`
+	SentAt  time.Time `json:"sent_at"`
+	Raw     []byte    `json:"-"`
+}
+
+// MemoryMailer keeps sent messages in memory instead of delivering them, for development and
+// tests. Only the most recent Limit messages are kept.
+type MemoryMailer struct {
+	Limit int
+
+	mu       sync.Mutex
+	messages []CapturedMessage
+}
+
+// NewMemoryMailer returns a memory backend that keeps up to limit messages.
+func NewMemoryMailer(limit int) *MemoryMailer {
+	return &MemoryMailer{Limit: limit}
+}
+
+// Send records the message. It never fails.
+func (m *MemoryMailer) Send(ctx context.Context, from string, to []string, msg []byte) error {
+	captured := CapturedMessage{
+		ID:     primitive.NewObjectID().Hex(),
+		From:   from,
+		To:     append([]string{}, to...),
+		Size:   len(msg),
+		SentAt: time.Now(),
+		Raw:    append([]byte{}, msg...),
+	}
+	if parsed, err := inbound.Parse(msg); err == nil {
+		captured.Subject = parsed.Subject
+		captured.Text = parsed.Text
+		captured.HTML = parsed.HTML
+		for _, attachment := range parsed.Attachments {
+			captured.Files = append(captured.Files, attachment.FileName)
+		}
+	} else if header, err := mail.ReadMessage(bytes.NewReader(msg)); err == nil {
+		// Not a complete message, e.g. without a From header; the subject is still useful
+		captured.Subject = header.Header.Get("Subject")
+		if decoded, err := new(mime.WordDecoder).DecodeHeader(captured.Subject); err == nil {
+			captured.Subject = decoded
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, captured)
+	if m.Limit > 0 && len(m.messages) > m.Limit {
+		m.messages = append([]CapturedMessage{}, m.messages[len(m.messages)-m.Limit:]...)
+	}
+	return nil
+}
+
+// Messages returns the captured messages, newest first.
+func (m *MemoryMailer) Messages() []CapturedMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	messages := make([]CapturedMessage, 0, len(m.messages))
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		messages = append(messages, m.messages[i])
+	}
+	return messages
+}
+
+// Get returns the captured message with the given ID.
+func (m *MemoryMailer) Get(id string) (CapturedMessage, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, message := range m.messages {
+		if message.ID == id {
+			return message, true
+		}
+	}
+	return CapturedMessage{}, false
+}
+
+// Clear drops every captured message.
+func (m *MemoryMailer) Clear() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = nil
+}
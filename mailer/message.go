@@ -0,0 +1,363 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Message is an email to be built into an RFC 5322 message with MIME bodies (RFC 2045).
+// From, To and Subject are required in practice; everything else is optional.
+type Message struct {
+	From        string // An address, optionally with a display name: "Acme Support <support@acme.com>"
+	ReplyTo     []string
+	To          []string
+	Cc          []string
+	Bcc         []string // Envelope recipients only, never written to the headers
+	Subject     string
+	Text        string
+	HTML        string
+	Attachments []Attachment
+	Headers     map[string]string // Custom headers such as X-Campaign-ID or List-Unsubscribe
+	Date        time.Time         // time.Now() when zero
+	MessageID   string            // Generated from the From domain when empty, with or without <>
+	InReplyTo   string
+	References  []string
+}
+
+// Attachment is a file sent with a message. ContentType may carry parameters,
+// e.g. "text/calendar; method=REQUEST".
+type Attachment struct {
+	FileName    string
+	ContentType string
+	Data        []byte
+}
+
+// ErrInvalidMessage is wrapped by the errors Message returns for bad addresses and headers.
+// Sending the message again cannot fix them.
+var ErrInvalidMessage = errors.New("invalid message")
+
+// reservedHeaders are written by Bytes and cannot be set through Headers.
+var reservedHeaders = map[string]bool{
+	"From": true, "Reply-To": true, "To": true, "Cc": true, "Bcc": true, "Subject": true,
+	"Date": true, "Message-Id": true, "In-Reply-To": true, "References": true,
+	"Mime-Version": true, "Content-Type": true, "Content-Transfer-Encoding": true,
+	"Dkim-Signature": true,
+}
+
+// Recipients returns the envelope recipients: the bare addresses of To, Cc and Bcc, without duplicates.
+func (m *Message) Recipients() ([]string, error) {
+	var recipients []string
+	seen := map[string]bool{}
+	for _, list := range [][]string{m.To, m.Cc, m.Bcc} {
+		addrs, err := parseAddresses(list)
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			if key := strings.ToLower(addr.Address); !seen[key] {
+				seen[key] = true
+				recipients = append(recipients, addr.Address)
+			}
+		}
+	}
+	return recipients, nil
+}
+
+// Sender returns the bare address of From, for the envelope.
+func (m *Message) Sender() (string, error) {
+	addr, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid From address %q: %v", ErrInvalidMessage, m.From, err)
+	}
+	return addr.Address, nil
+}
+
+// Check reports what would stop the message from being built, apart from the From address:
+// missing recipients, invalid addresses and header values that are not allowed.
+func (m *Message) Check() error {
+	if len(m.To)+len(m.Cc)+len(m.Bcc) == 0 {
+		return fmt.Errorf("%w: message has no recipients", ErrInvalidMessage)
+	}
+	for _, list := range [][]string{m.ReplyTo, m.To, m.Cc, m.Bcc} {
+		if _, err := parseAddresses(list); err != nil {
+			return err
+		}
+	}
+	for name, value := range map[string]string{
+		"Subject":     m.Subject,
+		"Message-ID":  m.MessageID,
+		"In-Reply-To": m.InReplyTo,
+		"References":  strings.Join(m.References, " "),
+	} {
+		if err := checkHeaderValue(name, value); err != nil {
+			return err
+		}
+	}
+	for name, value := range m.Headers {
+		if !validHeaderName(name) {
+			return fmt.Errorf("%w: invalid header name %q", ErrInvalidMessage, name)
+		}
+		if reservedHeaders[textproto.CanonicalMIMEHeaderKey(name)] {
+			return fmt.Errorf("%w: header %s cannot be set directly", ErrInvalidMessage, name)
+		}
+		if err := checkHeaderValue(name, value); err != nil {
+			return err
+		}
+	}
+	for _, attachment := range m.Attachments {
+		if err := checkHeaderValue("Content-Type", attachment.ContentType+attachment.FileName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Bytes builds the message. Non-ASCII display names and subjects are encoded as RFC 2047
+// encoded words and bodies as quoted-printable. A text and an HTML body become
+// multipart/alternative; attachments wrap the body in multipart/mixed.
+func (m *Message) Bytes() ([]byte, error) {
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid From address %q: %v", ErrInvalidMessage, m.From, err)
+	}
+	if err := m.Check(); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	header := func(name, value string) {
+		writeHeader(&buf, name, value)
+	}
+
+	date := m.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	header("Date", date.Format(time.RFC1123Z))
+	header("From", from.String())
+	for _, field := range []struct {
+		name string
+		list []string
+	}{{"Reply-To", m.ReplyTo}, {"To", m.To}, {"Cc", m.Cc}} {
+		if len(field.list) == 0 {
+			continue
+		}
+		addrs, _ := parseAddresses(field.list)
+		formatted := make([]string, 0, len(addrs))
+		for _, addr := range addrs {
+			formatted = append(formatted, addr.String())
+		}
+		header(field.name, strings.Join(formatted, ", "))
+	}
+	header("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+
+	messageID := m.MessageID
+	if messageID == "" {
+		messageID = NewMessageID(from.Address)
+	}
+	header("Message-ID", angleBrackets(messageID))
+	if m.InReplyTo != "" {
+		header("In-Reply-To", angleBrackets(m.InReplyTo))
+	}
+	if len(m.References) > 0 {
+		refs := make([]string, 0, len(m.References))
+		for _, ref := range m.References {
+			refs = append(refs, angleBrackets(ref))
+		}
+		header("References", strings.Join(refs, " "))
+	}
+
+	// Custom headers in a stable order, so signatures and tests see the same message
+	names := make([]string, 0, len(m.Headers))
+	for name := range m.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		header(name, mime.QEncoding.Encode("utf-8", m.Headers[name]))
+	}
+	header("MIME-Version", "1.0")
+
+	body, err := m.body()
+	if err != nil {
+		return nil, err
+	}
+	if len(m.Attachments) == 0 {
+		for _, name := range []string{"Content-Type", "Content-Transfer-Encoding"} {
+			if value := body.header.Get(name); value != "" {
+				header(name, value)
+			}
+		}
+		buf.WriteString("\r\n")
+		buf.Write(body.content)
+		return buf.Bytes(), nil
+	}
+
+	mixed := multipart.NewWriter(&buf)
+	header("Content-Type", "multipart/mixed; boundary=\""+mixed.Boundary()+"\"")
+	buf.WriteString("\r\n")
+	part, err := mixed.CreatePart(body.header)
+	if err != nil {
+		return nil, err
+	}
+	part.Write(body.content)
+
+	for _, attachment := range m.Attachments {
+		contentType := attachment.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		part, err := mixed.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {contentType},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": attachment.FileName})},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		writeBase64(part, attachment.Data)
+	}
+	if err := mixed.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type mimePart struct {
+	header  textproto.MIMEHeader
+	content []byte
+}
+
+// body encodes the text and HTML bodies: text/plain alone, or multipart/alternative with both.
+func (m *Message) body() (mimePart, error) {
+	var buf bytes.Buffer
+	if m.HTML == "" {
+		writeQuotedPrintable(&buf, m.Text)
+		return mimePart{textproto.MIMEHeader{
+			"Content-Type":              {"text/plain; charset=utf-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		}, buf.Bytes()}, nil
+	}
+
+	alternative := multipart.NewWriter(&buf)
+	// Clients show the last part they understand, so the HTML version goes last
+	for _, body := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", m.Text},
+		{"text/html; charset=utf-8", m.HTML},
+	} {
+		w, err := alternative.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {body.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return mimePart{}, err
+		}
+		writeQuotedPrintable(w, body.content)
+	}
+	if err := alternative.Close(); err != nil {
+		return mimePart{}, err
+	}
+	return mimePart{textproto.MIMEHeader{
+		"Content-Type": {"multipart/alternative; boundary=\"" + alternative.Boundary() + "\""},
+	}, buf.Bytes()}, nil
+}
+
+// NewMessageID returns a unique message ID on the domain of the sender address, which may
+// carry a display name.
+func NewMessageID(sender string) string {
+	domain := "localhost"
+	if addr, err := mail.ParseAddress(sender); err == nil {
+		sender = addr.Address
+	}
+	if at := strings.LastIndex(sender, "@"); at >= 0 && at < len(sender)-1 {
+		domain = sender[at+1:]
+	}
+	random := make([]byte, 12)
+	rand.Read(random)
+	return fmt.Sprintf("<%d.%s@%s>", time.Now().UnixNano(), hex.EncodeToString(random), domain)
+}
+
+func angleBrackets(id string) string {
+	id = strings.TrimSpace(id)
+	if !strings.HasPrefix(id, "<") {
+		id = "<" + id + ">"
+	}
+	return id
+}
+
+func parseAddresses(list []string) ([]*mail.Address, error) {
+	addrs := make([]*mail.Address, 0, len(list))
+	for _, value := range list {
+		addr, err := mail.ParseAddress(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid address %q: %v", ErrInvalidMessage, value, err)
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs, nil
+}
+
+// checkHeaderValue refuses line breaks, which would let a value inject headers of its own.
+func checkHeaderValue(name, value string) error {
+	if strings.ContainsAny(value, "\r\n") {
+		return fmt.Errorf("%w: header %s must not contain line breaks", ErrInvalidMessage, name)
+	}
+	return nil
+}
+
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if r <= ' ' || r > '~' || r == ':' {
+			return false
+		}
+	}
+	return true
+}
+
+// writeHeader writes a header field, folding it at spaces to keep lines under 78 characters
+// where possible (RFC 5322 section 2.2.3).
+func writeHeader(buf *bytes.Buffer, name, value string) {
+	line := name + ":"
+	for _, word := range strings.Split(value, " ") {
+		if len(line) > len(name)+1 && len(line)+1+len(word) > 76 {
+			buf.WriteString(line + "\r\n")
+			line = ""
+		}
+		line += " " + word
+	}
+	buf.WriteString(line + "\r\n")
+}
+
+func writeQuotedPrintable(w interface{ Write([]byte) (int, error) }, content string) {
+	// Normalise line endings, so the encoder emits CRLF for every line break
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	content = strings.ReplaceAll(content, "\n", "\r\n")
+	qp := quotedprintable.NewWriter(w)
+	qp.Write([]byte(content))
+	qp.Close()
+}
+
+func writeBase64(w interface{ Write([]byte) (int, error) }, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	// Base64 lines must not exceed 76 characters
+	for len(encoded) > 76 {
+		w.Write([]byte(encoded[:76] + "\r\n"))
+		encoded = encoded[76:]
+	}
+	w.Write([]byte(encoded + "\r\n"))
+}
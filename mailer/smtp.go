@@ -0,0 +1,221 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// TLS modes of the SMTP backend.
+const (
+	TLSAuto     = "auto"     // STARTTLS when the server offers it
+	TLSStartTLS = "starttls" // STARTTLS required
+	TLSImplicit = "tls"      // TLS from the first byte, usually port 465
+	TLSNone     = "none"
+)
+
+// Authentication methods of the SMTP backend.
+const (
+	AuthPlain   = "plain"
+	AuthLogin   = "login"
+	AuthCRAMMD5 = "cram-md5"
+	AuthNone    = "none"
+)
+
+// SMTPMailer sends mail through an SMTP server.
+type SMTPMailer struct {
+	Addr               string // host:port of the server
+	ServerName         string // Name to verify the certificate against; the host of Addr by default
+	TLS                string // One of the TLS modes, TLSAuto by default
+	InsecureSkipVerify bool   // Accept any certificate, for test servers only
+	Auth               string // One of the authentication methods; AuthPlain when a username is set
+	Username           string
+	Password           string
+	LocalName          string        // Name sent with EHLO, "localhost" by default
+	Timeout            time.Duration // For the whole conversation, 30 seconds by default
+}
+
+// SMTPConfigFromEnv configures the SMTP backend from SMTP_ADDR, SMTP_TLS, SMTP_AUTH,
+// SMTP_USERNAME, SMTP_PASSWORD, SMTP_SERVER_NAME, SMTP_LOCAL_NAME, SMTP_TIMEOUT and
+// SMTP_INSECURE_SKIP_VERIFY. The older FROM_EMAIL, FROM_EMAIL_PASSWORD and FROM_EMAIL_SMTP
+// variables are used when the newer ones are not set.
+func SMTPConfigFromEnv() (*SMTPMailer, error) {
+	m := &SMTPMailer{
+		Addr:               os.Getenv("SMTP_ADDR"),
+		ServerName:         firstNonEmpty(os.Getenv("SMTP_SERVER_NAME"), os.Getenv("FROM_EMAIL_SMTP")),
+		TLS:                strings.ToLower(os.Getenv("SMTP_TLS")),
+		InsecureSkipVerify: os.Getenv("SMTP_INSECURE_SKIP_VERIFY") == "true",
+		Auth:               strings.ToLower(os.Getenv("SMTP_AUTH")),
+		Username:           firstNonEmpty(os.Getenv("SMTP_USERNAME"), os.Getenv("FROM_EMAIL")),
+		Password:           firstNonEmpty(os.Getenv("SMTP_PASSWORD"), os.Getenv("FROM_EMAIL_PASSWORD")),
+		LocalName:          os.Getenv("SMTP_LOCAL_NAME"),
+		Timeout:            envDuration("SMTP_TIMEOUT", 30*time.Second),
+	}
+	return m, m.check()
+}
+
+func (m *SMTPMailer) check() error {
+	if m.Addr == "" {
+		return errors.New("SMTP_ADDR is not set")
+	}
+	if _, _, err := net.SplitHostPort(m.Addr); err != nil {
+		return fmt.Errorf("invalid SMTP_ADDR: %v", err)
+	}
+	switch m.TLS {
+	case "", TLSAuto, TLSStartTLS, TLSImplicit, TLSNone:
+	default:
+		return fmt.Errorf("unknown SMTP TLS mode %q", m.TLS)
+	}
+	switch m.Auth {
+	case "", AuthPlain, AuthLogin, AuthCRAMMD5, AuthNone:
+	default:
+		return fmt.Errorf("unknown SMTP auth method %q", m.Auth)
+	}
+	return nil
+}
+
+// Send delivers msg in one SMTP session. Replies from the server are returned as
+// *textproto.Error, so callers can tell permanent (5xx) from temporary failures.
+func (m *SMTPMailer) Send(ctx context.Context, from string, to []string, msg []byte) error {
+	if err := m.check(); err != nil {
+		return err
+	}
+	host, _, _ := net.SplitHostPort(m.Addr)
+	serverName := firstNonEmpty(m.ServerName, host)
+	tlsConfig := &tls.Config{ServerName: serverName, InsecureSkipVerify: m.InsecureSkipVerify}
+
+	timeout := m.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	dialer := &net.Dialer{Deadline: deadline}
+
+	var conn net.Conn
+	var err error
+	if m.TLS == TLSImplicit {
+		conn, err = tls.DialWithDialer(dialer, "tcp", m.Addr, tlsConfig)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", m.Addr)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, serverName)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if err := client.Hello(firstNonEmpty(m.LocalName, "localhost")); err != nil {
+		return err
+	}
+	if m.TLS == TLSStartTLS || m.TLS == TLSAuto || m.TLS == "" {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(tlsConfig); err != nil {
+				return err
+			}
+		} else if m.TLS == TLSStartTLS {
+			return errors.New("SMTP server does not support STARTTLS")
+		}
+	}
+
+	if auth := m.auth(serverName); auth != nil {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return errors.New("SMTP server does not support authentication")
+		}
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := client.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func (m *SMTPMailer) auth(serverName string) smtp.Auth {
+	method := m.Auth
+	if method == "" {
+		method = AuthPlain
+		if m.Username == "" {
+			method = AuthNone
+		}
+	}
+	switch method {
+	case AuthPlain:
+		return smtp.PlainAuth("", m.Username, m.Password, serverName)
+	case AuthLogin:
+		return &loginAuth{username: m.Username, password: m.Password, host: serverName}
+	case AuthCRAMMD5:
+		return smtp.CRAMMD5Auth(m.Username, m.Password)
+	}
+	return nil
+}
+
+// loginAuth implements the LOGIN mechanism, which some servers offer instead of PLAIN.
+// Like smtp.PlainAuth it refuses to send the password over an unencrypted connection,
+// except to localhost.
+type loginAuth struct {
+	username, password, host string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && a.host != "localhost" && a.host != "127.0.0.1" && a.host != "::1" {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:":
+		return []byte(a.username), nil
+	case "password:":
+		return []byte(a.password), nil
+	}
+	return nil, fmt.Errorf("unexpected LOGIN challenge %q", fromServer)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -1,11 +1,17 @@
 package main
 
 import (
+	controller "github.com/SiddharthaKR/golang-jwt-project/controllers"
 	routes "github.com/SiddharthaKR/golang-jwt-project/routes"
+	"github.com/SiddharthaKR/golang-jwt-project/inbound"
+	"github.com/SiddharthaKR/golang-jwt-project/outbox"
+	"github.com/SiddharthaKR/golang-jwt-project/scheduler"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 	"log"
 	"os"
+	"strconv"
+	"time"
 )
 
 func main() {
@@ -24,11 +30,28 @@ func main() {
 	router.Use(gin.Logger())
 	
 	routes.AuthRoutes(router)
+	routes.FileRoutes(router)
+	routes.CalendarRoutes(router)
+	routes.FeedbackRoutes(router)
+	routes.PublicArticleRoutes(router)
+	routes.InboundEmailRoutes(router)
+	routes.TrackingRoutes(router)
 	routes.UserRoutes(router)
 	routes.CustomerRoutes(router)
 	routes.CompanyRoutes(router)
 	routes.InteractionRoutes(router)
 	routes.EmailRoutes(router)
+	routes.DealRoutes(router)
+	routes.ExchangeRateRoutes(router)
+	routes.SLARoutes(router)
+	routes.AttachmentRoutes(router)
+	routes.JobRoutes(router)
+	routes.TaskRoutes(router)
+	routes.SurveyRoutes(router)
+	routes.ArticleRoutes(router)
+	routes.InboundRoutes(router)
+	routes.MacroRoutes(router)
+	routes.CampaignRoutes(router)
 
 	router.GET("/api-1", func(c *gin.Context) {
 		c.JSON(200, gin.H{"success": "Access granted for api-1"})
@@ -38,5 +61,50 @@ func main() {
 		c.JSON(200, gin.H{"success": "Access granted for api-2"})
 	})
 
+	// Re-check ticket SLAs in the background; SLA_EVALUATION_INTERVAL is in seconds
+	slaInterval := time.Minute
+	if seconds, err := strconv.Atoi(os.Getenv("SLA_EVALUATION_INTERVAL")); err == nil && seconds > 0 {
+		slaInterval = time.Duration(seconds) * time.Second
+	}
+	controller.RegisterEventHandlers()
+	controller.RegisterJobs("@every " + slaInterval.String())
+
+	// Poll for due background jobs; JOB_POLL_INTERVAL is in seconds
+	pollInterval := 10 * time.Second
+	if seconds, err := strconv.Atoi(os.Getenv("JOB_POLL_INTERVAL")); err == nil && seconds > 0 {
+		pollInterval = time.Duration(seconds) * time.Second
+	}
+	go scheduler.Start(pollInterval)
+
+	// Deliver queued email; OUTBOX_WORKERS senders check every OUTBOX_POLL_INTERVAL seconds
+	outboxWorkers := 4
+	if workers, err := strconv.Atoi(os.Getenv("OUTBOX_WORKERS")); err == nil && workers > 0 {
+		outboxWorkers = workers
+	}
+	outboxInterval := 5 * time.Second
+	if seconds, err := strconv.Atoi(os.Getenv("OUTBOX_POLL_INTERVAL")); err == nil && seconds > 0 {
+		outboxInterval = time.Duration(seconds) * time.Second
+	}
+	outbox.Start(outboxWorkers, outboxInterval)
+
+	// Receive support mail directly when INBOUND_SMTP_ADDR is set, e.g. ":2525"
+	if addr := os.Getenv("INBOUND_SMTP_ADDR"); addr != "" {
+		hostname := os.Getenv("INBOUND_SMTP_HOSTNAME")
+		if hostname == "" {
+			hostname = "localhost"
+		}
+		smtpServer := &inbound.Server{
+			Addr:          addr,
+			Hostname:      hostname,
+			MaxBytes:      controller.InboundMaxBytes(),
+			MaxRecipients: 100,
+			Timeout:       5 * time.Minute,
+			Handler:       controller.HandleInboundEmail,
+		}
+		go func() {
+			log.Println("Inbound SMTP stopped:", smtpServer.ListenAndServe())
+		}()
+	}
+
 	router.Run(":" + port)
 }
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ArticleCategory groups the knowledge base articles of a company.
+type ArticleCategory struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	CompanyID   primitive.ObjectID `bson:"companyID" json:"company_id"`
+	Name        string             `bson:"name" json:"name" validate:"required,max=100"`
+	Description string             `bson:"description,omitempty" json:"description,omitempty"`
+	Position    int                `bson:"position" json:"position"` // Categories are listed by position, then name.
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// Article is a knowledge base article. Only PUBLISHED articles are served publicly.
+type Article struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	CompanyID   primitive.ObjectID `bson:"companyID" json:"company_id"`
+	CategoryID  primitive.ObjectID `bson:"categoryID,omitempty" json:"category_id,omitempty"`
+	Title       string             `bson:"title" json:"title" validate:"required,max=200"`
+	Slug        string             `bson:"slug" json:"slug"` // Unique within the company, derived from the title.
+	Body        string             `bson:"body" json:"body,omitempty" validate:"required"`
+	BodyHTML    string             `bson:"-" json:"body_html,omitempty"` // Body rendered to sanitised HTML when read.
+	Tags        []string           `bson:"tags,omitempty" json:"tags,omitempty"`
+	Status      string             `bson:"status" json:"status" validate:"required,eq=DRAFT|eq=PUBLISHED"`
+	AuthorID    primitive.ObjectID `bson:"authorID" json:"author_id"`
+	PublishedAt *time.Time         `bson:"published_at,omitempty" json:"published_at,omitempty"` // First time the article was published.
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// TicketArticle records that an article resolved a ticket.
+type TicketArticle struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	CompanyID primitive.ObjectID `bson:"companyID" json:"company_id"`
+	TicketID  primitive.ObjectID `bson:"ticketID" json:"ticket_id"`
+	ArticleID primitive.ObjectID `bson:"articleID" json:"article_id"`
+	LinkedBy  primitive.ObjectID `bson:"linkedBy" json:"linked_by"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Attachment is an uploaded file linked to an interaction, customer or lead. The bytes live in the blob store under StorageKey.
+type Attachment struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	CompanyID   primitive.ObjectID `bson:"companyID" json:"company_id"`
+	TargetType  string             `bson:"target_type" json:"target_type"` // INTERACTION, CUSTOMER or LEAD
+	TargetID    primitive.ObjectID `bson:"targetID" json:"target_id"`
+	FileName    string             `bson:"file_name" json:"file_name"`
+	ContentType string             `bson:"content_type" json:"content_type"` // Sniffed from the file contents, not taken from the client.
+	Size        int64              `bson:"size" json:"size"`
+	SHA256      string             `bson:"sha256" json:"sha256"`
+	StorageKey  string             `bson:"storage_key" json:"-"`
+	MessageID   primitive.ObjectID `bson:"messageID,omitempty" json:"message_id,omitempty"` // Ticket message the file belongs to, if any
+	Internal    bool               `bson:"internal,omitempty" json:"internal,omitempty"`    // Hidden from customers: uploaded as INTERNAL or attached to an internal note
+	UploadedBy  primitive.ObjectID `bson:"uploadedBy" json:"uploaded_by"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+}
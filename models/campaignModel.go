@@ -0,0 +1,67 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Campaign is a bulk email to the customers of a company: either a segment of them or a list.
+// Each recipient gets their own copy of the template, rendered for them and sent separately.
+// Campaigns move from DRAFT to SCHEDULED, SENDING and SENT, or are CANCELLED on the way.
+type Campaign struct {
+	ID            primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+	CompanyID     primitive.ObjectID   `bson:"companyID" json:"company_id"`
+	Name          string               `bson:"name" json:"name" validate:"required,max=200"`
+	TemplateID    primitive.ObjectID   `bson:"templateID" json:"template_id"`
+	Segment       *CampaignSegment     `bson:"segment,omitempty" json:"segment,omitempty"`                                 // Send to the customers matching the segment,
+	CustomerIDs   []primitive.ObjectID `bson:"customerIDs,omitempty" json:"customer_ids,omitempty"`                        // or to this list of customers
+	RatePerMinute int                  `bson:"rate_per_minute" json:"rate_per_minute" validate:"omitempty,min=1,max=1000"` // Emails queued per minute, 60 by default
+	Status        string               `bson:"status" json:"status"`
+	ScheduledAt   *time.Time           `bson:"scheduled_at,omitempty" json:"scheduled_at,omitempty"`
+	StartedAt     *time.Time           `bson:"started_at,omitempty" json:"started_at,omitempty"`     // When recipients were resolved
+	CompletedAt   *time.Time           `bson:"completed_at,omitempty" json:"completed_at,omitempty"` // When the last recipient was queued
+	CreatedBy     string               `bson:"created_by" json:"created_by"`                         // user_id; the template's {{.User}}
+	CreatedAt     time.Time            `bson:"created_at" json:"created_at"`
+	UpdatedAt     time.Time            `bson:"updated_at" json:"updated_at"`
+}
+
+// CampaignSegment selects customers of the campaign's company. Empty criteria match everyone.
+type CampaignSegment struct {
+	Statuses      []string   `bson:"statuses,omitempty" json:"statuses,omitempty" validate:"dive,oneof=LEAD PROSPECT CUSTOMER"`
+	CreatedAfter  *time.Time `bson:"created_after,omitempty" json:"created_after,omitempty"`
+	CreatedBefore *time.Time `bson:"created_before,omitempty" json:"created_before,omitempty"`
+}
+
+// CampaignRecipient is one customer a campaign is sent to. Its ID is also the ID of the outbox
+// message it was queued as, so a recipient can never be queued twice.
+type CampaignRecipient struct {
+	ID             primitive.ObjectID `bson:"_id" json:"id"`
+	CampaignID     primitive.ObjectID `bson:"campaignID" json:"campaign_id"`
+	CompanyID      primitive.ObjectID `bson:"companyID" json:"company_id"`
+	CustomerID     primitive.ObjectID `bson:"customerID" json:"customer_id"`
+	Email          string             `bson:"email" json:"email"`
+	Status         string             `bson:"status" json:"status"`                     // PENDING, QUEUED or SKIPPED
+	Detail         string             `bson:"detail,omitempty" json:"detail,omitempty"` // Why the recipient was skipped
+	QueuedAt       *time.Time         `bson:"queued_at,omitempty" json:"queued_at,omitempty"`
+	UnsubscribedAt *time.Time         `bson:"unsubscribed_at,omitempty" json:"unsubscribed_at,omitempty"`
+}
+
+// CampaignStats summarises how a campaign went. Sent, Failed, Suppressed, Opened, Clicked,
+// Bounced and Complained count outbox messages; a message opened or clicked several times
+// counts once.
+type CampaignStats struct {
+	Audience     int64 `json:"audience"`   // Customers the campaign would reach now; before it starts
+	Recipients   int64 `json:"recipients"` // Customers it was resolved to; once it has started
+	Pending      int64 `json:"pending"`    // Recipients not queued yet
+	Skipped      int64 `json:"skipped"`
+	Queued       int64 `json:"queued"` // Queued and not yet sent or given up on
+	Sent         int64 `json:"sent"`
+	Failed       int64 `json:"failed"`
+	Suppressed   int64 `json:"suppressed"` // Not sent because the address was suppressed by then
+	Opened       int64 `json:"opened"`
+	Clicked      int64 `json:"clicked"`
+	Bounced      int64 `json:"bounced"`
+	Complained   int64 `json:"complained"`
+	Unsubscribed int64 `json:"unsubscribed"`
+}
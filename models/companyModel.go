@@ -6,8 +6,12 @@ import (
 )
 
 type Company struct {
-	ID        primitive.ObjectID `bson:"_id"`
-	Name      *string            `json:"name" validate:"required"`
-	CreatedAt time.Time         `json:"created_at"`
-	UpdatedAt time.Time         `json:"updated_at"`
+	ID                primitive.ObjectID `bson:"_id"`
+	Name              *string            `json:"name" validate:"required"`
+	ReportingCurrency string             `json:"reporting_currency,omitempty" bson:"reporting_currency,omitempty"` // ISO 4217 code reports are converted into.
+	CustomerCount     int                `json:"customer_count" bson:"customer_count,omitempty"`                   // Maintained by the server.
+	OpenTickets       int                `json:"open_tickets" bson:"open_tickets,omitempty"`                       // Maintained by the server.
+	InboundEmails     []string           `json:"inbound_emails,omitempty" bson:"inbound_emails,omitempty"`         // Addresses whose mail becomes tickets of this company.
+	CreatedAt         time.Time          `json:"created_at"`
+	UpdatedAt         time.Time          `json:"updated_at"`
 }
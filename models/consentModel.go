@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Consent records that a customer granted or withdrew consent to be contacted on a channel
+// for a purpose. Records are never changed; the latest one for a channel and purpose is the
+// customer's current consent.
+type Consent struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	CustomerID primitive.ObjectID `bson:"customerID" json:"customer_id"`
+	CompanyID  primitive.ObjectID `bson:"companyID" json:"company_id"`
+	Channel    string             `bson:"channel" json:"channel" validate:"required,oneof=EMAIL SMS PHONE"`
+	Purpose    string             `bson:"purpose" json:"purpose" validate:"required,max=50"` // e.g. MARKETING; EMAIL MARKETING consent drives unsubscribes
+	Status     string             `bson:"status" json:"status" validate:"required,oneof=GRANTED WITHDRAWN"`
+	Source     string             `bson:"source" json:"source" validate:"required,max=100"` // Where it was given, e.g. "signup_form" or "unsubscribe_link"
+	IP         string             `bson:"ip,omitempty" json:"ip,omitempty"`
+	RecordedBy string             `bson:"recorded_by,omitempty" json:"recorded_by,omitempty"` // user_id, or the customer's ID when they recorded it themselves
+	RecordedAt time.Time          `bson:"recorded_at" json:"recorded_at"`                     // When consent was given or withdrawn
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+}
@@ -18,8 +18,25 @@ type Customer struct {
 	UpdatedAt     time.Time          `json:"updated_at" bson:"updated_at"`                // Timestamp for the last update.
 	CustomerID    string             `json:"customer_id" bson:"customer_id"`              // Unique identifier for business logic.
 	LastInteraction time.Time        `json:"last_interaction,omitempty" bson:"last_interaction"` // Timestamp for the last interaction with the customer.
+	OpenTickets       int                `json:"open_tickets" bson:"open_tickets"`                          // Tickets not yet resolved or closed; maintained by the server.
+	TotalInteractions int                `json:"total_interactions" bson:"total_interactions"`              // Interactions of any type, a recurring meeting counting once; maintained by the server.
+	NextMeetingAt     *time.Time         `json:"next_meeting_at,omitempty" bson:"next_meeting_at,omitempty"` // Start of the next scheduled meeting; maintained by the server.
+	NextMeetingID     primitive.ObjectID `json:"next_meeting_id,omitempty" bson:"next_meetingID,omitempty"`  // Meeting (or series) starting at NextMeetingAt.
 	CompanyID       primitive.ObjectID `bson:"companyID" json:"company_id"`
 	PasswordHash  *string            `json:"password" validate:"required" bson:"password"` // Hashed password for security.
 	Token         *string            `json:"token,omitempty" bson:"token"`                // JWT token for session management.
 	RefreshToken  *string            `json:"refresh_token,omitempty" bson:"refresh_token"`// Refresh token for extended sessions.
 }
+
+// CustomerChange records a change to one field of a customer. Status changes are the customer's
+// lead transitions (LEAD, PROSPECT, CUSTOMER).
+type CustomerChange struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	CustomerID primitive.ObjectID `bson:"customerID" json:"customer_id"`
+	CompanyID  primitive.ObjectID `bson:"companyID" json:"company_id"`
+	Field      string             `bson:"field" json:"field"`
+	From       string             `bson:"from" json:"from"`
+	To         string             `bson:"to" json:"to"`
+	ChangedBy  primitive.ObjectID `bson:"changedBy" json:"changed_by"`
+	ChangedAt  time.Time          `bson:"changed_at" json:"changed_at"`
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Deal struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	CompanyID    primitive.ObjectID `bson:"companyID" json:"company_id"`
+	CustomerID   primitive.ObjectID `bson:"customerID" json:"customer_id" validate:"required"`
+	OwnerID      primitive.ObjectID `bson:"ownerID" json:"owner_id"`
+	Title        string             `bson:"title" json:"title" validate:"required"`
+	Stage        string             `bson:"stage" json:"stage" validate:"required,eq=PROSPECTING|eq=QUALIFIED|eq=PROPOSAL|eq=NEGOTIATION|eq=WON|eq=LOST"`
+	Value        Money              `bson:"value" json:"value"`
+	CloseDate    time.Time          `bson:"close_date,omitempty" json:"close_date,omitempty"` // Expected or actual close date.
+	StageHistory []DealStageChange  `bson:"stage_history,omitempty" json:"stage_history,omitempty"`
+	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt    time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+type DealStageChange struct {
+	From      string             `bson:"from" json:"from"`
+	To        string             `bson:"to" json:"to"`
+	ChangedBy primitive.ObjectID `bson:"changedBy" json:"changed_by"`
+	ChangedAt time.Time          `bson:"changed_at" json:"changed_at"`
+}
+
+type Quote struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	CompanyID  primitive.ObjectID `bson:"companyID" json:"company_id"`
+	CustomerID primitive.ObjectID `bson:"customerID" json:"customer_id" validate:"required"`
+	DealID     primitive.ObjectID `bson:"dealID,omitempty" json:"deal_id,omitempty"`
+	Status     string             `bson:"status" json:"status" validate:"required,eq=DRAFT|eq=SENT|eq=ACCEPTED|eq=REJECTED"`
+	Currency   string             `bson:"currency" json:"currency" validate:"required,len=3,uppercase"`
+	Items      []QuoteItem        `bson:"items" json:"items" validate:"required,min=1,dive"`
+	Total      Money              `bson:"total" json:"total"` // Computed from Items on save.
+	ValidUntil time.Time          `bson:"valid_until,omitempty" json:"valid_until,omitempty"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt  time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+type QuoteItem struct {
+	Description string `bson:"description" json:"description" validate:"required"`
+	Quantity    int64  `bson:"quantity" json:"quantity" validate:"required,min=1"`
+	UnitPrice   Money  `bson:"unit_price" json:"unit_price"`
+}
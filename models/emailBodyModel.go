@@ -0,0 +1,11 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// EmailBody is the full body of an email logged as an EMAIL interaction. It is kept apart from
+// the interaction, so listing interactions does not load every email in full.
+type EmailBody struct {
+	ID   primitive.ObjectID `bson:"_id" json:"interaction_id"` // The interaction's ID
+	Text string             `bson:"text,omitempty" json:"text,omitempty"`
+	HTML string             `bson:"html,omitempty" json:"html,omitempty"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// EmailEvent records a recipient opening a tracked email or clicking one of its links.
+type EmailEvent struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Type       string             `bson:"type" json:"type"` // OPEN or CLICK
+	OutboxID   primitive.ObjectID `bson:"outboxID" json:"outbox_id"`
+	CompanyID  primitive.ObjectID `bson:"companyID,omitempty" json:"company_id,omitempty"`
+	CustomerID primitive.ObjectID `bson:"customerID,omitempty" json:"customer_id,omitempty"`
+	CampaignID primitive.ObjectID `bson:"campaignID,omitempty" json:"campaign_id,omitempty"`
+	Subject    string             `bson:"subject" json:"subject"`
+	URL        string             `bson:"url,omitempty" json:"url,omitempty"` // The link clicked
+	IP         string             `bson:"ip,omitempty" json:"ip,omitempty"`
+	UserAgent  string             `bson:"user_agent,omitempty" json:"user_agent,omitempty"`
+	OccurredAt time.Time          `bson:"occurred_at" json:"occurred_at"`
+}
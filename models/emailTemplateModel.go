@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// EmailTemplate is a company's email template or layout. Subject and TextBody use Go's
+// text/template syntax and HTMLBody html/template, e.g. {{.Customer.FirstName}}. A LAYOUT
+// wraps the bodies of the templates that use it with {{template "content" .}}; its subject
+// is not used.
+type EmailTemplate struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	CompanyID primitive.ObjectID `bson:"companyID" json:"company_id"`
+	Name      string             `bson:"name" json:"name" validate:"required,max=100"`
+	Type      string             `bson:"type" json:"type" validate:"omitempty,eq=TEMPLATE|eq=LAYOUT"` // TEMPLATE by default
+	LayoutID  primitive.ObjectID `bson:"layoutID,omitempty" json:"layout_id,omitempty"`               // For templates
+	Subject   string             `bson:"subject,omitempty" json:"subject,omitempty"`
+	TextBody  string             `bson:"text_body,omitempty" json:"text_body,omitempty"`
+	HTMLBody  string             `bson:"html_body,omitempty" json:"html_body,omitempty"`
+	CreatedBy primitive.ObjectID `bson:"createdBy" json:"created_by"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// InboundEmail records what happened to an email received for ticket ingestion.
+type InboundEmail struct {
+	ID              primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	MessageID       string             `bson:"message_id,omitempty" json:"message_id,omitempty"`
+	From            string             `bson:"from" json:"from"`
+	To              []string           `bson:"to" json:"to"` // Envelope recipients, or the To and Cc headers for messages posted over HTTP.
+	Subject         string             `bson:"subject,omitempty" json:"subject,omitempty"`
+	CompanyID       primitive.ObjectID `bson:"companyID,omitempty" json:"company_id,omitempty"`
+	CustomerID      primitive.ObjectID `bson:"customerID,omitempty" json:"customer_id,omitempty"`
+	TicketID        primitive.ObjectID `bson:"ticketID,omitempty" json:"ticket_id,omitempty"`
+	TicketMessageID primitive.ObjectID `bson:"ticketMessageID,omitempty" json:"ticket_message_id,omitempty"`
+	Status          string             `bson:"status" json:"status"` // See InboundEmailStatuses.
+	Detail          string             `bson:"detail,omitempty" json:"detail,omitempty"`
+	Attachments     int                `bson:"attachments,omitempty" json:"attachments,omitempty"` // Attachments stored with the ticket.
+	ReceivedAt      time.Time          `bson:"received_at" json:"received_at"`
+}
+
+// InboundEmailStatuses lists the outcomes of an inbound email.
+var InboundEmailStatuses = []string{
+	"TICKET_CREATED",    // A new ticket was raised.
+	"REPLY_ADDED",       // The email was added to an existing ticket as a customer reply.
+	"DUPLICATE",         // An email with the same Message-ID was already ingested.
+	"UNKNOWN_RECIPIENT", // No company receives mail at any of the recipient addresses.
+	"UNKNOWN_SENDER",    // The sender is not a customer of the company.
+	"AUTO_REPLY",        // Automatic replies such as out-of-office notices are dropped.
+	"INVALID",           // The message could not be parsed.
+}
@@ -7,14 +7,93 @@ import (
 )
 
 type Interaction struct {
-	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	CustomerID   primitive.ObjectID `bson:"customerID" json:"customer_id"`
-	UserID       primitive.ObjectID `bson:"userID" json:"user_id"`
-	CompanyID    primitive.ObjectID `bson:"companyID" json:"company_id"`
-	Type         string             `bson:"type" json:"type" validate:"required,eq=MEETING|eq=TICKET"`
-	Status       string             `bson:"status" json:"status" validate:"required,eq=OPEN|eq=RESOLVED"`
-	Description  string             `bson:"description,omitempty" json:"description"`
-	ScheduledAt  time.Time          `bson:"scheduled_at,omitempty" json:"scheduled_at"` // For meetings
-	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
-	UpdatedAt    time.Time          `bson:"updated_at" json:"updated_at"`
+	ID               primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	CustomerID       primitive.ObjectID `bson:"customerID" json:"customer_id"`
+	UserID           primitive.ObjectID `bson:"userID" json:"user_id"`
+	CompanyID        primitive.ObjectID `bson:"companyID" json:"company_id"`
+	Type             string             `bson:"type" json:"type" validate:"required,eq=MEETING|eq=TICKET|eq=CALL|eq=EMAIL|eq=NOTE|eq=TASK"`
+	Status           string             `bson:"status" json:"status" validate:"required"` // Allowed values depend on Type, see InteractionStatuses.
+	Description      string             `bson:"description,omitempty" json:"description"`
+	ScheduledAt      time.Time          `bson:"scheduled_at,omitempty" json:"scheduled_at"`                                // For meetings: start time
+	EndAt            time.Time          `bson:"end_at,omitempty" json:"end_at,omitempty"`                                  // For meetings
+	TimeZone         string             `bson:"time_zone,omitempty" json:"time_zone,omitempty"`                            // For meetings: IANA name, e.g. Europe/Berlin
+	Location         string             `bson:"location,omitempty" json:"location,omitempty"`                              // For meetings
+	VideoLink        string             `bson:"video_link,omitempty" json:"video_link,omitempty" validate:"omitempty,url"` // For meetings
+	Attendees        []MeetingAttendee  `bson:"attendees,omitempty" json:"attendees,omitempty"`                            // For meetings
+	RRule            string             `bson:"rrule,omitempty" json:"rrule,omitempty"`                                    // For recurring meetings: RFC 5545 rule, e.g. FREQ=WEEKLY;BYDAY=MO
+	ExDates          []time.Time        `bson:"exdates,omitempty" json:"exdates,omitempty"`                                // For recurring meetings: skipped occurrences
+	RecurrenceEnd    *time.Time         `bson:"recurrence_end,omitempty" json:"recurrence_end,omitempty"`                  // For recurring meetings: end of the last occurrence, nil if endless
+	SeriesID         primitive.ObjectID `bson:"seriesID,omitempty" json:"series_id,omitempty"`                             // For occurrences of a recurring meeting
+	RecurrenceID     time.Time          `bson:"recurrence_id,omitempty" json:"recurrence_id,omitempty"`                    // For occurrences: original start time
+	Sequence         int                `bson:"sequence,omitempty" json:"sequence,omitempty"`                              // For meetings: iCalendar SEQUENCE, bumped on every change
+	ExternalUID      string             `bson:"external_uid,omitempty" json:"external_uid,omitempty"`                      // For meetings imported from another calendar
+	MeetingHistory   []MeetingChange    `bson:"meeting_history,omitempty" json:"meeting_history,omitempty"`                // For meetings
+	Direction        string             `bson:"direction,omitempty" json:"direction,omitempty"`                            // For calls and emails: INBOUND or OUTBOUND
+	DurationSeconds  int                `bson:"duration_seconds,omitempty" json:"duration_seconds,omitempty"`              // For calls
+	Outcome          string             `bson:"outcome,omitempty" json:"outcome,omitempty"`                                // For calls
+	Subject          string             `bson:"subject,omitempty" json:"subject,omitempty"`                                // For emails
+	MessageID        string             `bson:"message_id,omitempty" json:"message_id,omitempty"`                          // For emails
+	ThreadID         string             `bson:"thread_id,omitempty" json:"thread_id,omitempty"`                            // For emails: Message-ID of the first email of the thread
+	Snippet          string             `bson:"snippet,omitempty" json:"snippet,omitempty"`                                // For emails: start of the body, the full body is in email_body
+	From             string             `bson:"from,omitempty" json:"from,omitempty"`                                      // For emails
+	To               []string           `bson:"to,omitempty" json:"to,omitempty"`                                          // For emails
+	OutboxID         primitive.ObjectID `bson:"outboxID,omitempty" json:"outbox_id,omitempty"`                             // For emails sent through the outbox
+	DueAt            time.Time          `bson:"due_at,omitempty" json:"due_at,omitempty"`                                  // For tasks
+	AssigneeID       primitive.ObjectID `bson:"assigneeID,omitempty" json:"assignee_id,omitempty"`                         // For tasks and tickets
+	Priority         string             `bson:"priority,omitempty" json:"priority,omitempty"`                              // For tickets: LOW, NORMAL, HIGH or URGENT
+	Category         string             `bson:"category,omitempty" json:"category,omitempty"`                              // For tickets
+	Tags             []string           `bson:"tags,omitempty" json:"tags,omitempty"`                                      // For tickets
+	ReopenCount      int                `bson:"reopen_count,omitempty" json:"reopen_count,omitempty"`                      // For tickets
+	ResolvedAt       time.Time          `bson:"resolved_at,omitempty" json:"resolved_at,omitempty"`                        // For tickets
+	ClosedAt         time.Time          `bson:"closed_at,omitempty" json:"closed_at,omitempty"`                            // For tickets
+	FirstRespondedAt time.Time          `bson:"first_responded_at,omitempty" json:"first_responded_at,omitempty"`          // For tickets
+	SLA              *TicketSLA         `bson:"sla,omitempty" json:"sla,omitempty"`                                        // For tickets covered by an SLA policy
+	StatusHistory    []StatusChange     `bson:"status_history,omitempty" json:"status_history,omitempty"`
+	CreatedAt        time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt        time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// InteractionStatuses lists the statuses allowed for each interaction type.
+var InteractionStatuses = map[string][]string{
+	"MEETING": {"SCHEDULED", "OPEN", "RESOLVED", "COMPLETED", "CANCELLED"},
+	"TICKET":  {"NEW", "OPEN", "PENDING_CUSTOMER", "ON_HOLD", "RESOLVED", "CLOSED"},
+	"CALL":    {"SCHEDULED", "COMPLETED", "CANCELLED"},
+	"EMAIL":   {"LOGGED"},
+	"NOTE":    {"LOGGED"},
+	"TASK":    {"OPEN", "COMPLETED", "CANCELLED"},
+}
+
+// OpenTicketStatuses lists the statuses of tickets that still need work.
+var OpenTicketStatuses = []string{"NEW", "OPEN", "PENDING_CUSTOMER", "ON_HOLD"}
+
+// CallOutcomes lists the allowed outcomes of a CALL interaction.
+var CallOutcomes = []string{"CONNECTED", "NO_ANSWER", "VOICEMAIL", "BUSY", "WRONG_NUMBER"}
+
+// TicketTransitions lists the statuses a ticket may move to from each status.
+// CLOSED is final; a resolved ticket can still be reopened.
+var TicketTransitions = map[string][]string{
+	"NEW":              {"OPEN", "PENDING_CUSTOMER", "ON_HOLD", "RESOLVED", "CLOSED"},
+	"OPEN":             {"PENDING_CUSTOMER", "ON_HOLD", "RESOLVED", "CLOSED"},
+	"PENDING_CUSTOMER": {"OPEN", "ON_HOLD", "RESOLVED", "CLOSED"},
+	"ON_HOLD":          {"OPEN", "PENDING_CUSTOMER", "RESOLVED", "CLOSED"},
+	"RESOLVED":         {"OPEN", "CLOSED"},
+	"CLOSED":           {},
+}
+
+// TicketPriorities lists ticket priorities from lowest to highest.
+var TicketPriorities = []string{"LOW", "NORMAL", "HIGH", "URGENT"}
+
+type StatusChange struct {
+	From      string             `bson:"from" json:"from"`
+	To        string             `bson:"to" json:"to"`
+	ChangedBy primitive.ObjectID `bson:"changedBy" json:"changed_by"`
+	ChangedAt time.Time          `bson:"changed_at" json:"changed_at"`
+}
+
+type TicketCategory struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	CompanyID   primitive.ObjectID `bson:"companyID" json:"company_id"`
+	Name        string             `bson:"name" json:"name" validate:"required,max=50"`
+	Description string             `bson:"description,omitempty" json:"description,omitempty"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
 }
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Job is a unit of background work run by the scheduler. Jobs with a Schedule recur;
+// jobs without one run once at RunAt.
+type Job struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name          string             `bson:"name" json:"name"`                             // Unique, e.g. "sla_evaluation" or "reminder:<id>:<time>"
+	Type          string             `bson:"type" json:"type"`                             // Selects the registered handler
+	Schedule      string             `bson:"schedule,omitempty" json:"schedule,omitempty"` // Cron expression, @daily, @every 5m, ...
+	Payload       map[string]string  `bson:"payload,omitempty" json:"payload,omitempty"`
+	Status        string             `bson:"status" json:"status"` // SCHEDULED, RUNNING, RETRYING, COMPLETED or FAILED
+	Paused        bool               `bson:"paused" json:"paused"`
+	RunAt         time.Time          `bson:"run_at" json:"run_at"`
+	Attempts      int                `bson:"attempts" json:"attempts"`
+	MaxAttempts   int                `bson:"max_attempts" json:"max_attempts"`
+	LockedBy      string             `bson:"locked_by,omitempty" json:"locked_by,omitempty"`
+	LockToken     string             `bson:"lock_token,omitempty" json:"-"` // New to each claim; only its holder may release it
+	LockedUntil   *time.Time         `bson:"locked_until,omitempty" json:"locked_until,omitempty"`
+	LastRunAt     time.Time          `bson:"last_run_at,omitempty" json:"last_run_at,omitempty"`
+	LastSuccessAt time.Time          `bson:"last_success_at,omitempty" json:"last_success_at,omitempty"`
+	LastError     string             `bson:"last_error,omitempty" json:"last_error,omitempty"`
+	LastDuration  int64              `bson:"last_duration_ms,omitempty" json:"last_duration_ms,omitempty"`
+	CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt     time.Time          `bson:"updated_at" json:"updated_at"`
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CannedResponse is a saved reply agents insert into tickets. The body may use the variables
+// listed in CannedResponseVariables, written as {{customer.name}}.
+type CannedResponse struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	CompanyID primitive.ObjectID `bson:"companyID" json:"company_id"`
+	Name      string             `bson:"name" json:"name" validate:"required,max=100"`
+	Shortcut  string             `bson:"shortcut,omitempty" json:"shortcut,omitempty" validate:"omitempty,max=30"` // e.g. "refund", typed as /refund
+	Body      string             `bson:"body" json:"body" validate:"required"`
+	CreatedBy primitive.ObjectID `bson:"createdBy" json:"created_by"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// CannedResponseVariables lists the variables a canned response or macro reply may use.
+var CannedResponseVariables = []string{
+	"customer.name", "customer.first_name", "customer.last_name", "customer.email",
+	"ticket.id", "ticket.subject", "ticket.status", "ticket.priority",
+	"agent.name", "agent.first_name", "agent.last_name", "agent.email",
+	"company.name",
+}
+
+// Macro is a named set of actions applied to tickets in one step.
+type Macro struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	CompanyID   primitive.ObjectID `bson:"companyID" json:"company_id"`
+	Name        string             `bson:"name" json:"name" validate:"required,max=100"`
+	Description string             `bson:"description,omitempty" json:"description,omitempty"`
+	Actions     []MacroAction      `bson:"actions" json:"actions" validate:"required,min=1,dive"`
+	CreatedBy   primitive.ObjectID `bson:"createdBy" json:"created_by"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// MacroAction is one step of a macro. Value holds the status, priority, assignee ID, tag or
+// reply body, depending on Type. A POST_REPLY may use a canned response instead of a body.
+type MacroAction struct {
+	Type             string             `bson:"type" json:"type" validate:"required,eq=SET_STATUS|eq=SET_PRIORITY|eq=ASSIGN|eq=ADD_TAG|eq=POST_REPLY"`
+	Value            string             `bson:"value,omitempty" json:"value,omitempty"`
+	CannedResponseID primitive.ObjectID `bson:"cannedResponseID,omitempty" json:"canned_response_id,omitempty"`                              // For POST_REPLY
+	Visibility       string             `bson:"visibility,omitempty" json:"visibility,omitempty" validate:"omitempty,eq=PUBLIC|eq=INTERNAL"` // For POST_REPLY, PUBLIC by default
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ActiveMeetingStatuses are the meeting statuses that still occupy the attendees' calendars.
+var ActiveMeetingStatuses = []string{"SCHEDULED", "OPEN"}
+
+type MeetingAttendee struct {
+	Type  string             `bson:"type" json:"type" validate:"required,eq=USER|eq=CUSTOMER"`
+	ID    primitive.ObjectID `bson:"id" json:"id" validate:"required"`
+	Name  string             `bson:"name,omitempty" json:"name,omitempty"`
+	Email string             `bson:"email,omitempty" json:"email,omitempty"`
+}
+
+// MeetingChange records a reschedule or cancellation of a meeting.
+type MeetingChange struct {
+	Action       string             `bson:"action" json:"action"` // RESCHEDULED or CANCELLED
+	FromStart    time.Time          `bson:"from_start" json:"from_start"`
+	FromEnd      time.Time          `bson:"from_end,omitempty" json:"from_end,omitempty"`
+	ToStart      time.Time          `bson:"to_start,omitempty" json:"to_start,omitempty"`
+	ToEnd        time.Time          `bson:"to_end,omitempty" json:"to_end,omitempty"`
+	FromTimeZone string             `bson:"from_time_zone,omitempty" json:"from_time_zone,omitempty"`
+	ToTimeZone   string             `bson:"to_time_zone,omitempty" json:"to_time_zone,omitempty"`
+	Reason       string             `bson:"reason,omitempty" json:"reason,omitempty"`
+	ChangedBy    primitive.ObjectID `bson:"changedBy" json:"changed_by"`
+	ChangedAt    time.Time          `bson:"changed_at" json:"changed_at"`
+}
+
+// MeetingConflict describes another meeting that overlaps a proposed time slot.
+type MeetingConflict struct {
+	MeetingID   primitive.ObjectID `json:"meeting_id"`
+	AttendeeID  primitive.ObjectID `json:"attendee_id"`
+	ScheduledAt time.Time          `json:"scheduled_at"`
+	EndAt       time.Time          `json:"end_at"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Money is an amount in the minor units of an ISO 4217 currency (cents for USD, yen for JPY).
+type Money struct {
+	Amount   int64  `bson:"amount" json:"amount"`
+	Currency string `bson:"currency" json:"currency" validate:"required,len=3,uppercase"`
+}
+
+// ExchangeRate converts one unit of Base into Rate units of Quote from EffectiveDate onwards.
+type ExchangeRate struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Base          string             `bson:"base" json:"base" validate:"required,len=3,uppercase"`
+	Quote         string             `bson:"quote" json:"quote" validate:"required,len=3,uppercase"`
+	Rate          float64            `bson:"rate" json:"rate" validate:"required,gt=0"`
+	EffectiveDate time.Time          `bson:"effective_date" json:"effective_date" validate:"required"`
+	Source        string             `bson:"source,omitempty" json:"source,omitempty"` // MANUAL or IMPORT
+	CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
+}
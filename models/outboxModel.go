@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OutboxMessage is an email waiting to be delivered, or the record of one that was. Workers
+// deliver QUEUED and RETRYING messages; a message that keeps failing ends up DEAD, and one
+// whose recipients are all on the suppression list ends up SUPPRESSED.
+type OutboxMessage struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	CompanyID     primitive.ObjectID `bson:"companyID,omitempty" json:"company_id,omitempty"`
+	CustomerID    primitive.ObjectID `bson:"customerID,omitempty" json:"customer_id,omitempty"` // The customer it was sent to, for tracking
+	CampaignID    primitive.ObjectID `bson:"campaignID,omitempty" json:"campaign_id,omitempty"`
+	CreatedBy     string             `bson:"created_by,omitempty" json:"created_by,omitempty"` // user_id of the user it was sent for
+	Source        string             `bson:"source,omitempty" json:"source,omitempty"`         // What queued it, e.g. "email" or "ticket_message"
+	Marketing     bool               `bson:"marketing,omitempty" json:"marketing,omitempty"`   // Unsubscribes apply to it
+	To            []string           `bson:"to" json:"to"`
+	Cc            []string           `bson:"cc,omitempty" json:"cc,omitempty"`
+	Bcc           []string           `bson:"bcc,omitempty" json:"bcc,omitempty"`
+	ReplyTo       []string           `bson:"reply_to,omitempty" json:"reply_to,omitempty"`
+	Headers       map[string]string  `bson:"headers,omitempty" json:"headers,omitempty"` // Custom headers, e.g. List-Unsubscribe
+	Subject       string             `bson:"subject" json:"subject"`
+	MessageID     string             `bson:"message_id,omitempty" json:"message_id,omitempty"` // Without angle brackets
+	Text          string             `bson:"text,omitempty" json:"text,omitempty"`
+	HTML          string             `bson:"html,omitempty" json:"html,omitempty"`
+	Attachments   []OutboxAttachment `bson:"attachments,omitempty" json:"attachments,omitempty"`
+	TrackedLinks  []string           `bson:"tracked_links,omitempty" json:"tracked_links,omitempty"` // Targets of the rewritten links, by index
+	Opens         int                `bson:"opens,omitempty" json:"opens"`
+	Clicks        int                `bson:"clicks,omitempty" json:"clicks"`
+	OpenedAt      *time.Time         `bson:"opened_at,omitempty" json:"opened_at,omitempty"`   // First open
+	ClickedAt     *time.Time         `bson:"clicked_at,omitempty" json:"clicked_at,omitempty"` // First click
+	BouncedAt     *time.Time         `bson:"bounced_at,omitempty" json:"bounced_at,omitempty"`
+	ComplainedAt  *time.Time         `bson:"complained_at,omitempty" json:"complained_at,omitempty"` // Marked as spam
+	Status        string             `bson:"status" json:"status"`                                   // QUEUED, SENDING, RETRYING, SENT, DEAD or SUPPRESSED
+	Attempts      int                `bson:"attempts" json:"attempts"`
+	MaxAttempts   int                `bson:"max_attempts" json:"max_attempts"`
+	NextAttemptAt time.Time          `bson:"next_attempt_at" json:"next_attempt_at"`
+	LockedBy      string             `bson:"locked_by,omitempty" json:"-"`
+	LockToken     string             `bson:"lock_token,omitempty" json:"-"` // New to each claim; only its holder may release it
+	LockedUntil   *time.Time         `bson:"locked_until,omitempty" json:"-"`
+	LastError     string             `bson:"last_error,omitempty" json:"last_error,omitempty"`
+	SentAt        *time.Time         `bson:"sent_at,omitempty" json:"sent_at,omitempty"`
+	CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt     time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// OutboxAttachment is a file sent with an outbox message.
+type OutboxAttachment struct {
+	FileName    string `bson:"file_name" json:"file_name"`
+	ContentType string `bson:"content_type" json:"content_type"`
+	Data        []byte `bson:"data" json:"-"`
+}
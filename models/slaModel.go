@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SLAPolicy sets response and resolution targets for a company's tickets.
+// A policy matches tickets by priority and category; an empty value matches any.
+type SLAPolicy struct {
+	ID                   primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	CompanyID            primitive.ObjectID `bson:"companyID" json:"company_id"`
+	Name                 string             `bson:"name" json:"name" validate:"required"`
+	Priority             string             `bson:"priority,omitempty" json:"priority,omitempty" validate:"omitempty,eq=LOW|eq=NORMAL|eq=HIGH|eq=URGENT"`
+	Category             string             `bson:"category,omitempty" json:"category,omitempty"`
+	FirstResponseMinutes int                `bson:"first_response_minutes" json:"first_response_minutes" validate:"required,min=1"` // In business minutes.
+	ResolutionMinutes    int                `bson:"resolution_minutes" json:"resolution_minutes" validate:"required,min=1"`         // In business minutes.
+	AtRiskPercent        int                `bson:"at_risk_percent" json:"at_risk_percent" validate:"min=0,max=100"`                // Share of a target elapsed before a ticket is at risk. Defaults to 80.
+	BusinessHours        BusinessHours      `bson:"business_hours" json:"business_hours"`
+	Escalations          []SLAEscalation    `bson:"escalations,omitempty" json:"escalations,omitempty" validate:"dive"`
+	Active               bool               `bson:"active" json:"active"`
+	CreatedAt            time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt            time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// BusinessHours describes the working week SLA targets are counted in.
+// A zero value means targets run around the clock.
+type BusinessHours struct {
+	TimeZone string `bson:"time_zone,omitempty" json:"time_zone,omitempty"`                   // IANA name, e.g. Europe/London. Defaults to UTC.
+	Days     []int  `bson:"days,omitempty" json:"days,omitempty" validate:"dive,min=0,max=6"` // 0 is Sunday.
+	Start    string `bson:"start,omitempty" json:"start,omitempty"`                           // HH:MM
+	End      string `bson:"end,omitempty" json:"end,omitempty"`                               // HH:MM
+}
+
+// SLAEscalation is an action taken once when a ticket reaches a state for a target.
+type SLAEscalation struct {
+	Target      string             `bson:"target" json:"target" validate:"required,eq=FIRST_RESPONSE|eq=RESOLUTION"`
+	Trigger     string             `bson:"trigger" json:"trigger" validate:"required,eq=AT_RISK|eq=BREACHED"`
+	Action      string             `bson:"action" json:"action" validate:"required,eq=REASSIGN|eq=NOTIFY_MANAGER|eq=RAISE_PRIORITY"`
+	AssigneeID  primitive.ObjectID `bson:"assigneeID,omitempty" json:"assignee_id,omitempty"`    // For REASSIGN
+	NotifyEmail string             `bson:"notify_email,omitempty" json:"notify_email,omitempty"` // For NOTIFY_MANAGER; defaults to the company's managers
+}
+
+// TicketSLA is the SLA state stored on a ticket.
+type TicketSLA struct {
+	PolicyID            primitive.ObjectID `bson:"policyID" json:"policy_id"`
+	FirstResponseDueAt  time.Time          `bson:"first_response_due_at" json:"first_response_due_at"`
+	ResolutionDueAt     time.Time          `bson:"resolution_due_at" json:"resolution_due_at"`
+	FirstResponseState  string             `bson:"first_response_state" json:"first_response_state"` // PENDING, AT_RISK, BREACHED or MET
+	ResolutionState     string             `bson:"resolution_state" json:"resolution_state"`         // PENDING, AT_RISK, BREACHED or MET
+	FirstResponseBreach time.Time          `bson:"first_response_breached_at,omitempty" json:"first_response_breached_at,omitempty"`
+	ResolutionBreach    time.Time          `bson:"resolution_breached_at,omitempty" json:"resolution_breached_at,omitempty"`
+	EscalationsApplied  []string           `bson:"escalations_applied,omitempty" json:"escalations_applied,omitempty"` // Keys of escalations already run
+	EvaluatedAt         time.Time          `bson:"evaluated_at" json:"evaluated_at"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Suppression keeps email from being sent to an address. A suppression without a company
+// applies to email of every company; bounces and complaints are recorded that way. UNSUBSCRIBE
+// suppressions only stop marketing email, the other reasons stop all email.
+type Suppression struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Email      string             `bson:"email" json:"email"`          // Bare address, lower case
+	CompanyID  primitive.ObjectID `bson:"companyID" json:"company_id"` // Zero for every company
+	Reason     string             `bson:"reason" json:"reason"`        // UNSUBSCRIBE, BOUNCE, COMPLAINT or MANUAL
+	Source     string             `bson:"source" json:"source"`        // What added it, e.g. "unsubscribe_link" or "feedback"
+	Detail     string             `bson:"detail,omitempty" json:"detail,omitempty"`
+	OutboxID   primitive.ObjectID `bson:"outboxID,omitempty" json:"outbox_id,omitempty"` // The email that led to it
+	CampaignID primitive.ObjectID `bson:"campaignID,omitempty" json:"campaign_id,omitempty"`
+	CreatedBy  string             `bson:"created_by,omitempty" json:"created_by,omitempty"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// SuppressionReasons are the reasons an address can be suppressed for.
+var SuppressionReasons = []string{"UNSUBSCRIBE", "BOUNCE", "COMPLAINT", "MANUAL"}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Survey defines a satisfaction survey of a company. CSAT surveys ask for a score from 1 to 5,
+// NPS surveys for a score from 0 to 10; both take an optional comment.
+// TICKET_RESOLVED surveys go to the customer of every ticket that is resolved;
+// SCHEDULE surveys go to all customers of the company on a cron schedule.
+type Survey struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	CompanyID primitive.ObjectID `bson:"companyID" json:"company_id"`
+	Name      string             `bson:"name" json:"name" validate:"required"`
+	Type      string             `bson:"type" json:"type" validate:"required,eq=CSAT|eq=NPS"`
+	Question  string             `bson:"question,omitempty" json:"question,omitempty"` // Defaults to a standard question for the type.
+	Trigger   string             `bson:"trigger" json:"trigger" validate:"required,eq=TICKET_RESOLVED|eq=SCHEDULE"`
+	Schedule  string             `bson:"schedule,omitempty" json:"schedule,omitempty"` // For SCHEDULE surveys: five-field cron expression in UTC.
+	Active    bool               `bson:"active" json:"active"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// SurveyResponse is one survey sent to a customer. Score and RespondedAt are set once the
+// customer answers through the link in the email.
+type SurveyResponse struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	SurveyID      primitive.ObjectID `bson:"surveyID" json:"survey_id"`
+	SurveyType    string             `bson:"survey_type" json:"survey_type"`
+	CompanyID     primitive.ObjectID `bson:"companyID" json:"company_id"`
+	CustomerID    primitive.ObjectID `bson:"customerID" json:"customer_id"`
+	InteractionID primitive.ObjectID `bson:"interactionID,omitempty" json:"interaction_id,omitempty"` // Ticket the survey asks about
+	AgentID       primitive.ObjectID `bson:"agentID,omitempty" json:"agent_id,omitempty"`             // User who handled the ticket
+	Email         string             `bson:"email" json:"email"`
+	Pending       bool               `bson:"pending,omitempty" json:"-"` // Recorded by a scheduled run, email not queued yet
+	Score         *int               `bson:"score,omitempty" json:"score,omitempty"`
+	Comment       string             `bson:"comment,omitempty" json:"comment,omitempty"`
+	SentAt        time.Time          `bson:"sent_at" json:"sent_at"`
+	RespondedAt   *time.Time         `bson:"responded_at,omitempty" json:"responded_at,omitempty"`
+}
+
+// SurveyScoreRange returns the lowest and highest score of a survey type.
+func SurveyScoreRange(surveyType string) (int, int) {
+	if surveyType == "NPS" {
+		return 0, 10
+	}
+	return 1, 5
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Task is a follow-up assigned to a user, optionally linked to a customer, lead, deal or ticket.
+// Completing a task with a Recurrence creates the next task of the series.
+type Task struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	CompanyID   primitive.ObjectID `bson:"companyID" json:"company_id"`
+	TargetType  string             `bson:"target_type,omitempty" json:"target_type,omitempty" validate:"omitempty,eq=CUSTOMER|eq=LEAD|eq=DEAL|eq=TICKET"`
+	TargetID    primitive.ObjectID `bson:"targetID,omitempty" json:"target_id,omitempty"`
+	CustomerID  primitive.ObjectID `bson:"customerID,omitempty" json:"customer_id,omitempty"` // Customer of the target, if it has one
+	Title       string             `bson:"title" json:"title" validate:"required,max=200"`
+	Description string             `bson:"description,omitempty" json:"description,omitempty"`
+	DueAt       time.Time          `bson:"due_at" json:"due_at" validate:"required"`
+	TimeZone    string             `bson:"time_zone,omitempty" json:"time_zone,omitempty"` // IANA name; recurring tasks keep their wall-clock due time in it
+	Priority    string             `bson:"priority" json:"priority" validate:"omitempty,eq=LOW|eq=NORMAL|eq=HIGH|eq=URGENT"`
+	Status      string             `bson:"status" json:"status" validate:"omitempty,eq=OPEN|eq=COMPLETED|eq=CANCELLED"`
+	AssigneeID  primitive.ObjectID `bson:"assigneeID" json:"assignee_id"`
+	CreatedBy   primitive.ObjectID `bson:"createdBy" json:"created_by"`
+	Recurrence  string             `bson:"recurrence,omitempty" json:"recurrence,omitempty"`  // RFC 5545 rule, e.g. FREQ=WEEKLY;BYDAY=FR
+	PreviousID  primitive.ObjectID `bson:"previousID,omitempty" json:"previous_id,omitempty"` // Task this one follows up in a recurring series
+	CompletedAt time.Time          `bson:"completed_at,omitempty" json:"completed_at,omitempty"`
+	CompletedBy primitive.ObjectID `bson:"completedBy,omitempty" json:"completed_by,omitempty"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// TaskStatuses lists the statuses a task can have.
+var TaskStatuses = []string{"OPEN", "COMPLETED", "CANCELLED"}
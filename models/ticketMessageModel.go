@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TicketMessage is one entry in a ticket's conversation. INTERNAL messages are notes visible only to staff.
+type TicketMessage struct {
+	ID          primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	TicketID    primitive.ObjectID  `bson:"ticketID" json:"ticket_id"`
+	CompanyID   primitive.ObjectID  `bson:"companyID" json:"company_id"`
+	CustomerID  primitive.ObjectID  `bson:"customerID" json:"customer_id"`
+	AuthorID    primitive.ObjectID  `bson:"authorID" json:"author_id"`
+	AuthorType  string              `bson:"author_type" json:"author_type"` // CUSTOMER or USER
+	AuthorName  string              `bson:"author_name" json:"author_name"`
+	Visibility  string              `bson:"visibility" json:"visibility" validate:"required,eq=PUBLIC|eq=INTERNAL"`
+	Body        string              `bson:"body" json:"body" validate:"required"`
+	Attachments []MessageAttachment `bson:"attachments,omitempty" json:"attachments,omitempty"` // Copied from the stored attachments
+	MessageID   string              `bson:"message_id,omitempty" json:"message_id,omitempty"`   // Set for messages received by email
+	CreatedAt   time.Time           `bson:"created_at" json:"created_at"`
+}
+
+type MessageAttachment struct {
+	AttachmentID primitive.ObjectID `bson:"attachmentID,omitempty" json:"attachment_id,omitempty"`
+	FileName     string             `bson:"file_name" json:"file_name"`
+	ContentType  string             `bson:"content_type,omitempty" json:"content_type,omitempty"`
+	Size         int64              `bson:"size,omitempty" json:"size,omitempty"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// TimelineEvent is one entry in a customer's timeline. Data holds the record the event came
+// from: an interaction, a ticket message, a deal, or a history entry.
+type TimelineEvent struct {
+	ID         string      `json:"id"` // Unique within the timeline, e.g. "interaction:<id>" or "status:<id>:0002"
+	Type       string      `json:"type"`
+	OccurredAt time.Time   `json:"occurred_at"`
+	ActorID    string      `json:"actor_id,omitempty"`
+	Summary    string      `json:"summary"`
+	Data       interface{} `json:"data,omitempty"`
+}
+
+// TimelineEventTypes lists the event types a customer timeline can contain.
+var TimelineEventTypes = []string{
+	"INTERACTION",       // An interaction was logged (meeting, call, note, task or ticket)
+	"EMAIL",             // An email was logged or sent
+	"EMAIL_OPENED",      // The customer opened a tracked email
+	"EMAIL_CLICKED",     // The customer clicked a link in a tracked email
+	"STATUS_CHANGE",     // An interaction changed status
+	"MEETING_CHANGE",    // A meeting was rescheduled or cancelled
+	"TICKET_MESSAGE",    // A reply or internal note on a ticket
+	"DEAL_CREATED",      // A deal was opened
+	"DEAL_STAGE_CHANGE", // A deal moved stage
+	"LEAD_TRANSITION",   // The customer's status changed, e.g. LEAD to PROSPECT
+	"FIELD_CHANGE",      // Another audited customer field changed
+}
@@ -23,4 +23,5 @@ type User struct {
 	UserID        string             `json:"user_id" bson:"user_id"`                      // Unique identifier for business logic.
 	LastLogin     time.Time          `json:"last_login,omitempty" bson:"last_login"`      // Timestamp for last login.
 	CompanyIDs     []primitive.ObjectID `json:"company_ids"`
+	CalendarToken  string             `json:"-" bson:"calendar_token,omitempty"`  // Secret for the user's calendar feed URL.
 }
@@ -0,0 +1,389 @@
+// Package outbox delivers email in the background. Messages are written to the outbox
+// collection first and sent by a pool of workers, which retry failures with exponential
+// backoff. Like the scheduler, workers on every replica claim messages with an atomic lease,
+// so each message is sent by one worker at a time.
+package outbox
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SiddharthaKR/golang-jwt-project/database"
+	"github.com/SiddharthaKR/golang-jwt-project/events"
+	helper "github.com/SiddharthaKR/golang-jwt-project/helpers"
+	"github.com/SiddharthaKR/golang-jwt-project/internal/lease"
+	"github.com/SiddharthaKR/golang-jwt-project/mailer"
+	"github.com/SiddharthaKR/golang-jwt-project/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	StatusQueued   = "QUEUED"
+	StatusSending  = "SENDING"
+	StatusRetrying = "RETRYING"
+	StatusSent     = "SENT"
+	StatusDead     = "DEAD"
+
+	// StatusSuppressed marks a message that was not sent because all its recipients are on
+	// the suppression list.
+	StatusSuppressed = "SUPPRESSED"
+
+	defaultMaxAttempts = 8
+	leaseDuration      = 2 * time.Minute
+	baseBackoff        = 30 * time.Second
+	maxBackoff         = 6 * time.Hour
+)
+
+var outboxCollection *mongo.Collection = database.OpenCollection(database.Client, "outbox")
+
+var (
+	indexesOnce sync.Once
+
+	// wake lets Enqueue start a local worker straight away instead of at the next poll.
+	wake = make(chan struct{}, 1)
+)
+
+// ErrNotFound is returned when a message does not exist.
+var ErrNotFound = errors.New("outbox message not found")
+
+// ErrNotDead is returned when retrying a message that has not been given up on.
+var ErrNotDead = errors.New("only DEAD messages can be retried")
+
+// permanentError marks a delivery failure that retrying cannot fix.
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as a failure that retrying cannot fix, so the message is given up on at once.
+func Permanent(err error) error {
+	return permanentError{err: err}
+}
+
+// IsPermanent reports whether a delivery error should not be retried: errors marked with
+// Permanent, messages that cannot be built, and SMTP 5xx replies such as an unknown mailbox.
+func IsPermanent(err error) bool {
+	var permanent permanentError
+	if errors.As(err, &permanent) || errors.Is(err, mailer.ErrInvalidMessage) {
+		return true
+	}
+	var smtpErr *textproto.Error
+	return errors.As(err, &smtpErr) && smtpErr.Code >= 500
+}
+
+// Enqueue adds a message to the outbox, to be sent as soon as a worker is free. The insert
+// uses ctx, so calling it with the mongo.SessionContext of a transaction queues the message
+// only if the transaction commits.
+func Enqueue(ctx context.Context, msg *models.OutboxMessage) error {
+	if len(msg.To) == 0 {
+		return errors.New("outbox message has no recipients")
+	}
+	ensureIndexes()
+	now := time.Now().UTC()
+	if msg.ID.IsZero() {
+		msg.ID = primitive.NewObjectID()
+	}
+	if msg.MessageID == "" {
+		// Known before sending, so replies and logged interactions can refer to it
+		msg.MessageID = strings.Trim(mailer.NewMessageID(helper.DefaultFromAddress()), "<>")
+	}
+	if msg.MaxAttempts <= 0 {
+		msg.MaxAttempts = defaultMaxAttempts
+	}
+	if msg.NextAttemptAt.IsZero() {
+		msg.NextAttemptAt = now
+	}
+	msg.Status = StatusQueued
+	msg.Attempts = 0
+	msg.CreatedAt = now
+	msg.UpdatedAt = now
+	if _, err := outboxCollection.InsertOne(ctx, msg); err != nil {
+		return err
+	}
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// KeyID derives a message ID from a key naming the email, such as the name of the job that
+// sends it. Queueing the same key again fails with a duplicate key error, so a job retried
+// after it queued its email does not send it twice.
+func KeyID(key string) primitive.ObjectID {
+	sum := sha256.Sum256([]byte(key))
+	var id primitive.ObjectID
+	copy(id[:], sum[:])
+	return id
+}
+
+// Get returns the message with the given ID.
+func Get(ctx context.Context, id primitive.ObjectID) (models.OutboxMessage, error) {
+	var msg models.OutboxMessage
+	err := outboxCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&msg)
+	if err == mongo.ErrNoDocuments {
+		return msg, ErrNotFound
+	}
+	return msg, err
+}
+
+// GetByMessageID returns the message with the given Message-ID, without angle brackets.
+func GetByMessageID(ctx context.Context, messageID string) (models.OutboxMessage, error) {
+	var msg models.OutboxMessage
+	err := outboxCollection.FindOne(ctx, bson.M{"message_id": messageID}).Decode(&msg)
+	if err == mongo.ErrNoDocuments {
+		return msg, ErrNotFound
+	}
+	return msg, err
+}
+
+// List returns a page of the messages matching filter, newest first, and how many match in total.
+func List(ctx context.Context, filter bson.M, skip int64, limit int64) ([]models.OutboxMessage, int64, error) {
+	total, err := outboxCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	cursor, err := outboxCollection.Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(skip).
+		SetLimit(limit).
+		SetProjection(bson.M{"attachments.data": 0}))
+	if err != nil {
+		return nil, 0, err
+	}
+	messages := []models.OutboxMessage{}
+	if err := cursor.All(ctx, &messages); err != nil {
+		return nil, 0, err
+	}
+	return messages, total, nil
+}
+
+// Count returns how many messages match filter.
+func Count(ctx context.Context, filter bson.M) (int64, error) {
+	return outboxCollection.CountDocuments(ctx, filter)
+}
+
+// Retry queues a DEAD message again with a fresh set of attempts.
+func Retry(ctx context.Context, id primitive.ObjectID) (models.OutboxMessage, error) {
+	now := time.Now().UTC()
+	var msg models.OutboxMessage
+	err := outboxCollection.FindOneAndUpdate(ctx, bson.M{"_id": id, "status": StatusDead}, bson.M{"$set": bson.M{
+		"status":          StatusQueued,
+		"attempts":        0,
+		"next_attempt_at": now,
+		"updated_at":      now,
+	}}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&msg)
+	if err == mongo.ErrNoDocuments {
+		if _, getErr := Get(ctx, id); getErr != nil {
+			return msg, getErr
+		}
+		return msg, ErrNotDead
+	}
+	if err == nil {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+	return msg, err
+}
+
+// RecordEvent counts an OPEN or CLICK of a tracked message and notes when it was first
+// opened or clicked. A click also marks the message opened, since images may be blocked.
+// A BOUNCE or COMPLAINT only notes when it first happened.
+func RecordEvent(ctx context.Context, id primitive.ObjectID, eventType string, at time.Time) error {
+	update := bson.M{}
+	switch eventType {
+	case "OPEN":
+		update["$inc"] = bson.M{"opens": 1}
+		update["$min"] = bson.M{"opened_at": at}
+	case "CLICK":
+		update["$inc"] = bson.M{"clicks": 1}
+		update["$min"] = bson.M{"opened_at": at, "clicked_at": at}
+	case "BOUNCE":
+		update["$min"] = bson.M{"bounced_at": at}
+	case "COMPLAINT":
+		update["$min"] = bson.M{"complained_at": at}
+	default:
+		return fmt.Errorf("unknown email event type %q", eventType)
+	}
+	_, err := outboxCollection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+// Start runs workers that deliver due messages, checking for them every interval and
+// whenever this replica queues one. It returns immediately.
+func Start(workers int, interval time.Duration) {
+	ensureIndexes()
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go work(interval)
+	}
+}
+
+func work(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		deliverDue()
+		select {
+		case <-ticker.C:
+		case <-wake:
+		}
+	}
+}
+
+// deliverDue claims and sends due messages one at a time until none are left.
+func deliverDue() {
+	for {
+		msg, err := claim()
+		if err == mongo.ErrNoDocuments {
+			return
+		}
+		if err != nil {
+			log.Println("Error claiming outbox message:", err)
+			return
+		}
+		finish(msg, deliver(msg))
+	}
+}
+
+// claim takes the lease on the next due message. Messages whose lease expired while
+// SENDING, because their replica died, are claimed again.
+func claim() (models.OutboxMessage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now().UTC()
+	filter := bson.M{
+		"next_attempt_at": bson.M{"$lte": now},
+		"$or": bson.A{
+			bson.M{"status": bson.M{"$in": bson.A{StatusQueued, StatusRetrying}}},
+			lease.Expired(StatusSending, now),
+		},
+	}
+	update := bson.M{
+		"$set": lease.Take(bson.M{
+			"status":     StatusSending,
+			"updated_at": now,
+		}, now, leaseDuration),
+		"$inc": bson.M{"attempts": 1},
+	}
+	opts := options.FindOneAndUpdate().SetSort(bson.M{"next_attempt_at": 1}).SetReturnDocument(options.After)
+
+	var msg models.OutboxMessage
+	err := outboxCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&msg)
+	return msg, err
+}
+
+// deliver sends a message, turning a panic into an error.
+func deliver(msg models.OutboxMessage) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	message := &mailer.Message{
+		To:        msg.To,
+		Cc:        msg.Cc,
+		Bcc:       msg.Bcc,
+		ReplyTo:   msg.ReplyTo,
+		Subject:   msg.Subject,
+		MessageID: msg.MessageID,
+		Text:      msg.Text,
+		HTML:      msg.HTML,
+		Headers:   msg.Headers,
+	}
+	for _, a := range msg.Attachments {
+		message.Attachments = append(message.Attachments, mailer.Attachment{FileName: a.FileName, ContentType: a.ContentType, Data: a.Data})
+	}
+	return send(message, helper.SuppressionScope{CompanyID: msg.CompanyID, Marketing: msg.Marketing})
+}
+
+// send drops the recipients suppressed in the scope and hands the message to the mailer, from
+// the default address. It returns helper.ErrSuppressed, without sending, if none are left.
+// Everything else queues its email with Enqueue, so this is the only place mail is sent from.
+func send(msg *mailer.Message, scope helper.SuppressionScope) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	err := helper.RemoveSuppressedRecipients(ctx, msg, scope)
+	cancel()
+	if err != nil {
+		return err
+	}
+	if msg.From == "" {
+		msg.From = helper.DefaultFromAddress()
+	}
+	return mailer.SendMessage(context.Background(), msg)
+}
+
+// finish releases the lease and records the outcome. Failures are retried with exponential
+// backoff until the attempts run out or the failure is permanent; the message is then DEAD.
+// A message with only suppressed recipients is SUPPRESSED straight away.
+func finish(msg models.OutboxMessage, sendErr error) {
+	// Long enough for the EmailSent handlers too
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	now := time.Now().UTC()
+	set := bson.M{"updated_at": now}
+	switch {
+	case sendErr == nil:
+		set["status"] = StatusSent
+		set["sent_at"] = now
+		set["last_error"] = ""
+	case errors.Is(sendErr, helper.ErrSuppressed):
+		set["status"] = StatusSuppressed
+		set["last_error"] = sendErr.Error()
+	case msg.Attempts < msg.MaxAttempts && !IsPermanent(sendErr):
+		set["status"] = StatusRetrying
+		set["last_error"] = sendErr.Error()
+		set["next_attempt_at"] = now.Add(lease.Backoff(msg.Attempts, baseBackoff, maxBackoff))
+	default:
+		set["status"] = StatusDead
+		set["last_error"] = sendErr.Error()
+	}
+	if sendErr != nil && !errors.Is(sendErr, helper.ErrSuppressed) {
+		log.Printf("Outbox message %s failed (attempt %d): %v", msg.ID.Hex(), msg.Attempts, sendErr)
+	}
+
+	result, err := lease.Release(ctx, outboxCollection, msg.ID, msg.LockToken, set)
+	if err != nil {
+		log.Println("Error releasing outbox message", msg.ID.Hex(), ":", err)
+		return
+	}
+	if sendErr == nil && result.ModifiedCount > 0 {
+		events.Publish(ctx, events.Event{Type: events.EmailSent, CompanyID: msg.CompanyID, CustomerID: msg.CustomerID, OutboxID: msg.ID})
+	}
+}
+
+// ensureIndexes creates the indexes workers use to find due messages and listings and
+// campaign statistics filter by.
+func ensureIndexes() {
+	indexesOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_, err := outboxCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+			{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}}},
+			{Keys: bson.D{{Key: "companyID", Value: 1}, {Key: "created_at", Value: -1}}},
+			{Keys: bson.D{{Key: "campaignID", Value: 1}, {Key: "status", Value: 1}}},
+		})
+		if err != nil {
+			log.Println("Error creating outbox indexes:", err)
+		}
+	})
+}
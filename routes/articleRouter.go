@@ -0,0 +1,33 @@
+package routes
+
+import (
+	controller "github.com/SiddharthaKR/golang-jwt-project/controllers"
+	"github.com/SiddharthaKR/golang-jwt-project/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+// PublicArticleRoutes serves published knowledge base articles to the customer portal.
+// They need no token, so they must be registered before any authentication middleware.
+func PublicArticleRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/public/kb/:company_id/categories", controller.GetPublicArticleCategories())
+	incomingRoutes.GET("/public/kb/:company_id/articles", controller.GetPublicArticles())
+	incomingRoutes.GET("/public/kb/:company_id/articles/:article", controller.GetPublicArticle())
+}
+
+func ArticleRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.Use(middleware.Authenticate())
+	incomingRoutes.POST("/company/:company_id/kb/categories", controller.CreateArticleCategory())
+	incomingRoutes.GET("/company/:company_id/kb/categories", controller.GetArticleCategories())
+	incomingRoutes.PUT("/kb/categories/:category_id", controller.UpdateArticleCategory())
+	incomingRoutes.DELETE("/kb/categories/:category_id", controller.DeleteArticleCategory())
+	incomingRoutes.POST("/company/:company_id/kb/articles", controller.CreateArticle())
+	incomingRoutes.GET("/company/:company_id/kb/articles", controller.GetCompanyArticles())
+	incomingRoutes.GET("/kb/articles/:article_id", controller.GetArticle())
+	incomingRoutes.PUT("/kb/articles/:article_id", controller.UpdateArticle())
+	incomingRoutes.DELETE("/kb/articles/:article_id", controller.DeleteArticle())
+	incomingRoutes.GET("/kb/articles/:article_id/tickets", controller.GetArticleTickets())
+	incomingRoutes.GET("/tickets/:ticket_id/article-suggestions", controller.GetTicketArticleSuggestions())
+	incomingRoutes.GET("/tickets/:ticket_id/articles", controller.GetTicketArticles())
+	incomingRoutes.POST("/tickets/:ticket_id/articles", controller.LinkTicketArticle())
+	incomingRoutes.DELETE("/tickets/:ticket_id/articles/:article_id", controller.UnlinkTicketArticle())
+}
@@ -0,0 +1,21 @@
+package routes
+
+import (
+	controller "github.com/SiddharthaKR/golang-jwt-project/controllers"
+	"github.com/SiddharthaKR/golang-jwt-project/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+// FileRoutes serves signed attachment downloads. The signature is the credential,
+// so these must be registered before any authentication middleware.
+func FileRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/files/:attachment_id", controller.DownloadAttachment())
+}
+
+func AttachmentRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.Use(middleware.Authenticate())
+	incomingRoutes.POST("/attachments", controller.UploadAttachments())
+	incomingRoutes.GET("/attachments", controller.GetAttachments())
+	incomingRoutes.GET("/attachments/:attachment_id/url", controller.GetAttachmentURL())
+	incomingRoutes.DELETE("/attachments/:attachment_id", controller.DeleteAttachment())
+}
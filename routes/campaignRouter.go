@@ -0,0 +1,20 @@
+package routes
+
+import (
+	controller "github.com/SiddharthaKR/golang-jwt-project/controllers"
+	"github.com/SiddharthaKR/golang-jwt-project/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+func CampaignRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.Use(middleware.Authenticate())
+	incomingRoutes.POST("/company/:company_id/campaigns", controller.CreateCampaign())
+	incomingRoutes.GET("/company/:company_id/campaigns", controller.GetCampaigns())
+	incomingRoutes.GET("/campaigns/:campaign_id", controller.GetCampaign())
+	incomingRoutes.PUT("/campaigns/:campaign_id", controller.UpdateCampaign())
+	incomingRoutes.DELETE("/campaigns/:campaign_id", controller.DeleteCampaign())
+	incomingRoutes.POST("/campaigns/:campaign_id/schedule", controller.ScheduleCampaign())
+	incomingRoutes.POST("/campaigns/:campaign_id/cancel", controller.CancelCampaign())
+	incomingRoutes.GET("/campaigns/:campaign_id/recipients", controller.GetCampaignRecipients())
+	incomingRoutes.GET("/campaigns/:campaign_id/stats", controller.GetCampaignStats())
+}
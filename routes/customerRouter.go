@@ -19,6 +19,9 @@ func CustomerRoutes(incomingRoutes *gin.Engine) {
 	incomingRoutes.DELETE("/company/:company_id/customers/:customer_id", controller.DeleteComapnyCustomerByID())
 
 	incomingRoutes.GET("/customer/:user_id", controller.GetCustomer())
+	incomingRoutes.GET("/customers/:customer_id/timeline", controller.GetCustomerTimeline())
+	incomingRoutes.POST("/customers/:customer_id/consents", controller.CreateConsent())
+	incomingRoutes.GET("/customers/:customer_id/consents", controller.GetConsents())
 	// Define routes for customer operations
 	// incomingRoutes.POST("/customers", controller.CreateCustomer())            // Create a new customer
 	// incomingRoutes.PUT("/customers/:customer_id", controller.UpdateCustomer()) // Update an existing customer
@@ -0,0 +1,18 @@
+package routes
+
+import (
+	controller "github.com/SiddharthaKR/golang-jwt-project/controllers"
+	"github.com/SiddharthaKR/golang-jwt-project/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+func DealRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.Use(middleware.Authenticate())
+	incomingRoutes.POST("/company/:company_id/deals", controller.CreateDeal())
+	incomingRoutes.GET("/company/:company_id/deals", controller.GetCompanyDeals())
+	incomingRoutes.PUT("/deals/:deal_id/stage", controller.UpdateDealStage())
+	incomingRoutes.POST("/company/:company_id/quotes", controller.CreateQuote())
+	incomingRoutes.GET("/company/:company_id/quotes", controller.GetCompanyQuotes())
+	incomingRoutes.GET("/reports/deals", controller.GetDealReport())
+	incomingRoutes.GET("/reports/quotes", controller.GetQuoteReport())
+}
@@ -6,7 +6,30 @@ import (
     "github.com/gin-gonic/gin"
 )
 
+func TrackingRoutes(incomingRoutes *gin.Engine) {
+    incomingRoutes.GET("/t/o/:token", controller.TrackEmailOpen())  // Open pixel, /t/o/<token>.gif
+    incomingRoutes.GET("/t/c/:token", controller.TrackEmailClick()) // Link redirect
+    incomingRoutes.GET("/u/:token", controller.ShowUnsubscribe())   // Unsubscribe page
+    incomingRoutes.POST("/u/:token", controller.Unsubscribe())      // Form and one-click unsubscribe
+}
+
 func EmailRoutes(incomingRoutes *gin.Engine) {
     incomingRoutes.Use(middleware.Authenticate())
     incomingRoutes.POST("/email", controller.SendEmail())  // Route for sending emails
+    incomingRoutes.POST("/company/:company_id/email/templates", controller.CreateEmailTemplate())
+    incomingRoutes.GET("/company/:company_id/email/templates", controller.GetEmailTemplates())
+    incomingRoutes.GET("/email/templates/:template_id", controller.GetEmailTemplate())
+    incomingRoutes.PUT("/email/templates/:template_id", controller.UpdateEmailTemplate())
+    incomingRoutes.DELETE("/email/templates/:template_id", controller.DeleteEmailTemplate())
+    incomingRoutes.POST("/email/templates/:template_id/preview", controller.PreviewEmailTemplate())
+    incomingRoutes.GET("/email/outbox", controller.GetOutboxMessages())
+    incomingRoutes.GET("/email/outbox/:message_id", controller.GetOutboxMessage())
+    incomingRoutes.POST("/email/outbox/:message_id/retry", controller.RetryOutboxMessage())
+    incomingRoutes.GET("/email/outbox/:message_id/events", controller.GetOutboxMessageEvents())
+    incomingRoutes.GET("/email/suppressions", controller.GetSuppressions())
+    incomingRoutes.POST("/email/suppressions", controller.CreateSuppression())
+    incomingRoutes.DELETE("/email/suppressions/:suppression_id", controller.DeleteSuppression())
+    incomingRoutes.GET("/email/captured", controller.GetCapturedEmails())
+    incomingRoutes.GET("/email/captured/:message_id", controller.GetCapturedEmail())
+    incomingRoutes.DELETE("/email/captured", controller.ClearCapturedEmails())
 }
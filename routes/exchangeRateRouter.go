@@ -0,0 +1,14 @@
+package routes
+
+import (
+	controller "github.com/SiddharthaKR/golang-jwt-project/controllers"
+	"github.com/SiddharthaKR/golang-jwt-project/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+func ExchangeRateRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.Use(middleware.Authenticate())
+	incomingRoutes.GET("/exchange-rates", controller.GetExchangeRates())
+	incomingRoutes.POST("/exchange-rates", controller.CreateExchangeRate())
+	incomingRoutes.POST("/exchange-rates/import", controller.ImportExchangeRates())
+}
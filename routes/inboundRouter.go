@@ -0,0 +1,17 @@
+package routes
+
+import (
+	controller "github.com/SiddharthaKR/golang-jwt-project/controllers"
+	"github.com/SiddharthaKR/golang-jwt-project/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+func InboundEmailRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.POST("/inbound/email", controller.ReceiveInboundEmail())
+	incomingRoutes.POST("/email/feedback", controller.ReceiveEmailFeedback())
+}
+
+func InboundRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.Use(middleware.Authenticate())
+	incomingRoutes.GET("/inbound/emails", controller.GetInboundEmails())
+}
@@ -6,13 +6,40 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// CalendarRoutes serves the tokenised calendar feeds. The token is the credential,
+// so these must be registered before any authentication middleware.
+func CalendarRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/calendar/:token", controller.GetCalendarFeed())
+}
+
 func InteractionRoutes(incomingRoutes *gin.Engine) {
 	incomingRoutes.Use(middleware.Authenticate())
 	incomingRoutes.POST("/interactions/:company_id/ticket", controller.RaiseTicket())
 	incomingRoutes.POST("/interactions/:company_id/meeting", controller.CreateMeeting())
+	incomingRoutes.POST("/interactions/:company_id/call", controller.LogCall())
+	incomingRoutes.POST("/interactions/:company_id/email", controller.LogEmail())
+	incomingRoutes.GET("/emails/:interaction_id", controller.GetLoggedEmail())
+	incomingRoutes.POST("/interactions/:company_id/note", controller.CreateNote())
+	incomingRoutes.POST("/interactions/:company_id/task", controller.CreateTask())
     incomingRoutes.PUT("/interactions/:interaction_id/status", controller.UpdateInteractionStatus())
     incomingRoutes.GET("/customers/:customer_id/interactions", controller.GetCustomerInteractions())
 	incomingRoutes.GET("/reports/interactions", controller.GetInteractionReport())
     incomingRoutes.GET("/reports/conversion_rate", controller.GetConversionRateReport())
 	incomingRoutes.POST("/leads", controller.CreateLead())
+
+	incomingRoutes.GET("/meetings/:meeting_id", controller.GetMeeting())
+	incomingRoutes.PUT("/meetings/:meeting_id/reschedule", controller.RescheduleMeeting())
+	incomingRoutes.POST("/meetings/:meeting_id/cancel", controller.CancelMeeting())
+	incomingRoutes.GET("/users/:user_id/agenda", controller.GetUserAgenda())
+	incomingRoutes.GET("/users/:user_id/calendar", controller.GetCalendarFeedURL())
+	incomingRoutes.POST("/users/:user_id/calendar/rotate", controller.RotateCalendarToken())
+	incomingRoutes.POST("/interactions/:company_id/meeting/import", controller.ImportMeetings())
+
+	incomingRoutes.GET("/tickets/:ticket_id", controller.GetTicket())
+	incomingRoutes.PUT("/tickets/:ticket_id", controller.UpdateTicket())
+	incomingRoutes.GET("/tickets/:ticket_id/messages", controller.GetTicketMessages())
+	incomingRoutes.POST("/tickets/:ticket_id/messages", controller.PostTicketMessage())
+	incomingRoutes.GET("/company/:company_id/tickets", controller.GetCompanyTickets())
+	incomingRoutes.GET("/company/:company_id/ticket-categories", controller.GetTicketCategories())
+	incomingRoutes.POST("/company/:company_id/ticket-categories", controller.CreateTicketCategory())
 }
@@ -0,0 +1,16 @@
+package routes
+
+import (
+	controller "github.com/SiddharthaKR/golang-jwt-project/controllers"
+	"github.com/SiddharthaKR/golang-jwt-project/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+func JobRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.Use(middleware.Authenticate())
+	incomingRoutes.GET("/jobs", controller.GetJobs())
+	incomingRoutes.GET("/jobs/:name", controller.GetJob())
+	incomingRoutes.POST("/jobs/:name/pause", controller.PauseJob())
+	incomingRoutes.POST("/jobs/:name/resume", controller.ResumeJob())
+	incomingRoutes.POST("/jobs/:name/trigger", controller.TriggerJob())
+}
@@ -0,0 +1,22 @@
+package routes
+
+import (
+	controller "github.com/SiddharthaKR/golang-jwt-project/controllers"
+	"github.com/SiddharthaKR/golang-jwt-project/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+func MacroRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.Use(middleware.Authenticate())
+	incomingRoutes.POST("/company/:company_id/canned-responses", controller.CreateCannedResponse())
+	incomingRoutes.GET("/company/:company_id/canned-responses", controller.GetCannedResponses())
+	incomingRoutes.PUT("/canned-responses/:response_id", controller.UpdateCannedResponse())
+	incomingRoutes.DELETE("/canned-responses/:response_id", controller.DeleteCannedResponse())
+	incomingRoutes.GET("/tickets/:ticket_id/canned-responses/:response_id", controller.RenderCannedResponse())
+	incomingRoutes.POST("/company/:company_id/macros", controller.CreateMacro())
+	incomingRoutes.GET("/company/:company_id/macros", controller.GetMacros())
+	incomingRoutes.PUT("/macros/:macro_id", controller.UpdateMacro())
+	incomingRoutes.DELETE("/macros/:macro_id", controller.DeleteMacro())
+	incomingRoutes.POST("/macros/:macro_id/apply", controller.ApplyMacroBulk())
+	incomingRoutes.POST("/tickets/:ticket_id/macros/:macro_id", controller.ApplyMacro())
+}
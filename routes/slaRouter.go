@@ -0,0 +1,16 @@
+package routes
+
+import (
+	controller "github.com/SiddharthaKR/golang-jwt-project/controllers"
+	"github.com/SiddharthaKR/golang-jwt-project/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+func SLARoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.Use(middleware.Authenticate())
+	incomingRoutes.POST("/company/:company_id/sla-policies", controller.CreateSLAPolicy())
+	incomingRoutes.GET("/company/:company_id/sla-policies", controller.GetSLAPolicies())
+	incomingRoutes.PUT("/sla-policies/:policy_id", controller.UpdateSLAPolicy())
+	incomingRoutes.DELETE("/sla-policies/:policy_id", controller.DeleteSLAPolicy())
+	incomingRoutes.GET("/reports/sla", controller.GetSLAReport())
+}
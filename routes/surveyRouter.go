@@ -0,0 +1,21 @@
+package routes
+
+import (
+	controller "github.com/SiddharthaKR/golang-jwt-project/controllers"
+	"github.com/SiddharthaKR/golang-jwt-project/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+func FeedbackRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/feedback/:response_id", controller.RespondToSurvey())
+	incomingRoutes.POST("/feedback/:response_id", controller.RespondToSurvey())
+}
+
+func SurveyRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.Use(middleware.Authenticate())
+	incomingRoutes.POST("/company/:company_id/surveys", controller.CreateSurvey())
+	incomingRoutes.GET("/company/:company_id/surveys", controller.GetSurveys())
+	incomingRoutes.PUT("/surveys/:survey_id", controller.UpdateSurvey())
+	incomingRoutes.GET("/surveys/:survey_id/responses", controller.GetSurveyResponses())
+	incomingRoutes.GET("/reports/surveys", controller.GetSurveyReport())
+}
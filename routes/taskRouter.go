@@ -0,0 +1,18 @@
+package routes
+
+import (
+	controller "github.com/SiddharthaKR/golang-jwt-project/controllers"
+	"github.com/SiddharthaKR/golang-jwt-project/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+func TaskRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.Use(middleware.Authenticate())
+	incomingRoutes.POST("/company/:company_id/tasks", controller.CreateCompanyTask())
+	incomingRoutes.GET("/company/:company_id/tasks", controller.GetCompanyTasks())
+	incomingRoutes.GET("/tasks/:task_id", controller.GetTaskByID())
+	incomingRoutes.PUT("/tasks/:task_id", controller.UpdateTaskDetails())
+	incomingRoutes.PUT("/tasks/:task_id/status", controller.UpdateTaskState())
+	incomingRoutes.GET("/users/:user_id/tasks", controller.GetUserTasks())
+	incomingRoutes.GET("/users/:user_id/tasks/overdue", controller.GetUserOverdueTasks())
+}
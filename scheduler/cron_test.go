@@ -0,0 +1,47 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronScheduleNext(t *testing.T) {
+	monday := time.Date(2024, 8, 19, 10, 7, 0, 0, time.UTC)
+	saturday := time.Date(2024, 8, 24, 10, 0, 0, 0, time.UTC)
+	sunday := time.Date(2024, 8, 25, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		spec  string
+		after time.Time
+		want  time.Time
+	}{
+		{"*/15 * * * *", monday, time.Date(2024, 8, 19, 10, 15, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", monday, time.Date(2024, 8, 20, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * 0", monday, sunday},
+		{"0 9 * * 7", monday, sunday},
+		{"0 9 * * 5-7", saturday, sunday},
+		{"0 9 * * */7", monday, sunday},
+		{"0 9 * * 6,7", monday, saturday.Add(-time.Hour)},
+		{"0 0 1 * 1", monday, time.Date(2024, 8, 26, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", monday, time.Date(2024, 8, 25, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			schedule, err := ParseSchedule(tt.spec)
+			if err != nil {
+				t.Fatalf("ParseSchedule(%q): %v", tt.spec, err)
+			}
+			if got := schedule.Next(tt.after); !got.Equal(tt.want) {
+				t.Errorf("Next(%v) = %v, want %v", tt.after, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseScheduleRejectsInvalid(t *testing.T) {
+	for _, spec := range []string{"0 9 * *", "0 9 * * 8", "60 * * * *", "0 9 * * */0", "@every 0s"} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("ParseSchedule(%q) succeeded, want an error", spec)
+		}
+	}
+}
@@ -0,0 +1,353 @@
+// Package scheduler runs background jobs persisted in Mongo. Every replica polls the jobs
+// collection and claims due jobs with an atomic lease, so each run happens on one replica only.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/SiddharthaKR/golang-jwt-project/database"
+	"github.com/SiddharthaKR/golang-jwt-project/internal/lease"
+	"github.com/SiddharthaKR/golang-jwt-project/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	StatusScheduled = "SCHEDULED"
+	StatusRunning   = "RUNNING"
+	StatusRetrying  = "RETRYING"
+	StatusCompleted = "COMPLETED"
+	StatusFailed    = "FAILED"
+
+	defaultMaxAttempts = 5
+	leaseDuration      = 5 * time.Minute
+	baseBackoff        = 30 * time.Second
+	maxBackoff         = time.Hour
+)
+
+// Handler runs a job. Returning an error schedules a retry with exponential backoff.
+type Handler func(ctx context.Context, job models.Job) error
+
+var jobCollection *mongo.Collection = database.OpenCollection(database.Client, "jobs")
+
+var (
+	handlersMu sync.RWMutex
+	handlers   = map[string]Handler{}
+
+	indexesOnce sync.Once
+)
+
+// ErrNotFound is returned when a job does not exist.
+var ErrNotFound = errors.New("job not found")
+
+// ErrRunning is returned when triggering a job that is running.
+var ErrRunning = errors.New("job is already running")
+
+// Register sets the handler for a job type. It should be called before Start.
+func Register(jobType string, handler Handler) {
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
+	handlers[jobType] = handler
+}
+
+// EnsureRecurring creates the named recurring job, or updates its schedule if it already
+// exists. Pause state and run history of an existing job are kept.
+func EnsureRecurring(ctx context.Context, name string, jobType string, spec string) error {
+	schedule, err := ParseSchedule(spec)
+	if err != nil {
+		return err
+	}
+	ensureIndexes()
+	now := time.Now().UTC()
+
+	var existing models.Job
+	err = jobCollection.FindOne(ctx, bson.M{"name": name}).Decode(&existing)
+	if err == nil {
+		if existing.Schedule == spec && existing.Type == jobType {
+			return nil
+		}
+		_, err = jobCollection.UpdateOne(ctx, bson.M{"_id": existing.ID}, bson.M{"$set": bson.M{
+			"type":       jobType,
+			"schedule":   spec,
+			"run_at":     schedule.Next(now),
+			"updated_at": now,
+		}})
+		return err
+	}
+	if err != mongo.ErrNoDocuments {
+		return err
+	}
+
+	_, err = jobCollection.UpdateOne(ctx, bson.M{"name": name}, bson.M{"$setOnInsert": models.Job{
+		Name:        name,
+		Type:        jobType,
+		Schedule:    spec,
+		Status:      StatusScheduled,
+		RunAt:       schedule.Next(now),
+		MaxAttempts: defaultMaxAttempts,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}}, options.Update().SetUpsert(true))
+	return err
+}
+
+// ScheduleOnce schedules a one-shot job to run at runAt. Names are unique: scheduling a
+// name that already exists moves it to the new time and payload instead of adding another,
+// running it again if it has finished. A job that is running cannot be rescheduled and
+// returns ErrRunning.
+func ScheduleOnce(ctx context.Context, name string, jobType string, runAt time.Time, payload map[string]string) error {
+	ensureIndexes()
+	now := time.Now().UTC()
+	filter := bson.M{"name": name, "status": bson.M{"$ne": StatusRunning}}
+	update := bson.M{
+		"$set": bson.M{
+			"type":         jobType,
+			"payload":      payload,
+			"run_at":       runAt.UTC(),
+			"status":       StatusScheduled,
+			"attempts":     0,
+			"max_attempts": defaultMaxAttempts,
+			"updated_at":   now,
+		},
+		"$setOnInsert": bson.M{"paused": false, "created_at": now},
+	}
+	_, err := jobCollection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		// Only a running job is left out by the filter
+		return ErrRunning
+	}
+	return err
+}
+
+// Cancel removes a pending one-shot job. Missing jobs are ignored.
+func Cancel(ctx context.Context, name string) error {
+	_, err := jobCollection.DeleteOne(ctx, bson.M{"name": name, "schedule": bson.M{"$in": bson.A{nil, ""}}, "status": bson.M{"$ne": StatusRunning}})
+	return err
+}
+
+// List returns jobs matching the filter, soonest first.
+func List(ctx context.Context, filter bson.M) ([]models.Job, error) {
+	cursor, err := jobCollection.Find(ctx, filter, options.Find().SetSort(bson.M{"run_at": 1}).SetLimit(500))
+	if err != nil {
+		return nil, err
+	}
+	jobs := []models.Job{}
+	if err := cursor.All(ctx, &jobs); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// Get returns the job with the given name.
+func Get(ctx context.Context, name string) (models.Job, error) {
+	var job models.Job
+	err := jobCollection.FindOne(ctx, bson.M{"name": name}).Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		return job, ErrNotFound
+	}
+	return job, err
+}
+
+// SetPaused pauses or resumes a job. A paused job is never claimed.
+func SetPaused(ctx context.Context, name string, paused bool) (models.Job, error) {
+	return updateJob(ctx, bson.M{"name": name}, bson.M{"$set": bson.M{"paused": paused, "updated_at": time.Now().UTC()}})
+}
+
+// Trigger makes a job due immediately. Finished one-shot jobs are run again.
+func Trigger(ctx context.Context, name string) (models.Job, error) {
+	now := time.Now().UTC()
+	job, err := Get(ctx, name)
+	if err != nil {
+		return job, err
+	}
+	if job.Status == StatusRunning {
+		return job, ErrRunning
+	}
+	// The status is checked again in the update, as the job may have been claimed since
+	job, err = updateJob(ctx, bson.M{"name": name, "status": bson.M{"$ne": StatusRunning}}, bson.M{"$set": bson.M{
+		"run_at":     now,
+		"status":     StatusScheduled,
+		"attempts":   0,
+		"updated_at": now,
+	}})
+	if err == ErrNotFound {
+		return job, ErrRunning
+	}
+	return job, err
+}
+
+func updateJob(ctx context.Context, filter bson.M, update bson.M) (models.Job, error) {
+	var job models.Job
+	err := jobCollection.FindOneAndUpdate(ctx, filter, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		return job, ErrNotFound
+	}
+	return job, err
+}
+
+// Start polls for due jobs every interval until the process exits.
+func Start(interval time.Duration) {
+	ensureIndexes()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		runDueJobs()
+	}
+}
+
+// runDueJobs claims and runs due jobs one at a time until none are left.
+func runDueJobs() {
+	for {
+		job, err := claimJob()
+		if err == mongo.ErrNoDocuments {
+			return
+		}
+		if err != nil {
+			log.Println("Error claiming job:", err)
+			return
+		}
+		runJob(job)
+	}
+}
+
+// claimJob takes the lease on the next due job. Running jobs whose lease expired, because
+// their replica died, are claimed again.
+func claimJob() (models.Job, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now().UTC()
+	filter := bson.M{
+		"paused": false,
+		"run_at": bson.M{"$lte": now},
+		"$or": bson.A{
+			bson.M{"status": bson.M{"$in": bson.A{StatusScheduled, StatusRetrying}}},
+			lease.Expired(StatusRunning, now),
+		},
+	}
+	update := bson.M{
+		"$set": lease.Take(bson.M{
+			"status":      StatusRunning,
+			"last_run_at": now,
+			"updated_at":  now,
+		}, now, leaseDuration),
+		"$inc": bson.M{"attempts": 1},
+	}
+	opts := options.FindOneAndUpdate().SetSort(bson.M{"run_at": 1}).SetReturnDocument(options.After)
+
+	var job models.Job
+	err := jobCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&job)
+	return job, err
+}
+
+func runJob(job models.Job) {
+	handlersMu.RLock()
+	handler, ok := handlers[job.Type]
+	handlersMu.RUnlock()
+
+	started := time.Now()
+	var err error
+	if !ok {
+		err = fmt.Errorf("no handler registered for job type %q", job.Type)
+	} else {
+		err = safeRun(handler, job)
+	}
+	finishJob(job, err, time.Since(started))
+}
+
+// safeRun runs the handler within the lease, turning a panic into an error.
+func safeRun(handler Handler, job models.Job) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), leaseDuration)
+	defer cancel()
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return handler(ctx, job)
+}
+
+// finishJob releases the lease and records the outcome. Failed jobs are retried with
+// exponential backoff; once attempts run out a recurring job waits for its next run and a
+// one-shot job is marked FAILED.
+func finishJob(job models.Job, runErr error, duration time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now().UTC()
+	set := bson.M{
+		"last_duration_ms": duration.Milliseconds(),
+		"updated_at":       now,
+	}
+
+	var schedule Schedule
+	if job.Schedule != "" {
+		var err error
+		if schedule, err = ParseSchedule(job.Schedule); err != nil && runErr == nil {
+			runErr = err
+		}
+	}
+
+	maxAttempts := job.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+
+	switch {
+	case runErr == nil:
+		set["last_success_at"] = now
+		set["last_error"] = ""
+		set["attempts"] = 0
+		if schedule != nil {
+			set["status"] = StatusScheduled
+			set["run_at"] = schedule.Next(now)
+		} else {
+			set["status"] = StatusCompleted
+		}
+	case job.Attempts < maxAttempts:
+		set["last_error"] = runErr.Error()
+		set["status"] = StatusRetrying
+		set["run_at"] = now.Add(lease.Backoff(job.Attempts, baseBackoff, maxBackoff))
+	default:
+		set["last_error"] = runErr.Error()
+		set["attempts"] = 0
+		if schedule != nil {
+			set["status"] = StatusScheduled
+			set["run_at"] = schedule.Next(now)
+		} else {
+			set["status"] = StatusFailed
+		}
+	}
+	if runErr != nil {
+		log.Printf("Job %s failed (attempt %d): %v", job.Name, job.Attempts, runErr)
+	}
+
+	_, err := lease.Release(ctx, jobCollection, job.ID, job.LockToken, set)
+	if err != nil {
+		log.Println("Error releasing job", job.Name, ":", err)
+	}
+}
+
+// ensureIndexes creates the unique index on job names, which keeps jobs from being scheduled twice.
+func ensureIndexes() {
+	indexesOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_, err := jobCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+			{Keys: bson.M{"name": 1}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "status", Value: 1}, {Key: "run_at", Value: 1}}},
+		})
+		if err != nil {
+			log.Println("Error creating job indexes:", err)
+		}
+	})
+}
@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"sync"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore keeps uploaded files. Keys are slash-separated paths such as "<company_id>/<attachment_id>".
+type BlobStore interface {
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+var (
+	defaultStore BlobStore
+	defaultOnce  sync.Once
+)
+
+// Default returns the store selected by STORAGE_BACKEND ("local" or "s3"), created on first use.
+func Default() BlobStore {
+	defaultOnce.Do(func() {
+		switch os.Getenv("STORAGE_BACKEND") {
+		case "s3":
+			defaultStore = NewS3Store(
+				os.Getenv("S3_ENDPOINT"),
+				os.Getenv("S3_REGION"),
+				os.Getenv("S3_BUCKET"),
+				os.Getenv("S3_ACCESS_KEY"),
+				os.Getenv("S3_SECRET_KEY"),
+			)
+		case "", "local":
+			dir := os.Getenv("STORAGE_LOCAL_DIR")
+			if dir == "" {
+				dir = "uploads"
+			}
+			defaultStore = NewLocalStore(dir)
+		default:
+			log.Fatal("Unknown STORAGE_BACKEND: ", os.Getenv("STORAGE_BACKEND"))
+		}
+	})
+	return defaultStore
+}